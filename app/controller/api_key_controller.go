@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type ApiKeyController struct {
+	apiKeyService *service.ApiKeyService
+	log           *util.LogUtil
+}
+
+func NewApiKeyController(apiKeyService *service.ApiKeyService, log *util.LogUtil) *ApiKeyController {
+	return &ApiKeyController{apiKeyService: apiKeyService, log: log}
+}
+
+func (a *ApiKeyController) GetAll(c *gin.Context) {
+	apiKeys, err := a.apiKeyService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    apiKeys,
+		"count":   len(apiKeys),
+	})
+	return
+}
+
+func (a *ApiKeyController) Create(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails") //get the details about the current admin from the context passed by admin middleware
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.ApiKeyRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	apiKey, rawKey, err := a.apiKeyService.Create(inputData.Name, inputData.Scopes, inputData.ExpiresAt, accessDetails.UserId, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{ //the key is never shown again
+		"message": "success",
+		"data":    apiKey,
+		"key":     rawKey,
+	})
+	return
+}
+
+func (a *ApiKeyController) Revoke(c *gin.Context) {
+	apiKeyId, err := strconv.ParseUint(c.Param("api_key_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if err = a.apiKeyService.Revoke(apiKeyId, util.ActorFromContext(c)); err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type AuditController struct {
+	auditService *service.AuditService
+	log          *util.LogUtil
+}
+
+func NewAuditController(auditService *service.AuditService, log *util.LogUtil) *AuditController {
+	return &AuditController{auditService: auditService, log: log}
+}
+
+func (a *AuditController) GetAll(c *gin.Context) {
+	var inputData validation.AuditEventQuery
+	if err := c.ShouldBindQuery(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if inputData.Page < 1 {
+		inputData.Page = 1
+	}
+	if inputData.PerPage < 1 {
+		inputData.PerPage = 50
+	}
+
+	events, total, err := a.auditService.Find(auditEventFilter(inputData), inputData.Page, inputData.PerPage)
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    events,
+		"count":   len(events),
+		"total":   total,
+	})
+	return
+}
+
+// Export stream the matching events as a csv file
+func (a *AuditController) Export(c *gin.Context) {
+	var inputData validation.AuditEventQuery
+	if err := c.ShouldBindQuery(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=audit_events_"+time.Now().Format("20060102150405")+".csv")
+	c.Status(http.StatusOK)
+	if err := a.auditService.ExportCsv(auditEventFilter(inputData), c.Writer); err != nil { //the header is sent already, the file is cut short
+		a.log.BasicLog(err, "AuditController@Export")
+	}
+	return
+}
+
+func auditEventFilter(inputData validation.AuditEventQuery) repository.AuditEventFilter {
+	return repository.AuditEventFilter{
+		ActorType:  inputData.ActorType,
+		ActorId:    inputData.ActorId,
+		Action:     inputData.Action,
+		TargetType: inputData.TargetType,
+		TargetId:   inputData.TargetId,
+		RequestId:  inputData.RequestId,
+		From:       inputData.From,
+		To:         inputData.To,
+	}
+}
@@ -1,29 +1,26 @@
 package controller
 
 import (
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/app/validation"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/gin-gonic/gin"
-	"github.com/pquerna/otp"
-	"github.com/pquerna/otp/totp"
 	"net/http"
-	"reflect"
-	"time"
 )
 
 type AuthController struct {
 	userService *service.UserService
+	otpService  *service.OtpService
 	tokenUtil   *util.TokenUtil
 	log         *util.LogUtil
-	emailUtil   *util.EmailUtil
 	config      *config.AppConfig
 }
 
-func NewAuthController(userService *service.UserService, tokenUtil *util.TokenUtil, log *util.LogUtil, emailUtil *util.EmailUtil, config *config.AppConfig) *AuthController {
-	return &AuthController{userService: userService, tokenUtil: tokenUtil, log: log, emailUtil: emailUtil, config: config}
+func NewAuthController(userService *service.UserService, otpService *service.OtpService, tokenUtil *util.TokenUtil, log *util.LogUtil, config *config.AppConfig) *AuthController {
+	return &AuthController{userService: userService, otpService: otpService, tokenUtil: tokenUtil, log: log, config: config}
 }
 
 func (u *AuthController) VerifyOtp(c *gin.Context) {
@@ -36,22 +33,22 @@ func (u *AuthController) VerifyOtp(c *gin.Context) {
 		return
 	}
 
-	user, _ := u.userService.GetByEmail(inputData.Email) //get user from db using the email field
-
-	if valid, err := totp.ValidateCustom(inputData.Otp, user.TotpSecret, time.Now(), totp.ValidateOpts{Period: u.config.TotpPeriod, Algorithm: otp.AlgorithmSHA1, Digits: 6}); err != nil { //verify otp
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "fail",
-			"error":   err.Error(),
-		})
+	user, err := u.otpService.VerifyCode(inputData.Email, inputData.Otp, c.ClientIP()) //verify otp and get the user
+	if errors.Is(err, service.ErrOtpRateLimited) || errors.Is(err, service.ErrOtpLocked) {
+		util.GinResponseError(c, http.StatusTooManyRequests, "fail", err.Error())
 		return
-	} else if !valid {
+	} else if errors.Is(err, service.ErrOtpInvalid) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "otp is not valid",
 		})
 		return
+	} else if err != nil {
+		u.log.BasicLog(err, "AuthController@VerifyOtp")
+		util.GinResponseError(c, http.StatusInternalServerError, "fail", "error when verifying the otp")
+		return
 	}
 
-	token, err := u.userService.GenerateToken(&user) //generate access token for this user
+	token, err := u.userService.GenerateToken(&user, c.Request.UserAgent(), c.ClientIP()) //generate access token for this user
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "fail",
@@ -59,6 +56,9 @@ func (u *AuthController) VerifyOtp(c *gin.Context) {
 		})
 		return
 	}
+	if u.tokenUtil.SetRefreshCookie(c, token) { //the refresh token is kept away from javascript
+		token.RefreshToken = ""
+	}
 
 	c.JSON(http.StatusOK, gin.H{ //return success
 		"message": "success",
@@ -78,84 +78,19 @@ func (u *AuthController) RegisterByEmail(c *gin.Context) {
 		return
 	}
 
-	user, _ := u.userService.GetByEmail(inputData.Email) //check if user exist in the database
-
-	if reflect.ValueOf(user).IsZero() { //if the user not found
-		totpSecret, err := totp.Generate(totp.GenerateOpts{ //generate newTotpSecret for this user
-			Issuer:      "gmco",
-			AccountName: inputData.Email,
-			Period:      u.config.TotpPeriod,
-			Algorithm:   otp.AlgorithmSHA1,
-		})
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"message": "fail",
-				"error":   err.Error(),
-			})
-			return
-		}
-
-		newUser := model.User{ // insert new user record
-			Email:      inputData.Email,
-			TotpSecret: totpSecret.Secret(),
-		}
-		_, err = u.userService.InsertOne(&newUser)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"message": "fail",
-				"error":   err.Error(),
-			})
-			return
-		}
-
-		totpToken, err := totp.GenerateCodeCustom(totpSecret.Secret(), time.Now(), totp.ValidateOpts{Period: u.config.TotpPeriod}) //generate totp token
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"message": "fail",
-				"error":   err.Error(),
-			})
-			return
-		}
-
-		go func() { //send the totp to the registered email
-			data := map[string]any{"Totp": totpToken}
-			if err = u.emailUtil.SentTotpEmail(data, inputData.Email); err != nil {
-				u.log.BasicLog(err, "When sending totp")
-				return
-			}
-		}()
-
-		c.JSON(http.StatusOK, gin.H{
-			"message":             "success",
-			"totp_token":          totpToken,
-			"totp_secret":         totpSecret.Secret(),
-			"is_new_registration": true,
-		})
+	isNewRegistration, err := u.otpService.RequestCode(inputData.Email, c.ClientIP()) //register the user if needed, then email the otp
+	if errors.Is(err, service.ErrOtpRateLimited) || errors.Is(err, service.ErrOtpLocked) {
+		util.GinResponseError(c, http.StatusTooManyRequests, "fail", err.Error())
 		return
-	}
-
-	totpToken, err := totp.GenerateCodeCustom(user.TotpSecret, time.Now(), totp.ValidateOpts{Period: u.config.TotpPeriod}) //generate totp token
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "fail",
-			"error":   err.Error(),
-		})
+	} else if err != nil {
+		u.log.BasicLog(err, "AuthController@RegisterByEmail")
+		util.GinResponseError(c, http.StatusInternalServerError, "fail", "error when sending the otp")
 		return
 	}
 
-	go func() { //send the totp to the registered email
-		data := map[string]any{"Totp": totpToken}
-		if err = u.emailUtil.SentTotpEmail(data, inputData.Email); err != nil {
-			u.log.BasicLog(err, "When sending totp")
-			return
-		}
-	}()
-
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, gin.H{ //the otp is only sent to the email
 		"message":             "success",
-		"totp_token":          totpToken,
-		"totp_secret":         user.TotpSecret,
-		"is_new_registration": false,
+		"is_new_registration": isNewRegistration,
 	})
 }
 
@@ -183,7 +118,7 @@ func (u *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := u.userService.GenerateToken(&newUser) //generate token for this user
+	token, err := u.userService.GenerateToken(&newUser, c.Request.UserAgent(), c.ClientIP()) //generate token for this user
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "fail",
@@ -191,6 +126,9 @@ func (u *AuthController) Register(c *gin.Context) {
 		})
 		return
 	}
+	if u.tokenUtil.SetRefreshCookie(c, token) {
+		token.RefreshToken = ""
+	}
 
 	c.JSON(http.StatusOK, gin.H{ //return success
 		"message": "success",
@@ -231,67 +169,26 @@ func (u *AuthController) SignIn(c *gin.Context) {
 	return
 }
 
-func (u *AuthController) Login(c *gin.Context) {
-	var inputData validation.LoginValidation
-	var userInput model.User
-
-	if err := c.ShouldBindJSON(&inputData); err != nil { //validate the input data
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "fail",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	if inputData.Name == "" { //choose between the given credential. Can be user's name or email
-		userInput = model.User{
-			Email: inputData.Email,
-			Phone: inputData.Phone,
-		}
-	} else {
-		userInput = model.User{
-			Name:  inputData.Name,
-			Phone: inputData.Phone,
-		}
-	}
-
-	err := u.userService.ValidateLogin(&userInput) //validate if user exist and credential is correct
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "fail",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	token, err := u.userService.GenerateToken(&userInput) //generate token for this user
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "fail",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	c.SetSameSite(http.SameSiteNoneMode) //return success
-	c.JSON(http.StatusOK, gin.H{
-		"message": "success",
-		"token":   token,
-	})
-	return
-}
-
 func (u *AuthController) Logout(c *gin.Context) {
 	accessDetails, err := u.tokenUtil.GetValidatedAccess(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	deleted, err := u.tokenUtil.DeleteAuthn(accessDetails.AccessUuid)
+	var deleted int64
+	if accessDetails.SessionId != "" { //delete both of the access and the refresh token of this session
+		var isDeleted bool
+		if isDeleted, err = u.tokenUtil.DeleteSession(accessDetails.UserId, accessDetails.SessionId); isDeleted {
+			deleted = 1
+		}
+	} else {
+		deleted, err = u.tokenUtil.DeleteAuthn(accessDetails.AccessUuid)
+	}
 	if err != nil || deleted == 0 { //if any goes wrong
 		c.JSON(http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	u.tokenUtil.ClearRefreshCookie(c)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "success",
 	})
@@ -300,6 +197,12 @@ func (u *AuthController) Logout(c *gin.Context) {
 
 func (u *AuthController) RefreshToken(c *gin.Context) {
 	token, err := u.tokenUtil.Refresh(c)
+	if errors.Is(err, util.ErrRefreshTokenReused) { //the whole session has been revoked
+		u.log.AuditLog("refresh_token_reused", map[string]any{"client_ip": c.ClientIP(), "device": c.Request.UserAgent()})
+		u.tokenUtil.ClearRefreshCookie(c)
+		util.GinResponseError(c, http.StatusUnauthorized, "fail", err.Error())
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "fail",
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type BroadcastController struct {
+	broadcastService *service.BroadcastService
+	log              *util.LogUtil
+}
+
+func NewBroadcastController(broadcastService *service.BroadcastService, log *util.LogUtil) *BroadcastController {
+	return &BroadcastController{broadcastService: broadcastService, log: log}
+}
+
+func (b *BroadcastController) Create(c *gin.Context) {
+	var inputData validation.BroadcastRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	broadcast, err := b.broadcastService.Create(inputData.Subject, inputData.Body, inputData.Target, inputData.TargetValue, inputData.ScheduledAt, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "success",
+		"data":    broadcast,
+	})
+	return
+}
+
+func (b *BroadcastController) GetAll(c *gin.Context) {
+	broadcasts, err := b.broadcastService.GetAll(c.Query("status")) //optionally filtered by scheduled, sending, sent or cancelled
+	if err != nil {
+		b.log.BasicLog(err, "BroadcastController@GetAll")
+		util.GinResponseError(c, http.StatusNotFound, "request fail", "error when getting the data")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    broadcasts,
+		"count":   len(broadcasts),
+	})
+	return
+}
+
+func (b *BroadcastController) GetById(c *gin.Context) {
+	broadcastId, err := strconv.ParseUint(c.Param("broadcast_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	broadcast, err := b.broadcastService.GetById(broadcastId) //including who was sent this broadcast
+	if err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    broadcast,
+	})
+	return
+}
+
+func (b *BroadcastController) CountRecipients(c *gin.Context) {
+	count, err := b.broadcastService.CountRecipients(c.Query("target"), c.Query("target_value"))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"count":   count,
+	})
+	return
+}
+
+func (b *BroadcastController) Cancel(c *gin.Context) {
+	broadcastId, err := strconv.ParseUint(c.Param("broadcast_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	broadcast, err := b.broadcastService.Cancel(broadcastId, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    broadcast,
+	})
+	return
+}
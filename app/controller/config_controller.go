@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/gin-gonic/gin"
@@ -8,12 +9,13 @@ import (
 )
 
 type ConfigController struct {
-	config *config.AppConfig
-	log    *util.LogUtil
+	config        *config.AppConfig
+	configService *service.ConfigService
+	log           *util.LogUtil
 }
 
-func NewConfigController(config *config.AppConfig, log *util.LogUtil) *ConfigController {
-	return &ConfigController{config: config, log: log}
+func NewConfigController(config *config.AppConfig, configService *service.ConfigService, log *util.LogUtil) *ConfigController {
+	return &ConfigController{config: config, configService: configService, log: log}
 }
 
 func (g *ConfigController) GetAppConfig(c *gin.Context) {
@@ -24,13 +26,13 @@ func (g *ConfigController) GetAppConfig(c *gin.Context) {
 }
 
 func (g *ConfigController) OpenGate(c *gin.Context) {
-	g.config.IsOpenGate = true
+	g.configService.SetOpenGate(true, util.ActorFromContext(c))
 	c.Status(http.StatusOK)
 	return
 }
 
 func (g *ConfigController) CloseGate(c *gin.Context) {
-	g.config.IsOpenGate = false
+	g.configService.SetOpenGate(false, util.ActorFromContext(c))
 	c.Status(http.StatusOK)
 	return
 }
@@ -42,17 +44,11 @@ func (g *ConfigController) UpdateQrScanBehaviour(c *gin.Context) {
 		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
 		return
 	}
-	if inputData["qr_scan_behaviour"] == "open_gate" {
-		g.config.QrScanBehaviour = inputData["qr_scan_behaviour"]
-		c.Status(http.StatusOK)
+	if err := g.configService.SetQrScanBehaviour(inputData["qr_scan_behaviour"], util.ActorFromContext(c)); err != nil {
+		c.Status(http.StatusBadRequest)
 		return
 	}
-	if inputData["qr_scan_behaviour"] == "ticket_exchanging" {
-		g.config.QrScanBehaviour = inputData["qr_scan_behaviour"]
-		c.Status(http.StatusOK)
-		return
-	}
-	c.Status(http.StatusBadRequest)
+	c.Status(http.StatusOK)
 	return
 
 }
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type EmailController struct {
+	emailService *service.EmailService
+	log          *util.LogUtil
+}
+
+func NewEmailController(emailService *service.EmailService, log *util.LogUtil) *EmailController {
+	return &EmailController{emailService: emailService, log: log}
+}
+
+func (e *EmailController) GetAll(c *gin.Context) {
+	outboxes, err := e.emailService.GetAll(c.Query("status")) //optionally filtered by queued, sent, failed or bounced
+	if err != nil {
+		e.log.BasicLog(err, "EmailController@GetAll")
+		util.GinResponseError(c, http.StatusNotFound, "request fail", "error when getting the data")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    outboxes,
+		"count":   len(outboxes),
+	})
+	return
+}
+
+func (e *EmailController) GetById(c *gin.Context) {
+	outboxId, err := strconv.ParseUint(c.Param("email_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	outbox, err := e.emailService.GetById(outboxId)
+	if err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    outbox,
+	})
+	return
+}
+
+func (e *EmailController) Resend(c *gin.Context) {
+	outboxId, err := strconv.ParseUint(c.Param("email_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	outbox, err := e.emailService.Resend(outboxId, util.ActorFromContext(c)) //put the email back to the queue, the worker will pick it up
+	if err != nil {
+		e.log.BasicLog(err, "EmailController@Resend")
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "success",
+		"data":    outbox,
+	})
+	return
+}
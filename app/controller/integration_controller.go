@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IntegrationController serve the machine clients authenticated by the api key middleware
+type IntegrationController struct {
+	integrationService *service.IntegrationService
+	log                *util.LogUtil
+}
+
+func NewIntegrationController(integrationService *service.IntegrationService, log *util.LogUtil) *IntegrationController {
+	return &IntegrationController{integrationService: integrationService, log: log}
+}
+
+func (i *IntegrationController) GetSalesSummary(c *gin.Context) {
+	summary, err := i.integrationService.GetSalesSummary()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    summary,
+	})
+	return
+}
+
+func (i *IntegrationController) GetSales(c *gin.Context) {
+	since := time.Time{}
+	if c.Query("since") != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, c.Query("since")); err != nil {
+			util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", "since must be an RFC3339 time")
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	records, err := i.integrationService.GetSalesSince(since, limit)
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    records,
+		"count":   len(records),
+	})
+	return
+}
+
+func (i *IntegrationController) IssueComplimentary(c *gin.Context) {
+	var inputData validation.ComplimentaryRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	orderId, err := i.integrationService.IssueComplimentary(inputData.Name, inputData.Email, inputData.Phone, inputData.SeatIds, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusConflict, "conflict when processing the request data", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "success",
+		"order_id": orderId,
+	})
+	return
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type InvoiceController struct {
+	invoiceService *service.InvoiceService
+	log            *util.LogUtil
+}
+
+func NewInvoiceController(invoiceService *service.InvoiceService, log *util.LogUtil) *InvoiceController {
+	return &InvoiceController{invoiceService: invoiceService, log: log}
+}
+
+// GetPdf download the invoice of the user's order, it is the receipt once the order is paid
+func (i *InvoiceController) GetPdf(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")              //get the details about the current user that make request from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails) //type assertion
+	invoice, err := i.invoiceService.GetByOrder(c.Param("order_id"))
+	if err == nil && invoice.UserId != accessDetails.UserId { //do not tell the order of another user exists
+		err = service.ErrInvoiceNotFound
+	}
+	i.sendPdf(c, invoice, err)
+}
+
+// AdminGetPdf download the invoice of any order
+func (i *InvoiceController) AdminGetPdf(c *gin.Context) {
+	invoice, err := i.invoiceService.GetByOrder(c.Param("order_id"))
+	i.sendPdf(c, invoice, err)
+}
+
+func (i *InvoiceController) sendPdf(c *gin.Context, invoice model.Invoice, err error) {
+	if errors.Is(err, service.ErrInvoiceNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	filename := "invoice-" + invoice.OrderId + ".pdf"
+	if invoice.Number != "" {
+		filename = "receipt-" + invoice.Number + ".pdf"
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/pdf", i.invoiceService.RenderPdf(invoice))
+	return
+}
+
+func invoiceLineResponse(line model.InvoiceLine) validation.InvoiceLineResponse {
+	return validation.InvoiceLineResponse{Kind: line.Kind, Name: line.Name, Quantity: line.Quantity, UnitPrice: line.UnitPrice, Amount: line.Amount}
+}
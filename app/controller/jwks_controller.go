@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type JwksController struct {
+	keyUtil *util.KeyUtil
+	config  *config.AppConfig
+}
+
+func NewJwksController(keyUtil *util.KeyUtil, config *config.AppConfig) *JwksController {
+	return &JwksController{keyUtil: keyUtil, config: config}
+}
+
+// GetKeys publish the public keys so other services can verify our tokens
+func (j *JwksController) GetKeys(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(j.config.JwtKeyReload.Seconds()))) //a rotated key is published before it signs, so a short cache is fine
+	c.JSON(http.StatusOK, gin.H{
+		"keys": j.keyUtil.Jwks(),
+	})
+	return
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type OidcController struct {
+	oidcService *service.OidcService
+	userService *service.UserService
+	tokenUtil   *util.TokenUtil
+	log         *util.LogUtil
+}
+
+func NewOidcController(oidcService *service.OidcService, userService *service.UserService, tokenUtil *util.TokenUtil, log *util.LogUtil) *OidcController {
+	return &OidcController{oidcService: oidcService, userService: userService, tokenUtil: tokenUtil, log: log}
+}
+
+func (o *OidcController) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    o.oidcService.Providers(),
+	})
+	return
+}
+
+// Authorize return the provider login page url, the frontend redirect the browser to it. The browser keeps the signed state
+// in a cookie, the callback only accepts the state together with that cookie
+func (o *OidcController) Authorize(c *gin.Context) {
+	url, signedState, err := o.oidcService.AuthorizeUrl(c.Param("provider"))
+	if errors.Is(err, util.ErrOidcUnknownProvider) {
+		util.GinResponseError(c, http.StatusNotFound, "fail", err.Error())
+		return
+	} else if err != nil {
+		o.log.BasicLog(err, "OidcController@Authorize")
+		util.GinResponseError(c, http.StatusBadGateway, "fail", "the login provider is not available")
+		return
+	}
+	o.tokenUtil.SetOidcStateCookie(c, signedState)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"url":     url,
+	})
+	return
+}
+
+// Callback receive the code and the state the provider gave to the frontend redirect url
+func (o *OidcController) Callback(c *gin.Context) {
+	var inputData validation.OidcCallbackValidation //validate the input data
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+
+	user, isNew, err := o.oidcService.Login(c.Param("provider"), inputData.Code, inputData.State, o.tokenUtil.TakeOidcStateCookie(c), c.ClientIP())
+	if errors.Is(err, util.ErrOidcUnknownProvider) {
+		util.GinResponseError(c, http.StatusNotFound, "fail", err.Error())
+		return
+	} else if errors.Is(err, util.ErrOidcInvalidState) || errors.Is(err, service.ErrOidcEmailNotVerified) || errors.Is(err, service.ErrOidcStaffAccount) {
+		util.GinResponseError(c, http.StatusUnauthorized, "fail", err.Error())
+		return
+	} else if err != nil {
+		o.log.BasicLog(err, "OidcController@Callback")
+		util.GinResponseError(c, http.StatusUnauthorized, "fail", "cannot sign in with this provider")
+		return
+	}
+
+	token, err := o.userService.GenerateToken(&user, c.Request.UserAgent(), c.ClientIP()) //issue our own tokens, the provider tokens are not kept
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "fail", err.Error())
+		return
+	}
+	if o.tokenUtil.SetRefreshCookie(c, token) {
+		token.RefreshToken = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "success",
+		"token":               token,
+		"is_new_registration": isNew,
+	})
+	return
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type OrderController struct {
+	orderService *service.OrderService
+	log          *util.LogUtil
+}
+
+func NewOrderController(orderService *service.OrderService, log *util.LogUtil) *OrderController {
+	return &OrderController{orderService: orderService, log: log}
+}
+
+// GetAll list the orders for reconciliation, filtered by status, user and creation time
+func (o *OrderController) GetAll(c *gin.Context) {
+	var inputData validation.OrderQuery
+	if err := c.ShouldBindQuery(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if inputData.Page < 1 {
+		inputData.Page = 1
+	}
+	if inputData.PerPage < 1 {
+		inputData.PerPage = 50
+	}
+
+	filter := repository.OrderFilter{Status: inputData.Status, UserId: inputData.UserId, From: inputData.From, To: inputData.To}
+	orders, total, err := o.orderService.Find(filter, inputData.Page, inputData.PerPage)
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	ordersResponse := make([]validation.OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		ordersResponse = append(ordersResponse, o.orderResponse(order))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    ordersResponse,
+		"count":   len(ordersResponse),
+		"total":   total,
+	})
+	return
+}
+
+// UserGetAll list the orders of the current user, the newest first
+func (o *OrderController) UserGetAll(c *gin.Context) {
+	var inputData validation.UserOrderQuery
+	if err := c.ShouldBindQuery(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if inputData.Page < 1 {
+		inputData.Page = 1
+	}
+	if inputData.PerPage < 1 {
+		inputData.PerPage = 20
+	}
+	contextData, _ := c.Get("accessDetails")              //get the details about the current user that make request from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails) //type assertion
+
+	orders, total, err := o.orderService.Find(repository.OrderFilter{UserId: accessDetails.UserId}, inputData.Page, inputData.PerPage)
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	ordersResponse := make([]validation.OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		ordersResponse = append(ordersResponse, o.orderResponse(order))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    ordersResponse,
+		"count":   len(ordersResponse),
+		"total":   total,
+	})
+	return
+}
+
+// UserGetById show one order of the current user with its timeline, payment method and lines
+func (o *OrderController) UserGetById(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")              //get the details about the current user that make request from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails) //type assertion
+	order, err := o.orderService.GetById(c.Param("order_id"))
+	if err == nil && order.UserId != accessDetails.UserId { //do not tell the order of another user exists
+		err = service.ErrOrderNotFound
+	}
+	if errors.Is(err, service.ErrOrderNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    o.orderResponse(order),
+	})
+	return
+}
+
+// GetById show the order with its lines
+func (o *OrderController) GetById(c *gin.Context) {
+	order, err := o.orderService.GetById(c.Param("order_id"))
+	if errors.Is(err, service.ErrOrderNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    o.orderResponse(order),
+	})
+	return
+}
+
+func (o *OrderController) orderResponse(order model.Order) validation.OrderResponse {
+	response := validation.OrderResponse{
+		OrderId:              order.OrderId,
+		UserId:               order.UserId,
+		Name:                 order.User.Name,
+		Email:                order.User.Email,
+		Status:               order.Status,
+		Currency:             order.Currency,
+		Subtotal:             order.Subtotal,
+		Discount:             order.Discount,
+		Fees:                 order.Fees,
+		Tax:                  order.Tax,
+		Total:                order.Total,
+		PromoCode:            order.PromoCode,
+		PaymentType:          order.PaymentType,
+		GatewayStatus:        order.GatewayStatus,
+		GatewayTransactionId: order.GatewayTransactionId,
+		RedirectUrl:          order.RedirectUrl,
+		ExpiresAt:            order.ExpiresAt,
+		PaidAt:               order.PaidAt,
+		ClosedAt:             order.ClosedAt,
+		CreatedAt:            order.CreatedAt,
+		PaymentInstructions:  o.orderService.PaymentInstructions(order),
+		Lines:                []validation.OrderLineResponse{},
+	}
+	for _, event := range o.orderService.Timeline(order) {
+		response.Timeline = append(response.Timeline, validation.OrderEventResponse{Status: event.Status, At: event.At})
+	}
+	for _, tx := range order.Transactions {
+		seat := service.TicketSeat(tx)
+		line := validation.OrderLineResponse{
+			TransactionId:  tx.TransactionId,
+			Name:           seat.Name,
+			Link:           seat.Link,
+			Price:          seat.Price,
+			Confirmation:   tx.Confirmation,
+			PostSaleStatus: seat.PostSaleStatus,
+		}
+		if tx.UserId != order.UserId { //the ticket was given away, its link belongs to the new owner
+			line.Link, line.Transferred = "", true
+			if tx.SeatId == nil { //the name of a general admission ticket carries its code
+				line.Name = tx.TicketType.Name
+			}
+		}
+		response.Lines = append(response.Lines, line)
+	}
+	return response
+}
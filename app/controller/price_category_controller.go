@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type PriceCategoryController struct {
+	categoryService *service.PriceCategoryService
+	log             *util.LogUtil
+}
+
+func NewPriceCategoryController(categoryService *service.PriceCategoryService, log *util.LogUtil) *PriceCategoryController {
+	return &PriceCategoryController{categoryService: categoryService, log: log}
+}
+
+// GetAll list the categories for the seat map legend
+func (p *PriceCategoryController) GetAll(c *gin.Context) {
+	categories, err := p.categoryService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	categoriesResponse := make([]validation.CategoryResponse, 0, len(categories))
+	for _, category := range categories {
+		categoriesResponse = append(categoriesResponse, categoryResponse(category))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    categoriesResponse,
+		"count":   len(categoriesResponse),
+	})
+	return
+}
+
+func (p *PriceCategoryController) Create(c *gin.Context) {
+	var inputData validation.PriceCategoryRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	category, err := p.categoryService.Create(categoryModel(inputData), util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    categoryResponse(category),
+	})
+	return
+}
+
+func (p *PriceCategoryController) Update(c *gin.Context) {
+	categoryId, err := strconv.ParseUint(c.Param("price_category_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.PriceCategoryRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	category, err := p.categoryService.Update(categoryId, categoryModel(inputData), util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPriceCategoryNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    categoryResponse(category),
+	})
+	return
+}
+
+func (p *PriceCategoryController) AssignSeats(c *gin.Context) {
+	categoryId, err := strconv.ParseUint(c.Param("price_category_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.CategorySeatsRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	err = p.categoryService.AssignSeats(categoryId, inputData.SeatIds, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPriceCategoryNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"count":   len(inputData.SeatIds),
+	})
+	return
+}
+
+func (p *PriceCategoryController) Delete(c *gin.Context) {
+	categoryId, err := strconv.ParseUint(c.Param("price_category_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	err = p.categoryService.Delete(categoryId, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPriceCategoryNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusConflict, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func categoryModel(inputData validation.PriceCategoryRequest) model.PriceCategory {
+	if inputData.Currency == "" {
+		inputData.Currency = "IDR"
+	}
+	return model.PriceCategory{Name: inputData.Name, Price: inputData.Price, Currency: inputData.Currency, Description: inputData.Description, Color: inputData.Color}
+}
+
+func categoryResponse(category model.PriceCategory) validation.CategoryResponse {
+	return validation.CategoryResponse{
+		PriceCategoryId: category.PriceCategoryId,
+		Name:            category.Name,
+		Price:           category.Price,
+		Currency:        category.Currency,
+		Description:     category.Description,
+		Color:           category.Color,
+	}
+}
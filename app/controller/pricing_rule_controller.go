@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type PricingRuleController struct {
+	pricingService *service.PricingService
+	log            *util.LogUtil
+}
+
+func NewPricingRuleController(pricingService *service.PricingService, log *util.LogUtil) *PricingRuleController {
+	return &PricingRuleController{pricingService: pricingService, log: log}
+}
+
+// GetAll list the pricing rules and tell which of them apply now
+func (p *PricingRuleController) GetAll(c *gin.Context) {
+	rules, err := p.pricingService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	priceList, err := p.pricingService.PriceList()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	rulesResponse := make([]validation.PricingRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		response := pricingRuleResponse(rule)
+		response.AppliesNow = rule.Active && priceList.RuleApplies(rule)
+		rulesResponse = append(rulesResponse, response)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    rulesResponse,
+		"count":   len(rulesResponse),
+	})
+	return
+}
+
+func (p *PricingRuleController) Create(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails") //get the details about the current admin from the context passed by admin middleware
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.PricingRuleRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	rule := pricingRuleModel(inputData)
+	rule.CreatedBy = accessDetails.UserId
+	rule, err := p.pricingService.Create(rule, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPriceCategoryNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    pricingRuleResponse(rule),
+	})
+	return
+}
+
+func (p *PricingRuleController) Update(c *gin.Context) {
+	ruleId, err := strconv.ParseUint(c.Param("pricing_rule_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.PricingRuleRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	rule, err := p.pricingService.Update(ruleId, pricingRuleModel(inputData), util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPricingRuleNotFound) || errors.Is(err, service.ErrPriceCategoryNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    pricingRuleResponse(rule),
+	})
+	return
+}
+
+func (p *PricingRuleController) Delete(c *gin.Context) {
+	ruleId, err := strconv.ParseUint(c.Param("pricing_rule_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	err = p.pricingService.Delete(ruleId, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPricingRuleNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func pricingRuleModel(inputData validation.PricingRuleRequest) model.PricingRule {
+	active := true
+	if inputData.Active != nil {
+		active = *inputData.Active
+	}
+	return model.PricingRule{
+		Name:            inputData.Name,
+		PriceCategoryId: inputData.PriceCategoryId,
+		StartsAt:        inputData.StartsAt,
+		EndsAt:          inputData.EndsAt,
+		MinSoldPercent:  inputData.MinSoldPercent,
+		Kind:            inputData.Kind,
+		Value:           inputData.Value,
+		Priority:        inputData.Priority,
+		Active:          active,
+	}
+}
+
+func pricingRuleResponse(rule model.PricingRule) validation.PricingRuleResponse {
+	return validation.PricingRuleResponse{
+		PricingRuleId:   rule.PricingRuleId,
+		Name:            rule.Name,
+		PriceCategoryId: rule.PriceCategoryId,
+		StartsAt:        rule.StartsAt,
+		EndsAt:          rule.EndsAt,
+		MinSoldPercent:  rule.MinSoldPercent,
+		Kind:            rule.Kind,
+		Value:           rule.Value,
+		Priority:        rule.Priority,
+		Active:          rule.Active,
+	}
+}
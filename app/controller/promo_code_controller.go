@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type PromoCodeController struct {
+	promoService *service.PromoCodeService
+	log          *util.LogUtil
+}
+
+func NewPromoCodeController(promoService *service.PromoCodeService, log *util.LogUtil) *PromoCodeController {
+	return &PromoCodeController{promoService: promoService, log: log}
+}
+
+// GetAll list the promo codes with their redemptions
+func (p *PromoCodeController) GetAll(c *gin.Context) {
+	promoCodes, usages, err := p.promoService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	promoCodesResponse := make([]validation.PromoCodeResponse, 0, len(promoCodes))
+	for _, promoCode := range promoCodes {
+		promoCodesResponse = append(promoCodesResponse, promoCodeResponse(promoCode, usages[promoCode.PromoCodeId]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    promoCodesResponse,
+		"count":   len(promoCodesResponse),
+	})
+	return
+}
+
+func (p *PromoCodeController) Create(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails") //get the details about the current admin from the context passed by admin middleware
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.PromoCodeRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	promoCode := promoCodeModel(inputData)
+	promoCode.CreatedBy = accessDetails.UserId
+	promoCode, err := p.promoService.Create(promoCode, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    promoCodeResponse(promoCode, repository.PromoUsage{}),
+	})
+	return
+}
+
+func (p *PromoCodeController) Update(c *gin.Context) {
+	promoCodeId, err := strconv.ParseUint(c.Param("promo_code_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.PromoCodeRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	promoCode, err := p.promoService.Update(promoCodeId, promoCodeModel(inputData), util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPromoCodeNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    promoCodeResponse(promoCode, repository.PromoUsage{}),
+	})
+	return
+}
+
+func (p *PromoCodeController) Delete(c *gin.Context) {
+	promoCodeId, err := strconv.ParseUint(c.Param("promo_code_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	err = p.promoService.Delete(promoCodeId, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrPromoCodeNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusConflict, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+// GetRedemptions list the orders that applied the promo code, including the pending and the cancelled ones
+func (p *PromoCodeController) GetRedemptions(c *gin.Context) {
+	promoCodeId, err := strconv.ParseUint(c.Param("promo_code_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	redemptions, err := p.promoService.GetRedemptions(promoCodeId)
+	if errors.Is(err, service.ErrPromoCodeNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	redemptionsResponse := make([]validation.PromoRedemptionResponse, 0, len(redemptions))
+	for _, redemption := range redemptions {
+		redemptionsResponse = append(redemptionsResponse, validation.PromoRedemptionResponse{
+			OrderId:   redemption.OrderId,
+			UserId:    redemption.UserId,
+			Name:      redemption.User.Name,
+			Email:     redemption.User.Email,
+			Discount:  redemption.Discount,
+			Status:    redemption.Status,
+			CreatedAt: redemption.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    redemptionsResponse,
+		"count":   len(redemptionsResponse),
+	})
+	return
+}
+
+func promoCodeModel(inputData validation.PromoCodeRequest) model.PromoCode {
+	active := true
+	if inputData.Active != nil {
+		active = *inputData.Active
+	}
+	categoryIds := make([]string, 0, len(inputData.PriceCategoryIds))
+	for _, categoryId := range inputData.PriceCategoryIds {
+		categoryIds = append(categoryIds, strconv.FormatUint(categoryId, 10))
+	}
+	return model.PromoCode{
+		Code:             inputData.Code,
+		Description:      inputData.Description,
+		Kind:             inputData.Kind,
+		Value:            inputData.Value,
+		PriceCategoryIds: strings.Join(categoryIds, ","),
+		MaxUses:          inputData.MaxUses,
+		MaxUsesPerUser:   inputData.MaxUsesPerUser,
+		StartsAt:         inputData.StartsAt,
+		EndsAt:           inputData.EndsAt,
+		Active:           active,
+	}
+}
+
+func promoCodeResponse(promoCode model.PromoCode, usage repository.PromoUsage) validation.PromoCodeResponse {
+	categoryIds := make([]uint64, 0)
+	if promoCode.PriceCategoryIds != "" {
+		for _, categoryId := range strings.Split(promoCode.PriceCategoryIds, ",") {
+			id, _ := strconv.ParseUint(categoryId, 10, 64)
+			categoryIds = append(categoryIds, id)
+		}
+	}
+	return validation.PromoCodeResponse{
+		PromoCodeId:      promoCode.PromoCodeId,
+		Code:             promoCode.Code,
+		Description:      promoCode.Description,
+		Kind:             promoCode.Kind,
+		Value:            promoCode.Value,
+		PriceCategoryIds: categoryIds,
+		MaxUses:          promoCode.MaxUses,
+		MaxUsesPerUser:   promoCode.MaxUsesPerUser,
+		StartsAt:         promoCode.StartsAt,
+		EndsAt:           promoCode.EndsAt,
+		Active:           promoCode.Active,
+		Redeemed:         usage.Redeemed,
+		DiscountTotal:    usage.Discount,
+	}
+}
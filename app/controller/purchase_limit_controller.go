@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type PurchaseLimitController struct {
+	purchaseLimitService *service.PurchaseLimitService
+	log                  *util.LogUtil
+}
+
+func NewPurchaseLimitController(purchaseLimitService *service.PurchaseLimitService, log *util.LogUtil) *PurchaseLimitController {
+	return &PurchaseLimitController{purchaseLimitService: purchaseLimitService, log: log}
+}
+
+func (p *PurchaseLimitController) GetAll(c *gin.Context) {
+	limits, overrides, err := p.purchaseLimitService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "success",
+		"data":          limits,
+		"overrides":     overrides,
+		"default_limit": p.purchaseLimitService.DefaultLimit(),
+	})
+	return
+}
+
+func (p *PurchaseLimitController) SetLimit(c *gin.Context) {
+	var inputData validation.PurchaseLimitRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	limit, err := p.purchaseLimitService.SetLimit(inputData.PriceCategoryId, inputData.MaxSeats, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    limit,
+	})
+	return
+}
+
+func (p *PurchaseLimitController) DeleteLimit(c *gin.Context) {
+	limitId, err := strconv.ParseUint(c.Param("purchase_limit_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if err = p.purchaseLimitService.DeleteLimit(limitId, util.ActorFromContext(c)); err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func (p *PurchaseLimitController) SetOverride(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails") //get the details about the current admin from the context passed by admin middleware
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	userId, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.PurchaseLimitOverrideRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	override, err := p.purchaseLimitService.SetOverride(userId, inputData.MaxSeats, inputData.Reason, inputData.ExpiresAt, accessDetails.UserId, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    override,
+	})
+	return
+}
+
+func (p *PurchaseLimitController) DeleteOverride(c *gin.Context) {
+	userId, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	if err = p.purchaseLimitService.DeleteOverride(userId, util.ActorFromContext(c)); err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
@@ -2,7 +2,6 @@ package controller
 
 import (
 	"errors"
-	"fmt"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/app/validation"
@@ -12,7 +11,6 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
-	"time"
 )
 
 type ReservationController struct {
@@ -21,14 +19,17 @@ type ReservationController struct {
 	log    *util.LogUtil
 
 	reservationService *service.ReservationService
+	categoryService    *service.PriceCategoryService
+	ticketTypeService  *service.TicketTypeService
+	pricingService     *service.PricingService
 	txService          *service.TransactionService
 	seatService        *service.SeatService
 	userService        *service.UserService
 	tokenUtil          *util.TokenUtil
 }
 
-func NewReservationController(config *config.AppConfig, txDb *gorm.DB, log *util.LogUtil, reservationService *service.ReservationService, txService *service.TransactionService, seatService *service.SeatService, userService *service.UserService, tokenUtil *util.TokenUtil) *ReservationController {
-	return &ReservationController{config: config, txDb: txDb, log: log, reservationService: reservationService, txService: txService, seatService: seatService, userService: userService, tokenUtil: tokenUtil}
+func NewReservationController(config *config.AppConfig, txDb *gorm.DB, log *util.LogUtil, reservationService *service.ReservationService, categoryService *service.PriceCategoryService, ticketTypeService *service.TicketTypeService, pricingService *service.PricingService, txService *service.TransactionService, seatService *service.SeatService, userService *service.UserService, tokenUtil *util.TokenUtil) *ReservationController {
+	return &ReservationController{config: config, txDb: txDb, log: log, reservationService: reservationService, categoryService: categoryService, ticketTypeService: ticketTypeService, pricingService: pricingService, txService: txService, seatService: seatService, userService: userService, tokenUtil: tokenUtil}
 }
 
 func (r *ReservationController) GetSeatsInfo(c *gin.Context) {
@@ -39,23 +40,49 @@ func (r *ReservationController) GetSeatsInfo(c *gin.Context) {
 		return
 	}
 
-	seatsResponse := make([]validation.ReservationResponse, len(seats), len(seats)) //create response object
+	categories, err := r.categoryService.GetMap()
+	if err != nil {
+		r.log.ControllerResponseLog(err, "ReservationController@GetSeatsInfo", c.ClientIP(), 0)
+		util.GinResponseError(c, http.StatusNotFound, "something went wrong", "error when getting the data")
+		return
+	}
+
+	priceList, err := r.pricingService.PriceList() //the seats are shown with the price of the pricing rules
+	if err != nil {
+		r.log.ControllerResponseLog(err, "ReservationController@GetSeatsInfo", c.ClientIP(), 0)
+		util.GinResponseError(c, http.StatusNotFound, "something went wrong", "error when getting the data")
+		return
+	}
+
+	seatsResponse := make([]validation.ReservationResponse, 0, len(seats)) //create response object
+	seatIndex := make(map[uint]int, len(seats))                            //the seat ids may have gaps, so look the seats up by id
 	for _, seat := range seats {
-		seatsResponse[seat.SeatId-1].SeatId = seat.SeatId
-		seatsResponse[seat.SeatId-1].Name = seat.Name
-		if seat.Status != "purchased" && time.Now().After(seat.CreatedAt.Add(r.config.TransactionMinute)) { //overwrite the response with timestamp logic
-			seat.Status = "available"
+		price, rule := priceList.Apply(seat)
+		response := validation.ReservationResponse{
+			SeatId:    seat.SeatId,
+			Name:      seat.Name,
+			Status:    r.seatService.PublicStatus(seat), //overwrite the response with timestamp logic
+			Price:     price,
+			BasePrice: seat.Price,
+		}
+		if rule != nil {
+			response.PricingRule = rule.Name
+		}
+		if category, ok := categories[util.Deref(seat.PriceCategoryId)]; ok {
+			categoryData := categoryResponse(category)
+			response.Category = &categoryData
 		}
-		seatsResponse[seat.SeatId-1].Status = seat.Status
-		seatsResponse[seat.SeatId-1].Price = seat.Price
+		seatIndex[seat.SeatId] = len(seatsResponse)
+		seatsResponse = append(seatsResponse, response)
 	}
 
 	accessDetails, err := r.tokenUtil.GetValidatedAccess(c) //get the user data from the token in the request header
 	if err == nil {                                         //if credentials found (user is logged in)
 		mySeats, _ := r.txService.SeatsBelongsToUser(accessDetails.UserId) //overwrite the response object for this user
 		for _, mySeat := range mySeats {                                   //populate the response object
-			if seatsResponse[mySeat.SeatId-1].Status != "available" { //only overwrite the seat status if it was not overwritten previously by timestamp logic
-				seatsResponse[mySeat.SeatId-1].Status = mySeat.Status
+			i, ok := seatIndex[mySeat.SeatId]
+			if ok && seatsResponse[i].Status != "available" { //only overwrite the seat status if it was not overwritten previously by timestamp logic
+				seatsResponse[i].Status = mySeat.Status
 			}
 
 		}
@@ -88,16 +115,37 @@ func (r *ReservationController) ReserveSeats(c *gin.Context) {
 		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
 		return
 	}
-
-	if err := r.reservationService.CheckUserSeatCount(inputData.SeatIds, accessDetails.UserId); err != nil { //check user seat limit
-		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
-		util.GinResponseError(c, http.StatusForbidden, "error when processing the request data", err.Error())
+	if len(inputData.SeatIds) < 1 && len(inputData.Tickets) < 1 {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", "choose at least one seat or ticket")
 		return
 	}
+	quantities := make(map[uint64]int, len(inputData.Tickets)) //general admission tickets by ticket type
+	for _, ticket := range inputData.Tickets {
+		quantities[ticket.TicketTypeId] = ticket.Quantity
+	}
 
 	txn := r.txDb.Begin() //START DATABASE TRANSACTION
 	if txn.Error != nil {
-		fmt.Print(txn.Error)
+		r.log.ControllerResponseLog(txn.Error, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", "database operation error")
+		return
+	}
+
+	if err := r.reservationService.CheckPurchaseLimitTxn(txn, inputData.SeatIds, quantities, accessDetails.UserId); err != nil { //check the purchase limits across the buyer's accounts
+		txn.Rollback() //ABORT DATABASE TRANSACTION
+		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		var limitErr *service.PurchaseLimitError
+		if errors.As(err, &limitErr) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "fail",
+				"error":   limitErr.Error(),
+				"code":    "purchase_limit_exceeded",
+				"limit":   limitErr,
+			})
+			return
+		}
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", err.Error())
+		return
 	}
 
 	for _, seatId := range inputData.SeatIds { //check eligibility for each chair in request
@@ -119,17 +167,54 @@ func (r *ReservationController) ReserveSeats(c *gin.Context) {
 		}
 	}
 
-	txcErr := txn.Commit().Error //COMMIT DATABASE TRANSACTION
-	if txcErr != nil {
-		fmt.Print(txcErr)
+	priceList, err := r.pricingService.PriceListTxn(txn) //the price is locked at reservation, so the buyer pays the price they saw
+	if err != nil {
+		txn.Rollback() //ABORT DATABASE TRANSACTION
+		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", err.Error())
+		return
+	}
+	seatPrices, err := r.pricingService.SeatPricesTxn(txn, priceList, inputData.SeatIds)
+	if err != nil {
+		txn.Rollback() //ABORT DATABASE TRANSACTION
+		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", err.Error())
+		return
 	}
 
-	if err := r.txService.CreateTx(accessDetails.UserId, inputData.SeatIds); err != nil { //store reservation to txDb table
+	if err := r.ticketTypeService.ReserveTxn(txn, accessDetails.UserId, quantities, priceList); err != nil { //take the general admission tickets from the available tickets
+		txn.Rollback() //ABORT DATABASE TRANSACTION
+		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		var soldOutErr *service.TicketSoldOutError
+		if errors.As(err, &soldOutErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "fail",
+				"error":   soldOutErr.Error(),
+				"code":    "sold_out",
+				"ticket":  soldOutErr,
+			})
+			return
+		} else if errors.Is(err, service.ErrTicketTypeNotFound) {
+			util.GinResponseError(c, http.StatusNotFound, "error when processing the request data", err.Error())
+			return
+		}
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", err.Error())
+		return
+	}
+
+	if err := r.txService.CreateTxTxn(txn, accessDetails.UserId, inputData.SeatIds, seatPrices); err != nil { //store reservation to txDb table with the seats
+		txn.Rollback() //ABORT DATABASE TRANSACTION
 		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
 		util.GinResponseError(c, http.StatusConflict, "error when processing the request data", err.Error())
 		return
 	}
 
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		r.log.ControllerResponseLog(err, "ReservationController@ReserveSeats", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+		util.GinResponseError(c, http.StatusInternalServerError, "error when processing the request data", "database operation error")
+		return
+	}
+
 	c.JSON(http.StatusAccepted, gin.H{
 		"message": "information updated successfully",
 	})
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/gin-gonic/gin"
@@ -34,9 +35,12 @@ func (s *SeatController) AllDetails(c *gin.Context) {
 func (s *SeatController) InfoByLink(c *gin.Context) {
 	link := c.Param("link")
 	seatDetails, err := s.txService.GetDetailsByLink(link)
-	if err != nil {
+	if errors.Is(err, service.ErrTicketNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
 		s.log.Log.WithField("occurrence", "SeatsController@InfoByLink").Error(err)
-		util.GinResponseError(c, http.StatusNotFound, "request fail", "error when processing the request data")
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", "error when processing the request data")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -45,7 +49,7 @@ func (s *SeatController) InfoByLink(c *gin.Context) {
 			"user_name":  seatDetails.User.Name,
 			"user_email": seatDetails.User.Email,
 			"user_phone": seatDetails.User.Phone,
-			"seat_name":  seatDetails.Seat.Name,
+			"seat_name":  service.TicketSeat(seatDetails).Name,
 		},
 	})
 	return
@@ -54,9 +58,12 @@ func (s *SeatController) InfoByLink(c *gin.Context) {
 func (s *SeatController) DetailsByLink(c *gin.Context) {
 	link := c.Param("link")
 	seatDetails, err := s.txService.GetDetailsByLink(link)
-	if err != nil {
+	if errors.Is(err, service.ErrTicketNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
 		s.log.Log.WithField("occurrence", "SeatsController@InfoByLink").Error(err)
-		util.GinResponseError(c, http.StatusNotFound, "request fail", "error when processing the request data")
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", "error when processing the request data")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -75,7 +82,7 @@ func (s *SeatController) UpdateByLink(c *gin.Context) {
 		return
 	}
 	postSaleStatus := inputData["post_sale_status"]
-	if err := s.seatService.UpdatePostSaleStatus(link, postSaleStatus); err != nil {
+	if err := s.seatService.UpdatePostSaleStatus(link, postSaleStatus, util.ActorFromContext(c)); err != nil {
 		s.log.BasicLog(err, "SeatController@UpdateByLink")
 		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
 		return
@@ -88,7 +95,7 @@ func (s *SeatController) UpdateByLink(c *gin.Context) {
 
 func (s *SeatController) UpdateToAttended(c *gin.Context) {
 	link := c.Param("link")
-	if err := s.seatService.UpdatePostSaleStatus(link, "attended"); err != nil {
+	if err := s.seatService.UpdatePostSaleStatus(link, "attended", util.ActorFromContext(c)); err != nil {
 		s.log.BasicLog(err, "SeatController@UpdateByLink")
 		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
 		return
@@ -101,7 +108,7 @@ func (s *SeatController) UpdateToAttended(c *gin.Context) {
 
 func (s *SeatController) UpdateToExchanged(c *gin.Context) {
 	link := c.Param("link")
-	if err := s.seatService.UpdatePostSaleStatus(link, "exchanged"); err != nil {
+	if err := s.seatService.UpdatePostSaleStatus(link, "exchanged", util.ActorFromContext(c)); err != nil {
 		s.log.BasicLog(err, "SeatController@UpdateByLink")
 		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
 		return
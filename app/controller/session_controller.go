@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type SessionController struct {
+	sessionService *service.SessionService
+	log            *util.LogUtil
+}
+
+func NewSessionController(sessionService *service.SessionService, log *util.LogUtil) *SessionController {
+	return &SessionController{sessionService: sessionService, log: log}
+}
+
+func (s *SessionController) GetAll(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails") //get the details about the current user from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	sessions, err := s.sessionService.GetAll(accessDetails.UserId, accessDetails.SessionId)
+	if err != nil {
+		s.log.BasicLog(err, "SessionController@GetAll")
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", "error when getting the data")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    sessions,
+		"count":   len(sessions),
+	})
+	return
+}
+
+func (s *SessionController) Revoke(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	if err := s.sessionService.Revoke(accessDetails.UserId, c.Param("session_id")); err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func (s *SessionController) RevokeAll(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	revoked, err := s.sessionService.RevokeAll(accessDetails.UserId, util.ActorFromContext(c)) //including the current session
+	if err != nil {
+		s.log.BasicLog(err, "SessionController@RevokeAll")
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"revoked": revoked,
+	})
+	return
+}
+
+// ForceLogout let an admin revoke every session of a user
+func (s *SessionController) ForceLogout(c *gin.Context) {
+	userId, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	revoked, err := s.sessionService.RevokeAll(userId, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"revoked": revoked,
+	})
+	return
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/gin-gonic/gin"
@@ -8,14 +9,15 @@ import (
 )
 
 type SnapController struct {
-	snapService *service.SnapService
-	snapUtil    *util.SnapUtil
-	txService   *service.TransactionService
-	log         *util.LogUtil
+	snapService  *service.SnapService
+	snapUtil     *util.SnapUtil
+	txService    *service.TransactionService
+	emailService *service.EmailService
+	log          *util.LogUtil
 }
 
-func NewSnapController(snapService *service.SnapService, snapUtil *util.SnapUtil, txService *service.TransactionService, log *util.LogUtil) *SnapController {
-	return &SnapController{snapService: snapService, snapUtil: snapUtil, txService: txService, log: log}
+func NewSnapController(snapService *service.SnapService, snapUtil *util.SnapUtil, txService *service.TransactionService, emailService *service.EmailService, log *util.LogUtil) *SnapController {
+	return &SnapController{snapService: snapService, snapUtil: snapUtil, txService: txService, emailService: emailService, log: log}
 }
 
 func (s *SnapController) HandleCallback(c *gin.Context) {
@@ -28,34 +30,66 @@ func (s *SnapController) HandleCallback(c *gin.Context) {
 		c.Status(http.StatusBadRequest)
 		return
 	}
+	actor := util.ActorFromContext(c) //the signature proves the notification comes from midtrans
+	actor.Type, actor.Id = "gateway", "midtrans"
 	txStatus, _ := message["transaction_status"].(string) //handle according to the "transaction_status" field from the json data
 	if txStatus == "pending" {
-		if err := s.snapService.HandlePending(message); err != nil {
+		if err := s.snapService.HandlePending(message, actor); err != nil {
 			c.Status(http.StatusNotFound)
 			s.log.BasicLog(err, "SnapController@HandleCallback@HandlePending")
 			return
 		}
-		go func() {
-			if err := s.snapService.SendInfoEmail(s.snapService.PrepareTxDetailsByMsg(message)); err != nil {
-				s.log.BasicLog(err, "SnapController@HandleCallback@HandlePending@SendInfoEmail")
-			}
-		}()
+		seats, user, err := s.snapService.PrepareTxDetailsByMsg(message)
+		if errors.Is(err, service.ErrOrderNotLive) { //the hold was released, the gateway closes the payment by itself
+			s.log.Log.WithField("occurrence", "SnapController@HandleCallback@HandlePending").WithField("order_id", message["order_id"]).Error(err)
+			c.Status(http.StatusOK)
+			return
+		} else if err != nil {
+			c.Status(http.StatusInternalServerError)
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandlePending@PrepareTxDetailsByMsg")
+			return
+		}
+		if err := s.emailService.QueueInfoEmail(seats, user); err != nil { //the email is delivered by the worker
+			c.Status(http.StatusInternalServerError) //let midtrans retry the notification so the email is not lost
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandlePending@QueueInfoEmail")
+			return
+		}
 	} else if txStatus == "settlement" {
-		if err := s.snapService.HandleSettlement(message); err != nil {
+		if err := s.snapService.HandleSettlement(message, actor); errors.Is(err, service.ErrOrderNotLive) { //a retry cannot help, the admin has to refund the payment
+			s.log.Log.WithField("occurrence", "SnapController@HandleCallback@HandleSettlement").WithField("order_id", message["order_id"]).Error(err)
+			c.Status(http.StatusOK)
+			return
+		} else if err != nil {
 			c.Status(http.StatusNotFound)
 			s.log.BasicLog(err, "SnapController@HandleCallback@HandleSettlement")
 			return
 		}
-		go func() {
-			if err := s.snapService.SendTicketEmail(s.snapService.PrepareTxDetailsByMsg(message)); err != nil {
-				s.log.BasicLog(err, "SnapController@HandleCallback@HandlePending@SendInfoEmail")
-			}
-		}()
+		seats, user, err := s.snapService.PrepareTxDetailsByMsg(message)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandleSettlement@PrepareTxDetailsByMsg")
+			return
+		}
+		if err := s.emailService.QueueTicketEmail(seats, user); err != nil { //the email is delivered by the worker
+			c.Status(http.StatusInternalServerError) //let midtrans retry the notification so the tickets are not lost
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandleSettlement@QueueTicketEmail")
+			return
+		}
 	} else if txStatus == "expire" || txStatus == "cancel" || txStatus == "deny" {
-		if err := s.snapService.HandleFailure(message); err != nil {
+		if err := s.snapService.HandleFailure(message, actor); errors.Is(err, service.ErrOrderCancelling) {
+			c.Status(http.StatusInternalServerError) //let midtrans retry the notification once the order is replaced
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandleFailure")
+			return
+		} else if err != nil {
 			s.log.BasicLog(err, "SnapController@HandleFailure@HandleSettlement")
 			return
 		}
+	} else if txStatus == "refund" || txStatus == "partial_refund" {
+		if err := s.snapService.HandleRefund(message, actor); err != nil {
+			c.Status(http.StatusNotFound)
+			s.log.BasicLog(err, "SnapController@HandleCallback@HandleRefund")
+			return
+		}
 	}
 	c.Status(http.StatusOK)
 	return
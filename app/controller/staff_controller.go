@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type StaffController struct {
+	staffService *service.StaffService
+	userService  *service.UserService
+	tokenUtil    *util.TokenUtil
+	log          *util.LogUtil
+}
+
+func NewStaffController(staffService *service.StaffService, userService *service.UserService, tokenUtil *util.TokenUtil, log *util.LogUtil) *StaffController {
+	return &StaffController{staffService: staffService, userService: userService, tokenUtil: tokenUtil, log: log}
+}
+
+func (s *StaffController) Login(c *gin.Context) {
+	var inputData validation.StaffLoginValidation //validate the input data
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+
+	user, err := s.staffService.Login(inputData.Email, inputData.Password, inputData.Otp, inputData.RecoveryCode, c.ClientIP())
+	if errors.Is(err, service.ErrStaffTotpRequired) { //ask the client to show the authenticator code input
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message":       "fail",
+			"error":         err.Error(),
+			"totp_required": true,
+		})
+		return
+	} else if errors.Is(err, service.ErrStaffLocked) {
+		util.GinResponseError(c, http.StatusTooManyRequests, "fail", err.Error())
+		return
+	} else if errors.Is(err, service.ErrStaffCredential) || errors.Is(err, service.ErrStaffTotpInvalid) {
+		util.GinResponseError(c, http.StatusUnauthorized, "fail", err.Error())
+		return
+	} else if err != nil {
+		s.log.BasicLog(err, "StaffController@Login")
+		util.GinResponseError(c, http.StatusInternalServerError, "fail", "error when signing in")
+		return
+	}
+
+	token, err := s.userService.GenerateToken(&user, c.Request.UserAgent(), c.ClientIP()) //generate token for this staff
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "fail", err.Error())
+		return
+	}
+	if s.tokenUtil.SetRefreshCookie(c, token) {
+		token.RefreshToken = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"token":   token,
+		"role":    user.Role,
+	})
+	return
+}
+
+func (s *StaffController) GetAll(c *gin.Context) {
+	staff, err := s.staffService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    staff,
+		"count":   len(staff),
+	})
+	return
+}
+
+func (s *StaffController) Create(c *gin.Context) {
+	var inputData validation.StaffValidation
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	staff, err := s.staffService.Create(inputData.Name, inputData.Email, inputData.Role, inputData.Password, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    staff,
+	})
+	return
+}
+
+func (s *StaffController) ChangePassword(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.PasswordValidation
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	if err := s.staffService.ChangePassword(accessDetails.UserId, inputData.CurrentPassword, inputData.NewPassword, util.ActorFromContext(c)); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	s.tokenUtil.ClearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success, please sign in again with the new password",
+	})
+	return
+}
+
+func (s *StaffController) EnrollTotp(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	url, qrCode, err := s.staffService.EnrollTotp(accessDetails.UserId)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{ //scan the qr code, then confirm with the first code
+		"message": "success",
+		"url":     url,
+		"qr_code": qrCode,
+	})
+	return
+}
+
+func (s *StaffController) ConfirmTotp(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.TotpValidation
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	recoveryCodes, err := s.staffService.ConfirmTotp(accessDetails.UserId, inputData.Otp)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{ //the recovery codes are never shown again
+		"message":        "success",
+		"recovery_codes": recoveryCodes,
+	})
+	return
+}
+
+func (s *StaffController) DisableTotp(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.TotpDisableValidation
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	if err := s.staffService.DisableTotp(accessDetails.UserId, inputData.Password, inputData.Otp); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func (s *StaffController) RegenerateRecoveryCodes(c *gin.Context) {
+	contextData, _ := c.Get("accessDetails")
+	accessDetails, _ := contextData.(*util.AccessDetails)
+
+	var inputData validation.StaffPasswordValidation
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	recoveryCodes, err := s.staffService.RegenerateRecoveryCodes(accessDetails.UserId, inputData.Password)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "success",
+		"recovery_codes": recoveryCodes,
+	})
+	return
+}
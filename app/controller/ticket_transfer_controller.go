@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type TicketTransferController struct {
+	transferService *service.TicketTransferService
+	userService     *service.UserService
+	log             *util.LogUtil
+}
+
+func NewTicketTransferController(transferService *service.TicketTransferService, userService *service.UserService, log *util.LogUtil) *TicketTransferController {
+	return &TicketTransferController{transferService: transferService, userService: userService, log: log}
+}
+
+// GetAll list the transfers the user offered and the ones offered to the user's email
+func (t *TicketTransferController) GetAll(c *gin.Context) {
+	user, ok := t.currentUser(c)
+	if !ok {
+		return
+	}
+	transfers, err := t.transferService.GetByUser(user)
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	transfersResponse := make([]validation.TicketTransferResponse, 0, len(transfers))
+	for _, transfer := range transfers {
+		transfersResponse = append(transfersResponse, transferResponse(transfer, user))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    transfersResponse,
+		"count":   len(transfersResponse),
+	})
+	return
+}
+
+// Create offer the user's purchased seat or ticket to an email
+func (t *TicketTransferController) Create(c *gin.Context) {
+	var inputData validation.TicketTransferRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	user, ok := t.currentUser(c)
+	if !ok {
+		return
+	}
+	transfer, err := t.transferService.Offer(user.UserId, inputData.Link, inputData.Email, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    transferResponse(transfer, user),
+	})
+	return
+}
+
+// Accept take the ticket offered to the user's email, the response carries its new link
+func (t *TicketTransferController) Accept(c *gin.Context) {
+	transferId, err := strconv.ParseUint(c.Param("transfer_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	user, ok := t.currentUser(c)
+	if !ok {
+		return
+	}
+	transfer, seat, err := t.transferService.Accept(transferId, user, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrTicketTransferNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil && transfer.Status != "accepted" {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	} else if err != nil { //the ticket has moved, only the emails could not be queued
+		t.log.BasicLog(err, "TicketTransferController@Accept")
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    transferResponse(transfer, user),
+		"ticket":  gin.H{"name": seat.Name, "link": seat.Link},
+	})
+	return
+}
+
+// Cancel withdraw the pending transfer, the owner cancels it and the receiver turns it down
+func (t *TicketTransferController) Cancel(c *gin.Context) {
+	transferId, err := strconv.ParseUint(c.Param("transfer_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	user, ok := t.currentUser(c)
+	if !ok {
+		return
+	}
+	transfer, err := t.transferService.Cancel(transferId, user, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrTicketTransferNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    transferResponse(transfer, user),
+	})
+	return
+}
+
+func (t *TicketTransferController) currentUser(c *gin.Context) (model.User, bool) {
+	contextData, _ := c.Get("accessDetails")              //get the details about the current user that make request from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails) //type assertion
+	user, err := t.userService.GetById(accessDetails.UserId)
+	if err != nil {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return user, false
+	}
+	return user, true
+}
+
+func transferResponse(transfer model.TicketTransfer, user model.User) validation.TicketTransferResponse {
+	response := validation.TicketTransferResponse{
+		TicketTransferId: transfer.TicketTransferId,
+		Direction:        "incoming",
+		SeatName:         transfer.SeatName,
+		FromName:         transfer.FromUser.Name,
+		ToEmail:          transfer.ToEmail,
+		Status:           transfer.Status,
+		CreatedAt:        transfer.CreatedAt,
+		AcceptedAt:       transfer.AcceptedAt,
+		CancelledAt:      transfer.CancelledAt,
+	}
+	if transfer.FromUserId == user.UserId {
+		response.Direction, response.FromName = "outgoing", user.Name
+	}
+	return response
+}
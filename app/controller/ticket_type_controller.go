@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type TicketTypeController struct {
+	ticketTypeService *service.TicketTypeService
+	pricingService    *service.PricingService
+	log               *util.LogUtil
+}
+
+func NewTicketTypeController(ticketTypeService *service.TicketTypeService, pricingService *service.PricingService, log *util.LogUtil) *TicketTypeController {
+	return &TicketTypeController{ticketTypeService: ticketTypeService, pricingService: pricingService, log: log}
+}
+
+// GetAll list the general admission ticket types with the tickets left
+func (t *TicketTypeController) GetAll(c *gin.Context) {
+	ticketTypes, err := t.ticketTypeService.GetAll()
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	priceList, err := t.pricingService.PriceList() //the tickets are shown with the price of the pricing rules
+	if err != nil {
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", err.Error())
+		return
+	}
+	ticketTypesResponse := make([]validation.TicketTypeResponse, 0, len(ticketTypes))
+	for _, ticketType := range ticketTypes {
+		response := ticketTypeResponse(ticketType)
+		price, rule := priceList.Apply(model.Seat{Price: ticketType.Price, PriceCategoryId: ticketType.PriceCategoryId})
+		response.Price = price
+		if rule != nil {
+			response.PricingRule = rule.Name
+		}
+		ticketTypesResponse = append(ticketTypesResponse, response)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    ticketTypesResponse,
+		"count":   len(ticketTypesResponse),
+	})
+	return
+}
+
+func (t *TicketTypeController) Create(c *gin.Context) {
+	var inputData validation.TicketTypeRequest
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	ticketType, err := t.ticketTypeService.Create(ticketTypeModel(inputData), util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data":    ticketTypeResponse(ticketType),
+	})
+	return
+}
+
+func (t *TicketTypeController) Update(c *gin.Context) {
+	ticketTypeId, err := strconv.ParseUint(c.Param("ticket_type_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	var inputData validation.TicketTypeRequest
+	if err = c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	ticketType, err := t.ticketTypeService.Update(ticketTypeId, ticketTypeModel(inputData), util.ActorFromContext(c))
+	if errors.Is(err, service.ErrTicketTypeNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    ticketTypeResponse(ticketType),
+	})
+	return
+}
+
+func (t *TicketTypeController) Delete(c *gin.Context) {
+	ticketTypeId, err := strconv.ParseUint(c.Param("ticket_type_id"), 10, 64)
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	err = t.ticketTypeService.Delete(ticketTypeId, util.ActorFromContext(c))
+	if errors.Is(err, service.ErrTicketTypeNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		util.GinResponseError(c, http.StatusConflict, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+	return
+}
+
+func ticketTypeModel(inputData validation.TicketTypeRequest) model.TicketType {
+	onSale := true
+	if inputData.OnSale != nil {
+		onSale = *inputData.OnSale
+	}
+	return model.TicketType{Name: inputData.Name, Description: inputData.Description, Price: inputData.Price, PriceCategoryId: inputData.PriceCategoryId, Capacity: inputData.Capacity, OnSale: onSale}
+}
+
+func ticketTypeResponse(ticketType model.TicketType) validation.TicketTypeResponse {
+	return validation.TicketTypeResponse{
+		TicketTypeId:    ticketType.TicketTypeId,
+		Name:            ticketType.Name,
+		Description:     ticketType.Description,
+		Price:           ticketType.Price,
+		BasePrice:       ticketType.Price,
+		PriceCategoryId: ticketType.PriceCategoryId,
+		Capacity:        ticketType.Capacity,
+		Available:       ticketType.Available,
+		OnSale:          ticketType.OnSale,
+	}
+}
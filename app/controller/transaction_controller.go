@@ -2,22 +2,29 @@ package controller
 
 import (
 	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/app/validation"
 	"github.com/gin-gonic/gin"
+	"github.com/midtrans/midtrans-go/snap"
+	"io"
 	"net/http"
 )
 
 type TransactionController struct {
-	txService   *service.TransactionService
-	userService *service.UserService
-	snapUtil    *util.SnapUtil
-	log         *util.LogUtil
+	txService      *service.TransactionService
+	userService    *service.UserService
+	promoService   *service.PromoCodeService
+	invoiceService *service.InvoiceService
+	orderService   *service.OrderService
+	snapService    *service.SnapService
+	snapUtil       *util.SnapUtil
+	log            *util.LogUtil
 }
 
-func NewTransactionController(txService *service.TransactionService, userService *service.UserService, snapUtil *util.SnapUtil, log *util.LogUtil) *TransactionController {
-	return &TransactionController{txService: txService, userService: userService, snapUtil: snapUtil, log: log}
+func NewTransactionController(txService *service.TransactionService, userService *service.UserService, promoService *service.PromoCodeService, invoiceService *service.InvoiceService, orderService *service.OrderService, snapService *service.SnapService, snapUtil *util.SnapUtil, log *util.LogUtil) *TransactionController {
+	return &TransactionController{txService: txService, userService: userService, promoService: promoService, invoiceService: invoiceService, orderService: orderService, snapService: snapService, snapUtil: snapUtil, log: log}
 }
 
 func (t *TransactionController) GetNewTransactionDetails(c *gin.Context) {
@@ -38,33 +45,133 @@ func (t *TransactionController) GetNewTransactionDetails(c *gin.Context) {
 
 	var seatResponses []validation.BasicResponse //transform data
 	for _, tx := range txDetails {
-		seatResponse := validation.BasicResponse{Name: tx.Seat.Name, Price: tx.Seat.Price}
+		seat := service.TicketSeat(tx)
+		seatResponse := validation.BasicResponse{Name: seat.Name, Price: seat.Price}
 		seatResponses = append(seatResponses, seatResponse)
 	}
 
+	var promo *service.PromoQuote
+	if promoCode := c.Query("promo_code"); promoCode != "" { //preview the discount before checking out
+		quote, err := t.promoService.Quote(promoCode, accessDetails.UserId, t.txService.OrderIds(txDetails), t.txService.TicketSeats(txDetails))
+		var promoErr *service.PromoCodeError
+		if errors.As(err, &promoErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"message": "fail",
+				"error":   promoErr.Error(),
+				"code":    "promo_code_rejected",
+				"reason":  promoErr.Reason,
+			})
+			return
+		} else if err != nil {
+			util.GinResponseError(c, http.StatusInternalServerError, "something went wrong", err.Error())
+			return
+		}
+		promo = &quote
+	}
+
+	invoice := t.invoiceService.Build("", accessDetails.UserId, t.txService.TicketSeats(txDetails), util.Deref(promo)) //preview the fees and the tax
+	chargeResponses := make([]validation.InvoiceLineResponse, 0)
+	for _, line := range invoice.Lines {
+		if line.Kind == "fee" || line.Kind == "tax" {
+			chargeResponses = append(chargeResponses, invoiceLineResponse(line))
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"seats":      seatResponses,
-			"user_name":  txDetails[0].User.Name,
-			"user_email": txDetails[0].User.Email,
-			"user_phone": txDetails[0].User.Phone,
+			"seats":        seatResponses,
+			"promo":        promo,
+			"charges":      chargeResponses,
+			"tax_included": invoice.TaxIncluded,
+			"total":        invoice.Total,
+			"user_name":    txDetails[0].User.Name,
+			"user_email":   txDetails[0].User.Email,
+			"user_phone":   txDetails[0].User.Phone,
 		},
 	})
 	return
 }
 
+// InitiateTransaction open the payment page of the user's reserved seats and tickets. Checking out again gives the
+// payment page of the open order back, unless the user reserved more or asks for another promo code or payment method,
+// then the open order is cancelled at the payment gateway first. A request repeated with the same Idempotency-Key
+// header gets the payment page of the order it created
 func (t *TransactionController) InitiateTransaction(c *gin.Context) {
-	contextData, _ := c.Get("accessDetails")                                     //get the details about the current user that make request from the context passed by user middleware
-	accessDetails, _ := contextData.(*util.AccessDetails)                        //type assertion
-	snapRequest, err := t.txService.PrepareTransactionData(accessDetails.UserId) //prepare snap request
-	if err != nil {
+	contextData, _ := c.Get("accessDetails")              //get the details about the current user that make request from the context passed by user middleware
+	accessDetails, _ := contextData.(*util.AccessDetails) //type assertion
+	var inputData validation.CheckoutRequest              //the body is optional, it only carries the promo code and the payment method
+	if err := c.ShouldBindJSON(&inputData); err != nil && !errors.Is(err, io.EOF) {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", "the idempotency key is longer than 255 characters")
+		return
+	}
+
+	if idempotencyKey != "" {
+		order, err := t.orderService.GetByIdempotencyKey(accessDetails.UserId, idempotencyKey)
+		if err == nil && order.SnapToken == "" { //the first request is still running, or the payment gateway refused it
+			util.GinResponseError(c, http.StatusConflict, "request fail", service.ErrCheckoutRepeated.Error())
+			return
+		} else if err == nil {
+			t.paymentPageResponse(c, order)
+			return
+		} else if !errors.Is(err, service.ErrOrderNotFound) {
+			util.GinResponseError(c, http.StatusInternalServerError, "something went wrong", err.Error())
+			return
+		}
+	}
+
+	openOrder, err := t.orderService.GetOpenByUser(accessDetails.UserId)
+	if err == nil {
+		sameCheckout, err := t.txService.IsCheckoutOf(openOrder, inputData.PromoCode, inputData.PaymentMethod)
+		if err != nil {
+			util.GinResponseError(c, http.StatusInternalServerError, "something went wrong", err.Error())
+			return
+		}
+		if sameCheckout {
+			t.paymentPageResponse(c, openOrder)
+			return
+		}
+		if err = t.snapService.ReplaceOrder(openOrder, util.ActorFromContext(c)); errors.Is(err, service.ErrPaymentNotCancelled) {
+			util.GinResponseError(c, http.StatusBadGateway, "request fail", err.Error())
+			return
+		} else if errors.Is(err, service.ErrOrderNotOpen) { //paid or replaced by another checkout meanwhile
+			util.GinResponseError(c, http.StatusConflict, "request fail", err.Error())
+			return
+		} else if err != nil {
+			util.GinResponseError(c, http.StatusInternalServerError, "something went wrong", err.Error())
+			return
+		}
+	} else if !errors.Is(err, service.ErrOrderNotFound) {
+		util.GinResponseError(c, http.StatusInternalServerError, "something went wrong", err.Error())
+		return
+	}
+
+	snapRequest, err := t.txService.PrepareTransactionData(accessDetails.UserId, inputData.PromoCode, inputData.PaymentMethod, idempotencyKey) //prepare snap request
+	var promoErr *service.PromoCodeError
+	if errors.As(err, &promoErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message": "fail",
+			"error":   promoErr.Error(),
+			"code":    "promo_code_rejected",
+			"reason":  promoErr.Reason,
+		})
+		return
+	} else if errors.Is(err, service.ErrCheckoutRepeated) { //another request with the same key won the race
+		util.GinResponseError(c, http.StatusConflict, "request fail", err.Error())
+		return
+	} else if err != nil {
 		t.log.ControllerResponseLog(err, "TransactionController@InitiateTransaction", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
 		util.GinResponseError(c, http.StatusNotFound, "something went wrong", "error when getting the data")
 		return
 	}
 	response, midtransErr := t.snapUtil.CreateTransaction(&snapRequest) //send request to midtrans
 	if midtransErr != nil {
+		t.orderService.Fail(snapRequest.TransactionDetails.OrderID)
 		t.log.ControllerResponseLog(midtransErr, "TransactionController@InitiateTransaction", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
 		t.log.Log.
 			WithField("snap_request", snapRequest).
@@ -73,10 +180,25 @@ func (t *TransactionController) InitiateTransaction(c *gin.Context) {
 		util.GinResponseError(c, http.StatusNotFound, "something went wrong", "error when getting the data")
 		return
 	}
+	if err = t.orderService.SetPaymentPage(snapRequest.TransactionDetails.OrderID, response.Token, response.RedirectURL); err != nil { //the payment page is open already, the order only misses the link
+		t.log.ControllerResponseLog(err, "TransactionController@InitiateTransaction", c.ClientIP(), contextData.(*util.AccessDetails).UserId)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "success",
+		"order_id":      snapRequest.TransactionDetails.OrderID,
+		"resumed":       false,
 		"snap_request":  snapRequest,
 		"snap_response": response,
 	})
 	return
 }
+
+// paymentPageResponse give the payment page of the order that was created before
+func (t *TransactionController) paymentPageResponse(c *gin.Context, order model.Order) {
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "success",
+		"order_id":      order.OrderId,
+		"resumed":       true,
+		"snap_response": snap.Response{Token: order.SnapToken, RedirectURL: order.RedirectUrl},
+	})
+}
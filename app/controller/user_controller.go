@@ -41,9 +41,10 @@ func (u *UserController) UpdateInfo(c *gin.Context) {
 	}
 
 	newUser := model.User{ //update the new user data
-		Name:  inputData.Name,
-		Email: inputData.Email,
-		Phone: inputData.Phone,
+		Name:   inputData.Name,
+		Email:  inputData.Email,
+		Phone:  inputData.Phone,
+		Locale: inputData.Locale,
 	}
 	affectedRows, err := u.userService.UpdateById(accessDetails.UserId, &newUser)
 	if err != nil {
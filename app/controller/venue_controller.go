@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type VenueController struct {
+	venueService *service.VenueService
+	log          *util.LogUtil
+}
+
+func NewVenueController(venueService *service.VenueService, log *util.LogUtil) *VenueController {
+	return &VenueController{venueService: venueService, log: log}
+}
+
+// GetSeatMap return the venue layout with the seat status, as json or as svg with ?format=svg
+func (v *VenueController) GetSeatMap(c *gin.Context) {
+	layout, err := v.venueService.GetLayout()
+	if errors.Is(err, service.ErrVenueNotFound) {
+		util.GinResponseError(c, http.StatusNotFound, "request fail", err.Error())
+		return
+	} else if err != nil {
+		v.log.BasicLog(err, "VenueController@GetSeatMap")
+		util.GinResponseError(c, http.StatusInternalServerError, "request fail", "error when getting the data")
+		return
+	}
+	if c.Query("format") == "svg" {
+		c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(v.venueService.RenderSvg(layout)))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    layout,
+	})
+	return
+}
+
+// Import replace the venue layout with the one in the request body
+func (v *VenueController) Import(c *gin.Context) {
+	var inputData service.VenueLayout
+	if err := c.ShouldBindJSON(&inputData); err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "error when processing the request data", err.Error())
+		return
+	}
+	layout, err := v.venueService.Import(inputData, util.ActorFromContext(c))
+	if err != nil {
+		util.GinResponseError(c, http.StatusBadRequest, "request fail", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    layout,
+	})
+	return
+}
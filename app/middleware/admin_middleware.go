@@ -20,7 +20,17 @@ func NewAdminMiddleware(tokenUtil *util.TokenUtil, log *logrus.Logger, config *c
 	return &AdminMiddleware{tokenUtil: tokenUtil, log: log, config: config, userService: userService}
 }
 
+// AdminAccess only let the admin accounts through
 func (u *AdminMiddleware) AdminAccess(c *gin.Context) {
+	u.authorize(c, "admin")
+}
+
+// StaffAccess let every staff account through, the gate staff can only scan the tickets
+func (u *AdminMiddleware) StaffAccess(c *gin.Context) {
+	u.authorize(c, "admin", "gate")
+}
+
+func (u *AdminMiddleware) authorize(c *gin.Context, roles ...string) {
 	accessDetails, err := u.tokenUtil.GetValidatedAccess(c) //get the user data from the token in the request header
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -51,12 +61,16 @@ func (u *AdminMiddleware) AdminAccess(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	u.tokenUtil.TouchSession(accessDetails.SessionId, c.ClientIP()) //record the last activity of this session
 
 	adminUser, _ := u.userService.GetById(accessDetails.UserId)
-	if adminUser.Name == u.config.AdminName && adminUser.Email == u.config.AdminEmail && adminUser.Phone == u.config.AdminPhone { //check if this user is admin
-		c.Set("accessDetails", accessDetails)
-		c.Next()
-		return
+	for _, role := range roles { //check if this user has one of the roles
+		if adminUser.Role == role {
+			c.Set("accessDetails", accessDetails)
+			c.Set("staffRole", adminUser.Role) //the audit events tell the staff apart from the customers
+			c.Next()
+			return
+		}
 	}
 	c.Abort()
 	c.JSON(http.StatusUnauthorized, gin.H{
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type ApiKeyMiddleware struct {
+	apiKeyService *service.ApiKeyService
+	log           *logrus.Logger
+}
+
+func NewApiKeyMiddleware(apiKeyService *service.ApiKeyService, log *logrus.Logger) *ApiKeyMiddleware {
+	return &ApiKeyMiddleware{apiKeyService: apiKeyService, log: log}
+}
+
+// ApiKeyAccess return a handler that only let the api keys with the scope through. The key is read from the
+// X-Api-Key header or from the Authorization bearer header
+func (m *ApiKeyMiddleware) ApiKeyAccess(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader("X-Api-Key")
+		if rawKey == "" {
+			rawKey = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if !strings.HasPrefix(rawKey, "gmco_") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "fail",
+				"error":   "api key is required",
+			})
+			return
+		}
+
+		apiKey, err := m.apiKeyService.Authenticate(rawKey, c.ClientIP())
+		if errors.Is(err, service.ErrApiKeyInvalid) {
+			m.log.
+				WithField("occurrence", "ApiKeyMiddleware@ApiKeyAccess").
+				WithField("client_ip", c.ClientIP()).
+				WithField("endpoint", c.FullPath()).
+				Info("invalid api key")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "fail",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"message": "fail",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if !m.apiKeyService.HasScope(apiKey, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "fail",
+				"error":   "this api key does not have the " + scope + " scope",
+			})
+			return
+		}
+		c.Set("apiKey", &apiKey)
+		c.Set("apiKeyId", apiKey.ApiKeyId)
+		c.Next()
+	}
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type RateLimitMiddleware struct {
+	config    *config.AppConfig
+	limitUtil *util.RateLimitUtil
+	snapUtil  *util.SnapUtil
+	log       *logrus.Logger
+	allowlist []*net.IPNet
+}
+
+func NewRateLimitMiddleware(config *config.AppConfig, limitUtil *util.RateLimitUtil, snapUtil *util.SnapUtil, log *logrus.Logger) *RateLimitMiddleware {
+	var allowlist []*net.IPNet
+	for _, allowed := range config.WebhookAllowedIps {
+		if !strings.Contains(allowed, "/") { //a single ip is a cidr with the full mask
+			if strings.Contains(allowed, ":") {
+				allowed += "/128"
+			} else {
+				allowed += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(allowed)
+		if err != nil {
+			log.Panicf("invalid webhook allowed ip %s: %s", allowed, err.Error())
+		}
+		allowlist = append(allowlist, ipNet)
+	}
+	for name, policy := range config.RateLimitPolicies {
+		if policy.Key != "ip" && policy.Key != "user" && policy.Key != "email" && policy.Key != "api_key" {
+			log.Panicf("invalid key %s of the %s rate limit policy, use ip, user, email or api_key", policy.Key, name)
+		}
+	}
+	return &RateLimitMiddleware{config: config, limitUtil: limitUtil, snapUtil: snapUtil, log: log, allowlist: allowlist}
+}
+
+// Limit return a handler that apply the named policy. A user or api_key policy must be placed after the user or the api key middleware
+func (r *RateLimitMiddleware) Limit(policyName string) gin.HandlerFunc {
+	policy, ok := r.config.RateLimitPolicies[policyName]
+	if !ok {
+		r.log.Panicf("unknown rate limit policy: %s", policyName)
+	}
+	return func(c *gin.Context) {
+		if !r.config.RateLimitEnabled {
+			c.Next()
+			return
+		}
+		result, err := r.limitUtil.Hit(policyName+":"+r.key(c, policy.Key), policy.Limit, policy.Window)
+		if err != nil { //do not take the app down together with redis
+			r.log.
+				WithField("occurrence", "RateLimitMiddleware@Limit").
+				WithField("policy", policyName).
+				Error(err.Error())
+			c.Next()
+			return
+		}
+
+		resetSecond := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", resetSecond)
+		c.Header("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(int(policy.Window.Seconds())))
+		if !result.Allowed {
+			c.Header("Retry-After", resetSecond)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"message": "fail",
+				"error":   "too many requests, please try again later",
+			})
+			r.log.
+				WithField("occurrence", "RateLimitMiddleware@Limit").
+				WithField("policy", policyName).
+				WithField("client_ip", c.ClientIP()).
+				WithField("endpoint", c.FullPath()).
+				Info("rate limit exceeded")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Webhook apply the webhook policy to everybody except the allowed payment gateway ips. A notification signed with the
+// server key comes from midtrans whatever its ip, so it is never limited
+func (r *RateLimitMiddleware) Webhook() gin.HandlerFunc {
+	limit := r.Limit("webhook")
+	return func(c *gin.Context) {
+		if r.isSignedNotification(c) {
+			c.Next()
+			return
+		}
+		if ip := net.ParseIP(c.ClientIP()); ip != nil {
+			for _, allowed := range r.allowlist {
+				if allowed.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		limit(c)
+	}
+}
+
+// key identify the requester, falling back to the ip when the user or the email is unknown
+func (r *RateLimitMiddleware) key(c *gin.Context, keyType string) string {
+	switch keyType {
+	case "user":
+		if accessDetails, ok := c.Get("accessDetails"); ok {
+			return "user:" + strconv.FormatUint(accessDetails.(*util.AccessDetails).UserId, 10)
+		}
+	case "api_key":
+		if apiKey, ok := c.Get("apiKey"); ok {
+			return "api_key:" + strconv.FormatUint(apiKey.(*model.ApiKey).ApiKeyId, 10)
+		}
+	case "email":
+		if email := r.emailFromBody(c); email != "" {
+			return "email:" + email
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// emailFromBody peek the email field of the json body
+func (r *RateLimitMiddleware) emailFromBody(c *gin.Context) string {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if !r.peekBody(c, &input) {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(input.Email))
+}
+
+// isSignedNotification check the signature of the payment notification in the json body
+func (r *RateLimitMiddleware) isSignedNotification(c *gin.Context) bool {
+	message := make(map[string]interface{})
+	if !r.peekBody(c, &message) {
+		return false
+	}
+	return r.snapUtil.CheckSignature(message) == nil
+}
+
+// peekBody decode the json body, the body is put back for the controller
+func (r *RateLimitMiddleware) peekBody(c *gin.Context, input any) bool {
+	if c.Request.Body == nil {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(body, input) == nil
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"regexp"
+)
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type RequestIdMiddleware struct{}
+
+func NewRequestIdMiddleware() *RequestIdMiddleware {
+	return &RequestIdMiddleware{}
+}
+
+// HandleRequestId keep the X-Request-Id given by the proxy or create one, so the logs and the audit events of a
+// request can be found together
+func (m *RequestIdMiddleware) HandleRequestId(c *gin.Context) {
+	requestId := c.GetHeader("X-Request-Id")
+	if !requestIdPattern.MatchString(requestId) {
+		requestId = uuid.New().String()
+	}
+	c.Set("requestId", requestId)
+	c.Header("X-Request-Id", requestId)
+	c.Next()
+}
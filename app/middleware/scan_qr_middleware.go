@@ -44,7 +44,7 @@ func (m *ScanQrMiddleware) HandleScanQr(c *gin.Context) {
 	}
 
 	adminUser, _ := m.userService.GetById(accessDetails.UserId)
-	if adminUser.Name == m.config.AdminName && adminUser.Email == m.config.AdminEmail && adminUser.Phone == m.config.AdminPhone { //check if this user is admin
+	if adminUser.Role != "" { //check if this user is a staff
 		//redirect as admin
 		if m.config.QrScanBehaviour == "open_gate" {
 			c.Redirect(http.StatusFound, "/api/v1/admin/seat/attended/"+c.Param("link"))
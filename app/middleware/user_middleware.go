@@ -47,6 +47,7 @@ func (u *UserMiddleware) UserAccess(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	u.tokenUtil.TouchSession(accessDetails.SessionId, c.ClientIP()) //record the last activity of this session
 	c.Set("accessDetails", accessDetails)
 	c.Next()
 }
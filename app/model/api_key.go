@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ApiKeyScopes are the permissions an api key can be given
+var ApiKeyScopes = []string{"sales:read", "tickets:comp"}
+
+// ApiKey authenticate a machine client. Only the sha256 of the key is stored, the prefix is kept to recognize the key
+type ApiKey struct {
+	ApiKeyId   uint64     `gorm:"primaryKey"`
+	Name       string     `gorm:"not null"`
+	Prefix     string     `gorm:"not null"`
+	KeyHash    string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"not null"` //comma separated
+	CreatedBy  uint64     `gorm:"not null"` //the admin user id
+	ExpiresAt  *time.Time //never expires when empty
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIp string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// AuditEvent record one state changing operation. The table is append only, the migrator installs a trigger that
+// rejects every update and delete
+type AuditEvent struct {
+	AuditEventId uint64  `gorm:"primaryKey"`
+	ActorType    string  `gorm:"not null;index:idx_audit_actor"` //user, staff, api_key, gateway, system or anonymous
+	ActorId      string  `gorm:"index:idx_audit_actor"`
+	Action       string  `gorm:"not null;index"`
+	TargetType   string  `gorm:"index:idx_audit_target"`
+	TargetId     string  `gorm:"index:idx_audit_target"`
+	Before       *string `gorm:"type:jsonb"`
+	After        *string `gorm:"type:jsonb"`
+	Ip           string
+	RequestId    string    `gorm:"index"`
+	CreatedAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+type Broadcast struct {
+	BroadcastId    uint64    `gorm:"primaryKey"`
+	Kind           string    `gorm:"not null;default:manual;index"` //manual for the admin's broadcasts, event_reminder for the one scheduled from EVENT_STARTS_AT
+	Subject        string    `gorm:"not null"`                      //may contain {{ .Name }} and {{ .Seats }}
+	Body           string    `gorm:"type:text;not null"`            //may contain {{ .Name }} and {{ .Seats }}
+	Target         string    `gorm:"not null"`                      //all, section, attendance
+	TargetValue    string    //comma separated venue section names or row labels for section, attended, exchanged or absent for attendance
+	Status         string    `gorm:"not null;index"` //scheduled, sending, sent, cancelled
+	ScheduledAt    time.Time `gorm:"not null;index"`
+	SentAt         *time.Time
+	RecipientCount int                  `gorm:"not null;default:0"`
+	Recipients     []BroadcastRecipient `gorm:"foreignKey:BroadcastId" json:",omitempty"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// BroadcastRecipient record which ticket holder got which broadcast, the rendered email is kept in the email outbox
+type BroadcastRecipient struct {
+	BroadcastRecipientId uint64 `gorm:"primaryKey"`
+	BroadcastId          uint64 `gorm:"not null;uniqueIndex:idx_broadcast_user"`
+	UserId               uint64 `gorm:"not null;uniqueIndex:idx_broadcast_user"`
+	Email                string `gorm:"not null"`
+	Seats                string //comma separated seat names at the time of sending
+	EmailOutboxId        uint64
+	CreatedAt            time.Time
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+type EmailOutbox struct {
+	EmailOutboxId uint64 `gorm:"primaryKey"`
+	Kind          string `gorm:"not null"` //totp, info, ticket
+	Receiver      string `gorm:"not null;index"`
+	Subject       string `gorm:"not null"`
+	Locale        string
+	Data          string    `gorm:"type:text;not null"` //json encoded template data
+	Status        string    `gorm:"not null;index"`     //queued, sent, failed, bounced
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	LastError     string    `gorm:"type:text"`
+	SentAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Invoice is the itemized charges of an order, saved at checkout. It gets its sequential number when the order is paid
+type Invoice struct {
+	InvoiceId   uint64  `gorm:"primaryKey"`
+	Number      string  `gorm:"uniqueIndex:idx_invoices_number,where:number <> ''"` //empty until the order is paid
+	Sequence    *uint64 `gorm:"uniqueIndex"`
+	OrderId     string  `gorm:"not null;uniqueIndex"`
+	UserId      uint64  `gorm:"not null;index"`
+	User        User    `json:"-"`
+	Subtotal    uint64  `gorm:"not null"` //the seats and tickets
+	Discount    uint64  `gorm:"not null"`
+	Fees        uint64  `gorm:"not null"`
+	Tax         uint64  `gorm:"not null"`
+	TaxIncluded bool    `gorm:"not null"` //the tax is part of the prices, so it is not added to the total
+	Total       uint64  `gorm:"not null"`
+	Status      string  `gorm:"not null"` //pending, paid or cancelled
+	Lines       []InvoiceLine
+	IssuedAt    *time.Time //when the order was paid
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// InvoiceLine is a ticket, the discount, a fee or the tax of the invoice
+type InvoiceLine struct {
+	InvoiceLineId uint64 `gorm:"primaryKey"`
+	InvoiceId     uint64 `gorm:"not null;index"`
+	Kind          string `gorm:"not null"` //ticket, discount, fee or tax
+	Name          string `gorm:"not null"`
+	Quantity      uint   `gorm:"not null"`
+	UnitPrice     int64  `gorm:"not null"`
+	Amount        int64  `gorm:"not null"` //negative for the discount
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Order is one checkout of the user, its transactions are the order lines. The amounts are copied from the invoice and
+// the gateway fields from the payment notifications, so the order is the record of what was charged and how it was paid
+type Order struct {
+	OrderId              string        `gorm:"primaryKey"` //also the order id at the payment gateway
+	UserId               uint64        `gorm:"not null;index;uniqueIndex:idx_orders_user_idempotency_key"`
+	User                 User          `json:"-"`
+	Transactions         []Transaction `gorm:"foreignKey:OrderId;references:OrderId;constraint:-"` //no constraint, a transaction has an empty order id until the checkout
+	Status               string        `gorm:"not null;index"`                                     //awaiting_payment, pending, cancelling, paid, expired, cancelled, denied, failed, refunded or partially_refunded
+	Currency             string        `gorm:"not null"`
+	Subtotal             uint64        `gorm:"not null"`
+	Discount             uint64        `gorm:"not null"`
+	Fees                 uint64        `gorm:"not null"`
+	Tax                  uint64        `gorm:"not null"`
+	Total                uint64        `gorm:"not null"`
+	PromoCode            string
+	PaymentMethod        string  //the payment method the buyer asked for at checkout, empty for any
+	IdempotencyKey       *string `gorm:"uniqueIndex:idx_orders_user_idempotency_key" json:"-"` //from the Idempotency-Key header of the checkout
+	PaymentType          string  //like bank_transfer or credit_card, complimentary for the free orders
+	GatewayStatus        string  //the last transaction status notified by the gateway
+	GatewayTransactionId string  `gorm:"index"`
+	SnapToken            string  `json:"-"`
+	RedirectUrl          string
+	ExpiresAt            *time.Time //the seats and tickets are released after this
+	PendingAt            *time.Time //when the buyer chose how to pay
+	PaidAt               *time.Time
+	ClosedAt             *time.Time //when the order expired, was cancelled or failed
+	RefundedAt           *time.Time
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
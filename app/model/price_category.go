@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// PriceCategory is a ticket category like VIP, regular or student. The seats of the category copy its price, so
+// changing the category price reprice every seat in it
+type PriceCategory struct {
+	PriceCategoryId uint64 `gorm:"primaryKey"`
+	Name            string `gorm:"not null;uniqueIndex"`
+	Price           uint   `gorm:"not null"`
+	Currency        string `gorm:"not null;default:IDR"`
+	Description     string
+	Color           string //hex color of the category on the seat map
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
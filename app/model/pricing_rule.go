@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// PricingRule change the price of the seats and tickets while it applies, like an early bird price until a date or a
+// price increase once most of a category is sold. When several rules apply, the one with the highest priority wins
+type PricingRule struct {
+	PricingRuleId   uint64  `gorm:"primaryKey"`
+	Name            string  `gorm:"not null"`
+	PriceCategoryId *uint64 `gorm:"index"` //empty for every seat and ticket
+	StartsAt        *time.Time
+	EndsAt          *time.Time
+	MinSoldPercent  uint   `gorm:"not null"` //the rule applies once this much of the category is sold, 0 for always
+	Kind            string `gorm:"not null"` //percentage, fixed or price
+	Value           int    `gorm:"not null"` //percent or amount added to the base price, negative for a discount. The price itself for the price kind
+	Priority        int    `gorm:"not null"`
+	Active          bool   `gorm:"not null"`
+	CreatedBy       uint64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
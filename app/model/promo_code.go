@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// PromoCode take a percentage or a fixed amount off the seats and tickets it applies to at checkout
+type PromoCode struct {
+	PromoCodeId      uint64 `gorm:"primaryKey"`
+	Code             string `gorm:"not null;uniqueIndex"` //upper case
+	Description      string
+	Kind             string     `gorm:"not null"` //percentage or fixed
+	Value            uint       `gorm:"not null"` //the percentage, or the amount taken off the order
+	PriceCategoryIds string     //comma separated, empty when the code applies to every seat and ticket
+	MaxUses          int        `gorm:"not null"` //0 for no limit
+	MaxUsesPerUser   int        `gorm:"not null"` //0 for no limit
+	StartsAt         *time.Time //valid right away when empty
+	EndsAt           *time.Time //never expires when empty
+	Active           bool       `gorm:"not null"`
+	CreatedBy        uint64     `gorm:"not null"` //the admin user id
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// PromoRedemption is the promo code applied to one order. It is pending until the payment settles, then redeemed,
+// or cancelled when the payment fails or the user checks out again
+type PromoRedemption struct {
+	PromoRedemptionId uint64 `gorm:"primaryKey"`
+	PromoCodeId       uint64 `gorm:"not null;index"`
+	UserId            uint64 `gorm:"not null;index"`
+	User              User   `json:"-"`
+	OrderId           string `gorm:"not null;uniqueIndex"`
+	Discount          uint   `gorm:"not null"`
+	Status            string `gorm:"not null"` //pending, redeemed or cancelled
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// PurchaseLimit cap the seats one buyer can hold. A buyer is every account sharing the email or the phone number,
+// so registering more emails does not raise the limit
+type PurchaseLimit struct {
+	PurchaseLimitId uint64  `gorm:"primaryKey"`
+	PriceCategoryId *uint64 `gorm:"uniqueIndex;uniqueIndex:idx_purchase_limits_event,expression:(price_category_id IS NULL),where:price_category_id IS NULL"` //empty for the whole event, only one such limit, otherwise only the seats of this category
+	MaxSeats        int     `gorm:"not null"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// PurchaseLimitOverride give one account, like a group buyer, its own event wide limit instead of the purchase limits
+type PurchaseLimitOverride struct {
+	PurchaseLimitOverrideId uint64     `gorm:"primaryKey"`
+	UserId                  uint64     `gorm:"not null;uniqueIndex"`
+	MaxSeats                int        `gorm:"not null"`
+	Reason                  string     `gorm:"not null"`
+	CreatedBy               uint64     `gorm:"not null"` //the admin user id
+	ExpiresAt               *time.Time //never expires when empty
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+}
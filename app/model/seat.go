@@ -6,14 +6,21 @@ import (
 )
 
 type Seat struct {
-	SeatId         uint           `gorm:"primaryKey"`
-	Name           string         `gorm:"unique;not null"`
-	Price          uint           `gorm:"not null"`
-	Link           string         `gorm:"not null"`
-	Status         string         `gorm:"not null"`
-	PostSaleStatus string         `gorm:`
-	Transaction    []Transaction  `gorm:"foreignKey:SeatId"json:"-"`
-	CreatedAt      time.Time      `json:"-"`
-	UpdatedAt      time.Time      `json:"-"`
-	DeletedAt      gorm.DeletedAt `json:"-"`
+	SeatId          uint    `gorm:"primaryKey"`
+	Name            string  `gorm:"unique;not null"`
+	Price           uint    `gorm:"not null"` //copied from the price category when the seat has one
+	PriceCategoryId *uint64 `gorm:"index"`
+	Link            string  `gorm:"not null"`
+	Status          string  `gorm:"not null"`
+	PostSaleStatus  string
+	VenueRowId      *uint64        `gorm:"index" json:"-"` //empty when the seat is not in the venue layout
+	Label           string         `json:"-"`              //the number within the row, like 31 of H31
+	X               float64        `json:"-"`              //center of the seat on the seat map
+	Y               float64        `json:"-"`
+	Aisle           bool           `json:"-"` //next to an aisle
+	Accessibility   string         `json:"-"` //comma separated, see VenueAccessibility
+	Transaction     []Transaction  `gorm:"foreignKey:SeatId" json:"-"`
+	CreatedAt       time.Time      `json:"-"`
+	UpdatedAt       time.Time      `json:"-"`
+	DeletedAt       gorm.DeletedAt `json:"-"`
 }
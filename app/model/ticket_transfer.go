@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// TicketTransfer give a purchased seat or general admission ticket to another person. The owner offers it to an email,
+// and once the person with that email logs in and accepts, the transaction moves to them with a new link, so the old
+// e-ticket stops working
+type TicketTransfer struct {
+	TicketTransferId uint64      `gorm:"primaryKey"`
+	TransactionId    uint64      `gorm:"not null;index;uniqueIndex:idx_ticket_transfers_pending,where:status = 'pending'"` //one pending transfer per ticket
+	Transaction      Transaction `json:"-"`
+	FromUserId       uint64      `gorm:"not null;index"`
+	FromUser         User        `json:"-"`
+	ToEmail          string      `gorm:"not null;index"` //lower case
+	ToUserId         *uint64     //set once accepted
+	Status           string      `gorm:"not null"` //pending, accepted or cancelled
+	SeatName         string      `gorm:"not null"` //the seat or the ticket, as shown on the e-ticket when the transfer was offered
+	AcceptedAt       *time.Time
+	CancelledAt      *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// TicketType is a general admission or standing area ticket that is sold by quantity instead of by seat. Available is
+// the capacity left after the holds and the sold tickets, a hold takes from it and a released hold gives it back
+type TicketType struct {
+	TicketTypeId    uint64 `gorm:"primaryKey"`
+	Name            string `gorm:"not null;uniqueIndex"`
+	Description     string
+	Price           uint    `gorm:"not null"` //copied from the price category when the ticket type has one
+	PriceCategoryId *uint64 `gorm:"index"`
+	Capacity        uint    `gorm:"not null"`
+	Available       uint    `gorm:"not null"`
+	OnSale          bool    `gorm:"not null"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
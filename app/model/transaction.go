@@ -6,15 +6,23 @@ import (
 )
 
 type Transaction struct {
-	TransactionId uint64 `gorm:"primaryKey"`
-	OrderId       string `gorm:"not null"`
-	UserId        uint64 `gorm:"not null"`
-	SeatId        uint   `gorm:"not null"`
-	User          User
-	Seat          Seat
-	Vendor        string
-	Confirmation  string
-	CreatedAt     time.Time      `json:"-"`
-	UpdatedAt     time.Time      `json:"-"`
-	DeletedAt     gorm.DeletedAt `json:"-"`
+	TransactionId  uint64  `gorm:"primaryKey"`
+	OrderId        string  `gorm:"not null"`
+	UserId         uint64  `gorm:"not null"`
+	SeatId         *uint   //empty for a general admission ticket
+	TicketTypeId   *uint64 `gorm:"index"` //only for a general admission ticket
+	User           User
+	Seat           Seat
+	TicketType     TicketType
+	TicketCode     string `gorm:"uniqueIndex:idx_transactions_ticket_code,where:ticket_code <> ''"` //unique id of a general admission ticket, printed on the e-ticket in place of the seat name
+	PostSaleStatus string //attended or exchanged, the seats keep it on the seat
+	Price          *uint  //the price locked when the seat or ticket was reserved, empty for the reservations made before the pricing rules
+	Vendor         string
+	Confirmation   string
+	Instruction    string         `gorm:"type:text" json:"-"` //json encoded payment instruction from the gateway's pending notification
+	RemindedAt     *time.Time     `json:"-"`                  //when the hold expiring or payment pending reminder was queued
+	ReleasedAt     *time.Time     `json:"-"`                  //when the seats released email was queued
+	CreatedAt      time.Time      `json:"-"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-"`
 }
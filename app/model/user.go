@@ -8,10 +8,21 @@ import (
 type User struct {
 	UserId      uint64 `gorm:"primaryKey"`
 	Name        string
-	Email       string `gorm:"not null"`
+	Email       string `gorm:"not null;index:idx_users_email_lower,expression:LOWER(email)"` //found whatever its letter case
 	Phone       string
-	TotpSecret  string         `json:"-"`
-	Transaction []Transaction  `gorm:"foreignKey:UserId;references:UserId"json:"-"`
+	Locale      string //preferred language for emails, id or en
+	Role        string //empty for customers, admin or gate for the staff
+	TotpEnabled bool   //the staff login also asks the authenticator app code
+
+	PasswordHash  string     `json:"-"` //bcrypt, only staff have a password
+	TotpSecret    string     `json:"-"`
+	TotpCounter   int64      `json:"-"`                  //the time step of the last accepted code, so a code can not be replayed
+	RecoveryCodes string     `gorm:"type:text" json:"-"` //bcrypt hashes of the unused recovery codes, one per line
+	FailedLogins  int        `json:"-"`
+	LockedUntil   *time.Time `json:"-"`
+	LastLoginAt   *time.Time `json:"-"`
+
+	Transaction []Transaction  `gorm:"foreignKey:UserId;references:UserId" json:"-"`
 	CreatedAt   time.Time      `json:"-"`
 	UpdatedAt   time.Time      `json:"-"`
 	DeletedAt   gorm.DeletedAt `json:"-"`
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// UserIdentity link a user to the account of an openid connect provider, the subject is the account id at the provider
+type UserIdentity struct {
+	UserIdentityId uint64    `gorm:"primaryKey"`
+	UserId         uint64    `gorm:"not null;index"`
+	User           User      `gorm:"foreignKey:UserId;references:UserId" json:"-"`
+	Provider       string    `gorm:"not null;uniqueIndex:idx_provider_subject"`
+	Subject        string    `gorm:"not null;uniqueIndex:idx_provider_subject"`
+	Email          string    //the verified email at the time of the last login
+	LastLoginAt    time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// VenueAccessibility are the accessibility flags a seat can have
+var VenueAccessibility = []string{"wheelchair", "companion", "hearing_loop", "limited_view"}
+
+// Venue is the hall the seats are in. It is imported from a json layout, see service.VenueLayout
+type Venue struct {
+	VenueId   uint64         `gorm:"primaryKey"`
+	Name      string         `gorm:"not null"`
+	Width     float64        `gorm:"not null"` //size of the seat map, in the unit of the seat coordinates
+	Height    float64        `gorm:"not null"`
+	Sections  []VenueSection `gorm:"foreignKey:VenueId"`
+	CreatedAt time.Time      `json:"-"`
+	UpdatedAt time.Time      `json:"-"`
+}
+
+type VenueSection struct {
+	VenueSectionId uint64     `gorm:"primaryKey"`
+	VenueId        uint64     `gorm:"not null;index"`
+	Name           string     `gorm:"not null"`
+	Position       int        `gorm:"not null"` //the order in the layout
+	Rows           []VenueRow `gorm:"foreignKey:VenueSectionId"`
+}
+
+type VenueRow struct {
+	VenueRowId     uint64 `gorm:"primaryKey"`
+	VenueSectionId uint64 `gorm:"not null;index"`
+	Label          string `gorm:"not null"` //the row letter printed in the hall, like H
+	Position       int    `gorm:"not null"`
+	Seats          []Seat `gorm:"foreignKey:VenueRowId"`
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewApiKeyRepository(db *gorm.DB, log *util.LogUtil) *ApiKeyRepository {
+	return &ApiKeyRepository{db: db, log: log}
+}
+
+func (r *ApiKeyRepository) InsertOne(apiKey *model.ApiKey) *gorm.DB {
+	result := r.db.Create(apiKey)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "ApiKeyRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *ApiKeyRepository) GetAll(apiKeys *[]model.ApiKey) *gorm.DB {
+	result := r.db.Order("api_key_id DESC").Find(apiKeys)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "ApiKeyRepository@GetAll")
+	}
+	return result
+}
+
+func (r *ApiKeyRepository) GetByHash(apiKey *model.ApiKey, keyHash string) *gorm.DB {
+	result := r.db.Where("key_hash = ?", keyHash).Take(apiKey)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "ApiKeyRepository@GetByHash")
+	}
+	return result
+}
+
+// RevokeById revoke the key, nothing is updated when it is already revoked
+func (r *ApiKeyRepository) RevokeById(apiKeyId uint64) *gorm.DB {
+	result := r.db.Model(model.ApiKey{}).Where("api_key_id = ? AND revoked_at IS NULL", apiKeyId).Update("revoked_at", gorm.Expr("NOW()"))
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "ApiKeyRepository@RevokeById")
+	}
+	return result
+}
+
+func (r *ApiKeyRepository) UpdateById(apiKeyId uint64, fields map[string]any) *gorm.DB {
+	result := r.db.Model(model.ApiKey{}).Where("api_key_id = ?", apiKeyId).Updates(fields)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "ApiKeyRepository@UpdateById")
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+// AuditEventFilter narrow the audit events, the empty fields are not filtered
+type AuditEventFilter struct {
+	ActorType  string
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	RequestId  string
+	From       *time.Time
+	To         *time.Time
+}
+
+type AuditEventRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewAuditEventRepository(db *gorm.DB, log *util.LogUtil) *AuditEventRepository {
+	return &AuditEventRepository{db: db, log: log}
+}
+
+func (r *AuditEventRepository) InsertOne(event *model.AuditEvent) *gorm.DB {
+	result := r.db.Create(event)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "AuditEventRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *AuditEventRepository) filtered(filter AuditEventFilter) *gorm.DB {
+	query := r.db.Model(model.AuditEvent{})
+	for column, value := range map[string]string{
+		"actor_type":  filter.ActorType,
+		"actor_id":    filter.ActorId,
+		"action":      filter.Action,
+		"target_type": filter.TargetType,
+		"target_id":   filter.TargetId,
+		"request_id":  filter.RequestId,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// Find get one page of the matching events, the newest first
+func (r *AuditEventRepository) Find(events *[]model.AuditEvent, filter AuditEventFilter, limit, offset int) *gorm.DB {
+	result := r.filtered(filter).Order("audit_event_id DESC").Limit(limit).Offset(offset).Find(events)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "AuditEventRepository@Find")
+	}
+	return result
+}
+
+func (r *AuditEventRepository) Count(filter AuditEventFilter) (int64, error) {
+	var count int64
+	result := r.filtered(filter).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "AuditEventRepository@Count")
+	}
+	return count, result.Error
+}
+
+// FindInBatches go through every matching event, the oldest first, without loading all of them at once
+func (r *AuditEventRepository) FindInBatches(filter AuditEventFilter, batchSize int, handle func(events []model.AuditEvent) error) error {
+	var events []model.AuditEvent
+	result := r.filtered(filter).FindInBatches(&events, batchSize, func(tx *gorm.DB, batch int) error {
+		return handle(events)
+	})
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "AuditEventRepository@FindInBatches")
+	}
+	return result.Error
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type BroadcastRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewBroadcastRepository(db *gorm.DB, log *util.LogUtil) *BroadcastRepository {
+	return &BroadcastRepository{db: db, log: log}
+}
+
+func (r *BroadcastRepository) InsertOne(broadcast *model.Broadcast) *gorm.DB {
+	result := r.db.Create(broadcast)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *BroadcastRepository) GetById(broadcast *model.Broadcast, broadcastId uint64) *gorm.DB {
+	result := r.db.Preload("Recipients").First(broadcast, broadcastId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@GetById")
+	}
+	return result
+}
+
+// GetByKind get the broadcast the application schedules by itself, like the event day reminder
+func (r *BroadcastRepository) GetByKind(broadcast *model.Broadcast, kind string) *gorm.DB {
+	result := r.db.Where("kind = ?", kind).Take(broadcast)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "BroadcastRepository@GetByKind")
+	}
+	return result
+}
+
+func (r *BroadcastRepository) GetAll(broadcasts *[]model.Broadcast, status string) *gorm.DB {
+	query := r.db.Order("broadcast_id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	result := query.Find(broadcasts)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@GetAll")
+	}
+	return result
+}
+
+// ClaimDue lock the scheduled broadcasts that are due and mark them as sending. Broadcasts that have been sending
+// for longer than the lease are claimed again, so a crashed worker does not leave them half sent
+func (r *BroadcastRepository) ClaimDue(broadcasts *[]model.Broadcast, lease time.Duration) error {
+	err := r.db.Transaction(func(txn *gorm.DB) error {
+		now := time.Now()
+		result := txn.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND scheduled_at <= ?) OR (status = ? AND updated_at <= ?)", "scheduled", now, "sending", now.Add(-lease)).
+			Order("scheduled_at").
+			Find(broadcasts)
+		if result.Error != nil || result.RowsAffected < 1 {
+			return result.Error
+		}
+		var broadcastIds []uint64
+		for _, broadcast := range *broadcasts {
+			broadcastIds = append(broadcastIds, broadcast.BroadcastId)
+		}
+		return txn.Model(&model.Broadcast{}).Where("broadcast_id IN ?", broadcastIds).Updates(map[string]any{"status": "sending", "updated_at": now}).Error
+	})
+	if err != nil {
+		r.log.BasicLog(err, "BroadcastRepository@ClaimDue")
+	}
+	return err
+}
+
+func (r *BroadcastRepository) UpdateById(broadcastId uint64, fields map[string]any) *gorm.DB {
+	result := r.db.Model(&model.Broadcast{}).Where("broadcast_id = ?", broadcastId).Updates(fields)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@UpdateById")
+	}
+	return result
+}
+
+// UpdateByIdWithStatus change the broadcast only while it has the status, the affected rows tell if it happened
+func (r *BroadcastRepository) UpdateByIdWithStatus(broadcastId uint64, status string, fields map[string]any) *gorm.DB {
+	result := r.db.Model(&model.Broadcast{}).Where("broadcast_id = ? AND status = ?", broadcastId, status).Updates(fields)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@UpdateByIdWithStatus")
+	}
+	return result
+}
+
+// UpdateStatusFrom change the status only when it still has the expected value, the affected rows tell if it happened
+func (r *BroadcastRepository) UpdateStatusFrom(broadcastId uint64, from, to string) *gorm.DB {
+	result := r.db.Model(&model.Broadcast{}).Where("broadcast_id = ? AND status = ?", broadcastId, from).Update("status", to)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@UpdateStatusFrom")
+	}
+	return result
+}
+
+func (r *BroadcastRepository) InsertRecipientTxn(txn *gorm.DB, recipient *model.BroadcastRecipient) *gorm.DB {
+	result := txn.Create(recipient)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@InsertRecipientTxn")
+	}
+	return result
+}
+
+func (r *BroadcastRepository) GetRecipientUserIds(broadcastId uint64) ([]uint64, error) {
+	var userIds []uint64
+	result := r.db.Model(&model.BroadcastRecipient{}).Where("broadcast_id = ?", broadcastId).Pluck("user_id", &userIds)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@GetRecipientUserIds")
+	}
+	return userIds, result.Error
+}
+
+func (r *BroadcastRepository) CountRecipients(broadcastId uint64) (int64, error) {
+	var count int64
+	result := r.db.Model(&model.BroadcastRecipient{}).Where("broadcast_id = ?", broadcastId).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "BroadcastRepository@CountRecipients")
+	}
+	return count, result.Error
+}
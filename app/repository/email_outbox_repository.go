@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type EmailOutboxRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewEmailOutboxRepository(db *gorm.DB, log *util.LogUtil) *EmailOutboxRepository {
+	return &EmailOutboxRepository{db: db, log: log}
+}
+
+func (r *EmailOutboxRepository) InsertOne(outbox *model.EmailOutbox) *gorm.DB {
+	result := r.db.Create(outbox)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "EmailOutboxRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *EmailOutboxRepository) InsertOneTxn(txn *gorm.DB, outbox *model.EmailOutbox) *gorm.DB {
+	result := txn.Create(outbox)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "EmailOutboxRepository@InsertOneTxn")
+	}
+	return result
+}
+
+func (r *EmailOutboxRepository) GetById(outbox *model.EmailOutbox, outboxId uint64) *gorm.DB {
+	result := r.db.First(outbox, outboxId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "EmailOutboxRepository@GetById")
+	}
+	return result
+}
+
+func (r *EmailOutboxRepository) GetAll(outboxes *[]model.EmailOutbox, status string) *gorm.DB {
+	query := r.db.Order("email_outbox_id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	result := query.Find(outboxes)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "EmailOutboxRepository@GetAll")
+	}
+	return result
+}
+
+// ClaimDue lock the queued messages that are due and push their next attempt forward by the lease duration,
+// so another worker will not pick the same messages while this one is still sending them
+func (r *EmailOutboxRepository) ClaimDue(outboxes *[]model.EmailOutbox, limit int, lease time.Duration) error {
+	err := r.db.Transaction(func(txn *gorm.DB) error {
+		now := time.Now()
+		result := txn.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", "queued", now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(outboxes)
+		if result.Error != nil || result.RowsAffected < 1 {
+			return result.Error
+		}
+		var outboxIds []uint64
+		for _, outbox := range *outboxes {
+			outboxIds = append(outboxIds, outbox.EmailOutboxId)
+		}
+		return txn.Model(&model.EmailOutbox{}).Where("email_outbox_id IN ?", outboxIds).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		r.log.BasicLog(err, "EmailOutboxRepository@ClaimDue")
+	}
+	return err
+}
+
+func (r *EmailOutboxRepository) UpdateById(outboxId uint64, fields map[string]any) *gorm.DB {
+	result := r.db.Model(&model.EmailOutbox{}).Where("email_outbox_id = ?", outboxId).Updates(fields)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "EmailOutboxRepository@UpdateById")
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+type InvoiceRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewInvoiceRepository(db *gorm.DB, log *util.LogUtil) *InvoiceRepository {
+	return &InvoiceRepository{db: db, log: log}
+}
+
+// InsertOneTxn save the invoice with its lines
+func (r *InvoiceRepository) InsertOneTxn(txn *gorm.DB, invoice *model.Invoice) *gorm.DB {
+	result := txn.Create(invoice)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "InvoiceRepository@InsertOneTxn")
+	}
+	return result
+}
+
+func (r *InvoiceRepository) GetByOrder(invoice *model.Invoice, orderId string) *gorm.DB {
+	result := r.db.Joins("User").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("invoice_line_id")
+	}).Where("invoices.order_id = ?", orderId).Take(invoice)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "InvoiceRepository@GetByOrder")
+	}
+	return result
+}
+
+// Issue give the invoice of the paid order the next number of the invoice sequence, an invoice with a number keeps it
+func (r *InvoiceRepository) Issue(orderId, prefix string, issuedAt time.Time) *gorm.DB {
+	result := r.db.Exec(`UPDATE invoices SET (sequence, number, status, issued_at, updated_at) =
+		(SELECT seq.value, ? || LPAD(seq.value::text, 6, '0'), 'paid', ?::timestamptz, ?::timestamptz FROM (SELECT nextval('invoice_number_seq') AS value) AS seq)
+		WHERE order_id = ? AND sequence IS NULL`, prefix, issuedAt, issuedAt, orderId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "InvoiceRepository@Issue")
+	}
+	return result
+}
+
+// UpdateStatus change the status of the unpaid invoice
+func (r *InvoiceRepository) UpdateStatus(orderId, status string) *gorm.DB {
+	result := r.db.Model(&model.Invoice{}).Where("order_id = ? AND status = ?", orderId, "pending").Update("status", status)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "InvoiceRepository@UpdateStatus")
+	}
+	return result
+}
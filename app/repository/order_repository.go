@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OrderFilter struct {
+	Status string
+	UserId uint64
+	From   *time.Time
+	To     *time.Time
+}
+
+type OrderRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewOrderRepository(db *gorm.DB, log *util.LogUtil) *OrderRepository {
+	return &OrderRepository{db: db, log: log}
+}
+
+func (r *OrderRepository) InsertOne(order *model.Order) *gorm.DB {
+	result := r.db.Omit("Transactions").Create(order)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *OrderRepository) InsertOneTxn(txn *gorm.DB, order *model.Order) *gorm.DB {
+	result := txn.Omit("Transactions").Create(order)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@InsertOneTxn")
+	}
+	return result
+}
+
+// GetDetailsById get the order with the user and the order lines, including the lines of a failed order
+func (r *OrderRepository) GetDetailsById(order *model.Order, orderId string) *gorm.DB {
+	result := r.db.Joins("User").Preload("Transactions", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Joins("Seat").Joins("TicketType").Order("transactions.transaction_id")
+	}).Where("orders.order_id = ?", orderId).Take(order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "OrderRepository@GetDetailsById")
+	}
+	return result
+}
+
+// GetOpenByUser get the newest order of the user that still waits for its payment and has a payment page
+func (r *OrderRepository) GetOpenByUser(order *model.Order, userId uint64, now time.Time) *gorm.DB {
+	result := r.db.Where("user_id = ? AND status IN ? AND expires_at > ? AND snap_token <> ?", userId, []string{"awaiting_payment", "pending"}, now, "").
+		Order("created_at desc").Take(order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "OrderRepository@GetOpenByUser")
+	}
+	return result
+}
+
+func (r *OrderRepository) GetByIdempotencyKey(order *model.Order, userId uint64, key string) *gorm.DB {
+	result := r.db.Where("user_id = ? AND idempotency_key = ?", userId, key).Take(order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "OrderRepository@GetByIdempotencyKey")
+	}
+	return result
+}
+
+func (r *OrderRepository) GetByIdempotencyKeyTxn(txn *gorm.DB, order *model.Order, userId uint64, key string) *gorm.DB {
+	result := txn.Where("user_id = ? AND idempotency_key = ?", userId, key).Take(order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "OrderRepository@GetByIdempotencyKeyTxn")
+	}
+	return result
+}
+
+func (r *OrderRepository) UpdateTxn(txn *gorm.DB, orderId string, columns map[string]any) *gorm.DB {
+	result := txn.Model(&model.Order{}).Where("order_id = ?", orderId).Updates(columns)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@UpdateTxn")
+	}
+	return result
+}
+
+// Update change the columns of the order while it has one of the statuses, or whatever its status when none is given
+func (r *OrderRepository) Update(orderId string, columns map[string]any, statuses ...string) *gorm.DB {
+	query := r.db.Model(&model.Order{}).Where("order_id = ?", orderId)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	result := query.Updates(columns)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@Update")
+	}
+	return result
+}
+
+func (r *OrderRepository) filtered(filter OrderFilter) *gorm.DB {
+	query := r.db.Model(&model.Order{})
+	if filter.Status != "" {
+		query = query.Where("orders.status = ?", filter.Status)
+	}
+	if filter.UserId != 0 {
+		query = query.Where("orders.user_id = ?", filter.UserId)
+	}
+	if filter.From != nil {
+		query = query.Where("orders.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("orders.created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// Find get one page of the matching orders with their user and lines, the newest first
+func (r *OrderRepository) Find(orders *[]model.Order, filter OrderFilter, limit, offset int) *gorm.DB {
+	result := r.filtered(filter).Joins("User").Preload("Transactions", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Joins("Seat").Joins("TicketType").Order("transactions.transaction_id")
+	}).Order("orders.created_at DESC").Limit(limit).Offset(offset).Find(orders)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@Find")
+	}
+	return result
+}
+
+func (r *OrderRepository) Count(filter OrderFilter) (int64, error) {
+	var count int64
+	result := r.filtered(filter).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "OrderRepository@Count")
+	}
+	return count, result.Error
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+)
+
+type PriceCategoryRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewPriceCategoryRepository(db *gorm.DB, log *util.LogUtil) *PriceCategoryRepository {
+	return &PriceCategoryRepository{db: db, log: log}
+}
+
+func (r *PriceCategoryRepository) GetAll(categories *[]model.PriceCategory) *gorm.DB {
+	result := r.db.Order("price desc, name").Find(categories)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@GetAll")
+	}
+	return result
+}
+
+func (r *PriceCategoryRepository) GetById(category *model.PriceCategory, categoryId uint64) *gorm.DB {
+	result := r.db.Take(category, categoryId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@GetById")
+	}
+	return result
+}
+
+func (r *PriceCategoryRepository) GetByName(category *model.PriceCategory, name string) *gorm.DB {
+	result := r.db.Where("name = ?", name).Take(category)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@GetByName")
+	}
+	return result
+}
+
+func (r *PriceCategoryRepository) InsertOne(category *model.PriceCategory) *gorm.DB {
+	result := r.db.Create(category)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *PriceCategoryRepository) SaveTxn(txn *gorm.DB, category *model.PriceCategory) *gorm.DB {
+	result := txn.Save(category)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@SaveTxn")
+	}
+	return result
+}
+
+func (r *PriceCategoryRepository) DeleteById(categoryId uint64) *gorm.DB {
+	result := r.db.Delete(&model.PriceCategory{}, categoryId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PriceCategoryRepository@DeleteById")
+	}
+	return result
+}
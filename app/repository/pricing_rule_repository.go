@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+)
+
+// CategorySales is the seats and tickets of a price category and how many of them are sold
+type CategorySales struct {
+	PriceCategoryId uint64
+	Total           uint64
+	Sold            uint64
+}
+
+type PricingRuleRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewPricingRuleRepository(db *gorm.DB, log *util.LogUtil) *PricingRuleRepository {
+	return &PricingRuleRepository{db: db, log: log}
+}
+
+func (r *PricingRuleRepository) GetAll(rules *[]model.PricingRule) *gorm.DB {
+	result := r.db.Order("priority desc, pricing_rule_id").Find(rules)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@GetAll")
+	}
+	return result
+}
+
+// GetActive get the active rules, the rule that wins comes first
+func (r *PricingRuleRepository) GetActive(rules *[]model.PricingRule) *gorm.DB {
+	result := r.db.Where("active = ?", true).Order("priority desc, pricing_rule_id").Find(rules)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@GetActive")
+	}
+	return result
+}
+
+func (r *PricingRuleRepository) GetActiveTxn(txn *gorm.DB, rules *[]model.PricingRule) *gorm.DB {
+	result := txn.Where("active = ?", true).Order("priority desc, pricing_rule_id").Find(rules)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@GetActiveTxn")
+	}
+	return result
+}
+
+func (r *PricingRuleRepository) GetById(rule *model.PricingRule, ruleId uint64) *gorm.DB {
+	result := r.db.Take(rule, ruleId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@GetById")
+	}
+	return result
+}
+
+func (r *PricingRuleRepository) InsertOne(rule *model.PricingRule) *gorm.DB {
+	result := r.db.Create(rule)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *PricingRuleRepository) Save(rule *model.PricingRule) *gorm.DB {
+	result := r.db.Save(rule)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@Save")
+	}
+	return result
+}
+
+func (r *PricingRuleRepository) DeleteById(ruleId uint64) *gorm.DB {
+	result := r.db.Delete(&model.PricingRule{}, ruleId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@DeleteById")
+	}
+	return result
+}
+
+// GetCategorySales count the seats and the general admission capacity of every price category, with the purchased
+// seats and the settled tickets as sold
+func (r *PricingRuleRepository) GetCategorySales(sales *[]CategorySales) *gorm.DB {
+	return r.GetCategorySalesTxn(r.db, sales)
+}
+
+func (r *PricingRuleRepository) GetCategorySalesTxn(txn *gorm.DB, sales *[]CategorySales) *gorm.DB {
+	result := txn.Raw(`SELECT price_category_id, SUM(total) AS total, SUM(sold) AS sold FROM (
+		SELECT price_category_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE status = 'purchased') AS sold
+		FROM seats WHERE deleted_at IS NULL AND price_category_id IS NOT NULL GROUP BY price_category_id
+		UNION ALL
+		SELECT ticket_types.price_category_id, ticket_types.capacity AS total,
+			(SELECT COUNT(*) FROM transactions WHERE transactions.ticket_type_id = ticket_types.ticket_type_id AND transactions.confirmation = 'settlement' AND transactions.deleted_at IS NULL) AS sold
+		FROM ticket_types WHERE ticket_types.price_category_id IS NOT NULL
+	) AS inventory GROUP BY price_category_id`).Scan(sales)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PricingRuleRepository@GetCategorySalesTxn")
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// PromoUsage is the redeemed orders of a promo code and the total discount given
+type PromoUsage struct {
+	PromoCodeId uint64
+	Redeemed    int
+	Discount    uint64
+}
+
+type PromoCodeRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewPromoCodeRepository(db *gorm.DB, log *util.LogUtil) *PromoCodeRepository {
+	return &PromoCodeRepository{db: db, log: log}
+}
+
+func (r *PromoCodeRepository) GetAll(promoCodes *[]model.PromoCode) *gorm.DB {
+	result := r.db.Order("promo_code_id desc").Find(promoCodes)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@GetAll")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) GetById(promoCode *model.PromoCode, promoCodeId uint64) *gorm.DB {
+	result := r.db.Take(promoCode, promoCodeId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@GetById")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) GetByCode(promoCode *model.PromoCode, code string) *gorm.DB {
+	result := r.db.Where("code = ?", code).Take(promoCode)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@GetByCode")
+	}
+	return result
+}
+
+// LockByCodeTxn get the promo code and lock it until the end of the database transaction, so the usage limits are
+// checked and taken by one checkout at a time
+func (r *PromoCodeRepository) LockByCodeTxn(txn *gorm.DB, promoCode *model.PromoCode, code string) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).Take(promoCode)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@LockByCodeTxn")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) InsertOne(promoCode *model.PromoCode) *gorm.DB {
+	result := r.db.Create(promoCode)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) Save(promoCode *model.PromoCode) *gorm.DB {
+	result := r.db.Save(promoCode)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@Save")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) DeleteById(promoCodeId uint64) *gorm.DB {
+	result := r.db.Delete(&model.PromoCode{}, promoCodeId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@DeleteById")
+	}
+	return result
+}
+
+// CountUsesTxn count the redeemed orders of the promo code and the pending ones created after the given time, the
+// older pending orders can no longer be paid. A zero user id counts the uses of every user. The redemptions of the
+// excluded orders are not counted
+func (r *PromoCodeRepository) CountUsesTxn(txn *gorm.DB, promoCodeId, userId uint64, pendingSince time.Time, excludedOrderIds []string) (int64, error) {
+	var count int64
+	query := txn.Model(&model.PromoRedemption{}).
+		Where("promo_code_id = ?", promoCodeId).
+		Where("status = ? OR (status = ? AND created_at > ?)", "redeemed", "pending", pendingSince)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if len(excludedOrderIds) > 0 {
+		query = query.Where("order_id NOT IN ?", excludedOrderIds)
+	}
+	result := query.Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@CountUsesTxn")
+	}
+	return count, result.Error
+}
+
+func (r *PromoCodeRepository) CountRedemptions(promoCodeId uint64) (int64, error) {
+	var count int64
+	result := r.db.Model(&model.PromoRedemption{}).Where("promo_code_id = ?", promoCodeId).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@CountRedemptions")
+	}
+	return count, result.Error
+}
+
+func (r *PromoCodeRepository) InsertRedemptionTxn(txn *gorm.DB, redemption *model.PromoRedemption) *gorm.DB {
+	result := txn.Create(redemption)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@InsertRedemptionTxn")
+	}
+	return result
+}
+
+// CancelPendingByOrdersTxn cancel the pending redemptions of the orders, they are replaced by a new checkout
+func (r *PromoCodeRepository) CancelPendingByOrdersTxn(txn *gorm.DB, orderIds []string) *gorm.DB {
+	result := txn.Model(&model.PromoRedemption{}).Where("order_id IN ? AND status = ?", orderIds, "pending").Update("status", "cancelled")
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@CancelPendingByOrdersTxn")
+	}
+	return result
+}
+
+// UpdateRedemptionStatus move the pending redemption of the order to the status
+func (r *PromoCodeRepository) UpdateRedemptionStatus(orderId, status string) *gorm.DB {
+	result := r.db.Model(&model.PromoRedemption{}).Where("order_id = ? AND status = ?", orderId, "pending").Update("status", status)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@UpdateRedemptionStatus")
+	}
+	return result
+}
+
+func (r *PromoCodeRepository) GetRedemptionsByCode(redemptions *[]model.PromoRedemption, promoCodeId uint64) *gorm.DB {
+	result := r.db.Joins("User").Where("promo_redemptions.promo_code_id = ?", promoCodeId).Order("promo_redemptions.promo_redemption_id desc").Find(redemptions)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@GetRedemptionsByCode")
+	}
+	return result
+}
+
+// GetUsages sum the redeemed orders by promo code
+func (r *PromoCodeRepository) GetUsages(usages *[]PromoUsage) *gorm.DB {
+	result := r.db.Model(&model.PromoRedemption{}).
+		Select("promo_code_id, COUNT(*) AS redeemed, COALESCE(SUM(discount), 0) AS discount").
+		Where("status = ?", "redeemed").
+		Group("promo_code_id").
+		Scan(usages)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PromoCodeRepository@GetUsages")
+	}
+	return result
+}
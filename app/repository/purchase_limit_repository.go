@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+type PurchaseLimitRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewPurchaseLimitRepository(db *gorm.DB, log *util.LogUtil) *PurchaseLimitRepository {
+	return &PurchaseLimitRepository{db: db, log: log}
+}
+
+func (r *PurchaseLimitRepository) GetAll(limits *[]model.PurchaseLimit) *gorm.DB {
+	result := r.db.Order("price_category_id NULLS FIRST").Find(limits)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@GetAll")
+	}
+	return result
+}
+
+// GetByCategory get the limit of the price category, a nil category is the event wide limit
+func (r *PurchaseLimitRepository) GetByCategory(limit *model.PurchaseLimit, categoryId *uint64) *gorm.DB {
+	query := r.db.Where("price_category_id IS NULL")
+	if categoryId != nil {
+		query = r.db.Where("price_category_id = ?", *categoryId)
+	}
+	result := query.Take(limit)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@GetByCategory")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) Save(limit *model.PurchaseLimit) *gorm.DB {
+	result := r.db.Save(limit)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@Save")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) DeleteById(limitId uint64) *gorm.DB {
+	result := r.db.Delete(&model.PurchaseLimit{}, limitId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@DeleteById")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) GetAllOverrides(overrides *[]model.PurchaseLimitOverride) *gorm.DB {
+	result := r.db.Order("user_id").Find(overrides)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@GetAllOverrides")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) GetOverrideByUser(override *model.PurchaseLimitOverride, userId uint64) *gorm.DB {
+	result := r.db.Where("user_id = ?", userId).Take(override)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@GetOverrideByUser")
+	}
+	return result
+}
+
+// GetActiveOverrideByUser get the override of the user that has not expired
+func (r *PurchaseLimitRepository) GetActiveOverrideByUser(override *model.PurchaseLimitOverride, userId uint64, now time.Time) *gorm.DB {
+	result := r.db.Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userId, now).Take(override)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@GetActiveOverrideByUser")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) SaveOverride(override *model.PurchaseLimitOverride) *gorm.DB {
+	result := r.db.Save(override)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@SaveOverride")
+	}
+	return result
+}
+
+func (r *PurchaseLimitRepository) DeleteOverrideByUser(userId uint64) *gorm.DB {
+	result := r.db.Where("user_id = ?", userId).Delete(&model.PurchaseLimitOverride{})
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "PurchaseLimitRepository@DeleteOverrideByUser")
+	}
+	return result
+}
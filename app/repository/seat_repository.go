@@ -4,6 +4,7 @@ import (
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SeatRepository struct {
@@ -15,6 +16,14 @@ func NewSeatRepository(db *gorm.DB, log *util.LogUtil) *SeatRepository {
 	return &SeatRepository{db: db, log: log}
 }
 
+func (r *SeatRepository) GetByLink(seat *model.Seat, link string) *gorm.DB {
+	result := r.db.Where("link = ?", link).First(seat)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@GetByLink")
+	}
+	return result
+}
+
 func (r *SeatRepository) UpdatePostSaleStatus(link, status string) *gorm.DB {
 	result := r.db.Model(&model.Seat{}).Where("link = ?", link).Update("post_sale_status", status)
 	if result.Error != nil {
@@ -39,6 +48,15 @@ func (r *SeatRepository) UpdateStatusTxn(txn *gorm.DB, seatId uint, status strin
 	return result
 }
 
+// UpdateLinkTxn give the seat a new link, the e-tickets with the old one stop working
+func (r *SeatRepository) UpdateLinkTxn(txn *gorm.DB, seatId uint, link string) *gorm.DB {
+	result := txn.Model(&model.Seat{}).Where("seat_id = ?", seatId).Update("link", link)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@UpdateLinkTxn")
+	}
+	return result
+}
+
 func (r *SeatRepository) GetAll(seats *[]model.Seat) *gorm.DB {
 	result := r.db.Find(seats)
 	if result.Error != nil {
@@ -54,3 +72,64 @@ func (r *SeatRepository) GetByIdTxn(txn *gorm.DB, seat *model.Seat, id uint) *go
 	}
 	return result
 }
+
+// LockByIdsTxn get the seats and lock them until the end of the database transaction
+func (r *SeatRepository) LockByIdsTxn(txn *gorm.DB, seats *[]model.Seat, ids []uint) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Order("seat_id").Find(seats, ids)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@LockByIdsTxn")
+	}
+	return result
+}
+
+func (r *SeatRepository) GetByIds(seats *[]model.Seat, ids []uint) *gorm.DB {
+	result := r.db.Order("seat_id").Find(seats, ids)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@GetByIds")
+	}
+	return result
+}
+
+func (r *SeatRepository) GetByIdsTxn(txn *gorm.DB, seats *[]model.Seat, ids []uint) *gorm.DB {
+	result := txn.Order("seat_id").Find(seats, ids)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@GetByIdsTxn")
+	}
+	return result
+}
+
+// LockAllTxn get every seat and lock them until the end of the database transaction
+func (r *SeatRepository) LockAllTxn(txn *gorm.DB, seats *[]model.Seat) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Order("seat_id").Find(seats)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@LockAllTxn")
+	}
+	return result
+}
+
+// UpdatePriceByCategoryTxn reprice every seat of the category
+func (r *SeatRepository) UpdatePriceByCategoryTxn(txn *gorm.DB, categoryId uint64, price uint) *gorm.DB {
+	result := txn.Model(&model.Seat{}).Where("price_category_id = ?", categoryId).Update("price", price)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@UpdatePriceByCategoryTxn")
+	}
+	return result
+}
+
+// AssignCategoryTxn move the seats to the category and give them its price
+func (r *SeatRepository) AssignCategoryTxn(txn *gorm.DB, seatIds []uint, categoryId uint64, price uint) *gorm.DB {
+	result := txn.Model(&model.Seat{}).Where("seat_id IN ?", seatIds).Updates(map[string]any{"price_category_id": categoryId, "price": price})
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@AssignCategoryTxn")
+	}
+	return result
+}
+
+func (r *SeatRepository) CountByCategory(categoryId uint64) (int64, error) {
+	var count int64
+	result := r.db.Model(&model.Seat{}).Where("price_category_id = ?", categoryId).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "SeatRepository@CountByCategory")
+	}
+	return count, result.Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TicketTransferRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewTicketTransferRepository(db *gorm.DB, log *util.LogUtil) *TicketTransferRepository {
+	return &TicketTransferRepository{db: db, log: log}
+}
+
+func (r *TicketTransferRepository) InsertOne(transfer *model.TicketTransfer) *gorm.DB {
+	result := r.db.Create(transfer)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@InsertOne")
+	}
+	return result
+}
+
+func (r *TicketTransferRepository) GetById(transfer *model.TicketTransfer, transferId uint64) *gorm.DB {
+	result := r.db.Joins("FromUser").Where("ticket_transfers.ticket_transfer_id = ?", transferId).Take(transfer)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@GetById")
+	}
+	return result
+}
+
+// GetByUser get the transfers the user offered and the ones offered to the user's email, the newest first
+func (r *TicketTransferRepository) GetByUser(transfers *[]model.TicketTransfer, userId uint64, email string) *gorm.DB {
+	result := r.db.Joins("FromUser").Where("ticket_transfers.from_user_id = ? OR ticket_transfers.to_email = ?", userId, email).
+		Order("ticket_transfers.ticket_transfer_id desc").Find(transfers)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@GetByUser")
+	}
+	return result
+}
+
+// LockByIdTxn get the transfer and lock it until the end of the database transaction, so it is accepted only once
+func (r *TicketTransferRepository) LockByIdTxn(txn *gorm.DB, transfer *model.TicketTransfer, transferId uint64) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ticket_transfer_id = ?", transferId).Take(transfer)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@LockByIdTxn")
+	}
+	return result
+}
+
+// CountByStatusTxn count the transfers of the ticket with the status, the accepted ones are the times it changed hands
+func (r *TicketTransferRepository) CountByStatusTxn(txn *gorm.DB, transactionId uint64, status string) (int64, error) {
+	var count int64
+	result := txn.Model(&model.TicketTransfer{}).Where("transaction_id = ? AND status = ?", transactionId, status).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@CountByStatusTxn")
+	}
+	return count, result.Error
+}
+
+// UpdateTxn change the columns of the transfer while it has the status
+func (r *TicketTransferRepository) UpdateTxn(txn *gorm.DB, transferId uint64, status string, columns map[string]any) *gorm.DB {
+	result := txn.Model(&model.TicketTransfer{}).Where("ticket_transfer_id = ? AND status = ?", transferId, status).Updates(columns)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTransferRepository@UpdateTxn")
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TicketTypeRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewTicketTypeRepository(db *gorm.DB, log *util.LogUtil) *TicketTypeRepository {
+	return &TicketTypeRepository{db: db, log: log}
+}
+
+func (r *TicketTypeRepository) GetAll(ticketTypes *[]model.TicketType) *gorm.DB {
+	result := r.db.Order("price desc, name").Find(ticketTypes)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@GetAll")
+	}
+	return result
+}
+
+func (r *TicketTypeRepository) GetById(ticketType *model.TicketType, ticketTypeId uint64) *gorm.DB {
+	result := r.db.Take(ticketType, ticketTypeId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@GetById")
+	}
+	return result
+}
+
+func (r *TicketTypeRepository) GetByName(ticketType *model.TicketType, name string) *gorm.DB {
+	result := r.db.Where("name = ?", name).Take(ticketType)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@GetByName")
+	}
+	return result
+}
+
+func (r *TicketTypeRepository) InsertOne(ticketType *model.TicketType) *gorm.DB {
+	result := r.db.Create(ticketType)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@InsertOne")
+	}
+	return result
+}
+
+// LockByIdTxn get the ticket type and lock it until the end of the database transaction
+func (r *TicketTypeRepository) LockByIdTxn(txn *gorm.DB, ticketType *model.TicketType, ticketTypeId uint64) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Take(ticketType, ticketTypeId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@LockByIdTxn")
+	}
+	return result
+}
+
+func (r *TicketTypeRepository) SaveTxn(txn *gorm.DB, ticketType *model.TicketType) *gorm.DB {
+	result := txn.Save(ticketType)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@SaveTxn")
+	}
+	return result
+}
+
+// TakeTxn decrement the available tickets in a single statement. No row is affected when the ticket type is not on sale
+// or has less than the quantity left, so concurrent holds can never oversell the capacity
+func (r *TicketTypeRepository) TakeTxn(txn *gorm.DB, ticketTypeId uint64, quantity int) *gorm.DB {
+	result := txn.Model(&model.TicketType{}).
+		Where("ticket_type_id = ? AND on_sale = ? AND available >= ?", ticketTypeId, true, quantity).
+		Update("available", gorm.Expr("available - ?", quantity))
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@TakeTxn")
+	}
+	return result
+}
+
+// GiveBackTxn return the tickets of the released holds to the available tickets
+func (r *TicketTypeRepository) GiveBackTxn(txn *gorm.DB, ticketTypeId uint64, quantity int) *gorm.DB {
+	result := txn.Model(&model.TicketType{}).
+		Where("ticket_type_id = ?", ticketTypeId).
+		Update("available", gorm.Expr("LEAST(available + ?, capacity)", quantity))
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@GiveBackTxn")
+	}
+	return result
+}
+
+// UpdatePriceByCategoryTxn reprice every ticket type of the category
+func (r *TicketTypeRepository) UpdatePriceByCategoryTxn(txn *gorm.DB, categoryId uint64, price uint) *gorm.DB {
+	result := txn.Model(&model.TicketType{}).Where("price_category_id = ?", categoryId).Update("price", price)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@UpdatePriceByCategoryTxn")
+	}
+	return result
+}
+
+func (r *TicketTypeRepository) CountByCategory(categoryId uint64) (int64, error) {
+	var count int64
+	result := r.db.Model(&model.TicketType{}).Where("price_category_id = ?", categoryId).Count(&count)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@CountByCategory")
+	}
+	return count, result.Error
+}
+
+func (r *TicketTypeRepository) DeleteById(ticketTypeId uint64) *gorm.DB {
+	result := r.db.Delete(&model.TicketType{}, ticketTypeId)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "TicketTypeRepository@DeleteById")
+	}
+	return result
+}
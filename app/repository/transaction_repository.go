@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 type TransactionRepository struct {
@@ -16,7 +19,7 @@ func NewTransactionRepository(db *gorm.DB, log *util.LogUtil) *TransactionReposi
 }
 
 func (t *TransactionRepository) GetAllWithDetails(transactions *[]model.Transaction) *gorm.DB {
-	result := t.db.Joins("User").Joins("Seat").Find(transactions)
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").Find(transactions)
 	if result.Error != nil {
 		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetAllWithDetails")
 	}
@@ -31,16 +34,54 @@ func (t *TransactionRepository) GetBySeatTxn(txn *gorm.DB, transaction *model.Tr
 	return result
 }
 
-func (t *TransactionRepository) GetDetailsByLink(transaction *model.Transaction, link string) *gorm.DB {
-	result := t.db.Joins("User").Joins("Seat", t.db.Where(&model.Seat{Link: link})).First(transaction)
+// GetHoldsBySeatUserTxn get the reservations of the user on the seat that are reserved or waiting for the payment
+func (t *TransactionRepository) GetHoldsBySeatUserTxn(txn *gorm.DB, transactions *[]model.Transaction, seatId uint, userId uint64) *gorm.DB {
+	result := txn.Where("seat_id = ? AND user_id = ? AND confirmation IN ?", seatId, userId, []string{"reserved", "pending"}).Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetHoldsBySeatUserTxn")
+	}
+	return result
+}
+
+// LockByIdTxn get the transaction and lock it until the end of the database transaction
+func (t *TransactionRepository) LockByIdTxn(txn *gorm.DB, transaction *model.Transaction, transactionId uint64) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Where("transaction_id = ?", transactionId).Take(transaction)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@LockByIdTxn")
+	}
+	return result
+}
+
+// GetUnpricedHoldsByCategoryTxn get the reserved or pending seats and tickets of the category that have no locked price
+func (t *TransactionRepository) GetUnpricedHoldsByCategoryTxn(txn *gorm.DB, transactions *[]model.Transaction, categoryId uint64) *gorm.DB {
+	result := txn.Joins("Seat").Joins("TicketType").
+		Where(`transactions.price IS NULL AND transactions.confirmation IN ?`, []string{"reserved", "pending"}).
+		Where(`"Seat".price_category_id = ? OR "TicketType".price_category_id = ?`, categoryId, categoryId).
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetUnpricedHoldsByCategoryTxn")
+	}
+	return result
+}
+
+func (t *TransactionRepository) UpdateByIdTxn(txn *gorm.DB, transactionId uint64, columns map[string]any) *gorm.DB {
+	result := txn.Model(&model.Transaction{}).Where("transaction_id = ?", transactionId).Updates(columns)
 	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdateByIdTxn")
+	}
+	return result
+}
+
+func (t *TransactionRepository) GetDetailsByLink(transaction *model.Transaction, link string) *gorm.DB {
+	result := t.db.Joins("User").InnerJoins("Seat").Where(`"Seat".link = ?`, link).Take(transaction)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByLink")
 	}
 	return result
 }
 
 func (t *TransactionRepository) GetDetailsByUser(transactions *[]model.Transaction, userId uint64) *gorm.DB {
-	result := t.db.Joins("User").Joins("Seat").Where("transactions.user_id = ?", userId).Find(transactions)
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").Where("transactions.user_id = ?", userId).Find(transactions)
 	if result.Error != nil {
 		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByUser")
 	}
@@ -48,7 +89,7 @@ func (t *TransactionRepository) GetDetailsByUser(transactions *[]model.Transacti
 }
 
 func (t *TransactionRepository) GetDetailsByUserConfirmation(transactions *[]model.Transaction, userId uint64, confirmation string) *gorm.DB {
-	result := t.db.Joins("User").Joins("Seat").Where("transactions.user_id = ?", userId).Where("confirmation = ?", confirmation).Find(transactions)
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").Where("transactions.user_id = ?", userId).Where("confirmation = ?", confirmation).Find(transactions)
 	if result.Error != nil {
 		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByUser")
 	}
@@ -64,7 +105,7 @@ func (t *TransactionRepository) GetByOrder(transactions *[]model.Transaction, or
 }
 
 func (t *TransactionRepository) GetDetailsByOrder(transactions *[]model.Transaction, orderId string) *gorm.DB {
-	result := t.db.Joins("User").Joins("Seat").Where("transactions.order_id = ?", orderId).Find(transactions)
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").Where("transactions.order_id = ?", orderId).Find(transactions)
 	if result.Error != nil {
 		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByOrder")
 	}
@@ -87,10 +128,22 @@ func (t *TransactionRepository) UpdateUserPaymentStatus(userId uint64, orderId,
 	return result
 }
 
-func (t *TransactionRepository) UpdateUserOrderId(userId uint64, orderId string) *gorm.DB {
-	result := t.db.Model(&model.Transaction{}).Where("user_id = ? AND order_id = ?", userId, "").Update("order_id", orderId)
+// UpdateUserOrderId move the user's reserved seats and tickets to the order, including the ones left on an earlier
+// checkout that failed or was replaced
+func (t *TransactionRepository) UpdateUserOrderIdTxn(txn *gorm.DB, userId uint64, orderId string) *gorm.DB {
+	result := txn.Model(&model.Transaction{}).Where("user_id = ? AND confirmation = ?", userId, "reserved").Update("order_id", orderId)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdateUserOrderIdTxn")
+	}
+	return result
+}
+
+// ReopenByOrderTxn take the unpaid seats and tickets out of the order, they stay reserved for the next checkout
+func (t *TransactionRepository) ReopenByOrderTxn(txn *gorm.DB, orderId string) *gorm.DB {
+	result := txn.Model(&model.Transaction{}).Where("order_id = ? AND confirmation IN ?", orderId, []string{"reserved", "pending"}).
+		Updates(map[string]any{"order_id": "", "vendor": "no_vendor", "confirmation": "reserved"})
 	if result.Error != nil {
-		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdateUserOrderId")
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@ReopenByOrderTxn")
 	}
 	return result
 }
@@ -111,6 +164,14 @@ func (t *TransactionRepository) SoftDeleteBySeatUser(seatId uint, userId uint64)
 	return result
 }
 
+func (t *TransactionRepository) SoftDeleteBySeatUserTxn(txn *gorm.DB, seatId uint, userId uint64) *gorm.DB {
+	result := txn.Where("seat_id = ? AND user_id = ?", seatId, userId).Delete(&model.Transaction{})
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@SoftDeleteBySeatUserTxn")
+	}
+	return result
+}
+
 func (t *TransactionRepository) SoftDeleteByOrder(orderId string) *gorm.DB {
 	result := t.db.Where("order_id = ?", orderId).Delete(&model.Transaction{})
 	if result.Error != nil {
@@ -118,3 +179,180 @@ func (t *TransactionRepository) SoftDeleteByOrder(orderId string) *gorm.DB {
 	}
 	return result
 }
+
+func (t *TransactionRepository) UpdateInstruction(orderId, instruction string) *gorm.DB {
+	result := t.db.Model(&model.Transaction{}).Where("order_id = ?", orderId).Update("instruction", instruction)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdateInstruction")
+	}
+	return result
+}
+
+// GetUnremindedCreatedBetween get the unpaid holds created in the given time range that have not been reminded yet
+func (t *TransactionRepository) GetUnremindedCreatedBetween(transactions *[]model.Transaction, from, to time.Time) *gorm.DB {
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").
+		Where("transactions.confirmation IN ?", []string{"reserved", "pending"}).
+		Where("transactions.reminded_at IS NULL").
+		Where("transactions.created_at > ? AND transactions.created_at <= ?", from, to).
+		Order("transactions.transaction_id").
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetUnremindedCreatedBetween")
+	}
+	return result
+}
+
+// GetUnpaidCreatedBefore get the unpaid holds that are still active although they were created before the given time
+func (t *TransactionRepository) GetUnpaidCreatedBefore(transactions *[]model.Transaction, before time.Time) *gorm.DB {
+	result := t.db.
+		Where("confirmation IN ?", []string{"reserved", "pending"}).
+		Where("created_at <= ?", before).
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetUnpaidCreatedBefore")
+	}
+	return result
+}
+
+// GetUnnotifiedReleases get the unpaid holds (including the soft deleted one) that ended between the given time range
+// and the user has not been told yet. Holds that were replaced by a newer reservation of the same seat by the same user are skipped
+func (t *TransactionRepository) GetUnnotifiedReleases(transactions *[]model.Transaction, from, to time.Time) *gorm.DB {
+	result := t.db.Unscoped().Joins("User").Joins("Seat").Joins("TicketType").
+		Where("transactions.confirmation IN ?", []string{"reserved", "pending", "not_continued", "expire"}).
+		Where("transactions.released_at IS NULL").
+		Where("transactions.created_at > ?", from).
+		Where("transactions.created_at <= ? OR transactions.confirmation = ?", to, "expire").
+		Where("NOT EXISTS (SELECT 1 FROM transactions newer WHERE newer.seat_id = transactions.seat_id AND newer.user_id = transactions.user_id AND newer.transaction_id > transactions.transaction_id)").
+		Order("transactions.transaction_id").
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetUnnotifiedReleases")
+	}
+	return result
+}
+
+func (t *TransactionRepository) CountNewerBySeat(seatId uint, transactionId uint64) (int64, error) {
+	var count int64
+	result := t.db.Model(&model.Transaction{}).Where("seat_id = ? AND transaction_id > ?", seatId, transactionId).Count(&count)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@CountNewerBySeat")
+	}
+	return count, result.Error
+}
+
+func (t *TransactionRepository) UpdateByIds(transactionIds []uint64, column string, value any) *gorm.DB {
+	result := t.db.Unscoped().Model(&model.Transaction{}).Where("transaction_id IN ?", transactionIds).Update(column, value)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdateByIds")
+	}
+	return result
+}
+
+func (t *TransactionRepository) SoftDeleteById(transactionId uint64) *gorm.DB {
+	result := t.db.Delete(&model.Transaction{}, transactionId)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@SoftDeleteById")
+	}
+	return result
+}
+
+// GetTicketHolders get the settled transactions with the user and the seat or the ticket type, optionally narrowed to some sections
+// or rows of the venue layout (upper case section names or row labels) or to a post sale status. An empty post sale status
+// means the ticket holder has not attended
+func (t *TransactionRepository) GetTicketHolders(transactions *[]model.Transaction, sections []string, postSaleStatus *string) *gorm.DB {
+	query := t.db.Joins("User").Joins("Seat").Joins("TicketType").Where("transactions.confirmation = ?", "settlement")
+	if len(sections) > 0 { //only the seats placed on the venue layout belong to a section
+		query = query.
+			Joins(`JOIN venue_rows ON venue_rows.venue_row_id = "Seat".venue_row_id`).
+			Joins("JOIN venue_sections ON venue_sections.venue_section_id = venue_rows.venue_section_id").
+			Where("upper(venue_sections.name) IN ? OR upper(venue_rows.label) IN ?", sections, sections)
+	}
+	if postSaleStatus != nil {
+		query = query.Where(`COALESCE("Seat".post_sale_status, transactions.post_sale_status, '') = ?`, *postSaleStatus)
+	}
+	result := query.Order("transactions.user_id, transactions.transaction_id").Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetTicketHolders")
+	}
+	return result
+}
+
+// GetSettledSince get the settled transactions updated after the given time, the oldest first
+func (t *TransactionRepository) GetSettledSince(transactions *[]model.Transaction, since time.Time, limit int) *gorm.DB {
+	result := t.db.Joins("User").Joins("Seat").Joins("TicketType").
+		Where("transactions.confirmation = ?", "settlement").
+		Where("transactions.updated_at > ?", since).
+		Order("transactions.updated_at, transactions.transaction_id").
+		Limit(limit).
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetSettledSince")
+	}
+	return result
+}
+
+func (t *TransactionRepository) InsertOneTxn(txn *gorm.DB, tx *model.Transaction) *gorm.DB {
+	result := txn.Create(tx)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@InsertOneTxn")
+	}
+	return result
+}
+
+// GetDetailsByUsersTxn get the current holds and tickets of the accounts
+func (t *TransactionRepository) GetDetailsByUsersTxn(txn *gorm.DB, transactions *[]model.Transaction, userIds []uint64) *gorm.DB {
+	result := txn.Joins("Seat").Joins("TicketType").Where("transactions.user_id IN ?", userIds).Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByUsersTxn")
+	}
+	return result
+}
+
+func (t *TransactionRepository) GetDetailsByTicketCode(transaction *model.Transaction, ticketCode string) *gorm.DB {
+	result := t.db.Joins("User").Joins("TicketType").Where("transactions.ticket_code = ?", ticketCode).Take(transaction)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetDetailsByTicketCode")
+	}
+	return result
+}
+
+func (t *TransactionRepository) UpdatePostSaleStatusByTicketCode(ticketCode, status string) *gorm.DB {
+	result := t.db.Model(&model.Transaction{}).Where("ticket_code = ?", ticketCode).Update("post_sale_status", status)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@UpdatePostSaleStatusByTicketCode")
+	}
+	return result
+}
+
+// SoftDeleteByIdTxn end the hold, no row is affected when it has been ended already
+func (t *TransactionRepository) SoftDeleteByIdTxn(txn *gorm.DB, transactionId uint64) *gorm.DB {
+	result := txn.Delete(&model.Transaction{}, transactionId)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@SoftDeleteByIdTxn")
+	}
+	return result
+}
+
+// GetUnpaidByTicketTypeCreatedBeforeTxn get the unpaid general admission holds of the ticket type whose transaction time is over
+func (t *TransactionRepository) GetUnpaidByTicketTypeCreatedBeforeTxn(txn *gorm.DB, transactions *[]model.Transaction, ticketTypeId uint64, before time.Time) *gorm.DB {
+	result := txn.
+		Where("ticket_type_id = ?", ticketTypeId).
+		Where("confirmation IN ?", []string{"reserved", "pending"}).
+		Where("created_at <= ?", before).
+		Order("transaction_id").
+		Find(transactions)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@GetUnpaidByTicketTypeCreatedBeforeTxn")
+	}
+	return result
+}
+
+// CountByTicketType count every ticket of the ticket type, including the released holds
+func (t *TransactionRepository) CountByTicketType(ticketTypeId uint64) (int64, error) {
+	var count int64
+	result := t.db.Unscoped().Model(&model.Transaction{}).Where("ticket_type_id = ?", ticketTypeId).Count(&count)
+	if result.Error != nil {
+		t.log.BasicLog(result.Error, "TransactionRepotisoty@CountByTicketType")
+	}
+	return count, result.Error
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestTransactionRepository(t *testing.T) (*TransactionRepository, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.User{}, &model.Seat{}, &model.TicketType{}, &model.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(io.Discard)
+	return NewTransactionRepository(db, util.NewLogUtil(logrusLogger)), db
+}
+
+func TestTransactionRepositoryGetDetailsByLink(t *testing.T) {
+	txRepo, db := newTestTransactionRepository(t)
+	users := []model.User{{Name: "Chandra", Email: "chandra@example.com"}, {Name: "Dewi", Email: "dewi@example.com"}}
+	seats := []model.Seat{{Name: "H31", Link: "link-h31", Status: "purchased"}, {Name: "H32", Link: "link-h32", Status: "purchased"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&seats).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := range seats {
+		tx := model.Transaction{UserId: users[i].UserId, SeatId: &seats[i].SeatId, Vendor: "no_vendor", Confirmation: "settlement"}
+		if err := db.Create(&tx).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var transaction model.Transaction
+	if result := txRepo.GetDetailsByLink(&transaction, "link-h32"); result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if transaction.Seat.Name != "H32" || transaction.User.Email != "dewi@example.com" {
+		t.Errorf("expected the ticket of seat H32, got seat %q of %q", transaction.Seat.Name, transaction.User.Email)
+	}
+
+	var missing model.Transaction
+	if result := txRepo.GetDetailsByLink(&missing, "link-unknown"); !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		t.Errorf("expected not found for an unknown link, got %v with seat %q", result.Error, missing.Seat.Name)
+	}
+}
+
+func TestTransactionRepositoryGetDetailsByLinkSql(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=x"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(io.Discard)
+	txRepo := NewTransactionRepository(db, util.NewLogUtil(logrusLogger))
+
+	var transaction model.Transaction
+	sql := txRepo.GetDetailsByLink(&transaction, "link-h31").Statement.SQL.String()
+	if !strings.Contains(sql, `INNER JOIN "seats" "Seat"`) || !strings.Contains(sql, `"Seat".link = $1`) {
+		t.Errorf("expected the seat to be joined and filtered by the link, got %s", sql)
+	}
+}
@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -41,20 +44,9 @@ func (u *UserRepository) InsertOne(user *model.User) *gorm.DB {
 	return result
 }
 
-func (u *UserRepository) GetByPairs(userInput, userResult *model.User) *gorm.DB {
-	var result *gorm.DB
-	if result = u.db.Model(model.User{}).Where("name = ?", userInput.Name).Take(userResult); result.Error == nil {
-		return result
-	}
-	if result = u.db.Model(model.User{}).Where("email = ?", userInput.Email).Take(userResult); result.Error == nil {
-		return result
-	}
-	u.log.BasicLog(result.Error, "UserRepository@GetByPairs")
-	return result
-}
-
+// GetByEmail get the user of the email whatever its letter case, the oldest account when the email was registered twice
 func (u *UserRepository) GetByEmail(email string, userResult *model.User) *gorm.DB {
-	result := u.db.Where(model.User{}).Where("email = ?", email).First(userResult)
+	result := u.db.Where(model.User{}).Where("LOWER(email) = LOWER(?)", email).First(userResult)
 	if result.Error != nil {
 		u.log.BasicLog(result.Error, "-")
 	}
@@ -69,6 +61,32 @@ func (u *UserRepository) GetById(userId uint64, userResult *model.User) *gorm.DB
 	return result
 }
 
+func (u *UserRepository) GetByIdTxn(txn *gorm.DB, userId uint64, userResult *model.User) *gorm.DB {
+	result := txn.Take(userResult, userId)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@GetByIdTxn")
+	}
+	return result
+}
+
+// LockByIdsTxn lock the users until the end of the database transaction, in id order so two locks never wait for each other
+func (u *UserRepository) LockByIdsTxn(txn *gorm.DB, users *[]model.User, userIds []uint64) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Order("user_id").Find(users, userIds)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@LockByIdsTxn")
+	}
+	return result
+}
+
+// LockByIdTxn get the user and lock them until the end of the database transaction
+func (u *UserRepository) LockByIdTxn(txn *gorm.DB, user *model.User, userId uint64) *gorm.DB {
+	result := txn.Clauses(clause.Locking{Strength: "UPDATE"}).Take(user, userId)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@LockByIdTxn")
+	}
+	return result
+}
+
 func (u *UserRepository) UpdateById(userId uint64, userInput *model.User) *gorm.DB {
 	result := u.db.Model(model.User{}).Where("user_id = ?", userId).Updates(userInput)
 	if result.Error != nil {
@@ -76,3 +94,66 @@ func (u *UserRepository) UpdateById(userId uint64, userInput *model.User) *gorm.
 	}
 	return result
 }
+
+// UpdateFieldsById update the given columns, including the zero values that UpdateById skips
+func (u *UserRepository) UpdateFieldsById(userId uint64, fields map[string]any) *gorm.DB {
+	result := u.db.Model(model.User{}).Where("user_id = ?", userId).Updates(fields)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@UpdateFieldsById")
+	}
+	return result
+}
+
+func (u *UserRepository) GetStaff(users *[]model.User) *gorm.DB {
+	result := u.db.Where("role <> ''").Order("user_id").Find(users)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@GetStaff")
+	}
+	return result
+}
+
+// UpdateTotpCounter move the last used time step forward. Nothing is updated when the time step has been used
+func (u *UserRepository) UpdateTotpCounter(userId uint64, counter int64) *gorm.DB {
+	result := u.db.Model(model.User{}).Where("user_id = ? AND totp_counter < ?", userId, counter).Update("totp_counter", counter)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@UpdateTotpCounter")
+	}
+	return result
+}
+
+func (u *UserRepository) GetIdentity(provider, subject string, identity *model.UserIdentity) *gorm.DB {
+	result := u.db.Where("provider = ? AND subject = ?", provider, subject).Take(identity)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		u.log.BasicLog(result.Error, "UserRepository@GetIdentity")
+	}
+	return result
+}
+
+func (u *UserRepository) InsertIdentity(identity *model.UserIdentity) *gorm.DB {
+	result := u.db.Create(identity)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@InsertIdentity")
+	}
+	return result
+}
+
+func (u *UserRepository) UpdateIdentityById(identityId uint64, fields map[string]any) *gorm.DB {
+	result := u.db.Model(model.UserIdentity{}).Where("user_identity_id = ?", identityId).Updates(fields)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@UpdateIdentityById")
+	}
+	return result
+}
+
+// GetIdsByIdentityTxn get the accounts whose normalized email or phone is the given one, see util.NormalizeEmail and util.NormalizePhone
+func (u *UserRepository) GetIdsByIdentityTxn(txn *gorm.DB, userIds *[]uint64, email, phone string) *gorm.DB {
+	condition := `lower(regexp_replace(email, '\+[^@]*@', '@')) = @email`
+	if phone != "" {
+		condition += ` OR regexp_replace(regexp_replace(phone, '\D', '', 'g'), '^0', '62') = @phone`
+	}
+	result := txn.Model(&model.User{}).Where(condition, sql.Named("email", email), sql.Named("phone", phone)).Pluck("user_id", userIds)
+	if result.Error != nil {
+		u.log.BasicLog(result.Error, "UserRepository@GetIdsByIdentityTxn")
+	}
+	return result
+}
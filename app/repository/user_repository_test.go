@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserRepositoryGetByEmail(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatal(err)
+	}
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(io.Discard)
+	userRepo := NewUserRepository(db, util.NewLogUtil(logrusLogger))
+	users := []model.User{{Name: "Bob", Email: "Bob@Example.com"}, {Name: "Bob again", Email: "bob@example.com"}}
+	if err = db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"bob@example.com", "BOB@EXAMPLE.COM", "Bob@Example.com"} {
+		var user model.User
+		if result := userRepo.GetByEmail(email, &user); result.Error != nil || user.UserId != users[0].UserId {
+			t.Errorf("%s: expected the oldest account, got %+v %v", email, user, result.Error)
+		}
+	}
+	var missing model.User
+	if result := userRepo.GetByEmail("alice@example.com", &missing); result.Error == nil {
+		t.Errorf("expected no user for another email, got %+v", missing)
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+)
+
+type VenueRepository struct {
+	db  *gorm.DB
+	log *util.LogUtil
+}
+
+func NewVenueRepository(db *gorm.DB, log *util.LogUtil) *VenueRepository {
+	return &VenueRepository{db: db, log: log}
+}
+
+// GetLayout get the venue with its sections, rows and seats in the layout order
+func (r *VenueRepository) GetLayout(venue *model.Venue) *gorm.DB {
+	result := r.db.
+		Preload("Sections", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Sections.Rows", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Sections.Rows.Seats", func(db *gorm.DB) *gorm.DB { return db.Order("x") }).
+		Order("venue_id desc").First(venue)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "VenueRepository@GetLayout")
+	}
+	return result
+}
+
+// DeleteAllTxn remove the layout, the seats stay but are taken off the map
+func (r *VenueRepository) DeleteAllTxn(txn *gorm.DB) *gorm.DB {
+	result := txn.Model(&model.Seat{}).Where("venue_row_id IS NOT NULL").Update("venue_row_id", nil)
+	for _, table := range []any{&model.VenueRow{}, &model.VenueSection{}, &model.Venue{}} {
+		if result.Error != nil {
+			break
+		}
+		result = txn.Where("1 = 1").Delete(table)
+	}
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "VenueRepository@DeleteAllTxn")
+	}
+	return result
+}
+
+// InsertTxn create the venue with its sections and rows, the seats are created or, when they have an id, saved again
+func (r *VenueRepository) InsertTxn(txn *gorm.DB, venue *model.Venue) *gorm.DB {
+	result := txn.Session(&gorm.Session{FullSaveAssociations: true}).Create(venue)
+	if result.Error != nil {
+		r.log.BasicLog(result.Error, "VenueRepository@InsertTxn")
+	}
+	return result
+}
@@ -14,6 +14,9 @@ func NewRouter(
 	adminMiddleware *middleware.AdminMiddleware,
 	gateMiddleware *middleware.GateMiddleware,
 	qrMiddleware *middleware.ScanQrMiddleware,
+	rateLimitMiddleware *middleware.RateLimitMiddleware,
+	apiKeyMiddleware *middleware.ApiKeyMiddleware,
+	requestIdMiddleware *middleware.RequestIdMiddleware,
 
 	userController *controller.UserController,
 	authController *controller.AuthController,
@@ -22,6 +25,24 @@ func NewRouter(
 	snapController *controller.SnapController,
 	gateController *controller.ConfigController,
 	seatController *controller.SeatController,
+	emailController *controller.EmailController,
+	broadcastController *controller.BroadcastController,
+	sessionController *controller.SessionController,
+	jwksController *controller.JwksController,
+	staffController *controller.StaffController,
+	oidcController *controller.OidcController,
+	apiKeyController *controller.ApiKeyController,
+	integrationController *controller.IntegrationController,
+	auditController *controller.AuditController,
+	purchaseLimitController *controller.PurchaseLimitController,
+	venueController *controller.VenueController,
+	priceCategoryController *controller.PriceCategoryController,
+	ticketTypeController *controller.TicketTypeController,
+	promoCodeController *controller.PromoCodeController,
+	pricingRuleController *controller.PricingRuleController,
+	invoiceController *controller.InvoiceController,
+	orderController *controller.OrderController,
+	transferController *controller.TicketTransferController,
 ) *gin.Engine {
 	var router *gin.Engine
 	if config.IsProduction == true {
@@ -29,14 +50,27 @@ func NewRouter(
 	} else {
 		router = gin.Default()
 	}
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil { //the rate limits are keyed by the client ip, so it must not be spoofed
+		panic(err)
+	}
+	router.Use(requestIdMiddleware.HandleRequestId) //tie the logs and the audit events of one request together
+
+	//Public keys to verify the issued tokens
+	router.GET("/.well-known/jwks.json", jwksController.GetKeys)
 
 	//Public User Standard Auth Routes
 	public := router.Group("/api/v1").Use(gateMiddleware.HandleAccess)
-	public.POST("/user/refresh", authController.RefreshToken)
-	public.POST("user/register_email", authController.RegisterByEmail)
-	public.POST("user/otp", authController.VerifyOtp)
+	public.POST("/user/refresh", rateLimitMiddleware.Limit("refresh"), authController.RefreshToken)
+	public.POST("user/register_email", rateLimitMiddleware.Limit("otp_ip"), rateLimitMiddleware.Limit("otp_email"), authController.RegisterByEmail)
+	public.POST("user/otp", rateLimitMiddleware.Limit("otp_ip"), rateLimitMiddleware.Limit("otp_email"), authController.VerifyOtp)
 	public.Use(gateMiddleware.HandleAccess).GET("/seat_map", reservationController.GetSeatsInfo)
-	public.POST("/user/login", authController.Login)
+	public.GET("/venue/seat_map", venueController.GetSeatMap)
+	public.GET("/price_categories", priceCategoryController.GetAll)
+	public.GET("/ticket_types", ticketTypeController.GetAll)
+	public.GET("/user/oidc", oidcController.GetProviders)
+	public.GET("/user/oidc/:provider", rateLimitMiddleware.Limit("login"), oidcController.Authorize)
+	public.POST("/user/oidc/:provider/callback", rateLimitMiddleware.Limit("login"), oidcController.Callback)
+	public.POST("/staff/login", rateLimitMiddleware.Limit("login"), staffController.Login)
 
 	//public.POST("/user/register", authController.Register) //This route is no longer needed for current GMCO's ticketing case,
 	//public.POST("/user/sign_in", authController.SignIn) //but the code implementation in the controller is still remain in case of future use
@@ -46,30 +80,96 @@ func NewRouter(
 
 	//Midtrans Webhook
 	webhook := router.Group("api/v1")
-	webhook.POST("/snap/payment/callback", snapController.HandleCallback)
+	webhook.POST("/snap/payment/callback", rateLimitMiddleware.Webhook(), snapController.HandleCallback)
+
+	//Integration Routes, authenticated by an api key instead of a user token
+	integration := router.Group("/api/v1/integration")
+	integration.GET("/sales/summary", apiKeyMiddleware.ApiKeyAccess("sales:read"), rateLimitMiddleware.Limit("integration"), integrationController.GetSalesSummary)
+	integration.GET("/sales", apiKeyMiddleware.ApiKeyAccess("sales:read"), rateLimitMiddleware.Limit("integration"), integrationController.GetSales)
+	integration.POST("/complimentary", apiKeyMiddleware.ApiKeyAccess("tickets:comp"), rateLimitMiddleware.Limit("integration"), integrationController.IssueComplimentary)
 
 	//Logged-In User Routes
 	user := router.Group("/api/v1").Use(gateMiddleware.HandleAccess).Use(userMiddleware.UserAccess)
 	user.POST("/user/logout", authController.Logout)
 	user.GET("/user", userController.CurrentUser)
+	user.GET("/user/sessions", sessionController.GetAll)
+	user.DELETE("/user/sessions", sessionController.RevokeAll)
+	user.DELETE("/user/sessions/:session_id", sessionController.Revoke)
 
 	//Logged-In User Ticketing Routes
 	user.Use(gateMiddleware.HandleAccess).PATCH("/user", userController.UpdateInfo)
-	user.Use(gateMiddleware.HandleAccess).POST("/seat_map", reservationController.ReserveSeats)
+	user.Use(gateMiddleware.HandleAccess).POST("/seat_map", rateLimitMiddleware.Limit("reserve"), reservationController.ReserveSeats)
 	user.GET("/checkout", txController.GetNewTransactionDetails)
-	user.POST("/checkout", txController.InitiateTransaction)
+	user.POST("/checkout", rateLimitMiddleware.Limit("checkout"), txController.InitiateTransaction)
+	user.GET("/user/invoices/:order_id", invoiceController.GetPdf)
+	user.GET("/user/orders", orderController.UserGetAll)
+	user.GET("/user/orders/:order_id", orderController.UserGetById)
+	user.GET("/user/transfers", transferController.GetAll)
+	user.POST("/user/transfers", rateLimitMiddleware.Limit("transfer"), transferController.Create)
+	user.POST("/user/transfers/:transfer_id/accept", transferController.Accept)
+	user.POST("/user/transfers/:transfer_id/cancel", transferController.Cancel)
+
+	//Staff Routes, for the admin and the gate staff
+	staff := router.Group("/api/v1").Use(adminMiddleware.StaffAccess)
+	staff.GET("/staff", userController.CurrentUser)
+	staff.PATCH("/staff/password", staffController.ChangePassword)
+	staff.POST("/staff/totp", staffController.EnrollTotp)
+	staff.POST("/staff/totp/confirm", staffController.ConfirmTotp)
+	staff.POST("/staff/totp/disable", staffController.DisableTotp)
+	staff.POST("/staff/recovery_codes", staffController.RegenerateRecoveryCodes)
+	staff.GET("/admin/seat/:link", seatController.DetailsByLink)
+	staff.GET("/admin/seat/attended/:link", seatController.UpdateToAttended)
+	staff.GET("/admin/seat/exchanged/:link", seatController.UpdateToExchanged)
 
 	//Admin Routes
 	admin := router.Group("/api/v1").Use(adminMiddleware.AdminAccess)
-	admin.GET("/admin/seat/:link", seatController.DetailsByLink)
 	admin.PUT("/admin/seat/:link", seatController.UpdateByLink)
-	admin.GET("/admin/seat/attended/:link", seatController.UpdateToAttended)
-	admin.GET("/admin/seat/exchanged/:link", seatController.UpdateToExchanged)
 	admin.POST("/admin/open_the_gate", gateController.OpenGate)
 	admin.POST("/admin/close_the_gate", gateController.CloseGate)
 	admin.PATCH("/admin/qr_scan_behaviour", gateController.UpdateQrScanBehaviour)
 	admin.GET("/admin/get_app_config", gateController.GetAppConfig)
 	admin.GET("/admin/seats", seatController.AllDetails)
+	admin.GET("/admin/emails", emailController.GetAll)
+	admin.GET("/admin/emails/:email_id", emailController.GetById)
+	admin.POST("/admin/emails/:email_id/resend", emailController.Resend)
+	admin.POST("/admin/users/:user_id/logout", sessionController.ForceLogout)
+	admin.GET("/admin/broadcasts", broadcastController.GetAll)
+	admin.POST("/admin/broadcasts", broadcastController.Create)
+	admin.GET("/admin/broadcasts/recipients_count", broadcastController.CountRecipients)
+	admin.GET("/admin/broadcasts/:broadcast_id", broadcastController.GetById)
+	admin.POST("/admin/broadcasts/:broadcast_id/cancel", broadcastController.Cancel)
+	admin.GET("/admin/staff", staffController.GetAll)
+	admin.GET("/admin/api_keys", apiKeyController.GetAll)
+	admin.POST("/admin/api_keys", apiKeyController.Create)
+	admin.POST("/admin/api_keys/:api_key_id/revoke", apiKeyController.Revoke)
+	admin.POST("/admin/staff", staffController.Create)
+	admin.GET("/admin/audit_events", auditController.GetAll)
+	admin.GET("/admin/audit_events/export", auditController.Export)
+	admin.PUT("/admin/venue", venueController.Import)
+	admin.POST("/admin/price_categories", priceCategoryController.Create)
+	admin.PUT("/admin/price_categories/:price_category_id", priceCategoryController.Update)
+	admin.PUT("/admin/price_categories/:price_category_id/seats", priceCategoryController.AssignSeats)
+	admin.DELETE("/admin/price_categories/:price_category_id", priceCategoryController.Delete)
+	admin.POST("/admin/ticket_types", ticketTypeController.Create)
+	admin.PUT("/admin/ticket_types/:ticket_type_id", ticketTypeController.Update)
+	admin.DELETE("/admin/ticket_types/:ticket_type_id", ticketTypeController.Delete)
+	admin.GET("/admin/promo_codes", promoCodeController.GetAll)
+	admin.POST("/admin/promo_codes", promoCodeController.Create)
+	admin.PUT("/admin/promo_codes/:promo_code_id", promoCodeController.Update)
+	admin.DELETE("/admin/promo_codes/:promo_code_id", promoCodeController.Delete)
+	admin.GET("/admin/promo_codes/:promo_code_id/redemptions", promoCodeController.GetRedemptions)
+	admin.GET("/admin/pricing_rules", pricingRuleController.GetAll)
+	admin.POST("/admin/pricing_rules", pricingRuleController.Create)
+	admin.PUT("/admin/pricing_rules/:pricing_rule_id", pricingRuleController.Update)
+	admin.DELETE("/admin/pricing_rules/:pricing_rule_id", pricingRuleController.Delete)
+	admin.GET("/admin/invoices/:order_id", invoiceController.AdminGetPdf)
+	admin.GET("/admin/orders", orderController.GetAll)
+	admin.GET("/admin/orders/:order_id", orderController.GetById)
+	admin.GET("/admin/purchase_limits", purchaseLimitController.GetAll)
+	admin.PUT("/admin/purchase_limits", purchaseLimitController.SetLimit)
+	admin.DELETE("/admin/purchase_limits/:purchase_limit_id", purchaseLimitController.DeleteLimit)
+	admin.PUT("/admin/purchase_limit_overrides/:user_id", purchaseLimitController.SetOverride)
+	admin.DELETE("/admin/purchase_limit_overrides/:user_id", purchaseLimitController.DeleteOverride)
 
 	return router
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrApiKeyInvalid = errors.New("the api key is invalid, expired or revoked")
+
+const apiKeyTouchInterval = time.Minute //the last use is written at most once per interval, not on every request
+
+type ApiKeyService struct {
+	apiKeyRepo   *repository.ApiKeyRepository
+	auditService *AuditService
+	log          *util.LogUtil
+}
+
+func NewApiKeyService(apiKeyRepo *repository.ApiKeyRepository, auditService *AuditService, log *util.LogUtil) *ApiKeyService {
+	return &ApiKeyService{apiKeyRepo: apiKeyRepo, auditService: auditService, log: log}
+}
+
+// Create issue a new key. It returns the key itself, it is only shown once
+func (s *ApiKeyService) Create(name string, scopes []string, expiresAt *time.Time, createdBy uint64, actor util.Actor) (model.ApiKey, string, error) {
+	for _, scope := range scopes {
+		if !util.Contains(model.ApiKeyScopes, scope) {
+			return model.ApiKey{}, "", errors.New("unknown scope " + scope + ", use " + strings.Join(model.ApiKeyScopes, " or "))
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return model.ApiKey{}, "", errors.New("the expiry time has passed")
+	}
+	prefix := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return model.ApiKey{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return model.ApiKey{}, "", err
+	}
+	apiKey := model.ApiKey{
+		Name:      name,
+		Prefix:    "gmco_" + hex.EncodeToString(prefix),
+		Scopes:    strings.Join(scopes, ","),
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+	}
+	rawKey := apiKey.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey.KeyHash = hashApiKey(rawKey)
+	if result := s.apiKeyRepo.InsertOne(&apiKey); result.Error != nil {
+		return apiKey, "", errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "api_key_created", "api_key", strconv.FormatUint(apiKey.ApiKeyId, 10), nil, apiKey)
+	return apiKey, rawKey, nil
+}
+
+func (s *ApiKeyService) GetAll() ([]model.ApiKey, error) {
+	var apiKeys []model.ApiKey
+	if result := s.apiKeyRepo.GetAll(&apiKeys); result.Error != nil {
+		return apiKeys, errors.New("database operation error")
+	}
+	return apiKeys, nil
+}
+
+func (s *ApiKeyService) Revoke(apiKeyId uint64, actor util.Actor) error {
+	result := s.apiKeyRepo.RevokeById(apiKeyId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return errors.New("cannot find this api key or it is already revoked")
+	}
+	s.auditService.Record(actor, "api_key_revoked", "api_key", strconv.FormatUint(apiKeyId, 10), nil, nil)
+	return nil
+}
+
+// Authenticate find the active key of the given raw key and record its use
+func (s *ApiKeyService) Authenticate(rawKey, clientIp string) (model.ApiKey, error) {
+	var apiKey model.ApiKey
+	result := s.apiKeyRepo.GetByHash(&apiKey, hashApiKey(rawKey))
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return apiKey, ErrApiKeyInvalid
+	} else if result.Error != nil {
+		return apiKey, errors.New("database operation error")
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now)) {
+		return apiKey, ErrApiKeyInvalid
+	}
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval || apiKey.LastUsedIp != clientIp {
+		s.apiKeyRepo.UpdateById(apiKey.ApiKeyId, map[string]any{"last_used_at": now, "last_used_ip": clientIp})
+	}
+	return apiKey, nil
+}
+
+// HasScope check if the key has been given the scope
+func (s *ApiKeyService) HasScope(apiKey model.ApiKey, scope string) bool {
+	return util.Contains(strings.Split(apiKey.Scopes, ","), scope)
+}
+
+// hashApiKey use a plain sha256, the key is random enough that a slow hash adds nothing
+func hashApiKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"io"
+	"strconv"
+	"time"
+)
+
+type AuditService struct {
+	auditRepo *repository.AuditEventRepository
+	log       *util.LogUtil
+}
+
+func NewAuditService(auditRepo *repository.AuditEventRepository, log *util.LogUtil) *AuditService {
+	return &AuditService{auditRepo: auditRepo, log: log}
+}
+
+// Record store the change made by the actor. The before and after values are stored as json, nil means there is none.
+// A failure is only logged, the change itself has already happened
+func (s *AuditService) Record(actor util.Actor, action, targetType, targetId string, before, after any) {
+	event := model.AuditEvent{
+		ActorType:  actor.Type,
+		ActorId:    actor.Id,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Before:     encodeAuditValue(before),
+		After:      encodeAuditValue(after),
+		Ip:         actor.Ip,
+		RequestId:  actor.RequestId,
+	}
+	if result := s.auditRepo.InsertOne(&event); result.Error != nil {
+		s.log.Log.
+			WithField("occurrence", "AuditService@Record").
+			WithField("action", action).
+			WithField("target_id", targetId).
+			Error("cannot store the audit event")
+	}
+	s.log.AuditLog(action, map[string]any{
+		"actor_type":  actor.Type,
+		"actor_id":    actor.Id,
+		"target_type": targetType,
+		"target_id":   targetId,
+		"client_ip":   actor.Ip,
+		"request_id":  actor.RequestId,
+	})
+}
+
+func (s *AuditService) Find(filter repository.AuditEventFilter, page, perPage int) ([]model.AuditEvent, int64, error) {
+	var events []model.AuditEvent
+	if result := s.auditRepo.Find(&events, filter, perPage, (page-1)*perPage); result.Error != nil {
+		return nil, 0, errors.New("database operation error")
+	}
+	total, err := s.auditRepo.Count(filter)
+	if err != nil {
+		return nil, 0, errors.New("database operation error")
+	}
+	return events, total, nil
+}
+
+// ExportCsv write every matching event to the writer as csv, the oldest first
+func (s *AuditService) ExportCsv(filter repository.AuditEventFilter, writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	header := []string{"audit_event_id", "created_at", "actor_type", "actor_id", "action", "target_type", "target_id", "before", "after", "ip", "request_id"}
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+	err := s.auditRepo.FindInBatches(filter, 500, func(events []model.AuditEvent) error {
+		for _, event := range events {
+			record := []string{
+				strconv.FormatUint(event.AuditEventId, 10),
+				event.CreatedAt.Format(time.RFC3339),
+				event.ActorType,
+				csvSafe(event.ActorId),
+				event.Action,
+				event.TargetType,
+				csvSafe(event.TargetId), //may come from the request data
+				csvSafe(derefString(event.Before)),
+				csvSafe(derefString(event.After)),
+				event.Ip,
+				event.RequestId,
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	})
+	if err != nil {
+		return err
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func encodeAuditValue(value any) *string {
+	if value == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	result := string(encoded)
+	return &result
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// csvSafe stop a spreadsheet from running a cell as a formula
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
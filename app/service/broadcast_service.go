@@ -0,0 +1,299 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// the event day reminder, the start time is filled in when it is scheduled
+const (
+	eventReminderSubject = "See you at the event today, {{ .Name }}"
+	eventReminderBody    = "Hi {{ .Name }}, the event starts at %s. Your seats: {{ .Seats }}. Please bring your e-ticket to the gate."
+)
+
+type BroadcastService struct {
+	config        *config.AppConfig
+	db            *gorm.DB
+	broadcastRepo *repository.BroadcastRepository
+	txRepo        *repository.TransactionRepository
+	emailService  *EmailService
+	auditService  *AuditService
+	log           *util.LogUtil
+}
+
+func NewBroadcastService(config *config.AppConfig, db *gorm.DB, broadcastRepo *repository.BroadcastRepository, txRepo *repository.TransactionRepository, emailService *EmailService, auditService *AuditService, log *util.LogUtil) *BroadcastService {
+	return &BroadcastService{config: config, db: db, broadcastRepo: broadcastRepo, txRepo: txRepo, emailService: emailService, auditService: auditService, log: log}
+}
+
+// ticketHolder is one user with every seat the user has paid for that match the broadcast target
+type ticketHolder struct {
+	user  model.User
+	seats []string
+}
+
+func (s *BroadcastService) Create(subject, body, target, targetValue string, scheduledAt *time.Time, actor util.Actor) (model.Broadcast, error) {
+	broadcast := model.Broadcast{
+		Kind:        "manual",
+		Subject:     subject,
+		Body:        body,
+		Target:      target,
+		TargetValue: strings.Join(splitTargetValue(targetValue), ","),
+		Status:      "scheduled",
+		ScheduledAt: time.Now(), //send on the next worker tick when there is no schedule
+	}
+	if scheduledAt != nil {
+		broadcast.ScheduledAt = *scheduledAt
+	}
+	if _, _, err := targetFilter(broadcast); err != nil {
+		return broadcast, err
+	}
+	if _, err := personalize(subject, "Name", []string{"A1"}); err != nil { //fail early when the placeholders are invalid
+		return broadcast, errors.New("invalid subject: " + err.Error())
+	}
+	if _, err := personalize(body, "Name", []string{"A1"}); err != nil {
+		return broadcast, errors.New("invalid body: " + err.Error())
+	}
+	if result := s.broadcastRepo.InsertOne(&broadcast); result.Error != nil {
+		return broadcast, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "broadcast_created", "broadcast", strconv.FormatUint(broadcast.BroadcastId, 10), nil, broadcast)
+	return broadcast, nil
+}
+
+func (s *BroadcastService) GetAll(status string) ([]model.Broadcast, error) {
+	var broadcasts []model.Broadcast
+	if result := s.broadcastRepo.GetAll(&broadcasts, status); result.Error != nil {
+		return broadcasts, errors.New("database operation error")
+	}
+	return broadcasts, nil
+}
+
+func (s *BroadcastService) GetById(broadcastId uint64) (model.Broadcast, error) {
+	var broadcast model.Broadcast
+	if result := s.broadcastRepo.GetById(&broadcast, broadcastId); result.Error != nil {
+		return broadcast, errors.New("cannot find this broadcast")
+	}
+	return broadcast, nil
+}
+
+// CountRecipients tell how many ticket holders a broadcast with the given target would reach
+func (s *BroadcastService) CountRecipients(target, targetValue string) (int, error) {
+	holders, err := s.ticketHolders(model.Broadcast{Target: target, TargetValue: targetValue})
+	if err != nil {
+		return 0, err
+	}
+	return len(holders), nil
+}
+
+func (s *BroadcastService) Cancel(broadcastId uint64, actor util.Actor) (model.Broadcast, error) {
+	result := s.broadcastRepo.UpdateStatusFrom(broadcastId, "scheduled", "cancelled")
+	if result.Error != nil {
+		return model.Broadcast{}, errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return model.Broadcast{}, errors.New("only a scheduled broadcast can be cancelled")
+	}
+	s.auditService.Record(actor, "broadcast_cancelled", "broadcast", strconv.FormatUint(broadcastId, 10), map[string]any{"status": "scheduled"}, map[string]any{"status": "cancelled"})
+	return s.GetById(broadcastId)
+}
+
+// DispatchDue queue the emails of every broadcast whose schedule has passed, the event day reminder is scheduled first.
+// It returns the number of processed broadcasts
+func (s *BroadcastService) DispatchDue() (int, error) {
+	if err := s.scheduleEventReminder(); err != nil {
+		s.log.BasicLog(err, "BroadcastService@DispatchDue@scheduleEventReminder")
+	}
+	var broadcasts []model.Broadcast
+	if err := s.broadcastRepo.ClaimDue(&broadcasts, 10*time.Minute); err != nil {
+		return 0, errors.New("database operation error")
+	}
+	for _, broadcast := range broadcasts {
+		if err := s.dispatch(broadcast); err != nil {
+			s.log.Log.
+				WithField("occurrence", "BroadcastService@DispatchDue").
+				WithField("broadcast_id", broadcast.BroadcastId).
+				Error(err.Error())
+		}
+	}
+	return len(broadcasts), nil
+}
+
+func (s *BroadcastService) dispatch(broadcast model.Broadcast) error {
+	holders, err := s.ticketHolders(broadcast)
+	if err != nil {
+		return err
+	}
+	sentUserIds, err := s.broadcastRepo.GetRecipientUserIds(broadcast.BroadcastId) //the recipients of an interrupted dispatch are skipped
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	sent := make(map[uint64]bool, len(sentUserIds))
+	for _, userId := range sentUserIds {
+		sent[userId] = true
+	}
+
+	for _, holder := range holders {
+		if sent[holder.user.UserId] {
+			continue
+		}
+		subject, _ := personalize(broadcast.Subject, holder.user.Name, holder.seats) //the placeholders are validated on create
+		body, _ := personalize(broadcast.Body, holder.user.Name, holder.seats)
+		data := map[string]any{
+			"Name":    holder.user.Name,
+			"Seats":   holder.seats,
+			"Subject": subject,
+			"Body":    body,
+		}
+		txn := s.db.Begin() //START DATABASE TRANSACTION
+		if txn.Error != nil {
+			return errors.New("database operation error")
+		}
+		outbox, err := s.emailService.QueueTxn(txn, "broadcast", holder.user.Locale, data, holder.user.Email)
+		if err != nil {
+			txn.Rollback()
+			return err
+		}
+		recipient := model.BroadcastRecipient{
+			BroadcastId:   broadcast.BroadcastId,
+			UserId:        holder.user.UserId,
+			Email:         holder.user.Email,
+			Seats:         strings.Join(holder.seats, ","),
+			EmailOutboxId: outbox.EmailOutboxId,
+		}
+		if result := s.broadcastRepo.InsertRecipientTxn(txn, &recipient); result.Error != nil { //the email is queued only with its recipient, so a retried dispatch does not send it twice
+			txn.Rollback()
+			return errors.New("database operation error")
+		}
+		if err = txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+			return errors.New("database operation error")
+		}
+		s.broadcastRepo.UpdateById(broadcast.BroadcastId, map[string]any{"updated_at": time.Now()}) //keep the claim alive while sending
+	}
+
+	count, err := s.broadcastRepo.CountRecipients(broadcast.BroadcastId)
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	if result := s.broadcastRepo.UpdateById(broadcast.BroadcastId, map[string]any{"status": "sent", "sent_at": time.Now(), "recipient_count": count}); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// scheduleEventReminder add the event day reminder to every ticket holder as a broadcast, so the admin sees it and can
+// cancel it like any other broadcast. The reminder follows a new event start while it is still scheduled
+func (s *BroadcastService) scheduleEventReminder() error {
+	if s.config.EventStartsAt == nil || s.config.EventReminderLead <= 0 {
+		return nil
+	}
+	scheduledAt := s.config.EventStartsAt.Add(-s.config.EventReminderLead)
+	body := fmt.Sprintf(eventReminderBody, s.config.EventStartsAt.Format("15:04 on 02 Jan 2006"))
+	var reminder model.Broadcast
+	if result := s.broadcastRepo.GetByKind(&reminder, "event_reminder"); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if time.Now().After(*s.config.EventStartsAt) { //too late to remind
+			return nil
+		}
+		reminder = model.Broadcast{Kind: "event_reminder", Subject: eventReminderSubject, Body: body, Target: "all", Status: "scheduled", ScheduledAt: scheduledAt}
+		if result := s.broadcastRepo.InsertOne(&reminder); result.Error != nil {
+			return errors.New("database operation error")
+		}
+		s.auditService.Record(util.SystemActor("broadcast_worker"), "broadcast_created", "broadcast", strconv.FormatUint(reminder.BroadcastId, 10), nil, reminder)
+		return nil
+	} else if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if reminder.Status == "scheduled" && (!reminder.ScheduledAt.Equal(scheduledAt) || reminder.Body != body) {
+		if result := s.broadcastRepo.UpdateByIdWithStatus(reminder.BroadcastId, "scheduled", map[string]any{"scheduled_at": scheduledAt, "body": body}); result.Error != nil {
+			return errors.New("database operation error")
+		}
+	}
+	return nil
+}
+
+func (s *BroadcastService) ticketHolders(broadcast model.Broadcast) ([]ticketHolder, error) {
+	sections, postSaleStatus, err := targetFilter(broadcast)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []model.Transaction
+	if result := s.txRepo.GetTicketHolders(&transactions, sections, postSaleStatus); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+
+	var holders []ticketHolder
+	index := make(map[uint64]int)
+	for _, tx := range transactions { //one email per user, listing all of the user's matching seats
+		i, ok := index[tx.UserId]
+		if !ok {
+			i = len(holders)
+			index[tx.UserId] = i
+			holders = append(holders, ticketHolder{user: tx.User})
+		}
+		holders[i].seats = append(holders[i].seats, TicketSeat(tx).Name)
+	}
+	return holders, nil
+}
+
+// targetFilter translate the broadcast target to the venue sections or rows or the post sale status of the ticket holders query
+func targetFilter(broadcast model.Broadcast) ([]string, *string, error) {
+	values := splitTargetValue(broadcast.TargetValue)
+	switch broadcast.Target {
+	case "all":
+		return nil, nil, nil
+	case "section":
+		if len(values) < 1 {
+			return nil, nil, errors.New("section target needs the venue sections or rows, for example Balcony or A,B,C")
+		}
+		for i, section := range values {
+			values[i] = strings.ToUpper(section)
+		}
+		return values, nil, nil
+	case "attendance":
+		if len(values) != 1 {
+			return nil, nil, errors.New("attendance target needs one of attended, exchanged or absent")
+		}
+		status := values[0]
+		switch status {
+		case "attended", "exchanged":
+		case "absent":
+			status = ""
+		default:
+			return nil, nil, errors.New("attendance target needs one of attended, exchanged or absent")
+		}
+		return nil, &status, nil
+	}
+	return nil, nil, errors.New("unknown target, use all, section or attendance")
+}
+
+func splitTargetValue(targetValue string) []string {
+	var values []string
+	for _, value := range strings.Split(targetValue, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// personalize fill the {{ .Name }} and {{ .Seats }} placeholders written by the admin
+func personalize(text, name string, seats []string) (string, error) {
+	tmpl, err := template.New("broadcast").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, map[string]any{"Name": name, "Seats": strings.Join(seats, ", ")}); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
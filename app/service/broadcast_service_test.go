@@ -0,0 +1,96 @@
+package service
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBroadcastService(t *testing.T, eventStartsAt time.Time) (*BroadcastService, *config.AppConfig, *EmailService) {
+	emailService, db := newTestEmailService(t, util.NewMemoryMailer())
+	if err := db.AutoMigrate(&model.User{}, &model.Seat{}, &model.TicketType{}, &model.Transaction{}, &model.Broadcast{}, &model.BroadcastRecipient{}); err != nil {
+		t.Fatal(err)
+	}
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(io.Discard)
+	log := util.NewLogUtil(logrusLogger)
+	appConfig := &config.AppConfig{EventStartsAt: &eventStartsAt, EventReminderLead: 3 * time.Hour}
+	auditService := NewAuditService(repository.NewAuditEventRepository(db, log), log)
+	broadcastService := NewBroadcastService(appConfig, db, repository.NewBroadcastRepository(db, log), repository.NewTransactionRepository(db, log), emailService, auditService, log)
+
+	user := model.User{Name: "Chandra", Email: "chandra@example.com", Locale: "en"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	seat := model.Seat{Name: "H31", Link: "link-h31", Status: "purchased"}
+	if err := db.Create(&seat).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.Transaction{UserId: user.UserId, SeatId: &seat.SeatId, Vendor: "bank_transfer", Confirmation: "settlement"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return broadcastService, appConfig, emailService
+}
+
+func TestBroadcastServiceEventReminder(t *testing.T) {
+	startsAt := time.Now().Add(5 * time.Hour)
+	broadcastService, appConfig, emailService := newTestBroadcastService(t, startsAt)
+
+	if _, err := broadcastService.DispatchDue(); err != nil {
+		t.Fatal(err)
+	}
+	broadcasts, _ := broadcastService.GetAll("")
+	if len(broadcasts) != 1 || broadcasts[0].Kind != "event_reminder" || broadcasts[0].Status != "scheduled" || !broadcasts[0].ScheduledAt.Equal(startsAt.Add(-3*time.Hour)) {
+		t.Fatalf("expected the reminder to be scheduled 3 hours before the event, got %+v", broadcasts)
+	}
+
+	movedStartsAt := time.Now().Add(2 * time.Hour) //the event is moved, the reminder is now due
+	appConfig.EventStartsAt = &movedStartsAt
+	if _, err := broadcastService.DispatchDue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := broadcastService.DispatchDue(); err != nil {
+		t.Fatal(err)
+	}
+	reminder, err := broadcastService.GetById(broadcasts[0].BroadcastId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reminder.Status != "sent" || reminder.RecipientCount != 1 || !strings.Contains(reminder.Body, movedStartsAt.Format("15:04")) {
+		t.Errorf("expected the moved reminder to be sent once, got %+v", reminder)
+	}
+	if broadcasts, _ = broadcastService.GetAll(""); len(broadcasts) != 1 {
+		t.Errorf("the reminder must only be scheduled once, got %d broadcasts", len(broadcasts))
+	}
+	outboxes, err := emailService.GetAll("queued")
+	if err != nil || len(outboxes) != 1 || outboxes[0].Kind != "broadcast" || outboxes[0].Receiver != "chandra@example.com" {
+		t.Fatalf("expected 1 queued reminder email, got %+v %v", outboxes, err)
+	}
+	if len(reminder.Recipients) != 1 || reminder.Recipients[0].EmailOutboxId != outboxes[0].EmailOutboxId {
+		t.Errorf("expected the recipient to point at its email, got %+v", reminder.Recipients)
+	}
+}
+
+func TestBroadcastServiceEventReminderDisabled(t *testing.T) {
+	broadcastService, appConfig, _ := newTestBroadcastService(t, time.Now().Add(5*time.Hour))
+	appConfig.EventReminderLead = 0
+	if _, err := broadcastService.DispatchDue(); err != nil {
+		t.Fatal(err)
+	}
+	if broadcasts, _ := broadcastService.GetAll(""); len(broadcasts) != 0 {
+		t.Errorf("expected no reminder without a lead time, got %+v", broadcasts)
+	}
+
+	startedAt := time.Now().Add(-time.Hour)
+	appConfig.EventStartsAt, appConfig.EventReminderLead = &startedAt, 3*time.Hour
+	broadcastService.DispatchDue()
+	if broadcasts, _ := broadcastService.GetAll(""); len(broadcasts) != 0 {
+		t.Errorf("expected no reminder once the event has started, got %+v", broadcasts)
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+)
+
+// ConfigService change the runtime settings of the gate, they are kept in memory until the app restarts
+type ConfigService struct {
+	config       *config.AppConfig
+	auditService *AuditService
+}
+
+func NewConfigService(config *config.AppConfig, auditService *AuditService) *ConfigService {
+	return &ConfigService{config: config, auditService: auditService}
+}
+
+func (s *ConfigService) SetOpenGate(isOpenGate bool, actor util.Actor) {
+	action := "gate_closed"
+	if isOpenGate {
+		action = "gate_opened"
+	}
+	s.auditService.Record(actor, action, "config", "is_open_gate", s.config.IsOpenGate, isOpenGate)
+	s.config.IsOpenGate = isOpenGate
+}
+
+func (s *ConfigService) SetQrScanBehaviour(behaviour string, actor util.Actor) error {
+	if behaviour != "open_gate" && behaviour != "ticket_exchanging" {
+		return errors.New("the qr scan behaviour is open_gate or ticket_exchanging")
+	}
+	s.auditService.Record(actor, "qr_scan_behaviour_updated", "config", "qr_scan_behaviour", s.config.QrScanBehaviour, behaviour)
+	s.config.QrScanBehaviour = behaviour
+	return nil
+}
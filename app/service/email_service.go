@@ -0,0 +1,308 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"math"
+	"strconv"
+	"time"
+)
+
+// secretFields are the template data that must not outlive the delivery nor be shown to the admin, like the login code
+var secretFields = map[string][]string{"totp": {"Totp"}}
+
+type EmailService struct {
+	config       *config.AppConfig
+	outboxRepo   *repository.EmailOutboxRepository
+	emailUtil    *util.EmailUtil
+	eticketUtil  *util.ETicketUtil
+	auditService *AuditService
+	log          *util.LogUtil
+}
+
+func NewEmailService(config *config.AppConfig, outboxRepo *repository.EmailOutboxRepository, emailUtil *util.EmailUtil, eticketUtil *util.ETicketUtil, auditService *AuditService, log *util.LogUtil) *EmailService {
+	return &EmailService{config: config, outboxRepo: outboxRepo, emailUtil: emailUtil, eticketUtil: eticketUtil, auditService: auditService, log: log}
+}
+
+func (s *EmailService) Queue(kind, locale string, data map[string]any, receiver string) (model.EmailOutbox, error) {
+	outbox, err := s.newOutbox(kind, locale, data, receiver)
+	if err != nil {
+		return outbox, err
+	}
+	if result := s.outboxRepo.InsertOne(&outbox); result.Error != nil {
+		return outbox, errors.New("database operation error")
+	}
+	return outbox, nil
+}
+
+// QueueTxn is Queue inside the database transaction, the email is only sent if the transaction commits
+func (s *EmailService) QueueTxn(txn *gorm.DB, kind, locale string, data map[string]any, receiver string) (model.EmailOutbox, error) {
+	outbox, err := s.newOutbox(kind, locale, data, receiver)
+	if err != nil {
+		return outbox, err
+	}
+	if result := s.outboxRepo.InsertOneTxn(txn, &outbox); result.Error != nil {
+		return outbox, errors.New("database operation error")
+	}
+	return outbox, nil
+}
+
+// newOutbox render the email to check the template and keep the subject, the data is rendered again when it is sent
+func (s *EmailService) newOutbox(kind, locale string, data map[string]any, receiver string) (model.EmailOutbox, error) {
+	rendered, err := s.emailUtil.Render(kind, locale, data) //fail early when the template cannot be populated, the subject is kept for the admin
+	if err != nil {
+		return model.EmailOutbox{}, err
+	}
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return model.EmailOutbox{}, err
+	}
+	outbox := model.EmailOutbox{
+		Kind:          kind,
+		Receiver:      receiver,
+		Subject:       rendered.Subject,
+		Locale:        locale,
+		Data:          string(encodedData),
+		Status:        "queued",
+		NextAttemptAt: time.Now(),
+	}
+	return outbox, nil
+}
+
+func (s *EmailService) QueueTotpEmail(totpToken string, user model.User) error {
+	data := map[string]any{
+		"Name": user.Name,
+		"Totp": totpToken,
+	}
+	_, err := s.Queue("totp", user.Locale, data, user.Email)
+	return err
+}
+
+func (s *EmailService) QueueInfoEmail(seats []model.Seat, user model.User) error {
+	data := map[string]any{
+		"Name":  user.Name,
+		"Seats": seatsName(seats),
+	}
+	_, err := s.Queue("info", user.Locale, data, user.Email)
+	return err
+}
+
+func (s *EmailService) QueueTicketEmail(seats []model.Seat, user model.User) error {
+	var seatsName []string
+	var seatsLink []string
+	for _, seat := range seats {
+		seatsName = append(seatsName, seat.Name)
+		seatsLink = append(seatsLink, seat.Link)
+	}
+	data := map[string]any{ //the e-tickets are generated by the worker from the seat links, so only the links are stored
+		"Name":  user.Name,
+		"Seats": seatsName,
+		"Links": seatsLink,
+	}
+	_, err := s.Queue("ticket", user.Locale, data, user.Email)
+	return err
+}
+
+// QueueHoldExpiringEmail remind the user that the reserved seats will be released soon because the payment is not started yet
+func (s *EmailService) QueueHoldExpiringEmail(seats []model.Seat, user model.User, expiresAt time.Time) error {
+	data := map[string]any{
+		"Name":      user.Name,
+		"Seats":     seatsName(seats),
+		"ExpiresAt": expiresAt.Format("02 Jan 2006 15:04"),
+	}
+	_, err := s.Queue("hold_expiring", user.Locale, data, user.Email)
+	return err
+}
+
+// QueuePaymentPendingEmail remind the user to finish the started payment, the instructions are label and value pairs
+func (s *EmailService) QueuePaymentPendingEmail(seats []model.Seat, user model.User, expiresAt time.Time, instructions []map[string]string) error {
+	data := map[string]any{
+		"Name":         user.Name,
+		"Seats":        seatsName(seats),
+		"ExpiresAt":    expiresAt.Format("02 Jan 2006 15:04"),
+		"Instructions": instructions,
+	}
+	_, err := s.Queue("payment_pending", user.Locale, data, user.Email)
+	return err
+}
+
+func (s *EmailService) QueueSeatsReleasedEmail(seats []model.Seat, user model.User) error {
+	data := map[string]any{
+		"Name":  user.Name,
+		"Seats": seatsName(seats),
+	}
+	_, err := s.Queue("seats_released", user.Locale, data, user.Email)
+	return err
+}
+
+// QueueTransferOfferEmail ask the receiver to log in and accept the ticket, the receiver may not have an account yet
+func (s *EmailService) QueueTransferOfferEmail(seatName string, from model.User, receiver, locale string) error {
+	data := map[string]any{
+		"FromName": from.Name,
+		"Seats":    []string{seatName},
+	}
+	_, err := s.Queue("transfer_offer", locale, data, receiver)
+	return err
+}
+
+// QueueTransferReceivedEmail send the e-ticket with its new link to the user who accepted the transfer
+func (s *EmailService) QueueTransferReceivedEmail(seat model.Seat, from, user model.User) error {
+	data := map[string]any{ //generated by the worker like the ticket email
+		"Name":     user.Name,
+		"FromName": from.Name,
+		"Seats":    []string{seat.Name},
+		"Links":    []string{seat.Link},
+	}
+	_, err := s.Queue("transfer_received", user.Locale, data, user.Email)
+	return err
+}
+
+// QueueTransferCompletedEmail tell the previous owner that the ticket was accepted and the old e-ticket is void
+func (s *EmailService) QueueTransferCompletedEmail(seatName string, user model.User, receiver string) error {
+	data := map[string]any{
+		"Name":    user.Name,
+		"Seats":   []string{seatName},
+		"ToEmail": receiver,
+	}
+	_, err := s.Queue("transfer_completed", user.Locale, data, user.Email)
+	return err
+}
+
+func (s *EmailService) GetAll(status string) ([]model.EmailOutbox, error) {
+	var outboxes []model.EmailOutbox
+	if result := s.outboxRepo.GetAll(&outboxes, status); result.Error != nil {
+		return outboxes, errors.New("database operation error")
+	}
+	for i := range outboxes {
+		outboxes[i].Data = redactData(outboxes[i].Kind, outboxes[i].Data)
+	}
+	return outboxes, nil
+}
+
+func (s *EmailService) GetById(outboxId uint64) (model.EmailOutbox, error) {
+	var outbox model.EmailOutbox
+	if result := s.outboxRepo.GetById(&outbox, outboxId); result.Error != nil {
+		return outbox, errors.New("cannot find this email")
+	}
+	outbox.Data = redactData(outbox.Kind, outbox.Data)
+	return outbox, nil
+}
+
+func (s *EmailService) Resend(outboxId uint64, actor util.Actor) (model.EmailOutbox, error) {
+	outbox, err := s.GetById(outboxId)
+	if err != nil {
+		return outbox, err
+	}
+	if outbox.Status == "queued" {
+		return outbox, errors.New("this email is already waiting to be sent")
+	}
+	if _, ok := secretFields[outbox.Kind]; ok { //the code is gone after the delivery, the user has to request a new one
+		return outbox, errors.New("this email carries a one-time code, it cannot be resent")
+	}
+	fields := map[string]any{"status": "queued", "attempts": 0, "next_attempt_at": time.Now(), "last_error": ""}
+	if result := s.outboxRepo.UpdateById(outboxId, fields); result.Error != nil {
+		return outbox, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "email_resent", "email_outbox", strconv.FormatUint(outboxId, 10), map[string]any{"status": outbox.Status}, map[string]any{"status": "queued"})
+	return s.GetById(outboxId)
+}
+
+// DispatchDue send every queued email whose next attempt time has passed. It returns the number of processed emails
+func (s *EmailService) DispatchDue(limit int) (int, error) {
+	var outboxes []model.EmailOutbox
+	if err := s.outboxRepo.ClaimDue(&outboxes, limit, 5*time.Minute); err != nil {
+		return 0, errors.New("database operation error")
+	}
+	for _, outbox := range outboxes {
+		s.dispatch(outbox)
+	}
+	return len(outboxes), nil
+}
+
+func (s *EmailService) dispatch(outbox model.EmailOutbox) {
+	err := s.send(outbox)
+	attempts := outbox.Attempts + 1
+	if err == nil {
+		s.outboxRepo.UpdateById(outbox.EmailOutboxId, map[string]any{"status": "sent", "attempts": attempts, "sent_at": time.Now(), "last_error": "", "data": redactData(outbox.Kind, outbox.Data)})
+		return
+	}
+
+	s.log.Log.
+		WithField("occurrence", "EmailService@dispatch").
+		WithField("email_outbox_id", outbox.EmailOutboxId).
+		WithField("attempts", attempts).
+		Warn(err.Error())
+
+	fields := map[string]any{"attempts": attempts, "last_error": err.Error()}
+	if s.emailUtil.IsBounce(err) { //the receiver will never accept this email
+		fields["status"], fields["data"] = "bounced", redactData(outbox.Kind, outbox.Data)
+	} else if attempts >= s.config.MailMaxAttempt { //give up after too many attempts
+		fields["status"], fields["data"] = "failed", redactData(outbox.Kind, outbox.Data)
+	} else { //retry with exponential backoff: retry minute, 2x, 4x, ...
+		fields["next_attempt_at"] = time.Now().Add(s.config.MailRetryMinute * time.Duration(math.Pow(2, float64(attempts-1))))
+	}
+	s.outboxRepo.UpdateById(outbox.EmailOutboxId, fields)
+}
+
+func (s *EmailService) send(outbox model.EmailOutbox) error {
+	data := make(map[string]any)
+	if err := json.Unmarshal([]byte(outbox.Data), &data); err != nil {
+		return err
+	}
+	if outbox.Kind != "ticket" && outbox.Kind != "transfer_received" { //only these carry e-tickets
+		return s.emailUtil.Send(outbox.Kind, outbox.Locale, data, outbox.Receiver, nil)
+	}
+
+	var ticketData struct {
+		Seats []string
+		Links []string
+	}
+	if err := json.Unmarshal([]byte(outbox.Data), &ticketData); err != nil {
+		return err
+	}
+	var attachments []util.MailAttachment
+	for i, seatName := range ticketData.Seats { //regenerate the e-tickets on every attempt, they are stored in minio anyway
+		label, name := "SEAT", seatName
+		if isTicketCode(ticketData.Links[i]) { //a general admission ticket shows its ticket code instead of a seat name
+			label, name = "TICKET", ticketData.Links[i]
+		}
+		ticket, err := s.eticketUtil.GenerateETicket(label, name, ticketData.Links[i])
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, util.MailAttachment{Filename: name + ".png", Content: ticket})
+	}
+	return s.emailUtil.Send(outbox.Kind, outbox.Locale, data, outbox.Receiver, attachments)
+}
+
+// redactData mask the secret fields of the json encoded template data
+func redactData(kind, encodedData string) string {
+	fields, ok := secretFields[kind]
+	if !ok {
+		return encodedData
+	}
+	data := make(map[string]any)
+	if err := json.Unmarshal([]byte(encodedData), &data); err != nil {
+		return ""
+	}
+	for _, field := range fields {
+		if _, ok = data[field]; ok {
+			data[field] = "******"
+		}
+	}
+	redacted, _ := json.Marshal(data)
+	return string(redacted)
+}
+
+func seatsName(seats []model.Seat) []string {
+	var names []string
+	for _, seat := range seats {
+		names = append(names, seat.Name)
+	}
+	return names
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingMailer return the queued errors one by one, and deliver to the memory mailer once they run out
+type failingMailer struct {
+	mu     sync.Mutex
+	errs   []error
+	memory *util.MemoryMailer
+}
+
+func (m *failingMailer) Send(message *util.MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return err
+	}
+	return m.memory.Send(message)
+}
+
+func newTestDatabase(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.EmailOutbox{}, &model.AuditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestEmailService(t *testing.T, mailer util.Mailer) (*EmailService, *gorm.DB) {
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(io.Discard)
+	log := util.NewLogUtil(logrusLogger)
+	appConfig := &config.AppConfig{AppName: "gmcgo", MailMailer: "memory", MailTheme: "default", MailLocale: "id", MailMaxAttempt: 3, MailRetryMinute: time.Minute}
+	db := newTestDatabase(t)
+	emailUtil := util.NewEmailUtil(appConfig, log, mailer, util.NewTemplateRegistry(appConfig, log))
+	auditService := NewAuditService(repository.NewAuditEventRepository(db, log), log)
+	return NewEmailService(appConfig, repository.NewEmailOutboxRepository(db, log), emailUtil, nil, auditService, log), db
+}
+
+func getTestOutbox(t *testing.T, db *gorm.DB, outboxId uint64) model.EmailOutbox {
+	var outbox model.EmailOutbox
+	if err := db.First(&outbox, outboxId).Error; err != nil {
+		t.Fatal(err)
+	}
+	return outbox
+}
+
+// makeTestOutboxDue move the next attempt of the email to the past, as if the retry delay has passed
+func makeTestOutboxDue(t *testing.T, db *gorm.DB, outboxId uint64) {
+	if err := db.Model(&model.EmailOutbox{}).Where("email_outbox_id = ?", outboxId).Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailServiceQueue(t *testing.T) {
+	mailer := util.NewMemoryMailer()
+	emailService, db := newTestEmailService(t, mailer)
+
+	outbox, err := emailService.Queue("info", "en", map[string]any{"Name": "Chandra", "Seats": []string{"H31", "H32"}}, "chandra@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Kind != "info" || stored.Receiver != "chandra@example.com" || stored.Locale != "en" || stored.Status != "queued" || stored.Attempts != 0 {
+		t.Errorf("unexpected queued email %+v", stored)
+	}
+	if stored.Subject == "" || !strings.Contains(stored.Data, "H32") {
+		t.Errorf("expected the rendered subject and the template data, got %q %q", stored.Subject, stored.Data)
+	}
+	if len(mailer.Sent()) != 0 {
+		t.Error("queueing must not send the email")
+	}
+
+	if _, err = emailService.Queue("missing", "en", nil, "chandra@example.com"); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+	var count int64
+	db.Model(&model.EmailOutbox{}).Count(&count)
+	if count != 1 {
+		t.Errorf("the email that cannot be rendered must not be queued, got %d emails", count)
+	}
+}
+
+func TestEmailServiceDispatchDueSend(t *testing.T) {
+	mailer := util.NewMemoryMailer()
+	emailService, db := newTestEmailService(t, mailer)
+	outbox, err := emailService.Queue("info", "en", map[string]any{"Name": "Chandra", "Seats": []string{"H31"}}, "chandra@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed, err := emailService.DispatchDue(20)
+	if err != nil || processed != 1 {
+		t.Fatalf("expected 1 processed email, got %d %v", processed, err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != "chandra@example.com" || sent[0].Subject != outbox.Subject || !strings.Contains(sent[0].TextBody, "H31") {
+		t.Fatalf("unexpected sent emails %+v", sent)
+	}
+	stored := getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "sent" || stored.Attempts != 1 || stored.SentAt == nil || stored.LastError != "" {
+		t.Errorf("unexpected sent email %+v", stored)
+	}
+
+	if processed, _ = emailService.DispatchDue(20); processed != 0 || len(mailer.Sent()) != 1 {
+		t.Error("the sent email must not be sent again")
+	}
+}
+
+func TestEmailServiceDispatchDueRetry(t *testing.T) {
+	mailer := &failingMailer{errs: []error{errors.New("dial tcp: connection refused"), errors.New("421 service not available")}, memory: util.NewMemoryMailer()}
+	emailService, db := newTestEmailService(t, mailer)
+	outbox, err := emailService.Queue("info", "en", map[string]any{"Name": "Chandra", "Seats": []string{"H31"}}, "chandra@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if processed, _ := emailService.DispatchDue(20); processed != 1 {
+		t.Fatalf("expected 1 processed email, got %d", processed)
+	}
+	stored := getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "queued" || stored.Attempts != 1 || stored.LastError != "dial tcp: connection refused" {
+		t.Errorf("unexpected email after the first failure %+v", stored)
+	}
+	if delay := stored.NextAttemptAt.Sub(before); delay < time.Minute || delay > time.Minute+10*time.Second {
+		t.Errorf("expected the first retry after a minute, got %s", delay)
+	}
+	if processed, _ := emailService.DispatchDue(20); processed != 0 {
+		t.Error("the email must wait for its next attempt")
+	}
+
+	makeTestOutboxDue(t, db, outbox.EmailOutboxId)
+	before = time.Now()
+	emailService.DispatchDue(20)
+	stored = getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "queued" || stored.Attempts != 2 {
+		t.Errorf("unexpected email after the second failure %+v", stored)
+	}
+	if delay := stored.NextAttemptAt.Sub(before); delay < 2*time.Minute || delay > 2*time.Minute+10*time.Second {
+		t.Errorf("expected the retry delay to double, got %s", delay)
+	}
+
+	makeTestOutboxDue(t, db, outbox.EmailOutboxId)
+	emailService.DispatchDue(20)
+	stored = getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "sent" || stored.Attempts != 3 || stored.LastError != "" || len(mailer.memory.Sent()) != 1 {
+		t.Errorf("expected the email to be sent on the third attempt, got %+v", stored)
+	}
+}
+
+func TestEmailServiceDispatchDueGiveUp(t *testing.T) {
+	mailer := &failingMailer{errs: []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}, memory: util.NewMemoryMailer()}
+	emailService, db := newTestEmailService(t, mailer)
+	outbox, err := emailService.Queue("info", "en", map[string]any{"Name": "Chandra", "Seats": []string{"H31"}}, "chandra@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		makeTestOutboxDue(t, db, outbox.EmailOutboxId)
+		emailService.DispatchDue(20)
+	}
+	stored := getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "failed" || stored.Attempts != 3 || stored.LastError != "timeout" {
+		t.Errorf("expected the email to fail after the max attempts, got %+v", stored)
+	}
+
+	makeTestOutboxDue(t, db, outbox.EmailOutboxId)
+	if processed, _ := emailService.DispatchDue(20); processed != 0 {
+		t.Error("the failed email must not be retried")
+	}
+
+	resent, err := emailService.Resend(outbox.EmailOutboxId, util.Actor{Type: "staff", Id: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resent.Status != "queued" || resent.Attempts != 0 || resent.LastError != "" {
+		t.Errorf("unexpected resent email %+v", resent)
+	}
+	var event model.AuditEvent
+	if err = db.Where("action = ?", "email_resent").First(&event).Error; err != nil || event.ActorId != "1" {
+		t.Errorf("expected the resend to be audited, got %+v %v", event, err)
+	}
+	if _, err = emailService.Resend(outbox.EmailOutboxId, util.Actor{Type: "staff", Id: "1"}); err == nil {
+		t.Error("expected an error when resending a queued email")
+	}
+	emailService.DispatchDue(20)
+	if stored = getTestOutbox(t, db, outbox.EmailOutboxId); stored.Status != "sent" || len(mailer.memory.Sent()) != 1 {
+		t.Errorf("expected the resent email to be sent, got %+v", stored)
+	}
+}
+
+func TestEmailServiceDispatchDueBounce(t *testing.T) {
+	mailer := &failingMailer{errs: []error{errors.New("550 5.1.1 mailbox unavailable")}, memory: util.NewMemoryMailer()}
+	emailService, db := newTestEmailService(t, mailer)
+	outbox, err := emailService.Queue("info", "en", map[string]any{"Name": "Chandra", "Seats": []string{"H31"}}, "nobody@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emailService.DispatchDue(20)
+	stored := getTestOutbox(t, db, outbox.EmailOutboxId)
+	if stored.Status != "bounced" || stored.Attempts != 1 {
+		t.Errorf("expected the rejected email to bounce at once, got %+v", stored)
+	}
+	makeTestOutboxDue(t, db, outbox.EmailOutboxId)
+	if processed, _ := emailService.DispatchDue(20); processed != 0 || len(mailer.memory.Sent()) != 0 {
+		t.Error("the bounced email must not be retried")
+	}
+}
+
+func TestEmailServiceTotpRedacted(t *testing.T) {
+	mailer := util.NewMemoryMailer()
+	emailService, db := newTestEmailService(t, mailer)
+	if err := emailService.QueueTotpEmail("731904", model.User{Name: "Chandra", Email: "chandra@example.com", Locale: "en"}); err != nil {
+		t.Fatal(err)
+	}
+	outboxes, err := emailService.GetAll("queued")
+	if err != nil || len(outboxes) != 1 {
+		t.Fatalf("expected 1 queued email, got %d %v", len(outboxes), err)
+	}
+	if strings.Contains(outboxes[0].Data, "731904") {
+		t.Error("the admin must not see the code of the queued email")
+	}
+
+	emailService.DispatchDue(20)
+	sent := mailer.Sent()
+	if len(sent) != 1 || !strings.Contains(sent[0].TextBody, "731904") {
+		t.Fatalf("expected the code in the sent email, got %+v", sent)
+	}
+	stored := getTestOutbox(t, db, outboxes[0].EmailOutboxId)
+	if stored.Status != "sent" || strings.Contains(stored.Data, "731904") || !strings.Contains(stored.Data, "Chandra") {
+		t.Errorf("expected only the code to be removed after sending, got %q", stored.Data)
+	}
+	if _, err = emailService.Resend(stored.EmailOutboxId, util.Actor{Type: "staff", Id: "1"}); err == nil {
+		t.Error("expected an error when resending a one-time code")
+	}
+}
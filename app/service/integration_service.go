@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SalesSummary count the seats by status and the settled tickets
+type SalesSummary struct {
+	Seats         map[string]int `json:"seats"`
+	Sold          int            `json:"sold"`
+	Complimentary int            `json:"complimentary"`
+	Revenue       uint64         `json:"revenue"`  //after the promo code discounts
+	Discount      uint64         `json:"discount"` //given by the promo codes on the settled orders
+}
+
+// SaleRecord is one settled ticket for the integrations
+type SaleRecord struct {
+	TransactionId uint64    `json:"transaction_id"`
+	OrderId       string    `json:"order_id"`
+	Seat          string    `json:"seat"`
+	TicketCode    string    `json:"ticket_code,omitempty"` //only for a general admission ticket
+	Price         uint      `json:"price"`
+	Vendor        string    `json:"vendor"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	Phone         string    `json:"phone"`
+	SettledAt     time.Time `json:"settled_at"`
+}
+
+// IntegrationService serve the sales data and the complimentary tickets to the api key clients
+type IntegrationService struct {
+	config       *config.AppConfig
+	db           *gorm.DB
+	txRepo       *repository.TransactionRepository
+	seatRepo     *repository.SeatRepository
+	promoRepo    *repository.PromoCodeRepository
+	orderRepo    *repository.OrderRepository
+	orderService *OrderService
+	seatService  *SeatService
+	userService  *UserService
+	emailService *EmailService
+	auditService *AuditService
+	log          *util.LogUtil
+}
+
+func NewIntegrationService(config *config.AppConfig, db *gorm.DB, txRepo *repository.TransactionRepository, seatRepo *repository.SeatRepository, promoRepo *repository.PromoCodeRepository, orderRepo *repository.OrderRepository, orderService *OrderService, seatService *SeatService, userService *UserService, emailService *EmailService, auditService *AuditService, log *util.LogUtil) *IntegrationService {
+	return &IntegrationService{config: config, db: db, txRepo: txRepo, seatRepo: seatRepo, promoRepo: promoRepo, orderRepo: orderRepo, orderService: orderService, seatService: seatService, userService: userService, emailService: emailService, auditService: auditService, log: log}
+}
+
+func (s *IntegrationService) GetSalesSummary() (SalesSummary, error) {
+	summary := SalesSummary{Seats: make(map[string]int)}
+	var seats []model.Seat
+	if result := s.seatRepo.GetAll(&seats); result.Error != nil {
+		return summary, errors.New("database operation error")
+	}
+	for _, seat := range seats {
+		summary.Seats[seat.Status]++
+	}
+	var transactions []model.Transaction
+	if result := s.txRepo.GetTicketHolders(&transactions, nil, nil); result.Error != nil {
+		return summary, errors.New("database operation error")
+	}
+	for _, tx := range transactions {
+		if tx.Vendor == "complimentary" {
+			summary.Complimentary++
+			continue
+		}
+		summary.Sold++
+		summary.Revenue += uint64(TicketSeat(tx).Price)
+	}
+	var usages []repository.PromoUsage
+	if result := s.promoRepo.GetUsages(&usages); result.Error != nil {
+		return summary, errors.New("database operation error")
+	}
+	for _, usage := range usages {
+		summary.Discount += usage.Discount
+	}
+	if summary.Discount < summary.Revenue {
+		summary.Revenue -= summary.Discount
+	} else {
+		summary.Revenue = 0
+	}
+	return summary, nil
+}
+
+// GetSalesSince list the tickets settled after the given time, to be polled with the settled_at of the last record
+func (s *IntegrationService) GetSalesSince(since time.Time, limit int) ([]SaleRecord, error) {
+	var transactions []model.Transaction
+	if result := s.txRepo.GetSettledSince(&transactions, since, limit); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	records := make([]SaleRecord, 0, len(transactions))
+	for _, tx := range transactions {
+		seat := TicketSeat(tx)
+		records = append(records, SaleRecord{
+			TransactionId: tx.TransactionId,
+			OrderId:       tx.OrderId,
+			Seat:          seat.Name,
+			TicketCode:    tx.TicketCode,
+			Price:         seat.Price,
+			Vendor:        tx.Vendor,
+			Name:          tx.User.Name,
+			Email:         tx.User.Email,
+			Phone:         tx.User.Phone,
+			SettledAt:     tx.UpdatedAt,
+		})
+	}
+	return records, nil
+}
+
+// IssueComplimentary give the seats to the guest for free and email the tickets. The guest is registered by the email when needed
+func (s *IntegrationService) IssueComplimentary(name, email, phone string, seatIds []uint, actor util.Actor) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	user, err := s.userService.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		user = model.User{Name: name, Email: email, Phone: phone}
+		if _, err = s.userService.InsertOne(&user); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	orderId := "comp-" + uuid.New().String()
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return "", errors.New("database operation error")
+	}
+	order := s.orderService.NewComplimentary(orderId, user.UserId)
+	if result := s.orderRepo.InsertOneTxn(txn, &order); result.Error != nil {
+		txn.Rollback()
+		return "", errors.New("database operation error")
+	}
+	var seats []model.Seat
+	if result := s.seatRepo.LockByIdsTxn(txn, &seats, seatIds); result.Error != nil {
+		txn.Rollback()
+		return "", errors.New("database operation error")
+	}
+	if len(seats) != len(seatIds) {
+		txn.Rollback()
+		return "", errors.New("cannot find some of the seats")
+	}
+	for _, seat := range seats {
+		seat := seat
+		if err = s.seatService.IsOwnedTxn(txn, seat.SeatId, user.UserId); err != nil { //the same availability rule as the reservation
+			txn.Rollback()
+			return "", errors.New(err.Error() + " | conflict on this seat. seat_id: " + strconv.Itoa(int(seat.SeatId)))
+		}
+		var holds []model.Transaction //the seat is locked, so the guest cannot start another hold on it meanwhile
+		if result := s.txRepo.GetHoldsBySeatUserTxn(txn, &holds, seat.SeatId, user.UserId); result.Error != nil {
+			txn.Rollback()
+			return "", errors.New("database operation error")
+		}
+		for _, hold := range holds {
+			if hold.Confirmation == "pending" || hold.OrderId != "" || time.Now().Before(hold.CreatedAt.Add(s.config.TransactionMinute)) { //one seat must not end up in two transactions of the guest
+				txn.Rollback()
+				return "", errors.New("the guest is buying this seat already | conflict on this seat. seat_id: " + strconv.Itoa(int(seat.SeatId)))
+			}
+			if result := s.txRepo.SoftDeleteByIdTxn(txn, hold.TransactionId); result.Error != nil { //delete the previous failed reservation
+				txn.Rollback()
+				return "", errors.New("database operation error")
+			}
+		}
+		if err = s.seatService.UpdateStatusTxn(txn, seat.SeatId, "purchased"); err != nil {
+			txn.Rollback()
+			return "", err
+		}
+		tx := model.Transaction{OrderId: orderId, UserId: user.UserId, SeatId: &seat.SeatId, Vendor: "complimentary", Confirmation: "settlement"}
+		if result := s.txRepo.InsertOneTxn(txn, &tx); result.Error != nil {
+			txn.Rollback()
+			return "", errors.New("database operation error")
+		}
+	}
+	if err = txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return "", errors.New("database operation error")
+	}
+
+	s.auditService.Record(actor, "complimentary_issued", "order", orderId, nil, map[string]any{"user_id": user.UserId, "seat_ids": seatIds})
+	if err = s.emailService.QueueTicketEmail(seats, user); err != nil { //the seats are given already, the email can be resent by the admin
+		s.log.BasicLog(err, "IntegrationService@IssueComplimentary")
+	}
+	return orderId, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"math"
+	"strconv"
+	"time"
+)
+
+var ErrInvoiceNotFound = errors.New("cannot find the invoice of this order")
+
+type InvoiceService struct {
+	config      *config.AppConfig
+	invoiceRepo *repository.InvoiceRepository
+}
+
+func NewInvoiceService(config *config.AppConfig, invoiceRepo *repository.InvoiceRepository) *InvoiceService {
+	return &InvoiceService{config: config, invoiceRepo: invoiceRepo}
+}
+
+// Build itemize the order: a line for every seat and ticket, then the discount, the configured fees and the tax. The
+// fees are charged on the order after the discount and the tax on the order with the fees
+func (s *InvoiceService) Build(orderId string, userId uint64, seats []model.Seat, promo PromoQuote) model.Invoice {
+	invoice := model.Invoice{OrderId: orderId, UserId: userId, Status: "pending", TaxIncluded: s.config.TaxIncluded}
+	for _, seat := range seats {
+		invoice.Lines = append(invoice.Lines, model.InvoiceLine{Kind: "ticket", Name: seat.Name, Quantity: 1, UnitPrice: int64(seat.Price), Amount: int64(seat.Price)})
+		invoice.Subtotal += uint64(seat.Price)
+	}
+	invoice.Discount = uint64(promo.Discount)
+	if invoice.Discount > invoice.Subtotal {
+		invoice.Discount = invoice.Subtotal
+	}
+	if invoice.Discount > 0 {
+		invoice.Lines = append(invoice.Lines, model.InvoiceLine{Kind: "discount", Name: "Promo " + promo.Code, Quantity: 1, UnitPrice: -int64(invoice.Discount), Amount: -int64(invoice.Discount)})
+	}
+	base := invoice.Subtotal - invoice.Discount
+
+	for _, fee := range s.config.Fees {
+		line := model.InvoiceLine{Kind: "fee", Name: fee.Name, Quantity: 1}
+		switch fee.Kind {
+		case "per_ticket":
+			line.Quantity = uint(len(seats))
+			line.UnitPrice = int64(math.Round(fee.Amount))
+		case "per_order":
+			line.UnitPrice = int64(math.Round(fee.Amount))
+		case "percentage":
+			line.UnitPrice = int64(math.Round(float64(base) * fee.Amount / 100))
+		}
+		line.Amount = line.UnitPrice * int64(line.Quantity)
+		if line.Amount > 0 {
+			invoice.Lines = append(invoice.Lines, line)
+			invoice.Fees += uint64(line.Amount)
+		}
+	}
+
+	invoice.Total = base + invoice.Fees
+	if s.config.TaxPercent > 0 {
+		name := s.config.TaxName + " " + strconv.FormatFloat(s.config.TaxPercent, 'f', -1, 64) + "%"
+		if s.config.TaxIncluded { //the part of the total that is tax
+			invoice.Tax = invoice.Total - uint64(math.Round(float64(invoice.Total)*100/(100+s.config.TaxPercent)))
+			name += " (included)"
+		} else {
+			invoice.Tax = uint64(math.Round(float64(invoice.Total) * s.config.TaxPercent / 100))
+			invoice.Total += invoice.Tax
+		}
+		invoice.Lines = append(invoice.Lines, model.InvoiceLine{Kind: "tax", Name: name, Quantity: 1, UnitPrice: int64(invoice.Tax), Amount: int64(invoice.Tax)})
+	}
+	return invoice
+}
+
+// SaveTxn store the invoice of the order when the checkout start
+func (s *InvoiceService) SaveTxn(txn *gorm.DB, invoice *model.Invoice) error {
+	if result := s.invoiceRepo.InsertOneTxn(txn, invoice); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Issue number the invoice of the paid order, the order without an invoice like a complimentary one is skipped
+func (s *InvoiceService) Issue(orderId string) error {
+	if result := s.invoiceRepo.Issue(orderId, s.config.InvoicePrefix, time.Now()); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Cancel void the invoice of the failed order, it never gets a number
+func (s *InvoiceService) Cancel(orderId string) error {
+	if result := s.invoiceRepo.UpdateStatus(orderId, "cancelled"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+func (s *InvoiceService) GetByOrder(orderId string) (model.Invoice, error) {
+	var invoice model.Invoice
+	if result := s.invoiceRepo.GetByOrder(&invoice, orderId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return invoice, ErrInvoiceNotFound
+	} else if result.Error != nil {
+		return invoice, errors.New("database operation error")
+	}
+	return invoice, nil
+}
+
+// RenderPdf print the invoice, it is a receipt once the order is paid
+func (s *InvoiceService) RenderPdf(invoice model.Invoice) []byte {
+	pdf := util.NewPdfDocument()
+	const left, right = 50.0, util.PdfPageWidth - 50
+	title, number := "INVOICE", "Not issued, awaiting payment"
+	switch invoice.Status {
+	case "paid":
+		title, number = "RECEIPT", invoice.Number
+	case "cancelled":
+		number = "Cancelled"
+	}
+
+	pdf.Text(left, 60, 20, true, title)
+	pdf.TextRight(right, 60, 12, true, s.config.InvoiceIssuer)
+	y := 76.0
+	for _, line := range []string{s.config.InvoiceAddress, s.config.InvoiceTaxId} {
+		if line != "" {
+			pdf.TextRight(right, y, 9, false, line)
+			y += 12
+		}
+	}
+
+	y = 110
+	details := [][2]string{
+		{"Invoice number", number},
+		{"Order id", invoice.OrderId},
+		{"Date", invoice.CreatedAt.Format("02 January 2006 15:04")},
+		{"Billed to", invoice.User.Name + " <" + invoice.User.Email + ">"},
+	}
+	if invoice.IssuedAt != nil {
+		details = append(details, [2]string{"Paid at", invoice.IssuedAt.Format("02 January 2006 15:04")})
+	}
+	for _, detail := range details {
+		pdf.Text(left, y, 10, true, detail[0])
+		pdf.Text(left+110, y, 10, false, detail[1])
+		y += 15
+	}
+
+	y += 20
+	header := func() {
+		pdf.Text(left, y, 10, true, "Item")
+		pdf.TextRight(right-190, y, 10, true, "Qty")
+		pdf.TextRight(right-100, y, 10, true, "Unit price")
+		pdf.TextRight(right, y, 10, true, "Amount")
+		pdf.Line(left, y+6, right, y+6)
+		y += 22
+	}
+	header()
+	for _, line := range invoice.Lines {
+		if y > util.PdfPageHeight-120 { //continue the lines on the next page
+			pdf.AddPage()
+			y = 60
+			header()
+		}
+		name := []rune(line.Name)
+		if len(name) > 55 { //keep the name out of the quantity column
+			name = append(name[:52], []rune("...")...)
+		}
+		pdf.Text(left, y, 10, false, string(name))
+		pdf.TextRight(right-190, y, 10, false, strconv.FormatUint(uint64(line.Quantity), 10))
+		pdf.TextRight(right-100, y, 10, false, formatRupiah(line.UnitPrice))
+		pdf.TextRight(right, y, 10, false, formatRupiah(line.Amount))
+		y += 16
+	}
+
+	pdf.Line(left, y-6, right, y-6)
+	y += 10
+	totals := [][2]string{{"Subtotal", formatRupiah(int64(invoice.Subtotal))}}
+	if invoice.Discount > 0 {
+		totals = append(totals, [2]string{"Discount", formatRupiah(-int64(invoice.Discount))})
+	}
+	if invoice.Fees > 0 {
+		totals = append(totals, [2]string{"Fees", formatRupiah(int64(invoice.Fees))})
+	}
+	if invoice.Tax > 0 && !invoice.TaxIncluded {
+		totals = append(totals, [2]string{"Tax", formatRupiah(int64(invoice.Tax))})
+	}
+	for _, total := range totals {
+		pdf.TextRight(right-100, y, 10, false, total[0])
+		pdf.TextRight(right, y, 10, false, total[1])
+		y += 15
+	}
+	pdf.TextRight(right-100, y+4, 12, true, "Total")
+	pdf.TextRight(right, y+4, 12, true, formatRupiah(int64(invoice.Total)))
+	if invoice.Tax > 0 && invoice.TaxIncluded {
+		pdf.TextRight(right, y+22, 9, false, "The total includes "+formatRupiah(int64(invoice.Tax))+" of tax")
+	}
+	return pdf.Bytes()
+}
+
+// formatRupiah write the amount like Rp 165.000
+func formatRupiah(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "." + digits[i:]
+	}
+	return fmt.Sprintf("%sRp %s", sign, digits)
+}
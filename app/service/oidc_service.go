@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOidcEmailNotVerified = errors.New("the email of this account is not verified by the provider")
+	ErrOidcStaffAccount     = errors.New("staff accounts must sign in with the password")
+)
+
+// OidcService sign the customers in with an openid connect provider, linking the provider account to the user by the verified email
+type OidcService struct {
+	userRepo    *repository.UserRepository
+	userService *UserService
+	oidcUtil    *util.OidcUtil
+	log         *util.LogUtil
+}
+
+func NewOidcService(userRepo *repository.UserRepository, userService *UserService, oidcUtil *util.OidcUtil, log *util.LogUtil) *OidcService {
+	return &OidcService{userRepo: userRepo, userService: userService, oidcUtil: oidcUtil, log: log}
+}
+
+func (s *OidcService) Providers() []string {
+	return s.oidcUtil.Providers()
+}
+
+func (s *OidcService) AuthorizeUrl(provider string) (string, string, error) {
+	return s.oidcUtil.AuthorizeUrl(provider)
+}
+
+// Login finish the login at the provider and return the linked user, registering the user on the first login.
+// It returns whether the user is newly registered
+func (s *OidcService) Login(provider, code, state, signedState, clientIp string) (model.User, bool, error) {
+	claims, err := s.oidcUtil.Exchange(provider, code, state, signedState)
+	if err != nil {
+		return model.User{}, false, err
+	}
+
+	var identity model.UserIdentity
+	result := s.userRepo.GetIdentity(provider, claims.Subject, &identity)
+	if result.Error == nil { //a returning account, it stays linked even when its email changes at the provider
+		user, err := s.userService.GetById(identity.UserId)
+		if err != nil {
+			return user, false, err
+		}
+		if user.Role != "" {
+			return model.User{}, false, ErrOidcStaffAccount
+		}
+		s.userRepo.UpdateIdentityById(identity.UserIdentityId, map[string]any{"email": claims.Email, "last_login_at": time.Now()})
+		s.log.AuditLog("oidc_login", map[string]any{"provider": provider, "user_id": user.UserId, "client_ip": clientIp})
+		return user, false, nil
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return model.User{}, false, errors.New("database operation error")
+	}
+
+	if claims.Email == "" || !claims.EmailVerified { //an unverified email would let anyone take over the user of that email
+		s.log.AuditLog("oidc_rejected_unverified", map[string]any{"provider": provider, "subject": claims.Subject, "client_ip": clientIp})
+		return model.User{}, false, ErrOidcEmailNotVerified
+	}
+	isNew := false
+	email := strings.ToLower(strings.TrimSpace(claims.Email)) //the same user whatever the letter case the provider gives
+	user, err := s.userService.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		user = model.User{Name: claims.Name, Email: email}
+		if _, err = s.userService.InsertOne(&user); err != nil {
+			return user, false, err
+		}
+		isNew = true
+	} else if err != nil {
+		return user, false, err
+	}
+	if user.Role != "" {
+		s.log.AuditLog("oidc_rejected_staff", map[string]any{"provider": provider, "user_id": user.UserId, "client_ip": clientIp})
+		return model.User{}, false, ErrOidcStaffAccount
+	}
+
+	identity = model.UserIdentity{UserId: user.UserId, Provider: provider, Subject: claims.Subject, Email: claims.Email, LastLoginAt: time.Now()}
+	if result = s.userRepo.InsertIdentity(&identity); result.Error != nil {
+		return user, false, errors.New("database operation error")
+	}
+	s.log.AuditLog("oidc_linked", map[string]any{"provider": provider, "user_id": user.UserId, "client_ip": clientIp, "is_new_registration": isNew})
+	return user, isNew, nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+var ErrOrderNotFound = errors.New("cannot find this order")
+var ErrCheckoutRepeated = errors.New("the checkout with this idempotency key is in progress or has failed")
+var ErrOrderNotOpen = errors.New("the order was paid, closed or is being replaced by another checkout")
+
+// orderStatuses is the order status for the transaction status notified by the payment gateway
+var orderStatuses = map[string]string{
+	"pending":        "pending",
+	"settlement":     "paid",
+	"expire":         "expired",
+	"cancel":         "cancelled",
+	"deny":           "denied",
+	"refund":         "refunded",
+	"partial_refund": "partially_refunded",
+}
+
+// OrderEvent is a step of the order timeline
+type OrderEvent struct {
+	Status string    `json:"status"` //reserved, pending, settled, expired, cancelled, denied, failed or refunded
+	At     time.Time `json:"at"`
+}
+
+type OrderService struct {
+	orderRepo *repository.OrderRepository
+}
+
+func NewOrderService(orderRepo *repository.OrderRepository) *OrderService {
+	return &OrderService{orderRepo: orderRepo}
+}
+
+// CreateTxn open the order of the checkout, its amounts are set once the invoice is built. The idempotency key is
+// optional, it returns ErrCheckoutRepeated when the user has an order with the key already
+func (s *OrderService) CreateTxn(txn *gorm.DB, orderId string, userId uint64, paymentMethod, idempotencyKey string, expiresAt time.Time) error {
+	order := model.Order{
+		OrderId:       orderId,
+		UserId:        userId,
+		Status:        "awaiting_payment",
+		Currency:      "IDR",
+		PaymentMethod: paymentMethod,
+		ExpiresAt:     &expiresAt,
+	}
+	if idempotencyKey != "" {
+		var existing model.Order
+		if result := s.orderRepo.GetByIdempotencyKeyTxn(txn, &existing, userId, idempotencyKey); result.Error == nil {
+			return ErrCheckoutRepeated
+		} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errors.New("database operation error")
+		}
+		order.IdempotencyKey = &idempotencyKey
+	}
+	if result := s.orderRepo.InsertOneTxn(txn, &order); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// SetAmountsTxn copy the amounts of the invoice to its order
+func (s *OrderService) SetAmountsTxn(txn *gorm.DB, invoice model.Invoice, promoCode string) error {
+	columns := map[string]any{"subtotal": invoice.Subtotal, "discount": invoice.Discount, "fees": invoice.Fees, "tax": invoice.Tax, "total": invoice.Total, "promo_code": promoCode}
+	if result := s.orderRepo.UpdateTxn(txn, invoice.OrderId, columns); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// NewComplimentary is the paid order of the free tickets, to be inserted with the tickets
+func (s *OrderService) NewComplimentary(orderId string, userId uint64) model.Order {
+	now := time.Now()
+	return model.Order{OrderId: orderId, UserId: userId, Status: "paid", Currency: "IDR", PaymentType: "complimentary", PaidAt: &now}
+}
+
+// SetPaymentPage keep the snap token and the payment page of the order
+func (s *OrderService) SetPaymentPage(orderId, snapToken, redirectUrl string) error {
+	if result := s.orderRepo.Update(orderId, map[string]any{"snap_token": snapToken, "redirect_url": redirectUrl}); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Fail close the order the payment gateway did not accept
+func (s *OrderService) Fail(orderId string) error {
+	if result := s.orderRepo.Update(orderId, map[string]any{"status": "failed", "closed_at": time.Now()}, "awaiting_payment"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// MarkCancelling mark the unpaid order the buyer is replacing with a new checkout, until its payment is cancelled at the
+// payment gateway. It returns ErrOrderNotOpen when the order cannot be paid anymore
+func (s *OrderService) MarkCancelling(orderId string) error {
+	result := s.orderRepo.Update(orderId, map[string]any{"status": "cancelling"}, "awaiting_payment", "pending")
+	if result.Error != nil {
+		return errors.New("database operation error")
+	} else if result.RowsAffected < 1 {
+		return ErrOrderNotOpen
+	}
+	return nil
+}
+
+// Reopen put back the status of the order whose payment the gateway could not cancel
+func (s *OrderService) Reopen(orderId, status string) error {
+	if result := s.orderRepo.Update(orderId, map[string]any{"status": status}, "cancelling"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// CancelTxn close the order the buyer replaced with a new checkout, once its payment was cancelled at the gateway
+func (s *OrderService) CancelTxn(txn *gorm.DB, orderId string) error {
+	if result := s.orderRepo.UpdateTxn(txn, orderId, map[string]any{"status": "cancelled", "closed_at": time.Now()}); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Expire close the unpaid order whose seats and tickets were released
+func (s *OrderService) Expire(orderId string) error {
+	if result := s.orderRepo.Update(orderId, map[string]any{"status": "expired", "closed_at": time.Now()}, "awaiting_payment", "pending", "cancelling"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// RecordPayment apply the payment notification to the order. A paid order stays paid, and a closed order can only
+// become paid, by a payment that settles late
+func (s *OrderService) RecordPayment(message map[string]any) error {
+	gatewayStatus, _ := message["transaction_status"].(string)
+	status, ok := orderStatuses[gatewayStatus]
+	if !ok {
+		return nil
+	}
+	orderId, _ := message["order_id"].(string)
+	paymentType, _ := message["payment_type"].(string)
+	gatewayTransactionId, _ := message["transaction_id"].(string)
+	columns := map[string]any{"status": status, "gateway_status": gatewayStatus, "payment_type": paymentType, "gateway_transaction_id": gatewayTransactionId}
+	from := []string{"awaiting_payment", "pending"}
+	switch status {
+	case "pending":
+		columns["pending_at"] = time.Now()
+	case "refunded", "partially_refunded":
+		columns["refunded_at"] = time.Now()
+		from = []string{"paid", "partially_refunded"}
+	case "paid":
+		columns["paid_at"] = time.Now()
+		from = append(from, "cancelling", "expired", "cancelled", "denied", "failed")
+	case "expired", "cancelled", "denied":
+		columns["closed_at"] = time.Now()
+	}
+	if result := s.orderRepo.Update(orderId, columns, from...); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Timeline list the steps the order went through, the oldest first. The order starts when its first seat or ticket
+// was reserved
+func (s *OrderService) Timeline(order model.Order) []OrderEvent {
+	reservedAt := order.CreatedAt
+	for _, tx := range order.Transactions {
+		if tx.CreatedAt.Before(reservedAt) {
+			reservedAt = tx.CreatedAt
+		}
+	}
+	events := []OrderEvent{{Status: "reserved", At: reservedAt}}
+	if order.PendingAt != nil {
+		events = append(events, OrderEvent{Status: "pending", At: *order.PendingAt})
+	}
+	if order.ClosedAt != nil {
+		closed := order.Status
+		if closed != "cancelled" && closed != "denied" && closed != "failed" { //settled late, or the status moved on since
+			closed = "expired"
+		}
+		events = append(events, OrderEvent{Status: closed, At: *order.ClosedAt})
+	}
+	if order.PaidAt != nil {
+		events = append(events, OrderEvent{Status: "settled", At: *order.PaidAt})
+	}
+	if order.RefundedAt != nil {
+		events = append(events, OrderEvent{Status: "refunded", At: *order.RefundedAt})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+// PaymentInstructions is how to pay the pending order, like the virtual account number, from the gateway notification
+func (s *OrderService) PaymentInstructions(order model.Order) []map[string]string {
+	if order.Status != "pending" {
+		return nil
+	}
+	for _, tx := range order.Transactions {
+		if tx.Instruction != "" {
+			return paymentInstructions(tx.Instruction)
+		}
+	}
+	return nil
+}
+
+// GetById get the order with its user and lines
+func (s *OrderService) GetById(orderId string) (model.Order, error) {
+	var order model.Order
+	if result := s.orderRepo.GetDetailsById(&order, orderId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return order, ErrOrderNotFound
+	} else if result.Error != nil {
+		return order, errors.New("database operation error")
+	}
+	return order, nil
+}
+
+// GetOpenByUser get the order of the user that can still be paid on its payment page
+func (s *OrderService) GetOpenByUser(userId uint64) (model.Order, error) {
+	var order model.Order
+	if result := s.orderRepo.GetOpenByUser(&order, userId, time.Now()); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return order, ErrOrderNotFound
+	} else if result.Error != nil {
+		return order, errors.New("database operation error")
+	}
+	return order, nil
+}
+
+// GetByIdempotencyKey get the order the user created with the Idempotency-Key header of the checkout
+func (s *OrderService) GetByIdempotencyKey(userId uint64, key string) (model.Order, error) {
+	var order model.Order
+	if result := s.orderRepo.GetByIdempotencyKey(&order, userId, key); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return order, ErrOrderNotFound
+	} else if result.Error != nil {
+		return order, errors.New("database operation error")
+	}
+	return order, nil
+}
+
+// Find get one page of the matching orders, the newest first
+func (s *OrderService) Find(filter repository.OrderFilter, page, perPage int) ([]model.Order, int64, error) {
+	var orders []model.Order
+	if result := s.orderRepo.Find(&orders, filter, perPage, (page-1)*perPage); result.Error != nil {
+		return nil, 0, errors.New("database operation error")
+	}
+	total, err := s.orderRepo.Count(filter)
+	if err != nil {
+		return nil, 0, errors.New("database operation error")
+	}
+	return orders, total, nil
+}
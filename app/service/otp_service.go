@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"strings"
+)
+
+var (
+	ErrOtpRateLimited = errors.New("too many requests, please try again later")
+	ErrOtpLocked      = errors.New("too many wrong codes, please try again later")
+	ErrOtpInvalid     = errors.New("otp is not valid")
+)
+
+type OtpService struct {
+	config       *config.AppConfig
+	userService  *UserService
+	emailService *EmailService
+	otpUtil      *util.OtpUtil
+	log          *util.LogUtil
+}
+
+func NewOtpService(config *config.AppConfig, userService *UserService, emailService *EmailService, otpUtil *util.OtpUtil, log *util.LogUtil) *OtpService {
+	return &OtpService{config: config, userService: userService, emailService: emailService, otpUtil: otpUtil, log: log}
+}
+
+// RequestCode email a new login code to the given address, registering the user on the first request.
+// It returns whether the user is newly registered
+func (s *OtpService) RequestCode(email, clientIp string) (bool, error) {
+	email = strings.ToLower(strings.TrimSpace(email)) //one account, code and limit per mailbox whatever the letter case
+	if err := s.checkLimits(email, clientIp, "request"); err != nil {
+		return false, err
+	}
+
+	isNew := false
+	user, err := s.userService.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		user = model.User{Email: email}
+		if _, err = s.userService.InsertOne(&user); err != nil {
+			return false, err
+		}
+		isNew = true
+	} else if err != nil {
+		return false, err
+	}
+	if user.Role != "" { //the staff sign in with the password, answer like any other email so the staff emails are not revealed
+		s.log.AuditLog("otp_rejected_staff", map[string]any{"email": email, "client_ip": clientIp, "user_id": user.UserId})
+		return false, nil
+	}
+
+	code, err := s.otpUtil.Generate()
+	if err != nil {
+		return false, err
+	}
+	if err = s.otpUtil.Store(email, code); err != nil {
+		return false, errors.New("cache operation error")
+	}
+	if err = s.emailService.QueueTotpEmail(code, user); err != nil { //the code is only ever delivered by email
+		return false, err
+	}
+	s.log.AuditLog("otp_requested", map[string]any{"email": email, "client_ip": clientIp, "user_id": user.UserId, "is_new_registration": isNew})
+	return isNew, nil
+}
+
+// VerifyCode check the login code of the email and return its user when the code is valid
+func (s *OtpService) VerifyCode(email, code, clientIp string) (model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := s.checkLimits(email, clientIp, "verify"); err != nil {
+		return model.User{}, err
+	}
+
+	valid, err := s.otpUtil.Verify(email, code)
+	if err != nil {
+		return model.User{}, errors.New("cache operation error")
+	}
+	if !valid {
+		s.log.AuditLog("otp_failed", map[string]any{"email": email, "client_ip": clientIp})
+		if lockedFor, _ := s.otpUtil.LockedFor(email); lockedFor > 0 { //this was the last allowed attempt
+			s.log.AuditLog("otp_locked", map[string]any{"email": email, "client_ip": clientIp})
+			return model.User{}, ErrOtpLocked
+		}
+		return model.User{}, ErrOtpInvalid
+	}
+
+	user, err := s.userService.GetByEmail(email)
+	if err != nil {
+		return user, err
+	}
+	if user.Role != "" { //never reached unless a code was stored before the account became a staff
+		return model.User{}, ErrOtpInvalid
+	}
+	s.log.AuditLog("otp_verified", map[string]any{"email": email, "client_ip": clientIp, "user_id": user.UserId})
+	return user, nil
+}
+
+// checkLimits reject the request when the email is locked or when the email or the ip has made too many requests
+func (s *OtpService) checkLimits(email, clientIp, action string) error {
+	lockedFor, err := s.otpUtil.LockedFor(email)
+	if err != nil {
+		return errors.New("cache operation error")
+	}
+	if lockedFor > 0 {
+		s.log.AuditLog("otp_rejected_locked", map[string]any{"email": email, "client_ip": clientIp, "action": action})
+		return ErrOtpLocked
+	}
+
+	ipLimited, err := s.otpUtil.HitLimit("ip:"+clientIp, s.config.OtpIpLimit)
+	if err != nil {
+		return errors.New("cache operation error")
+	}
+	emailLimited := false
+	if action == "request" { //the wrong verifications of an email are limited by the lock instead
+		if emailLimited, err = s.otpUtil.HitLimit("email:"+email, s.config.OtpEmailLimit); err != nil {
+			return errors.New("cache operation error")
+		}
+	}
+	if ipLimited || emailLimited {
+		s.log.AuditLog("otp_rate_limited", map[string]any{"email": email, "client_ip": clientIp, "action": action})
+		return ErrOtpRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+var ErrPriceCategoryNotFound = errors.New("cannot find this price category")
+
+type PriceCategoryService struct {
+	db             *gorm.DB
+	categoryRepo   *repository.PriceCategoryRepository
+	seatRepo       *repository.SeatRepository
+	ticketTypeRepo *repository.TicketTypeRepository
+	txRepo         *repository.TransactionRepository
+	pricingService *PricingService
+	auditService   *AuditService
+}
+
+func NewPriceCategoryService(db *gorm.DB, categoryRepo *repository.PriceCategoryRepository, seatRepo *repository.SeatRepository, ticketTypeRepo *repository.TicketTypeRepository, txRepo *repository.TransactionRepository, pricingService *PricingService, auditService *AuditService) *PriceCategoryService {
+	return &PriceCategoryService{db: db, categoryRepo: categoryRepo, seatRepo: seatRepo, ticketTypeRepo: ticketTypeRepo, txRepo: txRepo, pricingService: pricingService, auditService: auditService}
+}
+
+func (s *PriceCategoryService) GetAll() ([]model.PriceCategory, error) {
+	var categories []model.PriceCategory
+	if result := s.categoryRepo.GetAll(&categories); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	return categories, nil
+}
+
+// GetMap return the categories by id, to look up the category of the seats
+func (s *PriceCategoryService) GetMap() (map[uint64]model.PriceCategory, error) {
+	categories, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[uint64]model.PriceCategory, len(categories))
+	for _, category := range categories {
+		byId[category.PriceCategoryId] = category
+	}
+	return byId, nil
+}
+
+func (s *PriceCategoryService) Create(category model.PriceCategory, actor util.Actor) (model.PriceCategory, error) {
+	var existing model.PriceCategory
+	if result := s.categoryRepo.GetByName(&existing, category.Name); result.Error == nil {
+		return category, errors.New("this category name is already used")
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return category, errors.New("database operation error")
+	}
+	if result := s.categoryRepo.InsertOne(&category); result.Error != nil {
+		return category, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "price_category_created", "price_category", strconv.FormatUint(category.PriceCategoryId, 10), nil, category)
+	return category, nil
+}
+
+// Update change the category, a new price is given to every seat and ticket type of the category at once. The seats and
+// tickets already on hold keep the price they were reserved with
+func (s *PriceCategoryService) Update(categoryId uint64, input model.PriceCategory, actor util.Actor) (model.PriceCategory, error) {
+	var category model.PriceCategory
+	if result := s.categoryRepo.GetById(&category, categoryId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return category, ErrPriceCategoryNotFound
+	} else if result.Error != nil {
+		return category, errors.New("database operation error")
+	}
+	if input.Name != category.Name {
+		var existing model.PriceCategory
+		if result := s.categoryRepo.GetByName(&existing, input.Name); result.Error == nil {
+			return category, errors.New("this category name is already used")
+		}
+	}
+	before := category
+	category.Name, category.Price, category.Currency, category.Description, category.Color = input.Name, input.Price, input.Currency, input.Description, input.Color
+
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return category, errors.New("database operation error")
+	}
+	if result := s.categoryRepo.SaveTxn(txn, &category); result.Error != nil {
+		txn.Rollback()
+		return category, errors.New("database operation error")
+	}
+	if before.Price != category.Price {
+		if err := s.lockHeldPricesTxn(txn, categoryId); err != nil {
+			txn.Rollback()
+			return category, err
+		}
+		if result := s.seatRepo.UpdatePriceByCategoryTxn(txn, categoryId, category.Price); result.Error != nil {
+			txn.Rollback()
+			return category, errors.New("database operation error")
+		}
+		if result := s.ticketTypeRepo.UpdatePriceByCategoryTxn(txn, categoryId, category.Price); result.Error != nil {
+			txn.Rollback()
+			return category, errors.New("database operation error")
+		}
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return category, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "price_category_updated", "price_category", strconv.FormatUint(categoryId, 10), before, category)
+	return category, nil
+}
+
+// AssignSeats move the seats to the category, they get the category price
+func (s *PriceCategoryService) AssignSeats(categoryId uint64, seatIds []uint, actor util.Actor) error {
+	var category model.PriceCategory
+	if result := s.categoryRepo.GetById(&category, categoryId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return ErrPriceCategoryNotFound
+	} else if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return errors.New("database operation error")
+	}
+	var seats []model.Seat
+	if result := s.seatRepo.LockByIdsTxn(txn, &seats, seatIds); result.Error != nil {
+		txn.Rollback()
+		return errors.New("database operation error")
+	}
+	if len(seats) != len(seatIds) {
+		txn.Rollback()
+		return errors.New("cannot find some of the seats")
+	}
+	if result := s.seatRepo.AssignCategoryTxn(txn, seatIds, categoryId, category.Price); result.Error != nil {
+		txn.Rollback()
+		return errors.New("database operation error")
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return errors.New("database operation error")
+	}
+	before := make([]map[string]any, 0, len(seats))
+	for _, seat := range seats {
+		before = append(before, map[string]any{"seat_id": seat.SeatId, "price_category_id": seat.PriceCategoryId, "price": seat.Price})
+	}
+	s.auditService.Record(actor, "price_category_seats_assigned", "price_category", strconv.FormatUint(categoryId, 10), before, map[string]any{"seat_ids": seatIds, "price": category.Price})
+	return nil
+}
+
+// Delete remove a category that no seat and no ticket type is in
+func (s *PriceCategoryService) Delete(categoryId uint64, actor util.Actor) error {
+	count, err := s.seatRepo.CountByCategory(categoryId)
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	if count > 0 {
+		return errors.New("move the " + strconv.FormatInt(count, 10) + " seats of this category to another category first")
+	}
+	if count, err = s.ticketTypeRepo.CountByCategory(categoryId); err != nil {
+		return errors.New("database operation error")
+	} else if count > 0 {
+		return errors.New("move the " + strconv.FormatInt(count, 10) + " ticket types of this category to another category first")
+	}
+	result := s.categoryRepo.DeleteById(categoryId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return ErrPriceCategoryNotFound
+	}
+	s.auditService.Record(actor, "price_category_deleted", "price_category", strconv.FormatUint(categoryId, 10), nil, nil)
+	return nil
+}
+
+// lockHeldPricesTxn store the current price on the holds of the category that were reserved before the prices were locked
+// at reservation, so the new category price does not reach them
+func (s *PriceCategoryService) lockHeldPricesTxn(txn *gorm.DB, categoryId uint64) error {
+	var holds []model.Transaction
+	if result := s.txRepo.GetUnpricedHoldsByCategoryTxn(txn, &holds, categoryId); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if len(holds) < 1 {
+		return nil
+	}
+	priceList, err := s.pricingService.PriceList()
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if result := s.txRepo.UpdateByIdTxn(txn, hold.TransactionId, map[string]any{"price": priceList.Price(TicketSeat(hold))}); result.Error != nil {
+			return errors.New("database operation error")
+		}
+	}
+	return nil
+}
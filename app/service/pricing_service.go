@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+var ErrPricingRuleNotFound = errors.New("cannot find this pricing rule")
+
+// PriceList is the pricing rules and the category sales at one moment, so every seat of a request is priced the same way
+type PriceList struct {
+	rules       []model.PricingRule
+	soldPercent map[uint64]uint64 //by price category id
+	at          time.Time
+}
+
+// Price is the price of the seat now, see Apply
+func (l PriceList) Price(seat model.Seat) uint {
+	price, _ := l.Apply(seat)
+	return price
+}
+
+// Apply return the price of the seat with the winning pricing rule, or the seat price and nil when no rule applies
+func (l PriceList) Apply(seat model.Seat) (uint, *model.PricingRule) {
+	for i := range l.rules {
+		rule := &l.rules[i]
+		if l.applies(*rule, seat.PriceCategoryId) {
+			return rulePrice(*rule, seat.Price), rule
+		}
+	}
+	return seat.Price, nil
+}
+
+// TicketTypePrice is the price of a general admission ticket of the type now
+func (l PriceList) TicketTypePrice(ticketType model.TicketType) uint {
+	return l.Price(model.Seat{Price: ticketType.Price, PriceCategoryId: ticketType.PriceCategoryId})
+}
+
+// RuleApplies tell whether the rule applies now to the seats and tickets of its category, whatever its priority
+func (l PriceList) RuleApplies(rule model.PricingRule) bool {
+	return l.applies(rule, rule.PriceCategoryId)
+}
+
+func (l PriceList) applies(rule model.PricingRule, categoryId *uint64) bool {
+	if rule.PriceCategoryId != nil && (categoryId == nil || *rule.PriceCategoryId != *categoryId) {
+		return false
+	}
+	if rule.StartsAt != nil && l.at.Before(*rule.StartsAt) {
+		return false
+	}
+	if rule.EndsAt != nil && !l.at.Before(*rule.EndsAt) {
+		return false
+	}
+	if rule.MinSoldPercent > 0 && (categoryId == nil || l.soldPercent[*categoryId] < uint64(rule.MinSoldPercent)) {
+		return false
+	}
+	return true
+}
+
+func rulePrice(rule model.PricingRule, base uint) uint {
+	price := int64(base)
+	switch rule.Kind {
+	case "percentage":
+		price = price * int64(100+rule.Value) / 100
+	case "fixed":
+		price += int64(rule.Value)
+	case "price":
+		price = int64(rule.Value)
+	}
+	if price < 0 {
+		return 0
+	}
+	return uint(price)
+}
+
+type PricingService struct {
+	ruleRepo     *repository.PricingRuleRepository
+	categoryRepo *repository.PriceCategoryRepository
+	seatRepo     *repository.SeatRepository
+	auditService *AuditService
+}
+
+func NewPricingService(ruleRepo *repository.PricingRuleRepository, categoryRepo *repository.PriceCategoryRepository, seatRepo *repository.SeatRepository, auditService *AuditService) *PricingService {
+	return &PricingService{ruleRepo: ruleRepo, categoryRepo: categoryRepo, seatRepo: seatRepo, auditService: auditService}
+}
+
+// PriceList load the active rules and the sales of the categories to price the seats and tickets now
+func (s *PricingService) PriceList() (PriceList, error) {
+	priceList := PriceList{at: time.Now()}
+	if result := s.ruleRepo.GetActive(&priceList.rules); result.Error != nil {
+		return priceList, errors.New("database operation error")
+	}
+	if len(priceList.rules) < 1 { //nothing to count the sales for
+		return priceList, nil
+	}
+	var sales []repository.CategorySales
+	if result := s.ruleRepo.GetCategorySales(&sales); result.Error != nil {
+		return priceList, errors.New("database operation error")
+	}
+	priceList.soldPercent = soldPercents(sales)
+	return priceList, nil
+}
+
+// PriceListTxn is the PriceList seen by the database transaction, the reservation prices the seats it has locked with it
+func (s *PricingService) PriceListTxn(txn *gorm.DB) (PriceList, error) {
+	priceList := PriceList{at: time.Now()}
+	if result := s.ruleRepo.GetActiveTxn(txn, &priceList.rules); result.Error != nil {
+		return priceList, errors.New("database operation error")
+	}
+	if len(priceList.rules) < 1 { //nothing to count the sales for
+		return priceList, nil
+	}
+	var sales []repository.CategorySales
+	if result := s.ruleRepo.GetCategorySalesTxn(txn, &sales); result.Error != nil {
+		return priceList, errors.New("database operation error")
+	}
+	priceList.soldPercent = soldPercents(sales)
+	return priceList, nil
+}
+
+// SeatPricesTxn price the seats with the price list, by seat id. Every seat must exist
+func (s *PricingService) SeatPricesTxn(txn *gorm.DB, priceList PriceList, seatIds []uint) (map[uint]uint, error) {
+	prices := make(map[uint]uint, len(seatIds))
+	if len(seatIds) < 1 {
+		return prices, nil
+	}
+	var seats []model.Seat
+	if result := s.seatRepo.GetByIdsTxn(txn, &seats, seatIds); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	for _, seat := range seats {
+		prices[seat.SeatId] = priceList.Price(seat)
+	}
+	for _, seatId := range seatIds {
+		if _, ok := prices[seatId]; !ok {
+			return nil, errors.New("cannot find this seat. seat_id: " + strconv.Itoa(int(seatId)))
+		}
+	}
+	return prices, nil
+}
+
+func (s *PricingService) GetAll() ([]model.PricingRule, error) {
+	var rules []model.PricingRule
+	if result := s.ruleRepo.GetAll(&rules); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	return rules, nil
+}
+
+// Create add a pricing rule, the seats and tickets reserved already keep the price they were reserved at
+func (s *PricingService) Create(rule model.PricingRule, actor util.Actor) (model.PricingRule, error) {
+	if err := s.checkPricingRule(rule); err != nil {
+		return rule, err
+	}
+	if result := s.ruleRepo.InsertOne(&rule); result.Error != nil {
+		return rule, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "pricing_rule_created", "pricing_rule", strconv.FormatUint(rule.PricingRuleId, 10), nil, rule)
+	return rule, nil
+}
+
+func (s *PricingService) Update(ruleId uint64, input model.PricingRule, actor util.Actor) (model.PricingRule, error) {
+	var rule model.PricingRule
+	if result := s.ruleRepo.GetById(&rule, ruleId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return rule, ErrPricingRuleNotFound
+	} else if result.Error != nil {
+		return rule, errors.New("database operation error")
+	}
+	if err := s.checkPricingRule(input); err != nil {
+		return rule, err
+	}
+	before := rule
+	input.PricingRuleId, input.CreatedBy, input.CreatedAt = rule.PricingRuleId, rule.CreatedBy, rule.CreatedAt
+	if result := s.ruleRepo.Save(&input); result.Error != nil {
+		return rule, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "pricing_rule_updated", "pricing_rule", strconv.FormatUint(ruleId, 10), before, input)
+	return input, nil
+}
+
+func (s *PricingService) Delete(ruleId uint64, actor util.Actor) error {
+	result := s.ruleRepo.DeleteById(ruleId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return ErrPricingRuleNotFound
+	}
+	s.auditService.Record(actor, "pricing_rule_deleted", "pricing_rule", strconv.FormatUint(ruleId, 10), nil, nil)
+	return nil
+}
+
+func (s *PricingService) checkPricingRule(rule model.PricingRule) error {
+	if rule.Kind == "percentage" && rule.Value < -100 {
+		return errors.New("a percentage discount cannot be more than 100")
+	}
+	if rule.Kind == "price" && rule.Value <= 0 {
+		return errors.New("the price must be more than 0")
+	}
+	if rule.MinSoldPercent > 0 && rule.PriceCategoryId == nil {
+		return errors.New("a rule on the sold percentage needs a price category")
+	}
+	if rule.StartsAt != nil && rule.EndsAt != nil && !rule.EndsAt.After(*rule.StartsAt) {
+		return errors.New("the pricing rule must end after it starts")
+	}
+	if rule.PriceCategoryId != nil {
+		var category model.PriceCategory
+		if result := s.categoryRepo.GetById(&category, *rule.PriceCategoryId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrPriceCategoryNotFound
+		} else if result.Error != nil {
+			return errors.New("database operation error")
+		}
+	}
+	return nil
+}
+
+// soldPercents is the sold percentage of each price category with seats or tickets
+func soldPercents(sales []repository.CategorySales) map[uint64]uint64 {
+	soldPercent := make(map[uint64]uint64, len(sales))
+	for _, sale := range sales {
+		if sale.Total > 0 {
+			soldPercent[sale.PriceCategoryId] = sale.Sold * 100 / sale.Total
+		}
+	}
+	return soldPercent
+}
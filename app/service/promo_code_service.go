@@ -0,0 +1,273 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPromoCodeNotFound = errors.New("cannot find this promo code")
+
+// PromoCodeError tell the buyer why the promo code cannot be used, the controller return it as is
+type PromoCodeError struct {
+	Reason  string `json:"reason"` //invalid, not_started, expired, used_up, used_by_user, not_applicable or no_amount_left
+	message string
+}
+
+func (e *PromoCodeError) Error() string {
+	return e.message
+}
+
+// PromoQuote is the discount the promo code gives to the seats and tickets
+type PromoQuote struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Eligible    uint64 `json:"eligible"` //the price of the seats and tickets the code applies to
+	Discount    uint   `json:"discount"`
+}
+
+type PromoCodeService struct {
+	config       *config.AppConfig
+	db           *gorm.DB
+	promoRepo    *repository.PromoCodeRepository
+	auditService *AuditService
+}
+
+func NewPromoCodeService(config *config.AppConfig, db *gorm.DB, promoRepo *repository.PromoCodeRepository, auditService *AuditService) *PromoCodeService {
+	return &PromoCodeService{config: config, db: db, promoRepo: promoRepo, auditService: auditService}
+}
+
+// GetAll return the promo codes and their usage by promo code id
+func (s *PromoCodeService) GetAll() ([]model.PromoCode, map[uint64]repository.PromoUsage, error) {
+	var promoCodes []model.PromoCode
+	if result := s.promoRepo.GetAll(&promoCodes); result.Error != nil {
+		return nil, nil, errors.New("database operation error")
+	}
+	var usages []repository.PromoUsage
+	if result := s.promoRepo.GetUsages(&usages); result.Error != nil {
+		return nil, nil, errors.New("database operation error")
+	}
+	byId := make(map[uint64]repository.PromoUsage, len(usages))
+	for _, usage := range usages {
+		byId[usage.PromoCodeId] = usage
+	}
+	return promoCodes, byId, nil
+}
+
+func (s *PromoCodeService) Create(promoCode model.PromoCode, actor util.Actor) (model.PromoCode, error) {
+	promoCode.Code = NormalizePromoCode(promoCode.Code)
+	if err := checkPromoCode(promoCode); err != nil {
+		return promoCode, err
+	}
+	var existing model.PromoCode
+	if result := s.promoRepo.GetByCode(&existing, promoCode.Code); result.Error == nil {
+		return promoCode, errors.New("this promo code is already used")
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return promoCode, errors.New("database operation error")
+	}
+	if result := s.promoRepo.InsertOne(&promoCode); result.Error != nil {
+		return promoCode, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "promo_code_created", "promo_code", strconv.FormatUint(promoCode.PromoCodeId, 10), nil, promoCode)
+	return promoCode, nil
+}
+
+// Update change the promo code, the orders that used it already keep their discount
+func (s *PromoCodeService) Update(promoCodeId uint64, input model.PromoCode, actor util.Actor) (model.PromoCode, error) {
+	var promoCode model.PromoCode
+	if result := s.promoRepo.GetById(&promoCode, promoCodeId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return promoCode, ErrPromoCodeNotFound
+	} else if result.Error != nil {
+		return promoCode, errors.New("database operation error")
+	}
+	input.Code = NormalizePromoCode(input.Code)
+	if err := checkPromoCode(input); err != nil {
+		return promoCode, err
+	}
+	if input.Code != promoCode.Code {
+		var existing model.PromoCode
+		if result := s.promoRepo.GetByCode(&existing, input.Code); result.Error == nil {
+			return promoCode, errors.New("this promo code is already used")
+		}
+	}
+	before := promoCode
+	input.PromoCodeId, input.CreatedBy, input.CreatedAt = promoCode.PromoCodeId, promoCode.CreatedBy, promoCode.CreatedAt
+	if result := s.promoRepo.Save(&input); result.Error != nil {
+		return promoCode, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "promo_code_updated", "promo_code", strconv.FormatUint(promoCodeId, 10), before, input)
+	return input, nil
+}
+
+// Delete remove a promo code that has never been applied, otherwise it can only be deactivated
+func (s *PromoCodeService) Delete(promoCodeId uint64, actor util.Actor) error {
+	count, err := s.promoRepo.CountRedemptions(promoCodeId)
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	if count > 0 {
+		return errors.New("this promo code has been applied to some orders, deactivate it instead")
+	}
+	result := s.promoRepo.DeleteById(promoCodeId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return ErrPromoCodeNotFound
+	}
+	s.auditService.Record(actor, "promo_code_deleted", "promo_code", strconv.FormatUint(promoCodeId, 10), nil, nil)
+	return nil
+}
+
+func (s *PromoCodeService) GetRedemptions(promoCodeId uint64) ([]model.PromoRedemption, error) {
+	var promoCode model.PromoCode
+	if result := s.promoRepo.GetById(&promoCode, promoCodeId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrPromoCodeNotFound
+	} else if result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	var redemptions []model.PromoRedemption
+	if result := s.promoRepo.GetRedemptionsByCode(&redemptions, promoCodeId); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	return redemptions, nil
+}
+
+// Quote tell the discount the promo code would give to the seats, without using it. The redemptions of the replaced
+// orders are not counted, as checking out cancels them
+func (s *PromoCodeService) Quote(code string, userId uint64, replacedOrderIds []string, seats []model.Seat) (PromoQuote, error) {
+	var promoCode model.PromoCode
+	if result := s.promoRepo.GetByCode(&promoCode, NormalizePromoCode(code)); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return PromoQuote{}, &PromoCodeError{Reason: "invalid", message: "this promo code is not valid"}
+	} else if result.Error != nil {
+		return PromoQuote{}, errors.New("database operation error")
+	}
+	return s.quoteTxn(s.db, promoCode, userId, replacedOrderIds, seats)
+}
+
+// RedeemTxn apply the promo code to the order, the redemption stays pending until the payment settles. The pending
+// redemptions of the orders replaced by this checkout are cancelled first. An empty code only cancels them
+func (s *PromoCodeService) RedeemTxn(txn *gorm.DB, code string, userId uint64, orderId string, replacedOrderIds []string, seats []model.Seat) (PromoQuote, error) {
+	if len(replacedOrderIds) > 0 {
+		if result := s.promoRepo.CancelPendingByOrdersTxn(txn, replacedOrderIds); result.Error != nil {
+			return PromoQuote{}, errors.New("database operation error")
+		}
+	}
+	if code == "" {
+		return PromoQuote{}, nil
+	}
+
+	var promoCode model.PromoCode
+	if result := s.promoRepo.LockByCodeTxn(txn, &promoCode, NormalizePromoCode(code)); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return PromoQuote{}, &PromoCodeError{Reason: "invalid", message: "this promo code is not valid"}
+	} else if result.Error != nil {
+		return PromoQuote{}, errors.New("database operation error")
+	}
+	quote, err := s.quoteTxn(txn, promoCode, userId, nil, seats)
+	if err != nil {
+		return quote, err
+	}
+	redemption := model.PromoRedemption{PromoCodeId: promoCode.PromoCodeId, UserId: userId, OrderId: orderId, Discount: quote.Discount, Status: "pending"}
+	if result := s.promoRepo.InsertRedemptionTxn(txn, &redemption); result.Error != nil {
+		return quote, errors.New("database operation error")
+	}
+	return quote, nil
+}
+
+// Settle count the promo code of the paid order as redeemed
+func (s *PromoCodeService) Settle(orderId string) error {
+	if result := s.promoRepo.UpdateRedemptionStatus(orderId, "redeemed"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+// Cancel give the use of the promo code back when the payment of the order fails
+func (s *PromoCodeService) Cancel(orderId string) error {
+	if result := s.promoRepo.UpdateRedemptionStatus(orderId, "cancelled"); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+func (s *PromoCodeService) quoteTxn(txn *gorm.DB, promoCode model.PromoCode, userId uint64, excludedOrderIds []string, seats []model.Seat) (PromoQuote, error) {
+	quote := PromoQuote{Code: promoCode.Code, Description: promoCode.Description}
+	now := time.Now()
+	if !promoCode.Active {
+		return quote, &PromoCodeError{Reason: "invalid", message: "this promo code is not valid"}
+	}
+	if promoCode.StartsAt != nil && now.Before(*promoCode.StartsAt) {
+		return quote, &PromoCodeError{Reason: "not_started", message: "this promo code can be used from " + promoCode.StartsAt.Format("02 Jan 2006 15:04")}
+	}
+	if promoCode.EndsAt != nil && now.After(*promoCode.EndsAt) {
+		return quote, &PromoCodeError{Reason: "expired", message: "this promo code has expired"}
+	}
+
+	pendingSince := now.Add(-s.config.TransactionMinute) //a pending order older than the transaction time cannot be paid anymore
+	if promoCode.MaxUses > 0 {
+		uses, err := s.promoRepo.CountUsesTxn(txn, promoCode.PromoCodeId, 0, pendingSince, excludedOrderIds)
+		if err != nil {
+			return quote, errors.New("database operation error")
+		}
+		if uses >= int64(promoCode.MaxUses) {
+			return quote, &PromoCodeError{Reason: "used_up", message: "this promo code has been used up"}
+		}
+	}
+	if promoCode.MaxUsesPerUser > 0 {
+		uses, err := s.promoRepo.CountUsesTxn(txn, promoCode.PromoCodeId, userId, pendingSince, excludedOrderIds)
+		if err != nil {
+			return quote, errors.New("database operation error")
+		}
+		if uses >= int64(promoCode.MaxUsesPerUser) {
+			return quote, &PromoCodeError{Reason: "used_by_user", message: "you have used this promo code as many times as allowed"}
+		}
+	}
+
+	var categoryIds []string
+	if promoCode.PriceCategoryIds != "" {
+		categoryIds = strings.Split(promoCode.PriceCategoryIds, ",")
+	}
+	var total uint64
+	for _, seat := range seats {
+		total += uint64(seat.Price)
+		if len(categoryIds) == 0 || (seat.PriceCategoryId != nil && util.Contains(categoryIds, strconv.FormatUint(*seat.PriceCategoryId, 10))) {
+			quote.Eligible += uint64(seat.Price)
+		}
+	}
+	if quote.Eligible == 0 {
+		return quote, &PromoCodeError{Reason: "not_applicable", message: "this promo code does not apply to your seats and tickets"}
+	}
+	discount := quote.Eligible * uint64(promoCode.Value) / 100
+	if promoCode.Kind == "fixed" {
+		discount = uint64(promoCode.Value)
+		if discount > quote.Eligible {
+			discount = quote.Eligible
+		}
+	}
+	if discount >= total { //the payment gateway cannot take a free order, those are given as complimentary tickets
+		return quote, &PromoCodeError{Reason: "no_amount_left", message: "this promo code would make the order free, please contact the organizer"}
+	}
+	quote.Discount = uint(discount)
+	return quote, nil
+}
+
+// NormalizePromoCode make the code case insensitive
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func checkPromoCode(promoCode model.PromoCode) error {
+	if promoCode.Kind == "percentage" && promoCode.Value > 100 {
+		return errors.New("a percentage discount cannot be more than 100")
+	}
+	if promoCode.StartsAt != nil && promoCode.EndsAt != nil && !promoCode.EndsAt.After(*promoCode.StartsAt) {
+		return errors.New("the promo code must end after it starts")
+	}
+	return nil
+}
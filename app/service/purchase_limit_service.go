@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+// PurchaseLimitService manage the purchase limits and the overrides, they are enforced by ReservationService.CheckPurchaseLimitTxn
+type PurchaseLimitService struct {
+	config       *config.AppConfig
+	limitRepo    *repository.PurchaseLimitRepository
+	categoryRepo *repository.PriceCategoryRepository
+	userService  *UserService
+	auditService *AuditService
+}
+
+func NewPurchaseLimitService(config *config.AppConfig, limitRepo *repository.PurchaseLimitRepository, categoryRepo *repository.PriceCategoryRepository, userService *UserService, auditService *AuditService) *PurchaseLimitService {
+	return &PurchaseLimitService{config: config, limitRepo: limitRepo, categoryRepo: categoryRepo, userService: userService, auditService: auditService}
+}
+
+// DefaultLimit is the event wide limit used until the admin set one
+func (s *PurchaseLimitService) DefaultLimit() int {
+	return s.config.PurchaseLimit
+}
+
+func (s *PurchaseLimitService) GetAll() ([]model.PurchaseLimit, []model.PurchaseLimitOverride, error) {
+	var limits []model.PurchaseLimit
+	if result := s.limitRepo.GetAll(&limits); result.Error != nil {
+		return nil, nil, errors.New("database operation error")
+	}
+	var overrides []model.PurchaseLimitOverride
+	if result := s.limitRepo.GetAllOverrides(&overrides); result.Error != nil {
+		return nil, nil, errors.New("database operation error")
+	}
+	return limits, overrides, nil
+}
+
+// SetLimit create or change the limit of the price category, a nil category is the event wide limit
+func (s *PurchaseLimitService) SetLimit(categoryId *uint64, maxSeats int, actor util.Actor) (model.PurchaseLimit, error) {
+	var limit model.PurchaseLimit
+	if categoryId != nil {
+		var category model.PriceCategory
+		if result := s.categoryRepo.GetById(&category, *categoryId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return limit, ErrPriceCategoryNotFound
+		} else if result.Error != nil {
+			return limit, errors.New("database operation error")
+		}
+	}
+	result := s.limitRepo.GetByCategory(&limit, categoryId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return limit, errors.New("database operation error")
+	}
+	before := map[string]any{"max_seats": nil}
+	if result.Error == nil {
+		before["max_seats"] = limit.MaxSeats
+	}
+	limit.PriceCategoryId, limit.MaxSeats = categoryId, maxSeats
+	if result = s.limitRepo.Save(&limit); result.Error != nil {
+		return limit, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "purchase_limit_set", "purchase_limit", strconv.FormatUint(limit.PurchaseLimitId, 10), before, limit)
+	return limit, nil
+}
+
+func (s *PurchaseLimitService) DeleteLimit(limitId uint64, actor util.Actor) error {
+	result := s.limitRepo.DeleteById(limitId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return errors.New("cannot find this purchase limit")
+	}
+	s.auditService.Record(actor, "purchase_limit_deleted", "purchase_limit", strconv.FormatUint(limitId, 10), nil, nil)
+	return nil
+}
+
+// SetOverride give the user its own event wide limit, for example a group buyer
+func (s *PurchaseLimitService) SetOverride(userId uint64, maxSeats int, reason string, expiresAt *time.Time, createdBy uint64, actor util.Actor) (model.PurchaseLimitOverride, error) {
+	var override model.PurchaseLimitOverride
+	if _, err := s.userService.GetById(userId); err != nil {
+		return override, err
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return override, errors.New("the expiry time has passed")
+	}
+	result := s.limitRepo.GetOverrideByUser(&override, userId)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return override, errors.New("database operation error")
+	}
+	var before any
+	if result.Error == nil {
+		before = override
+	}
+	override.UserId, override.MaxSeats, override.Reason, override.ExpiresAt, override.CreatedBy = userId, maxSeats, reason, expiresAt, createdBy
+	if result = s.limitRepo.SaveOverride(&override); result.Error != nil {
+		return override, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "purchase_limit_override_set", "user", strconv.FormatUint(userId, 10), before, override)
+	return override, nil
+}
+
+func (s *PurchaseLimitService) DeleteOverride(userId uint64, actor util.Actor) error {
+	result := s.limitRepo.DeleteOverrideByUser(userId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return errors.New("this user has no purchase limit override")
+	}
+	s.auditService.Record(actor, "purchase_limit_override_deleted", "user", strconv.FormatUint(userId, 10), nil, nil)
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReminderService struct {
+	config            *config.AppConfig
+	txRepo            *repository.TransactionRepository
+	seatService       *SeatService
+	ticketTypeService *TicketTypeService
+	orderService      *OrderService
+	emailService      *EmailService
+	auditService      *AuditService
+	log               *util.LogUtil
+}
+
+func NewReminderService(config *config.AppConfig, txRepo *repository.TransactionRepository, seatService *SeatService, ticketTypeService *TicketTypeService, orderService *OrderService, emailService *EmailService, auditService *AuditService, log *util.LogUtil) *ReminderService {
+	return &ReminderService{config: config, txRepo: txRepo, seatService: seatService, ticketTypeService: ticketTypeService, orderService: orderService, emailService: emailService, auditService: auditService, log: log}
+}
+
+// holdGroup is the unpaid holds of one user that share the same confirmation, they are reminded in a single email
+type holdGroup struct {
+	user         model.User
+	confirmation string
+	instruction  string
+	seats        []model.Seat
+	ids          []uint64
+	expiresAt    time.Time
+}
+
+func groupHolds(transactions []model.Transaction, transactionMinute time.Duration) []*holdGroup {
+	var groups []*holdGroup
+	index := make(map[string]*holdGroup)
+	for _, tx := range transactions {
+		key := fmt.Sprintf("%d|%s", tx.UserId, tx.Confirmation)
+		group, ok := index[key]
+		if !ok {
+			group = &holdGroup{user: tx.User, confirmation: tx.Confirmation, expiresAt: tx.CreatedAt.Add(transactionMinute)}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.seats = append(group.seats, TicketSeat(tx))
+		group.ids = append(group.ids, tx.TransactionId)
+		if tx.Instruction != "" {
+			group.instruction = tx.Instruction
+		}
+		if expiresAt := tx.CreatedAt.Add(transactionMinute); expiresAt.Before(group.expiresAt) { //the earliest seat to be released decides the deadline
+			group.expiresAt = expiresAt
+		}
+	}
+	return groups
+}
+
+// RemindExpiringHolds queue a reminder for the unpaid holds that will expire within the reminder lead time.
+// Holds that are not paid yet get the hold expiring email, holds that are waiting for the payment get the payment pending email
+func (s *ReminderService) RemindExpiringHolds() (int, error) {
+	now := time.Now()
+	var transactions []model.Transaction
+	if result := s.txRepo.GetUnremindedCreatedBetween(&transactions, now.Add(-s.config.TransactionMinute), now.Add(-s.config.TransactionMinute+s.config.ReminderLeadMinute)); result.Error != nil {
+		return 0, errors.New("database operation error")
+	}
+
+	reminded := 0
+	for _, group := range groupHolds(transactions, s.config.TransactionMinute) {
+		var err error
+		if group.confirmation == "pending" {
+			err = s.emailService.QueuePaymentPendingEmail(group.seats, group.user, group.expiresAt, paymentInstructions(group.instruction))
+		} else {
+			err = s.emailService.QueueHoldExpiringEmail(group.seats, group.user, group.expiresAt)
+		}
+		if err != nil {
+			s.log.BasicLog(err, "ReminderService@RemindExpiringHolds")
+			continue
+		}
+		if result := s.txRepo.UpdateByIds(group.ids, "reminded_at", now); result.Error != nil {
+			return reminded, errors.New("database operation error")
+		}
+		reminded++
+	}
+	return reminded, nil
+}
+
+// ReleaseExpiredHolds free the seats of the unpaid holds whose transaction time is over, then tell the users
+// which seats were released. Holds that ended by themselves (expired payment, new reservation) are notified too
+func (s *ReminderService) ReleaseExpiredHolds() (int, error) {
+	now := time.Now()
+	expiredBefore := now.Add(-s.config.TransactionMinute)
+
+	var expired []model.Transaction
+	if result := s.txRepo.GetUnpaidCreatedBefore(&expired, expiredBefore); result.Error != nil {
+		return 0, errors.New("database operation error")
+	}
+	for _, tx := range expired {
+		if tx.OrderId != "" { //the checkout was started but not paid
+			if err := s.orderService.Expire(tx.OrderId); err != nil {
+				return 0, err
+			}
+		}
+		if tx.SeatId == nil { //the general admission ticket goes back to the available tickets
+			if err := s.ticketTypeService.ReleaseHold(tx); err != nil {
+				return 0, err
+			}
+			s.auditService.Record(util.SystemActor("reminder_worker"), "hold_released", "transaction", strconv.FormatUint(tx.TransactionId, 10),
+				map[string]any{"order_id": tx.OrderId, "ticket_type_id": tx.TicketTypeId, "ticket_code": tx.TicketCode, "confirmation": tx.Confirmation}, map[string]any{"ticket_freed": true})
+			continue
+		}
+		if result := s.txRepo.SoftDeleteById(tx.TransactionId); result.Error != nil {
+			return 0, errors.New("database operation error")
+		}
+		newer, err := s.txRepo.CountNewerBySeat(*tx.SeatId, tx.TransactionId)
+		if err != nil {
+			return 0, errors.New("database operation error")
+		}
+		if newer == 0 { //do not free the seat if somebody else has reserved it since
+			if err := s.seatService.UpdateStatus(*tx.SeatId, "available"); err != nil {
+				return 0, err
+			}
+		}
+		s.auditService.Record(util.SystemActor("reminder_worker"), "hold_released", "transaction", strconv.FormatUint(tx.TransactionId, 10),
+			map[string]any{"order_id": tx.OrderId, "seat_id": tx.SeatId, "confirmation": tx.Confirmation}, map[string]any{"seat_freed": newer == 0})
+	}
+
+	var released []model.Transaction
+	if result := s.txRepo.GetUnnotifiedReleases(&released, expiredBefore.Add(-24*time.Hour), expiredBefore); result.Error != nil { //only look back one day so an old backlog is not sent at once
+		return 0, errors.New("database operation error")
+	}
+	notified := 0
+	for _, group := range groupHolds(released, s.config.TransactionMinute) {
+		if err := s.emailService.QueueSeatsReleasedEmail(group.seats, group.user); err != nil {
+			s.log.BasicLog(err, "ReminderService@ReleaseExpiredHolds")
+			continue
+		}
+		if result := s.txRepo.UpdateByIds(group.ids, "released_at", now); result.Error != nil {
+			return notified, errors.New("database operation error")
+		}
+		notified++
+	}
+	return notified, nil
+}
+
+// paymentInstructions turn the stored pending notification into label and value pairs for the email
+func paymentInstructions(encoded string) []map[string]string {
+	var instruction struct {
+		PaymentType string `json:"payment_type"`
+		VaNumbers   []struct {
+			Bank     string `json:"bank"`
+			VaNumber string `json:"va_number"`
+		} `json:"va_numbers"`
+		PermataVaNumber string `json:"permata_va_number"`
+		BillKey         string `json:"bill_key"`
+		BillerCode      string `json:"biller_code"`
+		PaymentCode     string `json:"payment_code"`
+		Store           string `json:"store"`
+		GrossAmount     string `json:"gross_amount"`
+		ExpiryTime      string `json:"expiry_time"`
+	}
+	if encoded == "" || json.Unmarshal([]byte(encoded), &instruction) != nil {
+		return nil
+	}
+
+	var instructions []map[string]string
+	add := func(label, value string) {
+		if value != "" {
+			instructions = append(instructions, map[string]string{"Label": label, "Value": value})
+		}
+	}
+	add("Payment", strings.ReplaceAll(instruction.PaymentType, "_", " "))
+	for _, va := range instruction.VaNumbers {
+		add(strings.ToUpper(va.Bank)+" VA", va.VaNumber)
+	}
+	add("Permata VA", instruction.PermataVaNumber)
+	add("Biller code", instruction.BillerCode)
+	add("Bill key", instruction.BillKey)
+	add("Store", instruction.Store)
+	add("Payment code", instruction.PaymentCode)
+	add("Amount", instruction.GrossAmount)
+	add("Pay before", instruction.ExpiryTime)
+	return instructions
+}
@@ -2,34 +2,163 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/config"
-	"strconv"
+	"gorm.io/gorm"
+	"time"
 )
 
+// PurchaseLimitError tell the buyer which limit the reservation goes over, the controller return it as is
+type PurchaseLimitError struct {
+	Scope           string  `json:"scope"`                       //event, category or override
+	PriceCategoryId *uint64 `json:"price_category_id,omitempty"` //only for the category scope
+	Category        string  `json:"category,omitempty"`
+	Limit           int     `json:"limit"`
+	Held            int     `json:"held"`      //seats and general admission tickets already held by the buyer across the linked accounts
+	Requested       int     `json:"requested"` //new seats and tickets in this reservation that count toward the limit
+}
+
+func (e *PurchaseLimitError) Error() string {
+	scope := "for this event"
+	if e.PriceCategoryId != nil {
+		scope = "for the " + e.Category + " seats"
+	}
+	return fmt.Sprintf("the purchase limit %s is %d seats, you already hold %d and cannot reserve %d more", scope, e.Limit, e.Held, e.Requested)
+}
+
 type ReservationService struct {
 	config    *config.AppConfig
-	txService *TransactionService
+	userRepo  *repository.UserRepository
+	txRepo    *repository.TransactionRepository
+	seatRepo  *repository.SeatRepository
+	limitRepo *repository.PurchaseLimitRepository
+
+	categoryService   *PriceCategoryService
+	ticketTypeService *TicketTypeService
 }
 
-func NewReservationService(config *config.AppConfig, txService *TransactionService) *ReservationService {
-	return &ReservationService{config: config, txService: txService}
+func NewReservationService(config *config.AppConfig, userRepo *repository.UserRepository, txRepo *repository.TransactionRepository, seatRepo *repository.SeatRepository, limitRepo *repository.PurchaseLimitRepository, categoryService *PriceCategoryService, ticketTypeService *TicketTypeService) *ReservationService {
+	return &ReservationService{config: config, userRepo: userRepo, txRepo: txRepo, seatRepo: seatRepo, limitRepo: limitRepo, categoryService: categoryService, ticketTypeService: ticketTypeService}
 }
 
-func (s *ReservationService) CheckUserSeatCount(seatIds []uint, userId uint64) error {
-	prevTransaction, err := s.txService.GetDetailsByUser(userId) //ambil data transaksi user yang sudah tercatat
+// CheckPurchaseLimitTxn check the reservation against the purchase limits. The seats and the general admission tickets
+// (quantities by ticket type id) held by every account of the same buyer are counted, the seats the user already hold
+// are not counted twice. The accounts are locked until the end of the database transaction, so the reservations of the
+// same buyer are checked one at a time. It returns a *PurchaseLimitError when a limit is exceeded
+func (s *ReservationService) CheckPurchaseLimitTxn(txn *gorm.DB, seatIds []uint, quantities map[uint64]int, userId uint64) error {
+	buyerIds, err := s.buyerAccountsTxn(txn, userId)
 	if err != nil {
+		return err
+	}
+	var buyers []model.User
+	if result := s.userRepo.LockByIdsTxn(txn, &buyers, buyerIds); result.Error != nil { //wait for the other reservation of this buyer
+		return errors.New("database operation error")
+	}
+	var held []model.Transaction
+	if result := s.txRepo.GetDetailsByUsersTxn(txn, &held, buyerIds); result.Error != nil {
 		return errors.New("database operation error")
 	}
+	var heldSeatIds []uint
+	heldTickets := 0
+	heldByCategory := make(map[uint64]int)
+	for _, tx := range held {
+		if tx.SeatId == nil { //every general admission ticket counts
+			heldTickets++
+		} else if util.Contains(heldSeatIds, *tx.SeatId) {
+			continue
+		} else {
+			heldSeatIds = append(heldSeatIds, *tx.SeatId)
+		}
+		if categoryId := TicketSeat(tx).PriceCategoryId; categoryId != nil {
+			heldByCategory[*categoryId]++
+		}
+	}
+
+	newSeatIds := util.ElementDifference(seatIds, heldSeatIds)
+	requestedTickets := 0
+	requestedByCategory := make(map[uint64]int)
+	if len(quantities) > 0 {
+		ticketTypes, err := s.ticketTypeService.GetMap()
+		if err != nil {
+			return err
+		}
+		for ticketTypeId, quantity := range quantities {
+			requestedTickets += quantity
+			if categoryId := ticketTypes[ticketTypeId].PriceCategoryId; categoryId != nil {
+				requestedByCategory[*categoryId] += quantity
+			}
+		}
+	}
+	if len(newSeatIds) > 0 {
+		var seats []model.Seat
+		if result := s.seatRepo.GetByIdsTxn(txn, &seats, newSeatIds); result.Error != nil {
+			return errors.New("database operation error")
+		}
+		for _, seat := range seats {
+			if seat.PriceCategoryId != nil {
+				requestedByCategory[*seat.PriceCategoryId]++
+			}
+		}
+	}
+
+	heldCount, requestedCount := len(heldSeatIds)+heldTickets, len(newSeatIds)+requestedTickets
 
-	var prevTxSeatIds []uint //ambil data seatId nya saja
-	for _, tx := range prevTransaction {
-		prevTxSeatIds = append(prevTxSeatIds, tx.SeatId)
+	var override model.PurchaseLimitOverride
+	result := s.limitRepo.GetActiveOverrideByUser(&override, userId, time.Now())
+	if result.Error == nil { //the override replace every purchase limit
+		if heldCount+requestedCount > override.MaxSeats {
+			return &PurchaseLimitError{Scope: "override", Limit: override.MaxSeats, Held: heldCount, Requested: requestedCount}
+		}
+		return nil
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return errors.New("database operation error")
 	}
 
-	diff := util.ElementDifference(seatIds, prevTxSeatIds)            //ambil perbedaan seatId sesudah dan sebelum
-	if totalSeat := len(diff) + len(prevTransaction); totalSeat > 5 { //jika jumlah kursi sebelumnya + jumlah kursi pesanan yang belum ada di transaksi sebelumnya > 5 return error
-		return errors.New("user telah memesan " + strconv.Itoa(len(prevTransaction)) + " kursi, tidak bisa memesan " + strconv.Itoa(len(seatIds)) + " kursi lagi")
+	var limits []model.PurchaseLimit
+	if result := s.limitRepo.GetAll(&limits); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	eventLimit := s.config.PurchaseLimit
+	for _, limit := range limits {
+		if limit.PriceCategoryId == nil {
+			eventLimit = limit.MaxSeats
+		}
+	}
+	if heldCount+requestedCount > eventLimit {
+		return &PurchaseLimitError{Scope: "event", Limit: eventLimit, Held: heldCount, Requested: requestedCount}
+	}
+	for _, limit := range limits {
+		if limit.PriceCategoryId == nil || requestedByCategory[*limit.PriceCategoryId] == 0 {
+			continue
+		}
+		categoryId := *limit.PriceCategoryId
+		if heldByCategory[categoryId]+requestedByCategory[categoryId] > limit.MaxSeats {
+			categories, err := s.categoryService.GetMap()
+			if err != nil {
+				return err
+			}
+			return &PurchaseLimitError{Scope: "category", PriceCategoryId: limit.PriceCategoryId, Category: categories[categoryId].Name, Limit: limit.MaxSeats, Held: heldByCategory[categoryId], Requested: requestedByCategory[categoryId]}
+		}
 	}
 	return nil
 }
+
+// buyerAccountsTxn find the accounts of the same buyer by the same normalized email or phone. The payment cards are not used, the
+// gateway only reports the masked card number which many unrelated cards share
+func (s *ReservationService) buyerAccountsTxn(txn *gorm.DB, userId uint64) ([]uint64, error) {
+	var user model.User
+	if result := s.userRepo.GetByIdTxn(txn, userId, &user); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	var buyerIds []uint64
+	if result := s.userRepo.GetIdsByIdentityTxn(txn, &buyerIds, util.NormalizeEmail(user.Email), util.NormalizePhone(user.Phone)); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	if !util.Contains(buyerIds, userId) {
+		buyerIds = append(buyerIds, userId)
+	}
+	return buyerIds, nil
+}
@@ -4,19 +4,22 @@ import (
 	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"gorm.io/gorm"
+	"strconv"
 	"time"
 )
 
 type SeatService struct {
-	config   *config.AppConfig
-	seatRepo *repository.SeatRepository
-	txRepo   *repository.TransactionRepository
+	config       *config.AppConfig
+	seatRepo     *repository.SeatRepository
+	txRepo       *repository.TransactionRepository
+	auditService *AuditService
 }
 
-func NewSeatService(config *config.AppConfig, seatRepo *repository.SeatRepository, txRepo *repository.TransactionRepository) *SeatService {
-	return &SeatService{config: config, seatRepo: seatRepo, txRepo: txRepo}
+func NewSeatService(config *config.AppConfig, seatRepo *repository.SeatRepository, txRepo *repository.TransactionRepository, auditService *AuditService) *SeatService {
+	return &SeatService{config: config, seatRepo: seatRepo, txRepo: txRepo, auditService: auditService}
 }
 
 func (s *SeatService) GetAllSeats() ([]model.Seat, error) {
@@ -27,10 +30,43 @@ func (s *SeatService) GetAllSeats() ([]model.Seat, error) {
 	return seats, nil
 }
 
-func (s *SeatService) UpdatePostSaleStatus(link, status string) error {
+// PublicStatus is the status shown on the seat map, a seat that is not purchased is shown available once the transaction time is over
+func (s *SeatService) PublicStatus(seat model.Seat) string {
+	if seat.Status != "purchased" && time.Now().After(seat.CreatedAt.Add(s.config.TransactionMinute)) {
+		return "available"
+	}
+	return seat.Status
+}
+
+// UpdatePostSaleStatus mark the ticket of the link attended or exchanged, the link is a seat link or a general admission ticket code
+func (s *SeatService) UpdatePostSaleStatus(link, status string, actor util.Actor) error {
+	if isTicketCode(link) {
+		return s.updateTicketPostSaleStatus(link, status, actor)
+	}
+	var seat model.Seat
+	if result := s.seatRepo.GetByLink(&seat, link); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return errors.New("cannot find this ticket")
+	} else if result.Error != nil {
+		return errors.New("database operation error")
+	}
 	if result := s.seatRepo.UpdatePostSaleStatus(link, status); result.Error != nil {
 		return errors.New("database operation error")
 	}
+	s.auditService.Record(actor, "seat_post_sale_status_updated", "seat", strconv.Itoa(int(seat.SeatId)), map[string]any{"post_sale_status": seat.PostSaleStatus}, map[string]any{"post_sale_status": status})
+	return nil
+}
+
+func (s *SeatService) updateTicketPostSaleStatus(ticketCode, status string, actor util.Actor) error {
+	var transaction model.Transaction
+	if result := s.txRepo.GetDetailsByTicketCode(&transaction, ticketCode); errors.Is(result.Error, gorm.ErrRecordNotFound) || (result.Error == nil && transaction.Confirmation != "settlement") {
+		return errors.New("cannot find this ticket")
+	} else if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result := s.txRepo.UpdatePostSaleStatusByTicketCode(ticketCode, status); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "ticket_post_sale_status_updated", "transaction", strconv.FormatUint(transaction.TransactionId, 10), map[string]any{"ticket_code": ticketCode, "post_sale_status": transaction.PostSaleStatus}, map[string]any{"post_sale_status": status})
 	return nil
 }
 
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"sort"
+	"strconv"
+)
+
+type SessionService struct {
+	userService  *UserService
+	auditService *AuditService
+	tokenUtil    *util.TokenUtil
+	log          *util.LogUtil
+}
+
+func NewSessionService(userService *UserService, auditService *AuditService, tokenUtil *util.TokenUtil, log *util.LogUtil) *SessionService {
+	return &SessionService{userService: userService, auditService: auditService, tokenUtil: tokenUtil, log: log}
+}
+
+// GetAll list the active sessions of the user, the most recently used first
+func (s *SessionService) GetAll(userId uint64, currentSessionId string) ([]util.Session, error) {
+	sessions, err := s.tokenUtil.GetSessions(userId)
+	if err != nil {
+		return nil, errors.New("cache operation error")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionId == currentSessionId
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *SessionService) Revoke(userId uint64, sessionId string) error {
+	deleted, err := s.tokenUtil.DeleteSession(userId, sessionId)
+	if err != nil {
+		return errors.New("cache operation error")
+	}
+	if !deleted {
+		return errors.New("cannot find this session")
+	}
+	s.log.AuditLog("session_revoked", map[string]any{"user_id": userId, "session_id": sessionId})
+	return nil
+}
+
+// RevokeAll log the user out of every device. The actor is whoever asked for it, it differs from the user for an admin
+func (s *SessionService) RevokeAll(userId uint64, actor util.Actor) (int, error) {
+	if _, err := s.userService.GetById(userId); err != nil {
+		return 0, err
+	}
+	revoked, err := s.tokenUtil.DeleteSessions(userId)
+	if err != nil {
+		return revoked, errors.New("cache operation error")
+	}
+	s.auditService.Record(actor, "sessions_revoked", "user", strconv.FormatUint(userId, 10), nil, map[string]any{"revoked": revoked})
+	return revoked, nil
+}
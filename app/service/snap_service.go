@@ -1,30 +1,54 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"gorm.io/gorm"
 )
 
+var ErrPaymentNotCancelled = errors.New("the payment gateway cannot cancel the payment of the open order, try again later")
+var ErrOrderNotLive = errors.New("the order has no seats or tickets left, its hold was released before the payment")
+var ErrOrderCancelling = errors.New("the order is being replaced by another checkout, its seats and tickets are taken out of it")
+
 type SnapService struct {
-	txService   *TransactionService
-	seatService *SeatService
-	txRepo      *repository.TransactionRepository
-	snapUtil    *util.SnapUtil
-	emailUtil   *util.EmailUtil
-	eticketUtil *util.ETicketUtil
-	log         *util.LogUtil
+	db                *gorm.DB
+	txService         *TransactionService
+	seatService       *SeatService
+	ticketTypeService *TicketTypeService
+	promoService      *PromoCodeService
+	invoiceService    *InvoiceService
+	orderService      *OrderService
+	auditService      *AuditService
+	txRepo            *repository.TransactionRepository
+	userRepo          *repository.UserRepository
+	snapUtil          *util.SnapUtil
+	log               *util.LogUtil
 }
 
-func NewSnapService(txService *TransactionService, seatService *SeatService, txRepo *repository.TransactionRepository, snapUtil *util.SnapUtil, emailUtil *util.EmailUtil, eticketUtil *util.ETicketUtil, log *util.LogUtil) *SnapService {
-	return &SnapService{txService: txService, seatService: seatService, txRepo: txRepo, snapUtil: snapUtil, emailUtil: emailUtil, eticketUtil: eticketUtil, log: log}
+func NewSnapService(db *gorm.DB, txService *TransactionService, seatService *SeatService, ticketTypeService *TicketTypeService, promoService *PromoCodeService, invoiceService *InvoiceService, orderService *OrderService, auditService *AuditService, txRepo *repository.TransactionRepository, userRepo *repository.UserRepository, snapUtil *util.SnapUtil, log *util.LogUtil) *SnapService {
+	return &SnapService{db: db, txService: txService, seatService: seatService, ticketTypeService: ticketTypeService, promoService: promoService, invoiceService: invoiceService, orderService: orderService, auditService: auditService, txRepo: txRepo, userRepo: userRepo, snapUtil: snapUtil, log: log}
 }
 
-func (s *SnapService) HandleSettlement(message map[string]any) error {
-	transactions, _ := s.txService.GetByOrder(message["order_id"].(string))
+// HandleSettlement mark the seats and tickets of the paid order as purchased. It returns ErrOrderNotLive when they were
+// released already, the payment then needs a refund by the admin
+func (s *SnapService) HandleSettlement(message map[string]any, actor util.Actor) error {
+	transactions, err := s.txService.GetByOrder(message["order_id"].(string))
+	if err != nil {
+		return err
+	}
+	if len(transactions) < 1 {
+		s.recordPayment(actor, "payment_settled_without_tickets", message, transactions)
+		return ErrOrderNotLive
+	}
 
 	for _, tx := range transactions { //update seats availability
-		if err := s.seatService.UpdateStatus(tx.SeatId, "purchased"); err != nil {
+		if tx.SeatId == nil { //the general admission ticket was taken from the available tickets when it was held
+			continue
+		}
+		if err := s.seatService.UpdateStatus(*tx.SeatId, "purchased"); err != nil {
 			return err
 		}
 	}
@@ -32,13 +56,31 @@ func (s *SnapService) HandleSettlement(message map[string]any) error {
 	if err := s.txService.UpdatePaymentStatus(message["order_id"].(string), message["payment_type"].(string), message["transaction_status"].(string)); err != nil { //update tx status
 		return err
 	}
+	if err := s.promoService.Settle(message["order_id"].(string)); err != nil { //the promo code use now counts for good
+		return err
+	}
+	if err := s.invoiceService.Issue(message["order_id"].(string)); err != nil { //the invoice gets its number once paid
+		return err
+	}
+	if err := s.orderService.RecordPayment(message); err != nil {
+		return err
+	}
+	s.recordPayment(actor, "payment_settled", message, transactions)
 	return nil
 }
 
-func (s *SnapService) HandleFailure(message map[string]any) error {
+// HandleFailure release the seats and tickets of the order the payment gateway closed. It returns ErrOrderCancelling
+// while the order is being replaced, the notification is retried once they are taken out of the order
+func (s *SnapService) HandleFailure(message map[string]any, actor util.Actor) error {
+	if order, err := s.orderService.GetById(message["order_id"].(string)); err == nil && order.Status == "cancelling" {
+		return ErrOrderCancelling
+	}
 	transactions, _ := s.txService.GetByOrder(message["order_id"].(string))
 	for _, tx := range transactions {
-		if err := s.seatService.UpdateStatus(tx.SeatId, "available"); err != nil {
+		if tx.SeatId == nil {
+			continue
+		}
+		if err := s.seatService.UpdateStatus(*tx.SeatId, "available"); err != nil {
 			return err
 		}
 	}
@@ -46,68 +88,128 @@ func (s *SnapService) HandleFailure(message map[string]any) error {
 	if err := s.txService.UpdatePaymentStatus(message["order_id"].(string), message["payment_type"].(string), message["transaction_status"].(string)); err != nil { //update tx status
 		return err
 	}
+	for _, tx := range transactions { //give the general admission tickets back
+		if tx.SeatId != nil {
+			continue
+		}
+		if err := s.ticketTypeService.ReleaseHold(tx); err != nil {
+			return err
+		}
+	}
 
+	if err := s.promoService.Cancel(message["order_id"].(string)); err != nil { //the promo code can be used again
+		return err
+	}
+	if err := s.invoiceService.Cancel(message["order_id"].(string)); err != nil {
+		return err
+	}
+	if err := s.orderService.RecordPayment(message); err != nil {
+		return err
+	}
 	s.txRepo.SoftDeleteByOrder(message["order_id"].(string)) //soft delete tx status
+	s.recordPayment(actor, "payment_failed", message, transactions)
 	return nil
 
 }
 
-func (s *SnapService) HandlePending(message map[string]any) error {
+func (s *SnapService) HandlePending(message map[string]any, actor util.Actor) error {
+	transactions, _ := s.txService.GetByOrder(message["order_id"].(string))
 
 	if err := s.txService.UpdatePaymentStatus(message["order_id"].(string), message["payment_type"].(string), message["transaction_status"].(string)); err != nil { //update tx status
 		return err
 	}
+
+	instruction := make(map[string]any) //keep how to pay so the payment pending reminder can repeat it
+	for _, key := range []string{"payment_type", "va_numbers", "permata_va_number", "bill_key", "biller_code", "payment_code", "store", "gross_amount", "expiry_time"} {
+		if value, ok := message[key]; ok {
+			instruction[key] = value
+		}
+	}
+	encodedInstruction, _ := json.Marshal(instruction)
+	s.txRepo.UpdateInstruction(message["order_id"].(string), string(encodedInstruction))
+	if err := s.orderService.RecordPayment(message); err != nil {
+		return err
+	}
+	s.recordPayment(actor, "payment_pending", message, transactions)
 	return nil
 }
 
-func (s *SnapService) PrepareTxDetailsByMsg(message map[string]any) ([]model.Seat, string, string) {
-	var seats []model.Seat
-	var userName string
-	var userEmail string
-	transactions, _ := s.txService.GetDetailsByOrder(message["order_id"].(string))
-	for _, tx := range transactions {
-		seats = append(seats, tx.Seat)
+// ReplaceOrder cancel the unpaid order so the buyer can check out again, like with another payment method. The order is
+// marked cancelling first, so the cancel notification of the gateway does not release its seats and tickets, and they
+// are taken out of the order only once the gateway has cancelled the payment
+func (s *SnapService) ReplaceOrder(order model.Order, actor util.Actor) error {
+	if err := s.orderService.MarkCancelling(order.OrderId); err != nil {
+		return err
+	}
+	if err := s.snapUtil.CancelTransaction(order.OrderId); err != nil {
+		s.log.BasicLog(err, "SnapService@ReplaceOrder@CancelTransaction")
+		if reopenErr := s.orderService.Reopen(order.OrderId, order.Status); reopenErr != nil {
+			return reopenErr
+		}
+		return ErrPaymentNotCancelled
 	}
-	userName = transactions[0].User.Name
-	userEmail = transactions[0].User.Email
-	return seats, userName, userEmail
-}
 
-func (s *SnapService) SendInfoEmail(seats []model.Seat, receiverName, receiverEmail string) error {
-	var seatsName []string
-	for _, seat := range seats {
-		seatsName = append(seatsName, seat.Name)
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return errors.New("database operation error")
+	}
+	var user model.User
+	if result := s.userRepo.LockByIdTxn(txn, &user, order.UserId); result.Error != nil { //wait for the other checkout of this user
+		txn.Rollback()
+		return errors.New("database operation error")
 	}
-	data := map[string]any{
-		"Name":  receiverName,
-		"Seats": seatsName,
+	if result := s.txRepo.ReopenByOrderTxn(txn, order.OrderId); result.Error != nil { //the seats and tickets stay reserved for the next checkout
+		txn.Rollback()
+		return errors.New("database operation error")
+	}
+	if err := s.orderService.CancelTxn(txn, order.OrderId); err != nil {
+		txn.Rollback()
+		return err
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return errors.New("database operation error")
+	}
+	if err := s.promoService.Cancel(order.OrderId); err != nil { //the promo code can be used again
+		return err
 	}
-	if err := s.emailUtil.SendInfoEmail(data, receiverEmail); err != nil {
+	if err := s.invoiceService.Cancel(order.OrderId); err != nil {
 		return err
 	}
+	s.auditService.Record(actor, "order_replaced", "order", order.OrderId, map[string]any{"status": order.Status, "payment_method": order.PaymentMethod}, map[string]any{"status": "cancelled"})
 	return nil
 }
 
-func (s *SnapService) SendTicketEmail(seats []model.Seat, receiverName, receiverEmail string) error {
-	var attachments = make(map[string][]byte)
-	var seatsName []string
+// HandleRefund mark the order refunded, the tickets stay with the buyer until an admin revokes them
+func (s *SnapService) HandleRefund(message map[string]any, actor util.Actor) error {
+	transactions, _ := s.txService.GetByOrder(message["order_id"].(string))
+	if err := s.orderService.RecordPayment(message); err != nil {
+		return err
+	}
+	s.recordPayment(actor, "payment_refunded", message, transactions)
+	return nil
+}
 
-	for _, seat := range seats {
-		ticket, err := s.eticketUtil.GenerateETicket(seat.Name, seat.Link)
-		if err != nil {
-			return err
-		}
-		attachments[seat.Name+".png"] = ticket
-		seatsName = append(seatsName, seat.Name)
+// recordPayment store the payment status change of the order, the transactions are the ones read before the change
+func (s *SnapService) recordPayment(actor util.Actor, action string, message map[string]any, transactions []model.Transaction) {
+	before := map[string]any{"confirmation": nil}
+	if len(transactions) > 0 {
+		before = map[string]any{"confirmation": transactions[0].Confirmation, "vendor": transactions[0].Vendor}
 	}
+	after := map[string]any{"confirmation": message["transaction_status"], "vendor": message["payment_type"], "gross_amount": message["gross_amount"]}
+	s.auditService.Record(actor, action, "order", message["order_id"].(string), before, after)
+}
 
-	data := map[string]any{
-		"Name":  receiverName,
-		"Seats": seatsName,
+func (s *SnapService) PrepareTxDetailsByMsg(message map[string]any) ([]model.Seat, model.User, error) {
+	var seats []model.Seat
+	transactions, err := s.txService.GetDetailsByOrder(message["order_id"].(string))
+	if err != nil {
+		return nil, model.User{}, err
 	}
-	if err := s.emailUtil.SendTicketEmail(data, receiverEmail, attachments, seatsName); err != nil { //send the e-ticket email
-		return err
+	if len(transactions) < 1 {
+		return nil, model.User{}, ErrOrderNotLive
 	}
-
-	return nil
+	for _, tx := range transactions {
+		seats = append(seats, TicketSeat(tx))
+	}
+	return seats, transactions[0].User, nil
 }
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"image/png"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStaffCredential   = errors.New("the email or the password is wrong")
+	ErrStaffLocked       = errors.New("too many failed logins, please try again later")
+	ErrStaffTotpRequired = errors.New("the authenticator code or a recovery code is required")
+	ErrStaffTotpInvalid  = errors.New("the authenticator code is not valid")
+)
+
+const (
+	totpPeriod        = 30
+	recoveryCodeCount = 10
+	recoveryAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789" //without the characters that are easily misread
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// dummyPasswordHash is compared when the email is not a staff, so the response time does not reveal the staff emails
+var dummyPasswordHash, _ = util.HashPassword("this is not the password of anyone")
+
+// StaffService manage the password login of the admin and gate accounts, separate from the customer email otp login
+type StaffService struct {
+	userRepo       *repository.UserRepository
+	userService    *UserService
+	sessionService *SessionService
+	auditService   *AuditService
+	config         *config.AppConfig
+	log            *util.LogUtil
+}
+
+func NewStaffService(userRepo *repository.UserRepository, userService *UserService, sessionService *SessionService, auditService *AuditService, config *config.AppConfig, log *util.LogUtil) *StaffService {
+	return &StaffService{userRepo: userRepo, userService: userService, sessionService: sessionService, auditService: auditService, config: config, log: log}
+}
+
+func (s *StaffService) GetAll() ([]model.User, error) {
+	var users []model.User
+	if result := s.userRepo.GetStaff(&users); result.Error != nil {
+		return users, errors.New("database operation error")
+	}
+	return users, nil
+}
+
+func (s *StaffService) Create(name, email, role, password string, actor util.Actor) (model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := util.CheckPasswordPolicy(password, email, s.config.StaffPasswordMinLength); err != nil {
+		return model.User{}, err
+	}
+	if _, err := s.userService.GetByEmail(email); err == nil {
+		return model.User{}, errors.New("this email is already registered")
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return model.User{}, err
+	}
+	hashed, err := util.HashPassword(password)
+	if err != nil {
+		return model.User{}, err
+	}
+	user := model.User{Name: name, Email: email, Role: role, PasswordHash: hashed}
+	if _, err = s.userService.InsertOne(&user); err != nil {
+		return user, err
+	}
+	s.auditService.Record(actor, "staff_created", "user", strconv.FormatUint(user.UserId, 10), nil, map[string]any{"name": name, "email": email, "role": role})
+	return user, nil
+}
+
+// Login check the password and, when the authenticator is enabled, the authenticator code or one of the recovery codes
+func (s *StaffService) Login(email, password, code, recoveryCode, clientIp string) (model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	user, err := s.userService.GetByEmail(email)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && user.Role == "") {
+		util.VerifyPassword(password, dummyPasswordHash)
+		s.log.AuditLog("staff_login_failed", map[string]any{"email": email, "client_ip": clientIp, "reason": "unknown_email"})
+		return model.User{}, ErrStaffCredential
+	} else if err != nil {
+		return model.User{}, err
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		s.log.AuditLog("staff_login_rejected_locked", map[string]any{"user_id": user.UserId, "client_ip": clientIp})
+		return model.User{}, ErrStaffLocked
+	}
+	if !util.VerifyPassword(password, user.PasswordHash) {
+		return model.User{}, s.loginFailed(user, clientIp, "password", ErrStaffCredential)
+	}
+
+	fields := map[string]any{"failed_logins": 0, "locked_until": nil, "last_login_at": time.Now()}
+	if user.TotpEnabled {
+		if code == "" && recoveryCode == "" { //the password is right, ask for the second factor without counting a failure
+			return model.User{}, ErrStaffTotpRequired
+		}
+		if code != "" {
+			if err = s.useTotp(user, code); err != nil {
+				return model.User{}, s.loginFailed(user, clientIp, "totp", err)
+			}
+		} else {
+			remaining, left, ok := useRecoveryCode(user.RecoveryCodes, recoveryCode)
+			if !ok {
+				return model.User{}, s.loginFailed(user, clientIp, "recovery_code", ErrStaffTotpInvalid)
+			}
+			fields["recovery_codes"] = remaining
+			s.log.AuditLog("staff_recovery_code_used", map[string]any{"user_id": user.UserId, "client_ip": clientIp, "recovery_codes_left": left})
+		}
+	}
+	if result := s.userRepo.UpdateFieldsById(user.UserId, fields); result.Error != nil {
+		return model.User{}, errors.New("database operation error")
+	}
+	s.log.AuditLog("staff_login", map[string]any{"user_id": user.UserId, "client_ip": clientIp, "role": user.Role})
+	return user, nil
+}
+
+// loginFailed count the failure and lock the account once it reaches the limit
+func (s *StaffService) loginFailed(user model.User, clientIp, reason string, err error) error {
+	fields := map[string]any{"failed_logins": user.FailedLogins + 1}
+	if user.FailedLogins+1 >= s.config.StaffMaxFailedLogin {
+		fields = map[string]any{"failed_logins": 0, "locked_until": time.Now().Add(s.config.StaffLockMinute)}
+		err = ErrStaffLocked
+	}
+	s.userRepo.UpdateFieldsById(user.UserId, fields)
+	s.log.AuditLog("staff_login_failed", map[string]any{"user_id": user.UserId, "client_ip": clientIp, "reason": reason})
+	if errors.Is(err, ErrStaffLocked) {
+		s.log.AuditLog("staff_locked", map[string]any{"user_id": user.UserId, "client_ip": clientIp})
+	}
+	return err
+}
+
+func (s *StaffService) ChangePassword(userId uint64, currentPassword, newPassword string, actor util.Actor) error {
+	user, err := s.userService.GetById(userId)
+	if err != nil {
+		return err
+	}
+	if !util.VerifyPassword(currentPassword, user.PasswordHash) {
+		return ErrStaffCredential
+	}
+	if currentPassword == newPassword {
+		return errors.New("the new password must be different")
+	}
+	if err = util.CheckPasswordPolicy(newPassword, user.Email, s.config.StaffPasswordMinLength); err != nil {
+		return err
+	}
+	hashed, err := util.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if result := s.userRepo.UpdateFieldsById(userId, map[string]any{"password_hash": hashed}); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "staff_password_changed", "user", strconv.FormatUint(userId, 10), nil, nil)
+	_, err = s.sessionService.RevokeAll(userId, actor) //every device must sign in again with the new password
+	return err
+}
+
+// EnrollTotp create a new authenticator secret. It is only used after the first code is confirmed.
+// It returns the otpauth url and its qr code as a png data uri
+func (s *StaffService) EnrollTotp(userId uint64) (string, string, error) {
+	user, err := s.userService.GetById(userId)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TotpEnabled {
+		return "", "", errors.New("the authenticator is already enabled, disable it first")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: s.config.AppName, AccountName: user.Email, Period: totpPeriod})
+	if err != nil {
+		return "", "", err
+	}
+	image, err := key.Image(256, 256)
+	if err != nil {
+		return "", "", err
+	}
+	var buffer bytes.Buffer
+	if err = png.Encode(&buffer, image); err != nil {
+		return "", "", err
+	}
+	if result := s.userRepo.UpdateFieldsById(userId, map[string]any{"totp_secret": key.Secret(), "totp_counter": 0}); result.Error != nil {
+		return "", "", errors.New("database operation error")
+	}
+	return key.URL(), "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// ConfirmTotp enable the authenticator when the code is right. It returns the recovery codes, they are only shown once
+func (s *StaffService) ConfirmTotp(userId uint64, code string) ([]string, error) {
+	user, err := s.userService.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, errors.New("the authenticator is already enabled")
+	}
+	if user.TotpSecret == "" {
+		return nil, errors.New("start the authenticator enrollment first")
+	}
+	if err = s.useTotp(user, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if result := s.userRepo.UpdateFieldsById(userId, map[string]any{"totp_enabled": true, "recovery_codes": hashes}); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	s.log.AuditLog("staff_totp_enabled", map[string]any{"user_id": userId})
+	return codes, nil
+}
+
+func (s *StaffService) DisableTotp(userId uint64, password, code string) error {
+	user, err := s.userService.GetById(userId)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return errors.New("the authenticator is not enabled")
+	}
+	if !util.VerifyPassword(password, user.PasswordHash) {
+		return ErrStaffCredential
+	}
+	if err = s.useTotp(user, code); err != nil {
+		return err
+	}
+	fields := map[string]any{"totp_enabled": false, "totp_secret": "", "totp_counter": 0, "recovery_codes": ""}
+	if result := s.userRepo.UpdateFieldsById(userId, fields); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	s.log.AuditLog("staff_totp_disabled", map[string]any{"user_id": userId})
+	return nil
+}
+
+// RegenerateRecoveryCodes replace every recovery code of the user with new ones
+func (s *StaffService) RegenerateRecoveryCodes(userId uint64, password string) ([]string, error) {
+	user, err := s.userService.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TotpEnabled {
+		return nil, errors.New("the authenticator is not enabled")
+	}
+	if !util.VerifyPassword(password, user.PasswordHash) {
+		return nil, ErrStaffCredential
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if result := s.userRepo.UpdateFieldsById(userId, map[string]any{"recovery_codes": hashes}); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	s.log.AuditLog("staff_recovery_codes_regenerated", map[string]any{"user_id": userId})
+	return codes, nil
+}
+
+// useTotp accept the code of the current, the previous or the next time step, but never a time step that has been used
+func (s *StaffService) useTotp(user model.User, code string) error {
+	now := time.Now()
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		counter := at.Unix() / totpPeriod
+		if counter <= user.TotpCounter {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.TotpSecret, at, totpOpts)
+		if err != nil || subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		result := s.userRepo.UpdateTotpCounter(user.UserId, counter) //only one request can use this time step
+		if result.Error != nil {
+			return errors.New("database operation error")
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaffTotpInvalid
+		}
+		return nil
+	}
+	return ErrStaffTotpInvalid
+}
+
+// generateRecoveryCodes return the codes to show and their bcrypt hashes to store
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	alphabetSize := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := range codes {
+		raw := make([]byte, 10)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, "", err
+			}
+			raw[j] = recoveryAlphabet[n.Int64()]
+		}
+		hashed, err := util.HashPassword(string(raw))
+		if err != nil {
+			return nil, "", err
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		hashes[i] = hashed
+	}
+	return codes, strings.Join(hashes, "\n"), nil
+}
+
+// useRecoveryCode find the code among the stored hashes. It returns the hashes without the used one and how many are left
+func useRecoveryCode(stored, code string) (string, int, bool) {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hashes := strings.Fields(stored)
+	for i, hashed := range hashes {
+		if util.VerifyPassword(code, hashed) {
+			remaining := append(hashes[:i:i], hashes[i+1:]...)
+			return strings.Join(remaining, "\n"), len(remaining), true
+		}
+	}
+	return stored, len(hashes), false
+}
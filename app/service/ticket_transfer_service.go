@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrTicketTransferNotFound = errors.New("cannot find this ticket transfer")
+
+type TicketTransferService struct {
+	config       *config.AppConfig
+	db           *gorm.DB
+	transferRepo *repository.TicketTransferRepository
+	txRepo       *repository.TransactionRepository
+	seatRepo     *repository.SeatRepository
+	txService    *TransactionService
+	userService  *UserService
+	emailService *EmailService
+	auditService *AuditService
+}
+
+func NewTicketTransferService(config *config.AppConfig, db *gorm.DB, transferRepo *repository.TicketTransferRepository, txRepo *repository.TransactionRepository, seatRepo *repository.SeatRepository, txService *TransactionService, userService *UserService, emailService *EmailService, auditService *AuditService) *TicketTransferService {
+	return &TicketTransferService{config: config, db: db, transferRepo: transferRepo, txRepo: txRepo, seatRepo: seatRepo, txService: txService, userService: userService, emailService: emailService, auditService: auditService}
+}
+
+// Offer start the transfer of the user's purchased seat or ticket, the link is the one in its e-ticket qr code. The
+// ticket stays with the user until the receiver accepts it
+func (s *TicketTransferService) Offer(userId uint64, link, email string, actor util.Actor) (model.TicketTransfer, error) {
+	if s.closed() {
+		return model.TicketTransfer{}, errors.New("the ticket transfers are closed for this event")
+	}
+	tx, err := s.txService.GetDetailsByLink(link)
+	if err != nil || tx.UserId != userId || tx.Confirmation != "settlement" { //do not tell the ticket of another user exists
+		return model.TicketTransfer{}, errors.New("cannot find this ticket")
+	}
+	seat := TicketSeat(tx)
+	if seat.PostSaleStatus != "" {
+		return model.TicketTransfer{}, errors.New("this ticket has been " + seat.PostSaleStatus + " already")
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == strings.ToLower(tx.User.Email) {
+		return model.TicketTransfer{}, errors.New("this ticket is yours already")
+	}
+	pending, err := s.transferRepo.CountByStatusTxn(s.db, tx.TransactionId, "pending")
+	if err != nil {
+		return model.TicketTransfer{}, errors.New("database operation error")
+	}
+	if pending > 0 {
+		return model.TicketTransfer{}, errors.New("this ticket has a pending transfer already, cancel it first")
+	}
+	if err = s.checkLimitTxn(s.db, tx.TransactionId); err != nil {
+		return model.TicketTransfer{}, err
+	}
+
+	transfer := model.TicketTransfer{TransactionId: tx.TransactionId, FromUserId: userId, ToEmail: email, Status: "pending", SeatName: seat.Name}
+	if result := s.transferRepo.InsertOne(&transfer); result.Error != nil { //also when a concurrent offer took the only pending slot
+		return transfer, errors.New("database operation error")
+	}
+	receiver, _ := s.userService.GetByEmail(email)
+	if err = s.emailService.QueueTransferOfferEmail(seat.Name, tx.User, email, receiver.Locale); err != nil {
+		return transfer, err
+	}
+	s.auditService.Record(actor, "ticket_transfer_offered", "transaction", strconv.FormatUint(tx.TransactionId, 10), nil, map[string]any{"ticket_transfer_id": transfer.TicketTransferId, "to_email": email})
+	return transfer, nil
+}
+
+// Accept move the ticket to the user, who must be logged in with the email it was offered to. The seat or ticket gets
+// a new link so the e-ticket of the previous owner stops working
+func (s *TicketTransferService) Accept(transferId uint64, user model.User, actor util.Actor) (model.TicketTransfer, model.Seat, error) {
+	var transfer model.TicketTransfer
+	var seat model.Seat
+	if s.closed() {
+		return transfer, seat, errors.New("the ticket transfers are closed for this event")
+	}
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return transfer, seat, errors.New("database operation error")
+	}
+	if result := s.transferRepo.LockByIdTxn(txn, &transfer, transferId); errors.Is(result.Error, gorm.ErrRecordNotFound) || (result.Error == nil && transfer.ToEmail != strings.ToLower(user.Email)) {
+		txn.Rollback()
+		return transfer, seat, ErrTicketTransferNotFound
+	} else if result.Error != nil {
+		txn.Rollback()
+		return transfer, seat, errors.New("database operation error")
+	}
+	if transfer.Status != "pending" {
+		txn.Rollback()
+		return transfer, seat, errors.New("this ticket transfer has been " + transfer.Status + " already")
+	}
+
+	var tx model.Transaction
+	if result := s.txRepo.LockByIdTxn(txn, &tx, transfer.TransactionId); result.Error != nil || tx.UserId != transfer.FromUserId || tx.Confirmation != "settlement" {
+		txn.Rollback()
+		return transfer, seat, errors.New("the ticket of this transfer is no longer available")
+	}
+	postSaleStatus := tx.PostSaleStatus
+	if tx.SeatId != nil { //the gate marks the seat, not the transaction
+		var seats []model.Seat
+		if result := s.seatRepo.LockByIdsTxn(txn, &seats, []uint{*tx.SeatId}); result.Error != nil || len(seats) < 1 {
+			txn.Rollback()
+			return transfer, seat, errors.New("database operation error")
+		}
+		postSaleStatus = seats[0].PostSaleStatus
+	}
+	if postSaleStatus != "" {
+		txn.Rollback()
+		return transfer, seat, errors.New("this ticket has been " + postSaleStatus + " already")
+	}
+	if err := s.checkLimitTxn(txn, tx.TransactionId); err != nil {
+		txn.Rollback()
+		return transfer, seat, err
+	}
+
+	columns := map[string]any{"user_id": user.UserId}
+	link := uuid.New().String()
+	if tx.SeatId != nil {
+		if result := s.seatRepo.UpdateLinkTxn(txn, *tx.SeatId, link); result.Error != nil {
+			txn.Rollback()
+			return transfer, seat, errors.New("database operation error")
+		}
+	} else { //a general admission ticket code is also its link
+		ticketCode, err := newTicketCode()
+		if err != nil {
+			txn.Rollback()
+			return transfer, seat, err
+		}
+		columns["ticket_code"], link = ticketCode, ticketCode
+	}
+	if result := s.txRepo.UpdateByIdTxn(txn, tx.TransactionId, columns); result.Error != nil {
+		txn.Rollback()
+		return transfer, seat, errors.New("database operation error")
+	}
+	now := time.Now()
+	if result := s.transferRepo.UpdateTxn(txn, transfer.TicketTransferId, "pending", map[string]any{"status": "accepted", "to_user_id": user.UserId, "accepted_at": now}); result.Error != nil {
+		txn.Rollback()
+		return transfer, seat, errors.New("database operation error")
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return transfer, seat, errors.New("database operation error")
+	}
+	transfer.Status, transfer.ToUserId, transfer.AcceptedAt = "accepted", &user.UserId, &now
+	seat = model.Seat{Name: transfer.SeatName, Link: link}
+	if tx.SeatId == nil { //the general admission ticket is named after its code
+		seat.Name = strings.Replace(transfer.SeatName, tx.TicketCode, link, 1)
+	}
+
+	from, _ := s.userService.GetById(transfer.FromUserId)
+	transfer.FromUser = from
+	if err := s.emailService.QueueTransferReceivedEmail(seat, from, user); err != nil {
+		return transfer, seat, err
+	}
+	if err := s.emailService.QueueTransferCompletedEmail(transfer.SeatName, from, user.Email); err != nil {
+		return transfer, seat, err
+	}
+	s.auditService.Record(actor, "ticket_transferred", "transaction", strconv.FormatUint(tx.TransactionId, 10), map[string]any{"user_id": tx.UserId}, map[string]any{"user_id": user.UserId, "ticket_transfer_id": transfer.TicketTransferId})
+	return transfer, seat, nil
+}
+
+// Cancel withdraw the pending transfer, by the owner or by the receiver turning it down
+func (s *TicketTransferService) Cancel(transferId uint64, user model.User, actor util.Actor) (model.TicketTransfer, error) {
+	var transfer model.TicketTransfer
+	if result := s.transferRepo.GetById(&transfer, transferId); errors.Is(result.Error, gorm.ErrRecordNotFound) || (result.Error == nil && transfer.FromUserId != user.UserId && transfer.ToEmail != strings.ToLower(user.Email)) {
+		return transfer, ErrTicketTransferNotFound
+	} else if result.Error != nil {
+		return transfer, errors.New("database operation error")
+	}
+	if transfer.Status != "pending" {
+		return transfer, errors.New("this ticket transfer has been " + transfer.Status + " already")
+	}
+	now := time.Now()
+	result := s.transferRepo.UpdateTxn(s.db, transferId, "pending", map[string]any{"status": "cancelled", "cancelled_at": now})
+	if result.Error != nil {
+		return transfer, errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 { //accepted or cancelled in the meantime
+		return transfer, errors.New("this ticket transfer is no longer pending")
+	}
+	transfer.Status, transfer.CancelledAt = "cancelled", &now
+	s.auditService.Record(actor, "ticket_transfer_cancelled", "transaction", strconv.FormatUint(transfer.TransactionId, 10), map[string]any{"ticket_transfer_id": transferId, "status": "pending"}, map[string]any{"status": "cancelled"})
+	return transfer, nil
+}
+
+// GetByUser list the transfers the user offered and the ones offered to the user
+func (s *TicketTransferService) GetByUser(user model.User) ([]model.TicketTransfer, error) {
+	var transfers []model.TicketTransfer
+	if result := s.transferRepo.GetByUser(&transfers, user.UserId, strings.ToLower(user.Email)); result.Error != nil {
+		return transfers, errors.New("database operation error")
+	}
+	return transfers, nil
+}
+
+// checkLimitTxn refuse the ticket that has changed hands as many times as allowed
+func (s *TicketTransferService) checkLimitTxn(txn *gorm.DB, transactionId uint64) error {
+	if s.config.TransferLimit < 1 {
+		return nil
+	}
+	accepted, err := s.transferRepo.CountByStatusTxn(txn, transactionId, "accepted")
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	if accepted >= int64(s.config.TransferLimit) {
+		return errors.New("this ticket has been transferred " + strconv.FormatInt(accepted, 10) + " times, it cannot be transferred again")
+	}
+	return nil
+}
+
+// closed tell whether the event is too close for the tickets to change hands
+func (s *TicketTransferService) closed() bool {
+	return s.config.EventStartsAt != nil && time.Now().After(s.config.EventStartsAt.Add(-s.config.TransferCutoff))
+}
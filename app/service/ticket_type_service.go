@@ -0,0 +1,313 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gorm.io/gorm"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ticketCodePrefix   = "GA-"
+	ticketCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" //without the look alike characters
+)
+
+var ErrTicketTypeNotFound = errors.New("cannot find this ticket type")
+
+// TicketSoldOutError tell the buyer that the ticket type does not have enough tickets left, the controller return it as is
+type TicketSoldOutError struct {
+	TicketTypeId uint64 `json:"ticket_type_id"`
+	Name         string `json:"name"`
+	Available    uint   `json:"available"`
+	Requested    int    `json:"requested"`
+}
+
+func (e *TicketSoldOutError) Error() string {
+	if e.Available == 0 {
+		return "the " + e.Name + " tickets are sold out"
+	}
+	return fmt.Sprintf("only %d %s tickets are left, you cannot reserve %d", e.Available, e.Name, e.Requested)
+}
+
+type TicketTypeService struct {
+	config         *config.AppConfig
+	db             *gorm.DB
+	ticketTypeRepo *repository.TicketTypeRepository
+	categoryRepo   *repository.PriceCategoryRepository
+	txRepo         *repository.TransactionRepository
+	auditService   *AuditService
+}
+
+func NewTicketTypeService(config *config.AppConfig, db *gorm.DB, ticketTypeRepo *repository.TicketTypeRepository, categoryRepo *repository.PriceCategoryRepository, txRepo *repository.TransactionRepository, auditService *AuditService) *TicketTypeService {
+	return &TicketTypeService{config: config, db: db, ticketTypeRepo: ticketTypeRepo, categoryRepo: categoryRepo, txRepo: txRepo, auditService: auditService}
+}
+
+func (s *TicketTypeService) GetAll() ([]model.TicketType, error) {
+	var ticketTypes []model.TicketType
+	if result := s.ticketTypeRepo.GetAll(&ticketTypes); result.Error != nil {
+		return nil, errors.New("database operation error")
+	}
+	return ticketTypes, nil
+}
+
+// GetMap return the ticket types by id
+func (s *TicketTypeService) GetMap() (map[uint64]model.TicketType, error) {
+	ticketTypes, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[uint64]model.TicketType, len(ticketTypes))
+	for _, ticketType := range ticketTypes {
+		byId[ticketType.TicketTypeId] = ticketType
+	}
+	return byId, nil
+}
+
+// Create add a ticket type with all of its capacity available. The ticket type in a price category gets the category price
+func (s *TicketTypeService) Create(ticketType model.TicketType, actor util.Actor) (model.TicketType, error) {
+	var existing model.TicketType
+	if result := s.ticketTypeRepo.GetByName(&existing, ticketType.Name); result.Error == nil {
+		return ticketType, errors.New("this ticket type name is already used")
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return ticketType, errors.New("database operation error")
+	}
+	if err := s.applyCategory(&ticketType); err != nil {
+		return ticketType, err
+	}
+	ticketType.Available = ticketType.Capacity
+	if result := s.ticketTypeRepo.InsertOne(&ticketType); result.Error != nil {
+		return ticketType, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "ticket_type_created", "ticket_type", strconv.FormatUint(ticketType.TicketTypeId, 10), nil, ticketType)
+	return ticketType, nil
+}
+
+// Update change the ticket type. A new capacity moves the available tickets by the same amount, it cannot go below
+// the tickets that are held or sold already
+func (s *TicketTypeService) Update(ticketTypeId uint64, input model.TicketType, actor util.Actor) (model.TicketType, error) {
+	if err := s.applyCategory(&input); err != nil {
+		return input, err
+	}
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return input, errors.New("database operation error")
+	}
+	var ticketType model.TicketType
+	if result := s.ticketTypeRepo.LockByIdTxn(txn, &ticketType, ticketTypeId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		txn.Rollback()
+		return ticketType, ErrTicketTypeNotFound
+	} else if result.Error != nil {
+		txn.Rollback()
+		return ticketType, errors.New("database operation error")
+	}
+	if input.Name != ticketType.Name {
+		var existing model.TicketType
+		if result := s.ticketTypeRepo.GetByName(&existing, input.Name); result.Error == nil {
+			txn.Rollback()
+			return ticketType, errors.New("this ticket type name is already used")
+		}
+	}
+	taken := ticketType.Capacity - ticketType.Available
+	if input.Capacity < taken {
+		txn.Rollback()
+		return ticketType, errors.New(strconv.FormatUint(uint64(taken), 10) + " tickets are held or sold already, the capacity cannot be lower")
+	}
+	before := ticketType
+	ticketType.Name, ticketType.Description, ticketType.Price, ticketType.PriceCategoryId, ticketType.OnSale = input.Name, input.Description, input.Price, input.PriceCategoryId, input.OnSale
+	ticketType.Capacity, ticketType.Available = input.Capacity, input.Capacity-taken
+	if result := s.ticketTypeRepo.SaveTxn(txn, &ticketType); result.Error != nil {
+		txn.Rollback()
+		return ticketType, errors.New("database operation error")
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return ticketType, errors.New("database operation error")
+	}
+	s.auditService.Record(actor, "ticket_type_updated", "ticket_type", strconv.FormatUint(ticketTypeId, 10), before, ticketType)
+	return ticketType, nil
+}
+
+// Delete remove a ticket type that has never been reserved, otherwise it can only be taken off sale
+func (s *TicketTypeService) Delete(ticketTypeId uint64, actor util.Actor) error {
+	count, err := s.txRepo.CountByTicketType(ticketTypeId)
+	if err != nil {
+		return errors.New("database operation error")
+	}
+	if count > 0 {
+		return errors.New("this ticket type has been reserved, take it off sale instead")
+	}
+	result := s.ticketTypeRepo.DeleteById(ticketTypeId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 {
+		return ErrTicketTypeNotFound
+	}
+	s.auditService.Record(actor, "ticket_type_deleted", "ticket_type", strconv.FormatUint(ticketTypeId, 10), nil, nil)
+	return nil
+}
+
+// ReserveTxn hold the quantity of tickets of each ticket type for the user, one transaction with its own ticket code
+// per ticket. The expired holds of the ticket type are released first so their tickets can be taken again.
+// It returns a *TicketSoldOutError when a ticket type does not have enough tickets left
+func (s *TicketTypeService) ReserveTxn(txn *gorm.DB, userId uint64, quantities map[uint64]int, priceList PriceList) error {
+	ticketTypeIds := make([]uint64, 0, len(quantities))
+	for ticketTypeId := range quantities {
+		ticketTypeIds = append(ticketTypeIds, ticketTypeId)
+	}
+	sort.Slice(ticketTypeIds, func(i, j int) bool { return ticketTypeIds[i] < ticketTypeIds[j] }) //the same locking order for every reservation
+
+	for _, ticketTypeId := range ticketTypeIds {
+		ticketTypeId := ticketTypeId
+		if err := s.releaseExpiredTxn(txn, ticketTypeId); err != nil {
+			return err
+		}
+		quantity := quantities[ticketTypeId]
+		result := s.ticketTypeRepo.TakeTxn(txn, ticketTypeId, quantity)
+		if result.Error != nil {
+			return errors.New("database operation error")
+		}
+		var ticketType model.TicketType
+		if result := s.ticketTypeRepo.LockByIdTxn(txn, &ticketType, ticketTypeId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrTicketTypeNotFound
+		} else if result.Error != nil {
+			return errors.New("database operation error")
+		}
+		if result.RowsAffected < 1 {
+			soldOut := &TicketSoldOutError{TicketTypeId: ticketTypeId, Name: ticketType.Name, Available: ticketType.Available, Requested: quantity}
+			if !ticketType.OnSale {
+				soldOut.Available = 0
+			}
+			return soldOut
+		}
+		price := priceList.TicketTypePrice(ticketType) //the buyer pays the price of the reservation time
+		for i := 0; i < quantity; i++ {
+			code, err := newTicketCode()
+			if err != nil {
+				return err
+			}
+			tx := model.Transaction{
+				OrderId:      "",
+				UserId:       userId,
+				TicketTypeId: &ticketTypeId,
+				TicketCode:   code,
+				Price:        &price,
+				Vendor:       "no_vendor",
+				Confirmation: "reserved",
+			}
+			if result := s.txRepo.InsertOneTxn(txn, &tx); result.Error != nil {
+				return errors.New("database operation error")
+			}
+		}
+	}
+	return nil
+}
+
+// ReleaseHold end the general admission hold and give its ticket back, a hold that has been released already is skipped
+func (s *TicketTypeService) ReleaseHold(tx model.Transaction) error {
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return errors.New("database operation error")
+	}
+	if err := s.releaseTxn(txn, tx); err != nil {
+		txn.Rollback()
+		return err
+	}
+	if err := txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+func (s *TicketTypeService) releaseTxn(txn *gorm.DB, tx model.Transaction) error {
+	result := s.txRepo.SoftDeleteByIdTxn(txn, tx.TransactionId)
+	if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	if result.RowsAffected < 1 || tx.TicketTypeId == nil { //only the one that actually ended the hold gives the ticket back
+		return nil
+	}
+	if result = s.ticketTypeRepo.GiveBackTxn(txn, *tx.TicketTypeId, 1); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	return nil
+}
+
+func (s *TicketTypeService) releaseExpiredTxn(txn *gorm.DB, ticketTypeId uint64) error {
+	var expired []model.Transaction
+	if result := s.txRepo.GetUnpaidByTicketTypeCreatedBeforeTxn(txn, &expired, ticketTypeId, time.Now().Add(-s.config.TransactionMinute)); result.Error != nil {
+		return errors.New("database operation error")
+	}
+	for _, tx := range expired {
+		if err := s.releaseTxn(txn, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCategory copy the price of the ticket type's category
+func (s *TicketTypeService) applyCategory(ticketType *model.TicketType) error {
+	if ticketType.PriceCategoryId == nil {
+		return nil
+	}
+	var category model.PriceCategory
+	if result := s.categoryRepo.GetById(&category, *ticketType.PriceCategoryId); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return ErrPriceCategoryNotFound
+	} else if result.Error != nil {
+		return errors.New("database operation error")
+	}
+	ticketType.Price = category.Price
+	return nil
+}
+
+// TicketSeat is the seat shown for the transaction. A general admission ticket has no seat, it is shown as a seat named
+// after the ticket type and the ticket code, with the ticket code as the link. So the emails, the e-tickets and the
+// scanner handle both kinds of tickets the same way
+func TicketSeat(tx model.Transaction) model.Seat {
+	if tx.Price != nil { //the price locked at reservation
+		tx.Seat.Price, tx.TicketType.Price = *tx.Price, *tx.Price
+	}
+	if tx.TicketTypeId == nil {
+		return tx.Seat
+	}
+	status := "reserved"
+	if tx.Confirmation == "settlement" {
+		status = "purchased"
+	}
+	return model.Seat{
+		Name:            tx.TicketType.Name + " " + tx.TicketCode,
+		Price:           tx.TicketType.Price,
+		PriceCategoryId: tx.TicketType.PriceCategoryId,
+		Link:            tx.TicketCode,
+		Status:          status,
+		PostSaleStatus:  tx.PostSaleStatus,
+	}
+}
+
+// isTicketCode tell the general admission ticket code apart from the seat link, which is an uuid
+func isTicketCode(link string) bool {
+	return strings.HasPrefix(link, ticketCodePrefix)
+}
+
+// newTicketCode generate the unguessable ticket code, it is also the link in the e-ticket qr code
+func newTicketCode() (string, error) {
+	code := make([]byte, 12)
+	alphabetSize := big.NewInt(int64(len(ticketCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = ticketCodeAlphabet[n.Int64()]
+	}
+	return ticketCodePrefix + string(code), nil
+}
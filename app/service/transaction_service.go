@@ -4,34 +4,58 @@ import (
 	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/google/uuid"
 	"github.com/midtrans/midtrans-go"
 	"github.com/midtrans/midtrans-go/snap"
+	"gorm.io/gorm"
 	"strconv"
 	"time"
 )
 
+var ErrTicketNotFound = errors.New("cannot find this ticket")
+
 type TransactionService struct {
-	txRepo *repository.TransactionRepository
-	config *config.AppConfig
+	db                *gorm.DB
+	txRepo            *repository.TransactionRepository
+	userRepo          *repository.UserRepository
+	categoryRepo      *repository.PriceCategoryRepository
+	ticketTypeService *TicketTypeService
+	promoService      *PromoCodeService
+	pricingService    *PricingService
+	invoiceService    *InvoiceService
+	orderService      *OrderService
+	config            *config.AppConfig
 }
 
-func NewTransactionService(txRepo *repository.TransactionRepository, config *config.AppConfig) *TransactionService {
-	return &TransactionService{txRepo: txRepo, config: config}
+func NewTransactionService(db *gorm.DB, txRepo *repository.TransactionRepository, userRepo *repository.UserRepository, categoryRepo *repository.PriceCategoryRepository, ticketTypeService *TicketTypeService, promoService *PromoCodeService, pricingService *PricingService, invoiceService *InvoiceService, orderService *OrderService, config *config.AppConfig) *TransactionService {
+	return &TransactionService{db: db, txRepo: txRepo, userRepo: userRepo, categoryRepo: categoryRepo, ticketTypeService: ticketTypeService, promoService: promoService, pricingService: pricingService, invoiceService: invoiceService, orderService: orderService, config: config}
 }
 
-func (s *TransactionService) CreateTx(userId uint64, seatIds []uint) error {
+// CreateTxTxn create the reservation of the seats in the database transaction of the reservation, locking the given
+// price of each seat
+func (s *TransactionService) CreateTxTxn(txn *gorm.DB, userId uint64, seatIds []uint, prices map[uint]uint) error {
+	for _, seatId := range seatIds { //every seat is priced before anything is stored
+		if _, ok := prices[seatId]; !ok {
+			return errors.New("cannot find the price of this seat. seat_id: " + strconv.Itoa(int(seatId)))
+		}
+	}
 	for _, seatId := range seatIds { //create tx for each seat
+		seatId := seatId
+		price := prices[seatId]
 		newTx := model.Transaction{
 			OrderId:      "",
 			UserId:       userId,
-			SeatId:       seatId,
+			SeatId:       &seatId,
+			Price:        &price,
 			Vendor:       "no_vendor",
 			Confirmation: "reserved",
 		}
-		s.txRepo.SoftDeleteBySeatUser(seatId, userId)                  //delete the previous failed reservation
-		if result := s.txRepo.InsertOne(&newTx); result.Error != nil { //save the transaction
+		if result := s.txRepo.SoftDeleteBySeatUserTxn(txn, seatId, userId); result.Error != nil { //delete the previous failed reservation
+			return errors.New("database operation error")
+		}
+		if result := s.txRepo.InsertOneTxn(txn, &newTx); result.Error != nil { //save the transaction
 			return errors.New("database operation error")
 		}
 	}
@@ -48,7 +72,17 @@ func (s *TransactionService) GetAllWithDetails() ([]model.Transaction, error) {
 
 func (s *TransactionService) GetDetailsByLink(link string) (model.Transaction, error) {
 	var transaction model.Transaction
-	if result := s.txRepo.GetDetailsByLink(&transaction, link); result.Error != nil {
+	if isTicketCode(link) { //a general admission ticket
+		if result := s.txRepo.GetDetailsByTicketCode(&transaction, link); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return transaction, ErrTicketNotFound
+		} else if result.Error != nil {
+			return transaction, errors.New("database operation error")
+		}
+		return transaction, nil
+	}
+	if result := s.txRepo.GetDetailsByLink(&transaction, link); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return transaction, ErrTicketNotFound
+	} else if result.Error != nil {
 		return transaction, errors.New("database operation error")
 	}
 	return transaction, nil
@@ -94,7 +128,14 @@ func (s *TransactionService) CleanUpGhostTransaction(transactions []model.Transa
 		if time.Now().After(tx.CreatedAt.Add(s.config.TransactionMinute)) && tx.Confirmation != "settlement" { //if tx created_at + 15 < time now  => berarti transaction ngambang
 			//update database
 			s.txRepo.UpdateUserPaymentStatus(tx.UserId, "", "not_continued")
-			s.txRepo.SoftDeleteBySeatUser(tx.SeatId, tx.UserId)
+			if tx.OrderId != "" { //the checkout was started but not paid
+				s.orderService.Expire(tx.OrderId)
+			}
+			if tx.SeatId == nil { //a general admission hold gives its ticket back
+				s.ticketTypeService.ReleaseHold(tx)
+				continue
+			}
+			s.txRepo.SoftDeleteBySeatUser(*tx.SeatId, tx.UserId)
 		} else {
 			newTransaction = append(newTransaction, tx)
 		}
@@ -114,6 +155,9 @@ func (s *TransactionService) SeatsBelongsToUser(userId uint64) ([]model.Seat, er
 		return seats, errors.New("this user doesen`t have any transaction")
 	}
 	for _, tx := range transactions {
+		if tx.SeatId == nil { //general admission tickets are not on the seat map
+			continue
+		}
 		if tx.Confirmation == "reserved" {
 			tx.Seat.Status = "reserved_by_me"
 		}
@@ -125,43 +169,201 @@ func (s *TransactionService) SeatsBelongsToUser(userId uint64) ([]model.Seat, er
 	return seats, nil
 }
 
-func (s *TransactionService) PrepareTransactionData(userId uint64) (snap.Request, error) {
+// PrepareTransactionData create the order of the user's reserved seats and tickets. The discount of the promo code, when
+// given, is a negative item so the payment page shows it, followed by the fees and the tax of the invoice. The payment
+// page only offers the payment method when one is given. The checkouts of a user run one at a time. It returns a
+// *PromoCodeError when the promo code cannot be used, and ErrCheckoutRepeated when the idempotency key has an order
+func (s *TransactionService) PrepareTransactionData(userId uint64, promoCode, paymentMethod, idempotencyKey string) (snap.Request, error) {
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return snap.Request{}, errors.New("database operation error")
+	}
+	var user model.User
+	if result := s.userRepo.LockByIdTxn(txn, &user, userId); result.Error != nil { //wait for the other checkout of this user
+		txn.Rollback()
+		return snap.Request{}, errors.New("database operation error")
+	}
 	var txDetails []model.Transaction
 	s.txRepo.GetDetailsByUserConfirmation(&txDetails, userId, "reserved")     //get user's transaction
 	if txDetails = s.CleanUpGhostTransaction(txDetails); len(txDetails) < 1 { //clean up 'ghost' transaction that may be created by this user
+		txn.Rollback()
 		return snap.Request{}, errors.New("cannot find any transaction for this user")
 	}
-	orderId := uuid.New().String()               //create order_id for the new midtrans transaction
-	s.txRepo.UpdateUserOrderId(userId, orderId)  //update order_id of this transaction in the database
+	expiresAt := txDetails[0].CreatedAt //the order expires with its oldest hold
+	for _, tx := range txDetails {
+		if tx.CreatedAt.Before(expiresAt) {
+			expiresAt = tx.CreatedAt
+		}
+	}
+	expiresAt = expiresAt.Add(s.config.TransactionMinute)
+	now := time.Now()
+	paymentMinutes := int64(expiresAt.Sub(now) / time.Minute) //the payment closes before the holds are released
+	if paymentMinutes < 1 {
+		txn.Rollback()
+		return snap.Request{}, errors.New("the reservation is about to expire, please reserve again")
+	}
+	orderId := uuid.New().String() //create order_id for the new midtrans transaction
+	if err := s.orderService.CreateTxn(txn, orderId, userId, paymentMethod, idempotencyKey, expiresAt); err != nil {
+		txn.Rollback()
+		return snap.Request{}, err
+	}
 	customerDetails := midtrans.CustomerDetails{ //populate the midtrans request with the customer detail
 		FName: txDetails[0].User.Name,
 		LName: "",
 		Email: txDetails[0].User.Email,
 		Phone: txDetails[0].User.Phone,
 	}
-	var grossAmt int64 //populate the item detail
-	var itemDetails []midtrans.ItemDetails
+	var categories []model.PriceCategory //the category name is shown with the seat on the payment page
+	if result := s.categoryRepo.GetAll(&categories); result.Error != nil {
+		txn.Rollback()
+		return snap.Request{}, errors.New("database operation error")
+	}
+	categoryNames := make(map[uint64]string, len(categories))
+	for _, category := range categories {
+		categoryNames[category.PriceCategoryId] = category.Name
+	}
+	if err := s.lockPricesTxn(txn, txDetails); err != nil {
+		txn.Rollback()
+		return snap.Request{}, err
+	}
+	var itemDetails []midtrans.ItemDetails //populate the item detail
+	var invoiceSeats []model.Seat
 	for _, tx := range txDetails {
-		grossAmt += int64(tx.Seat.Price)
+		seat := TicketSeat(tx)
 		itemDetail := midtrans.ItemDetails{
-			ID:    strconv.FormatUint(uint64(tx.SeatId), 10),
-			Price: int64(tx.Seat.Price),
-			Qty:   1,
-			Name:  tx.Seat.Name,
+			ID:       tx.TicketCode,
+			Price:    int64(seat.Price),
+			Qty:      1,
+			Name:     seat.Name,
+			Category: categoryNames[util.Deref(seat.PriceCategoryId)],
+		}
+		if tx.SeatId != nil {
+			itemDetail.ID = strconv.FormatUint(uint64(*tx.SeatId), 10)
+		}
+		if itemDetail.Category != "" {
+			itemDetail.Name = seat.Name + " - " + itemDetail.Category
 		}
 		itemDetails = append(itemDetails, itemDetail)
+		invoiceSeats = append(invoiceSeats, model.Seat{Name: itemDetail.Name, Price: seat.Price})
+	}
+	quote, err := s.promoService.RedeemTxn(txn, promoCode, userId, orderId, s.OrderIds(txDetails), s.TicketSeats(txDetails))
+	if err != nil {
+		txn.Rollback()
+		return snap.Request{}, err
+	}
+	if quote.Discount > 0 {
+		itemDetails = append(itemDetails, midtrans.ItemDetails{
+			ID:       "PROMO-" + quote.Code,
+			Price:    -int64(quote.Discount),
+			Qty:      1,
+			Name:     "Promo " + quote.Code,
+			Category: "Discount",
+		})
+	}
+	invoice := s.invoiceService.Build(orderId, userId, invoiceSeats, quote)
+	for i, line := range invoice.Lines { //the included tax is already in the prices
+		if line.Kind == "fee" {
+			itemDetails = append(itemDetails, midtrans.ItemDetails{ID: "FEE-" + strconv.Itoa(i), Price: line.UnitPrice, Qty: int32(line.Quantity), Name: line.Name, Category: "Fee"})
+		} else if line.Kind == "tax" && !invoice.TaxIncluded {
+			itemDetails = append(itemDetails, midtrans.ItemDetails{ID: "TAX", Price: line.UnitPrice, Qty: 1, Name: line.Name, Category: "Tax"})
+		}
+	}
+	if err = s.invoiceService.SaveTxn(txn, &invoice); err != nil {
+		txn.Rollback()
+		return snap.Request{}, err
+	}
+	if err = s.orderService.SetAmountsTxn(txn, invoice, quote.Code); err != nil {
+		txn.Rollback()
+		return snap.Request{}, err
+	}
+	if result := s.txRepo.UpdateUserOrderIdTxn(txn, userId, orderId); result.Error != nil { //update order_id of this transaction in the database
+		txn.Rollback()
+		return snap.Request{}, errors.New("database operation error")
+	}
+	if err = txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return snap.Request{}, errors.New("database operation error")
 	}
 	var snapRequest snap.Request = snap.Request{ //create snap request data object
 		TransactionDetails: midtrans.TransactionDetails{
 			OrderID:  orderId,
-			GrossAmt: grossAmt,
+			GrossAmt: int64(invoice.Total),
 		},
 		CustomerDetail: &customerDetails,
 		Items:          &itemDetails,
+		Expiry: &snap.ExpiryDetails{ //otherwise the gateway keeps the payment open after the seats are released
+			StartTime: now.Format("2006-01-02 15:04:05 -0700"),
+			Unit:      "minute",
+			Duration:  paymentMinutes,
+		},
+	}
+	if paymentMethod != "" {
+		snapRequest.EnabledPayments = []snap.SnapPaymentType{snap.SnapPaymentType(paymentMethod)}
 	}
 	return snapRequest, nil
 }
 
+// IsCheckoutOf tell whether checking out again would create the same order, that is the user has reserved nothing
+// since and asks for the same promo code and payment method. The payment page of that order can be reused
+func (s *TransactionService) IsCheckoutOf(order model.Order, promoCode, paymentMethod string) (bool, error) {
+	if NormalizePromoCode(promoCode) != order.PromoCode || (paymentMethod != "" && paymentMethod != order.PaymentMethod) {
+		return false, nil
+	}
+	var txDetails []model.Transaction
+	if result := s.txRepo.GetDetailsByUserConfirmation(&txDetails, order.UserId, "reserved"); result.Error != nil {
+		return false, errors.New("database operation error")
+	}
+	for _, tx := range s.CleanUpGhostTransaction(txDetails) {
+		if tx.OrderId != order.OrderId {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lockPricesTxn price the reservations made before the pricing rules with the current price list, so the payment, the
+// e-ticket and the sales report all use the same price
+func (s *TransactionService) lockPricesTxn(txn *gorm.DB, transactions []model.Transaction) error {
+	var priceList *PriceList
+	for i := range transactions {
+		if transactions[i].Price != nil {
+			continue
+		}
+		if priceList == nil {
+			list, err := s.pricingService.PriceList()
+			if err != nil {
+				return err
+			}
+			priceList = &list
+		}
+		price := priceList.Price(TicketSeat(transactions[i]))
+		if result := s.txRepo.UpdateByIdTxn(txn, transactions[i].TransactionId, map[string]any{"price": price}); result.Error != nil {
+			return errors.New("database operation error")
+		}
+		transactions[i].Price = &price
+	}
+	return nil
+}
+
+// OrderIds is the orders the transactions were checked out with, a new checkout replaces them
+func (s *TransactionService) OrderIds(transactions []model.Transaction) []string {
+	var orderIds []string
+	for _, tx := range transactions {
+		if tx.OrderId != "" && !util.Contains(orderIds, tx.OrderId) {
+			orderIds = append(orderIds, tx.OrderId)
+		}
+	}
+	return orderIds
+}
+
+// TicketSeats is the seats and the general admission tickets of the transactions, see TicketSeat
+func (s *TransactionService) TicketSeats(transactions []model.Transaction) []model.Seat {
+	seats := make([]model.Seat, 0, len(transactions))
+	for _, tx := range transactions {
+		seats = append(seats, TicketSeat(tx))
+	}
+	return seats
+}
+
 func (s *TransactionService) UpdatePaymentStatus(orderId, vendor, confirmation string) error {
 	if result := s.txRepo.UpdatePaymentStatus(orderId, vendor, confirmation); result.Error != nil {
 		return errors.New("database operation error")
@@ -5,9 +5,11 @@ import (
 	"github.com/frchandra/ticketing-gmcgo/app/model"
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var ErrUserNotFound = errors.New("cannot find this user")
+
 type UserService struct {
 	userRepository *repository.UserRepository
 	tokenUtil      *util.TokenUtil
@@ -31,6 +33,9 @@ func (u *UserService) GetOrInsertOne(user *model.User) (int64, error) {
 func (u *UserService) GetByEmail(email string) (model.User, error) {
 	var userResult model.User
 	result := u.userRepository.GetByEmail(email, &userResult)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return userResult, ErrUserNotFound
+	}
 	if result.Error != nil {
 		return userResult, errors.New("database operation error")
 	}
@@ -65,35 +70,15 @@ func (u *UserService) UpdateById(userId uint64, user *model.User) (int64, error)
 	return result.RowsAffected, nil
 }
 
-func (u *UserService) verifyCredentials(cred, hashedCred string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedCred), []byte(cred))
-}
-
-func (u *UserService) ValidateLogin(userInput *model.User) error {
-	var userOut model.User
-	var err error
-
-	result := u.userRepository.GetByPairs(userInput, &userOut) //get the user credential pairs email/name & password
-	if result.Error != nil {
-		return errors.New("database operation error")
-	}
-
-	err = u.verifyCredentials(userInput.Phone, userOut.Phone) //verify the user credential
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return errors.New("credential authentication error")
-	}
-	*userInput = userOut
-	return nil
-}
-
-func (u *UserService) GenerateToken(userInput *model.User) (*util.TokenDetails, error) {
+// GenerateToken start a new session of the user on the given device (user agent) and ip
+func (u *UserService) GenerateToken(userInput *model.User, device, ip string) (*util.TokenDetails, error) {
 
-	tokenDetails, err := u.tokenUtil.CreateToken(userInput.UserId) //create token for the user
+	tokenDetails, err := u.tokenUtil.CreateToken(userInput.UserId, "") //create token for the user
 	if err != nil {
 		return tokenDetails, errors.New("credential authentication error")
 	}
 
-	if err = u.tokenUtil.StoreAuthn(userInput.UserId, tokenDetails); err != nil { //store the token to redis
+	if err = u.tokenUtil.StoreAuthn(userInput.UserId, tokenDetails, device, ip); err != nil { //store the token to redis
 		return tokenDetails, errors.New("credential preparation error")
 	}
 
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/repository"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"html"
+	"math"
+	"strings"
+)
+
+var ErrVenueNotFound = errors.New("the venue layout has not been imported")
+
+// VenueLayout is the json format of the venue, it is imported by the admin and returned as the seat map
+type VenueLayout struct {
+	Name       string                `json:"name" binding:"required,max=100"`
+	Width      float64               `json:"width" binding:"required,gt=0"`
+	Height     float64               `json:"height" binding:"required,gt=0"`
+	Categories []VenueLayoutCategory `json:"categories,omitempty" binding:"dive"` //created when there is no category with the name yet
+	Sections   []VenueLayoutSection  `json:"sections" binding:"required,min=1,dive"`
+}
+
+type VenueLayoutCategory struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Price       uint   `json:"price"`
+	Currency    string `json:"currency,omitempty" binding:"omitempty,len=3,uppercase"`
+	Description string `json:"description,omitempty" binding:"max=255"`
+	Color       string `json:"color,omitempty" binding:"omitempty,hexcolor"`
+}
+
+type VenueLayoutSection struct {
+	Name string           `json:"name" binding:"required,max=100"`
+	Rows []VenueLayoutRow `json:"rows" binding:"required,min=1,dive"`
+}
+
+type VenueLayoutRow struct {
+	Label string            `json:"label" binding:"required,max=10"`
+	Seats []VenueLayoutSeat `json:"seats" binding:"required,min=1,dive"`
+}
+
+type VenueLayoutSeat struct {
+	SeatId        uint     `json:"seat_id,omitempty"` //only in the seat map
+	Name          string   `json:"name,omitempty"`    //the row label followed by the seat label when empty
+	Label         string   `json:"label" binding:"required,max=10"`
+	X             float64  `json:"x" binding:"gte=0"`
+	Y             float64  `json:"y" binding:"gte=0"`
+	Price         uint     `json:"price"`              //only used for the new seats without a category, the existing seats keep their price
+	Category      string   `json:"category,omitempty"` //the seat get the category price
+	Aisle         bool     `json:"aisle,omitempty"`
+	Accessibility []string `json:"accessibility,omitempty" binding:"dive,oneof=wheelchair companion hearing_loop limited_view"`
+	Status        string   `json:"status,omitempty"` //only in the seat map
+}
+
+// BuildVenue turn the layout into the venue models, the seats are new available seats. The categories are looked up by name
+func BuildVenue(layout VenueLayout, categories map[string]model.PriceCategory) (model.Venue, error) {
+	venue := model.Venue{Name: layout.Name, Width: layout.Width, Height: layout.Height}
+	names := make(map[string]bool)
+	for i, section := range layout.Sections {
+		venueSection := model.VenueSection{Name: section.Name, Position: i}
+		for j, row := range section.Rows {
+			venueRow := model.VenueRow{Label: row.Label, Position: j}
+			for _, seat := range row.Seats {
+				name := seat.Name
+				if name == "" {
+					name = row.Label + seat.Label
+				}
+				if names[name] {
+					return venue, errors.New("the seat " + name + " is in the layout more than once")
+				}
+				names[name] = true
+				if seat.X > layout.Width || seat.Y > layout.Height {
+					return venue, errors.New("the seat " + name + " is outside of the venue size")
+				}
+				for _, flag := range seat.Accessibility {
+					if !util.Contains(model.VenueAccessibility, flag) {
+						return venue, errors.New("unknown accessibility " + flag + " on the seat " + name)
+					}
+				}
+				venueSeat := model.Seat{
+					Name:          name,
+					Label:         seat.Label,
+					Price:         seat.Price,
+					Link:          uuid.New().String(),
+					Status:        "available",
+					X:             seat.X,
+					Y:             seat.Y,
+					Aisle:         seat.Aisle,
+					Accessibility: strings.Join(seat.Accessibility, ","),
+				}
+				if seat.Category != "" {
+					category, ok := categories[seat.Category]
+					if !ok {
+						return venue, errors.New("unknown category " + seat.Category + " on the seat " + name)
+					}
+					venueSeat.PriceCategoryId, venueSeat.Price = &category.PriceCategoryId, category.Price
+				}
+				venueRow.Seats = append(venueRow.Seats, venueSeat)
+			}
+			venueSection.Rows = append(venueSection.Rows, venueRow)
+		}
+		venue.Sections = append(venue.Sections, venueSection)
+	}
+	return venue, nil
+}
+
+// NewCategoryFromLayout is the price category declared in the layout, in IDR when no currency is given
+func NewCategoryFromLayout(layoutCategory VenueLayoutCategory) model.PriceCategory {
+	if layoutCategory.Currency == "" {
+		layoutCategory.Currency = "IDR"
+	}
+	return model.PriceCategory{Name: layoutCategory.Name, Price: layoutCategory.Price, Currency: layoutCategory.Currency, Description: layoutCategory.Description, Color: layoutCategory.Color}
+}
+
+type VenueService struct {
+	db           *gorm.DB
+	venueRepo    *repository.VenueRepository
+	seatRepo     *repository.SeatRepository
+	categoryRepo *repository.PriceCategoryRepository
+	seatService  *SeatService
+	auditService *AuditService
+}
+
+func NewVenueService(db *gorm.DB, venueRepo *repository.VenueRepository, seatRepo *repository.SeatRepository, categoryRepo *repository.PriceCategoryRepository, seatService *SeatService, auditService *AuditService) *VenueService {
+	return &VenueService{db: db, venueRepo: venueRepo, seatRepo: seatRepo, categoryRepo: categoryRepo, seatService: seatService, auditService: auditService}
+}
+
+// Import replace the venue layout. The seats are matched by name: an existing seat keep its price, status and
+// ticket link and only gets its new place and category, the other seats are created. Seats missing from the layout are left off the map
+func (s *VenueService) Import(layout VenueLayout, actor util.Actor) (VenueLayout, error) {
+	var existingCategories []model.PriceCategory
+	if result := s.categoryRepo.GetAll(&existingCategories); result.Error != nil {
+		return layout, errors.New("database operation error")
+	}
+	categories := make(map[string]model.PriceCategory)
+	for _, category := range existingCategories {
+		categories[category.Name] = category
+	}
+
+	txn := s.db.Begin() //START DATABASE TRANSACTION
+	if txn.Error != nil {
+		return layout, errors.New("database operation error")
+	}
+	for _, layoutCategory := range layout.Categories {
+		if _, ok := categories[layoutCategory.Name]; ok {
+			continue
+		}
+		category := NewCategoryFromLayout(layoutCategory)
+		if result := s.categoryRepo.SaveTxn(txn, &category); result.Error != nil {
+			txn.Rollback()
+			return layout, errors.New("database operation error")
+		}
+		categories[category.Name] = category
+	}
+	venue, err := BuildVenue(layout, categories)
+	if err != nil {
+		txn.Rollback()
+		return layout, err
+	}
+	var existing []model.Seat
+	if result := s.seatRepo.LockAllTxn(txn, &existing); result.Error != nil { //no reservation can change a seat while it is saved again
+		txn.Rollback()
+		return layout, errors.New("database operation error")
+	}
+	byName := make(map[string]model.Seat, len(existing))
+	for _, seat := range existing {
+		byName[seat.Name] = seat
+	}
+	seatCount, newSeatCount := 0, 0
+	for i := range venue.Sections {
+		for j := range venue.Sections[i].Rows {
+			for k := range venue.Sections[i].Rows[j].Seats {
+				seat := &venue.Sections[i].Rows[j].Seats[k]
+				seatCount++
+				if old, ok := byName[seat.Name]; ok {
+					seat.SeatId, seat.Link, seat.Status, seat.PostSaleStatus, seat.CreatedAt = old.SeatId, old.Link, old.Status, old.PostSaleStatus, old.CreatedAt
+					if seat.PriceCategoryId == nil {
+						seat.PriceCategoryId, seat.Price = old.PriceCategoryId, old.Price
+					}
+					continue
+				}
+				newSeatCount++
+			}
+		}
+	}
+	if result := s.venueRepo.DeleteAllTxn(txn); result.Error != nil {
+		txn.Rollback()
+		return layout, errors.New("database operation error")
+	}
+	if result := s.venueRepo.InsertTxn(txn, &venue); result.Error != nil {
+		txn.Rollback()
+		return layout, errors.New("database operation error")
+	}
+	if err = txn.Commit().Error; err != nil { //COMMIT DATABASE TRANSACTION
+		return layout, errors.New("database operation error")
+	}
+
+	s.auditService.Record(actor, "venue_imported", "venue", fmt.Sprint(venue.VenueId), nil, map[string]any{"name": venue.Name, "seats": seatCount, "new_seats": newSeatCount})
+	return s.GetLayout()
+}
+
+// GetLayout return the venue layout with the id, price and current status of the seats
+func (s *VenueService) GetLayout() (VenueLayout, error) {
+	var venue model.Venue
+	if result := s.venueRepo.GetLayout(&venue); errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return VenueLayout{}, ErrVenueNotFound
+	} else if result.Error != nil {
+		return VenueLayout{}, errors.New("database operation error")
+	}
+	var categories []model.PriceCategory
+	if result := s.categoryRepo.GetAll(&categories); result.Error != nil {
+		return VenueLayout{}, errors.New("database operation error")
+	}
+	categoryNames := make(map[uint64]string, len(categories))
+	layout := VenueLayout{Name: venue.Name, Width: venue.Width, Height: venue.Height}
+	for _, category := range categories {
+		categoryNames[category.PriceCategoryId] = category.Name
+		layout.Categories = append(layout.Categories, VenueLayoutCategory{Name: category.Name, Price: category.Price, Currency: category.Currency, Description: category.Description, Color: category.Color})
+	}
+	for _, section := range venue.Sections {
+		layoutSection := VenueLayoutSection{Name: section.Name}
+		for _, row := range section.Rows {
+			layoutRow := VenueLayoutRow{Label: row.Label}
+			for _, seat := range row.Seats {
+				var accessibility []string
+				if seat.Accessibility != "" {
+					accessibility = strings.Split(seat.Accessibility, ",")
+				}
+				layoutRow.Seats = append(layoutRow.Seats, VenueLayoutSeat{
+					SeatId:        seat.SeatId,
+					Name:          seat.Name,
+					Label:         seat.Label,
+					X:             seat.X,
+					Y:             seat.Y,
+					Price:         seat.Price,
+					Category:      categoryNames[util.Deref(seat.PriceCategoryId)],
+					Aisle:         seat.Aisle,
+					Accessibility: accessibility,
+					Status:        s.seatService.PublicStatus(seat),
+				})
+			}
+			layoutSection.Rows = append(layoutSection.Rows, layoutRow)
+		}
+		layout.Sections = append(layout.Sections, layoutSection)
+	}
+	return layout, nil
+}
+
+// RenderSvg draw the seat map. Every seat is a circle with its status as a css class, so the frontend can restyle it
+func (s *VenueService) RenderSvg(layout VenueLayout) string {
+	const radius = 10.0
+	colors := make(map[string]string, len(layout.Categories))
+	for _, category := range layout.Categories {
+		colors[category.Name] = category.Color
+	}
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %g %g" width="%g" height="%g">`, layout.Width, layout.Height, layout.Width, layout.Height)
+	svg.WriteString(`<style>.seat{stroke:#424242;stroke-width:1}.available{fill:#66bb6a}.reserved{fill:#ffca28}.purchased{fill:#bdbdbd}` +
+		`.wheelchair{stroke:#1565c0;stroke-width:3}.aisle{stroke-dasharray:3 2}text{font:12px sans-serif;fill:#212121}</style>`)
+	for _, section := range layout.Sections {
+		fmt.Fprintf(&svg, `<g class="section" data-section="%s">`, html.EscapeString(section.Name))
+		top, left := math.MaxFloat64, math.MaxFloat64
+		for _, row := range section.Rows {
+			for _, seat := range row.Seats {
+				top, left = math.Min(top, seat.Y), math.Min(left, seat.X)
+			}
+		}
+		if top != math.MaxFloat64 { //a section without seats has nowhere to put its label
+			fmt.Fprintf(&svg, `<text class="section-label" x="%g" y="%g">%s</text>`, left, math.Max(top-2*radius, radius), html.EscapeString(section.Name))
+		}
+		for _, row := range section.Rows {
+			fmt.Fprintf(&svg, `<g class="row" data-row="%s">`, html.EscapeString(row.Label))
+			if len(row.Seats) > 0 { //the label sits before the first seat
+				fmt.Fprintf(&svg, `<text class="row-label" x="%g" y="%g" text-anchor="end">%s</text>`, math.Max(row.Seats[0].X-2*radius, 0), row.Seats[0].Y+4, html.EscapeString(row.Label))
+			}
+			for _, seat := range row.Seats {
+				class := "seat " + seat.Status
+				if seat.Aisle {
+					class += " aisle"
+				}
+				for _, flag := range seat.Accessibility {
+					class += " " + flag
+				}
+				style := ""
+				if seat.Status == "available" && colors[seat.Category] != "" { //the available seats show their category color
+					style = ` style="fill:` + html.EscapeString(colors[seat.Category]) + `"`
+				}
+				fmt.Fprintf(&svg, `<circle class="%s"%s cx="%g" cy="%g" r="%g" data-seat-id="%d" data-seat-name="%s" data-category="%s"><title>%s %s %d</title></circle>`,
+					html.EscapeString(class), style, seat.X, seat.Y, radius, seat.SeatId, html.EscapeString(seat.Name), html.EscapeString(seat.Category),
+					html.EscapeString(seat.Name), html.EscapeString(seat.Category), seat.Price)
+			}
+			svg.WriteString(`</g>`)
+		}
+		svg.WriteString(`</g>`)
+	}
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVenueServiceRenderSvgEmptyRow(t *testing.T) {
+	layout := VenueLayout{
+		Name: "Hall", Width: 200, Height: 100,
+		Sections: []VenueLayoutSection{
+			{Name: "Floor", Rows: []VenueLayoutRow{
+				{Label: "A", Seats: []VenueLayoutSeat{{SeatId: 1, Name: "A1", Label: "1", X: 20, Y: 20, Status: "available"}}},
+				{Label: "B"}, //all of its seats were removed from the layout
+			}},
+			{Name: "Balcony"},
+		},
+	}
+	svg := (&VenueService{}).RenderSvg(layout)
+	if !strings.Contains(svg, `data-row="B"`) || !strings.Contains(svg, `data-section="Balcony"`) || !strings.HasSuffix(svg, "</svg>") {
+		t.Errorf("expected the empty row and section in the svg, got %s", svg)
+	}
+	if strings.Count(svg, `class="row-label"`) != 1 || strings.Count(svg, `class="section-label"`) != 1 {
+		t.Errorf("only the row and the section with seats have a label, got %s", svg)
+	}
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// Actor is who made a change, it is recorded in the audit events
+type Actor struct {
+	Type      string //user, staff, api_key, gateway, system or anonymous
+	Id        string
+	Ip        string
+	RequestId string
+}
+
+// ActorFromContext identify the requester from what the user, admin or api key middleware put in the context
+func ActorFromContext(c *gin.Context) Actor {
+	actor := Actor{Type: "anonymous", Ip: c.ClientIP(), RequestId: c.GetString("requestId")}
+	if contextData, ok := c.Get("accessDetails"); ok {
+		actor.Type, actor.Id = "user", strconv.FormatUint(contextData.(*AccessDetails).UserId, 10)
+		if c.GetString("staffRole") != "" {
+			actor.Type = "staff"
+		}
+	} else if apiKeyId, ok := c.Get("apiKeyId"); ok {
+		actor.Type, actor.Id = "api_key", strconv.FormatUint(apiKeyId.(uint64), 10)
+	}
+	return actor
+}
+
+// SystemActor is a background job of the app
+func SystemActor(name string) Actor {
+	return Actor{Type: "system", Id: name}
+}
@@ -19,7 +19,9 @@ func NewETicketUtil(config *config.AppConfig, minio *minio.Client, log *LogUtil)
 	return &ETicketUtil{config: config, minio: minio, log: log}
 }
 
-func (e *ETicketUtil) GenerateETicket(seatName, seatLink string) ([]byte, error) {
+// GenerateETicket create the e-ticket of a seat (label SEAT and the seat name) or a general admission ticket (label TICKET
+// and the ticket code). The qr code opens the link, it is stored in minio under the name
+func (e *ETicketUtil) GenerateETicket(label, name, seatLink string) ([]byte, error) {
 
 	url := e.config.AppUrl + ":" + e.config.AppPort + "/api/v1/seat/" + seatLink //creating basic qr code
 	qr, err := qrcode.Encode(url, qrcode.Medium, 256)
@@ -44,7 +46,7 @@ func (e *ETicketUtil) GenerateETicket(seatName, seatLink string) ([]byte, error)
 	seat := bimg.Watermark{
 		Top:         12,
 		Left:        90,
-		Text:        "SEAT - " + seatName,
+		Text:        label + " - " + name,
 		Opacity:     1,
 		Width:       200,
 		DPI:         100,
@@ -73,7 +75,7 @@ func (e *ETicketUtil) GenerateETicket(seatName, seatLink string) ([]byte, error)
 	}
 
 	bucketName := e.config.MinioTicketsBucket // Upload the file with to minio
-	objectName := seatName + ".png"
+	objectName := name + ".png"
 	fileBuffer := bytes.NewReader(ticket)
 	fileSize := fileBuffer.Size()
 	contentType := "png"
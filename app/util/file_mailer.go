@@ -0,0 +1,35 @@
+package util
+
+import (
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// FileMailer write every email as an .eml file to MAIL_FILE_DIR instead of sending it. Useful for local development
+type FileMailer struct {
+	config *config.AppConfig
+}
+
+func NewFileMailer(config *config.AppConfig) *FileMailer {
+	return &FileMailer{config: config}
+}
+
+func (m *FileMailer) Send(message *MailMessage) error {
+	if err := os.MkdirAll(m.config.MailFileDir, 0755); err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), unsafeFilename.ReplaceAllString(message.To, "_"))
+	file, err := os.Create(filepath.Join(m.config.MailFileDir, filename))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = buildGomailMessage(m.config, message).WriteTo(file)
+	return err
+}
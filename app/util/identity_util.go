@@ -0,0 +1,32 @@
+package util
+
+import "strings"
+
+// NormalizeEmail lower the email and drop the +tag, name+1@mail.com and Name@mail.com are the same mailbox
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return local + domain
+}
+
+// NormalizePhone keep the digits and write the local 08xx numbers as 628xx
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	normalized := digits.String()
+	if strings.HasPrefix(normalized, "0") {
+		normalized = "62" + normalized[1:]
+	}
+	return normalized
+}
@@ -0,0 +1,256 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SigningKey struct {
+	Kid        string
+	Algorithm  string //RS256 or EdDSA
+	CreatedAt  time.Time
+	PrivateKey crypto.Signer
+}
+
+// KeyUtil hold the jwt signing keys. Every <kid>.pem file in the key directory is a verification key, the newest one
+// that has been published for the activation delay is used for signing. The kid starts with the creation unix time
+type KeyUtil struct {
+	config   *config.AppConfig
+	log      *LogUtil
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	loadedAt time.Time
+}
+
+func NewKeyUtil(config *config.AppConfig, log *LogUtil) *KeyUtil {
+	k := &KeyUtil{config: config, log: log, keys: make(map[string]*SigningKey)}
+	if err := k.reload(); err != nil {
+		log.Log.Panicf("failed on loading the jwt keys: %s", err.Error())
+	}
+	if len(k.keys) == 0 { //first run, there is nothing to rotate from
+		key, err := GenerateSigningKey(config.JwtKeyDir, config.JwtAlgorithm)
+		if err != nil {
+			log.Log.Panicf("failed on generating a jwt key: %s", err.Error())
+		}
+		log.Log.Warnf("there is no jwt key in %s, generated %s", config.JwtKeyDir, key.Kid)
+		k.keys[key.Kid] = key
+	}
+	return k
+}
+
+func (k *KeyUtil) reload() error {
+	keys, err := LoadSigningKeys(k.config.JwtKeyDir)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	return nil
+}
+
+// refresh pick up the keys added or removed by the rotation command, at most once per reload interval
+func (k *KeyUtil) refresh(interval time.Duration) {
+	k.mu.RLock()
+	isStale := time.Since(k.loadedAt) > interval
+	k.mu.RUnlock()
+	if !isStale {
+		return
+	}
+	if err := k.reload(); err != nil {
+		k.log.BasicLog(err, "KeyUtil@refresh")
+	}
+}
+
+// SigningKey return the key to sign new tokens with. A new key only signs after the activation delay, so every
+// instance and every jwks consumer has seen it before the first token signed by it arrives
+func (k *KeyUtil) SigningKey() (*SigningKey, error) {
+	k.refresh(k.config.JwtKeyReload)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var oldest, newestActive *SigningKey
+	activeBefore := time.Now().Add(-k.config.JwtKeyActivation)
+	for _, key := range k.keys {
+		if oldest == nil || key.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = key
+		}
+		if !key.CreatedAt.After(activeBefore) && (newestActive == nil || key.CreatedAt.After(newestActive.CreatedAt)) {
+			newestActive = key
+		}
+	}
+	if newestActive != nil {
+		return newestActive, nil
+	}
+	if oldest == nil {
+		return nil, errors.New("there is no jwt signing key")
+	}
+	return oldest, nil //every key is still new, use the one that has been published the longest
+}
+
+// VerificationKey return the public key and the algorithm of the given kid
+func (k *KeyUtil) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	k.refresh(k.config.JwtKeyReload)
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok { //the key may have just been rotated in, look again but do not let unknown kids hammer the disk
+		k.refresh(10 * time.Second)
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("unknown jwt key id: %s", kid)
+	}
+	return key.PrivateKey.Public(), key.Algorithm, nil
+}
+
+// Jwks return the public keys in the json web key set format
+func (k *KeyUtil) Jwks() []map[string]string {
+	k.refresh(k.config.JwtKeyReload)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := make([]map[string]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwk := map[string]string{"kid": key.Kid, "alg": key.Algorithm, "use": "sig"}
+		switch publicKey := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool {
+		return jwks[i]["kid"] > jwks[j]["kid"]
+	})
+	return jwks
+}
+
+// GenerateSigningKey create a new key of the algorithm and write it to the key directory as a pkcs8 pem file
+func GenerateSigningKey(dir, algorithm string) (*SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown jwt algorithm: %s, use RS256 or EdDSA", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		Kid:        fmt.Sprintf("%d-%s-%x", now.Unix(), strings.ToLower(algorithm), suffix),
+		Algorithm:  algorithm,
+		CreatedAt:  time.Unix(now.Unix(), 0),
+		PrivateKey: privateKey,
+	}
+
+	encoded, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(dir, key.Kid+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadSigningKeys read every key in the key directory, a missing directory has no keys
+func LoadSigningKeys(dir string) (map[string]*SigningKey, error) {
+	keys := make(map[string]*SigningKey)
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(content)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a pem file", file)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+
+		key := &SigningKey{Kid: strings.TrimSuffix(filepath.Base(file), ".pem")}
+		switch privateKey := parsed.(type) {
+		case *rsa.PrivateKey:
+			key.Algorithm, key.PrivateKey = "RS256", privateKey
+		case ed25519.PrivateKey:
+			key.Algorithm, key.PrivateKey = "EdDSA", privateKey
+		default:
+			return nil, fmt.Errorf("%s: only rsa and ed25519 keys are supported", file)
+		}
+		createdAt, err := strconv.ParseInt(strings.SplitN(key.Kid, "-", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: the file name must start with the creation unix time", file)
+		}
+		key.CreatedAt = time.Unix(createdAt, 0)
+		keys[key.Kid] = key
+	}
+	return keys, nil
+}
+
+// PruneSigningKeys delete the keys created before the cutoff, except the newest one. Tokens signed by a deleted key
+// can not be verified anymore, so the cutoff must be older than the refresh token lifetime
+func PruneSigningKeys(dir string, cutoff time.Time) ([]string, error) {
+	keys, err := LoadSigningKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+	var newest *SigningKey
+	for _, key := range keys {
+		if newest == nil || key.CreatedAt.After(newest.CreatedAt) {
+			newest = key
+		}
+	}
+	var pruned []string
+	for _, key := range keys {
+		if key == newest || !key.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, key.Kid+".pem")); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, key.Kid)
+	}
+	return pruned, nil
+}
@@ -25,3 +25,11 @@ func (u *LogUtil) ControllerResponseLog(err error, occurrence string, clientIp s
 		WithField("client_id", clientId).
 		Info(err.Error())
 }
+
+// AuditLog record a security relevant event, such as a login attempt, so it can be traced later
+func (u *LogUtil) AuditLog(event string, fields map[string]any) {
+	u.Log.
+		WithField("audit", event).
+		WithFields(fields).
+		Info(event)
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gopkg.in/gomail.v2"
+	"io"
+)
+
+type MailAttachment struct {
+	Filename string
+	Content  []byte
+}
+
+type MailMessage struct {
+	To          string
+	Subject     string
+	HtmlBody    string
+	TextBody    string
+	Attachments []MailAttachment
+}
+
+// Mailer deliver a rendered email. The implementation is chosen by the MAIL_MAILER config
+type Mailer interface {
+	Send(message *MailMessage) error
+}
+
+func NewMailer(config *config.AppConfig) (Mailer, error) {
+	switch config.MailMailer {
+	case "smtp":
+		return NewSmtpMailer(config), nil
+	case "file":
+		return NewFileMailer(config), nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	}
+	return nil, fmt.Errorf("unknown mailer: %s, use smtp, file or memory", config.MailMailer)
+}
+
+// buildGomailMessage convert the message to gomail's message which is used by the smtp and the file mailer
+func buildGomailMessage(config *config.AppConfig, message *MailMessage) *gomail.Message {
+	m := gomail.NewMessage()
+	if config.MailFromAddress != "" {
+		m.SetAddressHeader("From", config.MailFromAddress, config.MailFromName)
+	} else {
+		m.SetHeader("From", config.MailUsername)
+	}
+	m.SetHeader("To", message.To)
+	m.SetHeader("Subject", message.Subject)
+	if message.TextBody != "" { //plain text first, mail clients pick the last alternative they can display
+		m.SetBody("text/plain", message.TextBody)
+		m.AddAlternative("text/html", message.HtmlBody)
+	} else {
+		m.SetBody("text/html", message.HtmlBody)
+	}
+	for _, attachment := range message.Attachments {
+		content := attachment.Content //copy for the closure, it is called when the message is written
+		m.Attach(attachment.Filename, gomail.SetCopyFunc(func(writer io.Writer) error {
+			_, err := writer.Write(content)
+			return err
+		}))
+	}
+	return m
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestLogUtil() *LogUtil {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewLogUtil(logger)
+}
+
+func newTestMailConfig() *config.AppConfig {
+	return &config.AppConfig{AppName: "gmcgo", MailMailer: "memory", MailTheme: "default", MailLocale: "id"}
+}
+
+func TestNewMailer(t *testing.T) {
+	appConfig := newTestMailConfig()
+	for _, mailer := range []string{"smtp", "file", "memory"} {
+		appConfig.MailMailer = mailer
+		got, err := NewMailer(appConfig)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", mailer, err)
+		}
+		if mailerName(got) != mailer {
+			t.Errorf("%s: got the %s mailer", mailer, mailerName(got))
+		}
+	}
+
+	appConfig.MailMailer = "sendmail"
+	if _, err := NewMailer(appConfig); err == nil || !strings.Contains(err.Error(), "unknown mailer: sendmail") {
+		t.Errorf("expected an unknown mailer error, got %v", err)
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+	for _, to := range []string{"first@example.com", "second@example.com"} {
+		if err := mailer.Send(&MailMessage{To: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := mailer.Sent()
+	if len(sent) != 2 || sent[0].To != "first@example.com" || sent[1].To != "second@example.com" {
+		t.Fatalf("unexpected sent emails %+v", sent)
+	}
+
+	sent[0].To = "changed@example.com" //the caller gets a copy
+	if mailer.Sent()[0].To != "first@example.com" {
+		t.Error("the sent emails must not be changed through the returned copy")
+	}
+
+	mailer.Reset()
+	if len(mailer.Sent()) != 0 {
+		t.Error("expected no emails after reset")
+	}
+}
+
+func TestEmailUtilSend(t *testing.T) {
+	appConfig, log, mailer := newTestMailConfig(), newTestLogUtil(), NewMemoryMailer()
+	emailUtil := NewEmailUtil(appConfig, log, mailer, NewTemplateRegistry(appConfig, log))
+
+	err := emailUtil.Send("totp", "en", map[string]any{"Name": "Chandra", "Totp": "123456"}, "chandra@example.com", []MailAttachment{{Filename: "H31.png", Content: []byte("png")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 email, got %d", len(sent))
+	}
+	message := sent[0]
+	if message.To != "chandra@example.com" || message.Subject != "Your gmcgo login code" {
+		t.Errorf("unexpected receiver or subject %q %q", message.To, message.Subject)
+	}
+	if !strings.Contains(message.HtmlBody, "123456") || !strings.Contains(message.TextBody, "123456") {
+		t.Error("expected the code in both the html and the text body")
+	}
+	if len(message.Attachments) != 1 || message.Attachments[0].Filename != "H31.png" {
+		t.Errorf("unexpected attachments %+v", message.Attachments)
+	}
+
+	if err = emailUtil.Send("missing", "en", nil, "chandra@example.com", nil); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+	if len(mailer.Sent()) != 1 {
+		t.Error("nothing should be sent when the template cannot be rendered")
+	}
+}
+
+func TestEmailUtilIsBounce(t *testing.T) {
+	emailUtil := NewEmailUtil(newTestMailConfig(), newTestLogUtil(), NewMemoryMailer(), nil)
+	cases := map[string]bool{
+		"550 5.1.1 mailbox unavailable":            true,
+		"gomail: could not send email 1: 553 nope": true,
+		"421 service not available":                false,
+		"dial tcp: connection refused":             false,
+	}
+	for message, expected := range cases {
+		if got := emailUtil.IsBounce(errors.New(message)); got != expected {
+			t.Errorf("%q: got %v, expected %v", message, got, expected)
+		}
+	}
+	if emailUtil.IsBounce(nil) {
+		t.Error("a nil error is not a bounce")
+	}
+}
+
+func mailerName(mailer Mailer) string {
+	switch mailer.(type) {
+	case *SmtpMailer:
+		return "smtp"
+	case *FileMailer:
+		return "file"
+	case *MemoryMailer:
+		return "memory"
+	}
+	return "unknown"
+}
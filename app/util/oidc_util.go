@@ -0,0 +1,195 @@
+package util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/go-redis/redis/v9"
+	"golang.org/x/oauth2"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOidcUnknownProvider = errors.New("unknown login provider")
+	ErrOidcInvalidState    = errors.New("the login has expired or was already used, please try again")
+)
+
+// OidcClaims is the account of the customer at the provider
+type OidcClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// oidcState is kept in redis between the redirect to the provider and the callback
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OidcUtil run the authorization code flow with pkce against the configured openid connect providers
+type OidcUtil struct {
+	db        *redis.Client
+	appConfig *config.AppConfig
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider
+}
+
+func NewOidcUtil(db *redis.Client, appConfig *config.AppConfig) *OidcUtil {
+	return &OidcUtil{db: db, appConfig: appConfig, providers: make(map[string]*oidc.Provider)}
+}
+
+// Providers return the names of the configured providers
+func (ou *OidcUtil) Providers() []string {
+	names := make([]string, 0, len(ou.appConfig.OidcProviders))
+	for name := range ou.appConfig.OidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// provider fetch the discovery document on the first use, so the app can start while a provider is unreachable
+func (ou *OidcUtil) provider(ctx context.Context, name string) (*oidc.Provider, *oauth2.Config, error) {
+	providerConfig, ok := ou.appConfig.OidcProviders[name]
+	if !ok {
+		return nil, nil, ErrOidcUnknownProvider
+	}
+	ou.mu.Lock()
+	defer ou.mu.Unlock()
+	provider, ok := ou.providers[name]
+	if !ok {
+		var err error
+		if provider, err = oidc.NewProvider(ctx, providerConfig.Issuer); err != nil {
+			return nil, nil, err
+		}
+		ou.providers[name] = provider
+	}
+	return provider, &oauth2.Config{
+		ClientID:     providerConfig.ClientId,
+		ClientSecret: providerConfig.ClientSecret,
+		RedirectURL:  providerConfig.RedirectUrl,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       providerConfig.Scopes,
+	}, nil
+}
+
+// AuthorizeUrl return the url of the provider login page. The state, the nonce and the pkce verifier are stored until the callback.
+// It also returns the signed state for the cookie that binds the login to the browser which started it
+func (ou *OidcUtil) AuthorizeUrl(name string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, oauthConfig, err := ou.provider(ctx, name)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := oidcState{Provider: name, Nonce: randomString(), CodeVerifier: randomString()}
+	stateKey := randomString()
+	encoded, _ := json.Marshal(state)
+	if err = ou.db.Set(ctx, "oidc_state:"+stateKey, encoded, ou.appConfig.OidcStateMinute).Err(); err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+	return oauthConfig.AuthCodeURL(stateKey,
+		oidc.Nonce(state.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), ou.signState(stateKey), nil
+}
+
+// Exchange trade the code of the callback for the id token of the provider and return its verified claims. The signed state
+// comes from the cookie of the browser, so a code and state sent by another browser (login csrf) are refused
+func (ou *OidcUtil) Exchange(name, code, stateKey, signedState string) (*OidcClaims, error) {
+	if !hmac.Equal([]byte(signedState), []byte(ou.signState(stateKey))) { //checked first so a forged callback cannot use up the state
+		return nil, ErrOidcInvalidState
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	encoded, err := ou.db.GetDel(ctx, "oidc_state:"+stateKey).Bytes() //a state can only be used once
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrOidcInvalidState
+	} else if err != nil {
+		return nil, err
+	}
+	var state oidcState
+	if err = json.Unmarshal(encoded, &state); err != nil || state.Provider != name {
+		return nil, ErrOidcInvalidState
+	}
+
+	provider, oauthConfig, err := ou.provider(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", state.CodeVerifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("the provider did not return an id token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}).Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, errors.New("the id token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"` //some providers send it as a string
+		Name          string `json:"name"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	result := &OidcClaims{Subject: idToken.Subject, Email: claims.Email, EmailVerified: isTrue(claims.EmailVerified), Name: claims.Name}
+	if result.Email == "" { //the email is only in the userinfo of some providers
+		userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, err
+		}
+		if userInfo.Subject != result.Subject {
+			return nil, errors.New("the userinfo subject does not match the id token")
+		}
+		result.Email, result.EmailVerified = userInfo.Email, userInfo.EmailVerified
+	}
+	return result, nil
+}
+
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func randomString() string {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		panic(err) //the system random generator never fails on the supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// signState sign the state key with the OIDC_STATE_SECRET
+func (ou *OidcUtil) signState(stateKey string) string {
+	mac := hmac.New(sha256.New, []byte(ou.appConfig.OidcStateSecret))
+	mac.Write([]byte("oidc_state:" + stateKey))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
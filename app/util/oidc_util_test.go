@@ -0,0 +1,24 @@
+package util
+
+import (
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"testing"
+)
+
+func TestOidcUtilExchangeRefusesAnotherBrowser(t *testing.T) {
+	oidcUtil := NewOidcUtil(nil, &config.AppConfig{OidcStateSecret: "secret"})
+	signedState := oidcUtil.signState("state-of-the-attacker")
+	if signedState == oidcUtil.signState("state-of-the-victim") {
+		t.Fatal("different states must have different signatures")
+	}
+	if other := NewOidcUtil(nil, &config.AppConfig{OidcStateSecret: "other"}); other.signState("state-of-the-attacker") == signedState {
+		t.Fatal("the signature must depend on the secret")
+	}
+
+	for _, cookie := range []string{"", signedState} { //no cookie, or the cookie of the browser that started another login
+		if _, err := oidcUtil.Exchange("mock", "code", "state-of-the-victim", cookie); !errors.Is(err, ErrOidcInvalidState) {
+			t.Errorf("cookie %q: expected the invalid state error, got %v", cookie, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/go-redis/redis/v9"
+	"math/big"
+	"time"
+)
+
+// OtpUtil keep the one time login codes in redis. Only the hmac of a code is stored, together with the number of wrong attempts
+type OtpUtil struct {
+	db        *redis.Client
+	appConfig *config.AppConfig
+}
+
+func NewOtpUtil(db *redis.Client, appConfig *config.AppConfig) *OtpUtil {
+	return &OtpUtil{db: db, appConfig: appConfig}
+}
+
+// Generate create a random 6 digits code
+func (ou *OtpUtil) Generate() (string, error) {
+	number, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", number.Int64()), nil
+}
+
+func (ou *OtpUtil) hash(email, code string) string {
+	mac := hmac.New(sha256.New, []byte(ou.appConfig.OtpSecret))
+	mac.Write([]byte(email + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Store replace the previous code of the email with the new one
+func (ou *OtpUtil) Store(email, code string) error {
+	ctx := context.Background()
+	key := "otp:code:" + email
+	_, err := ou.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "hash", ou.hash(email, code), "attempts", 0)
+		pipe.Expire(ctx, key, ou.appConfig.OtpExpireMinute)
+		return nil
+	})
+	return err
+}
+
+// Verify check the code of the email. A valid code is deleted so it can only be used once, a wrong code counts as
+// a failed attempt and the email is locked once the attempts reach the limit
+func (ou *OtpUtil) Verify(email, code string) (bool, error) {
+	ctx := context.Background()
+	key := "otp:code:" + email
+	stored, err := ou.db.HGet(ctx, key, "hash").Result()
+	if err == redis.Nil { //expired or never requested
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if hmac.Equal([]byte(stored), []byte(ou.hash(email, code))) {
+		deleted, err := ou.db.Del(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		return deleted == 1, nil //a concurrent request has used the code already
+	}
+
+	attempts, err := ou.db.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return false, err
+	}
+	if int(attempts) >= ou.appConfig.OtpMaxAttempt {
+		if err := ou.Lock(email); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Lock block the email from requesting and verifying codes for the lock duration, the current code is discarded
+func (ou *OtpUtil) Lock(email string) error {
+	ctx := context.Background()
+	_, err := ou.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, "otp:code:"+email)
+		pipe.Set(ctx, "otp:lock:"+email, 1, ou.appConfig.OtpLockMinute)
+		return nil
+	})
+	return err
+}
+
+// LockedFor return the remaining lock duration of the email, zero when it is not locked
+func (ou *OtpUtil) LockedFor(email string) (time.Duration, error) {
+	ttl, err := ou.db.TTL(context.Background(), "otp:lock:"+email).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 { //the key does not exist
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// HitLimit count one hit of the given key in the rate window. It returns true when the hits exceed the limit
+func (ou *OtpUtil) HitLimit(key string, limit int) (bool, error) {
+	ctx := context.Background()
+	key = "otp:rate:" + key
+	hits, err := ou.db.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if hits == 1 { //the window starts on the first hit
+		if err := ou.db.Expire(ctx, key, ou.appConfig.OtpRateWindow).Err(); err != nil {
+			return false, err
+		}
+	}
+	return int(hits) > limit, nil
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"unicode"
+)
+
+// CheckPasswordPolicy reject the staff passwords that are too short, too long for bcrypt, use less than three kinds of
+// characters, or contain the local part of the email
+func CheckPasswordPolicy(password, email string, minLength int) error {
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("the password must be at least %d characters", minLength)
+	}
+	if len(password) > 72 { //bcrypt ignores everything after the 72nd byte
+		return errors.New("the password must be at most 72 bytes")
+	}
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	kinds := 0
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if has {
+			kinds++
+		}
+	}
+	if kinds < 3 {
+		return errors.New("the password must contain at least three of lowercase letters, uppercase letters, digits and symbols")
+	}
+	localPart := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	if len(localPart) >= 3 && strings.Contains(strings.ToLower(password), localPart) {
+		return errors.New("the password must not contain the email")
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func VerifyPassword(password, hashed string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PdfDocument is a minimal a4 pdf writer for the text documents like the invoices, using the standard helvetica fonts
+// so nothing has to be embedded. The coordinates are in points from the top left corner of the page
+type PdfDocument struct {
+	pages []*bytes.Buffer
+}
+
+const (
+	PdfPageWidth  = 595.28
+	PdfPageHeight = 841.89
+)
+
+func NewPdfDocument() *PdfDocument {
+	document := &PdfDocument{}
+	document.AddPage()
+	return document
+}
+
+func (d *PdfDocument) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// Text write the text on the current page, the characters outside latin-1 are replaced
+func (d *PdfDocument) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, PdfPageHeight-y, pdfEscape(text))
+}
+
+// TextRight write the text ending at x, the width is estimated from the average helvetica character width
+func (d *PdfDocument) TextRight(x, y, size float64, bold bool, text string) {
+	d.Text(x-pdfTextWidth(text, size), y, size, bold, text)
+}
+
+func (d *PdfDocument) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PdfPageHeight-y1, x2, PdfPageHeight-y2)
+}
+
+// Bytes is the pdf file
+func (d *PdfDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+	//1 catalog, 2 pages, 3 and 4 fonts, then a page and its content for every page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", PdfPageWidth, PdfPageHeight, 6+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func (d *PdfDocument) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+func pdfEscape(text string) string {
+	var escaped strings.Builder
+	for _, char := range text {
+		switch {
+		case char == '(' || char == ')' || char == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(char)
+		case char < 32:
+			escaped.WriteByte(' ')
+		case char > 255:
+			escaped.WriteByte('?')
+		case char > 126:
+			fmt.Fprintf(&escaped, "\\%03o", char)
+		default:
+			escaped.WriteRune(char)
+		}
+	}
+	return escaped.String()
+}
+
+func pdfTextWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.5
+}
@@ -0,0 +1,10 @@
+package util
+
+// Deref return the value of the pointer, or the zero value when it is nil
+func Deref[T any](pointer *T) T {
+	var value T
+	if pointer != nil {
+		value = *pointer
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"time"
+)
+
+// slidingWindowScript keep the hit timestamps of a key in a sorted set, drop the ones outside of the window and
+// only record the new hit when the window still has room. It returns {allowed, hits in the window, ms until the oldest hit leaves}
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local hits = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if hits < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	hits = hits + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, hits, reset}
+`)
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration //until the window has room again
+}
+
+type RateLimitUtil struct {
+	db *redis.Client
+}
+
+func NewRateLimitUtil(db *redis.Client) *RateLimitUtil {
+	return &RateLimitUtil{db: db}
+}
+
+// Hit count one request of the key in a sliding window, the request is rejected once the window holds limit requests
+func (ru *RateLimitUtil) Hit(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	result := RateLimitResult{Limit: limit}
+	values, err := slidingWindowScript.Run(context.Background(), ru.db, []string{"rate:" + key},
+		time.Now().UnixMilli(), window.Milliseconds(), limit, uuid.New().String()).Int64Slice()
+	if err != nil {
+		return result, err
+	}
+	result.Allowed = values[0] == 1
+	result.Remaining = limit - int(values[1])
+	result.Reset = time.Duration(values[2]) * time.Millisecond
+	return result, nil
+}
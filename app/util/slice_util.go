@@ -13,3 +13,12 @@ func ElementDifference(after, before []uint) []uint {
 	}
 	return diff
 }
+
+func Contains[T comparable](elements []T, element T) bool {
+	for _, x := range elements {
+		if x == element {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"gopkg.in/gomail.v2"
+	"strconv"
+)
+
+type SmtpMailer struct {
+	config *config.AppConfig
+}
+
+func NewSmtpMailer(config *config.AppConfig) *SmtpMailer {
+	return &SmtpMailer{config: config}
+}
+
+func (m *SmtpMailer) Send(message *MailMessage) error {
+	port, _ := strconv.Atoi(m.config.MailPort)
+	d := gomail.NewDialer(m.config.MailHost, port, m.config.MailUsername, m.config.MailPassword)
+	return d.DialAndSend(buildGomailMessage(m.config, message))
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
 	"github.com/midtrans/midtrans-go/snap"
 )
 
 type SnapUtil struct {
 	app        *config.AppConfig
 	snapClient snap.Client
+	coreClient coreapi.Client
 }
 
 func NewSnapUtil(app *config.AppConfig) *SnapUtil {
@@ -27,9 +29,17 @@ func NewSnapUtil(app *config.AppConfig) *SnapUtil {
 		snapClient.New(app.ServerKeySandbox, midtrans.Production)
 	}
 
+	var coreClient coreapi.Client //cancels the payment of a replaced order
+	if app.MidtransIsProduction == false {
+		coreClient.New(app.ServerKeySandbox, midtrans.Sandbox)
+	} else {
+		coreClient.New(app.ServerKeyProduction, midtrans.Production)
+	}
+
 	return &SnapUtil{
 		app:        app,
 		snapClient: snapClient,
+		coreClient: coreClient,
 	}
 }
 
@@ -41,11 +51,20 @@ func (u *SnapUtil) CreateTransaction(request *snap.Request) (*snap.Response, *mi
 	return resp, nil
 }
 
+// CancelTransaction cancel the payment of the order at midtrans. An order whose payment page was never used is unknown
+// to midtrans, so a not found is not an error
+func (u *SnapUtil) CancelTransaction(orderId string) *midtrans.Error {
+	if _, err := u.coreClient.CancelTransaction(orderId); err != nil && err.StatusCode != 404 {
+		return err
+	}
+	return nil
+}
+
 func (u *SnapUtil) CheckSignature(message map[string]interface{}) error {
-	orderId := message["order_id"].(string)
-	statusCode := message["status_code"].(string)
-	grossAmt := message["gross_amount"].(string)
-	signatureKey := message["signature_key"].(string)
+	orderId, _ := message["order_id"].(string) //a missing field does not match any signature
+	statusCode, _ := message["status_code"].(string)
+	grossAmt, _ := message["gross_amount"].(string)
+	signatureKey, _ := message["signature_key"].(string)
 	var serverKey string
 	if u.app.MidtransIsProduction == false {
 		serverKey = u.app.ServerKeySandbox
@@ -56,7 +75,7 @@ func (u *SnapUtil) CheckSignature(message map[string]interface{}) error {
 	hasher := sha512.New()
 	hasher.Write([]byte(payload))
 	hashStr := fmt.Sprintf("%x", hasher.Sum(nil))
-	if hashStr != signatureKey {
+	if signatureKey == "" || hashStr != signatureKey {
 		return errors.New("SIGNATURE KEY NOT MATCH. Signature key: " + signatureKey + " given: " + hashStr)
 	}
 	return nil
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/frchandra/ticketing-gmcgo/resource"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+type emailTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+type RenderedEmail struct {
+	Subject  string
+	HtmlBody string
+	TextBody string
+}
+
+// TemplateRegistry parse every email template once at startup. The templates are laid out as
+// <locale>/<name>.gohtml (html content), <locale>/<name>.txt (plain text) and <locale>/<name>.subject,
+// the html content is wrapped by the theme layout in theme/<MAIL_THEME>.gohtml
+type TemplateRegistry struct {
+	config    *config.AppConfig
+	templates map[string]map[string]emailTemplate //locale => template name => template
+}
+
+func NewTemplateRegistry(config *config.AppConfig, log *LogUtil) *TemplateRegistry {
+	var templateFs fs.FS
+	if config.MailTemplateDir != "" { //allow editing the templates without rebuilding the binary
+		templateFs = os.DirFS(config.MailTemplateDir)
+	} else {
+		templateFs, _ = fs.Sub(resource.Templates, "template")
+	}
+
+	registry := &TemplateRegistry{config: config, templates: make(map[string]map[string]emailTemplate)}
+	if err := registry.load(templateFs); err != nil {
+		log.Log.Panicf("failed on loading the email templates: %s", err.Error())
+	}
+	return registry
+}
+
+func (r *TemplateRegistry) load(templateFs fs.FS) error {
+	layout, err := fs.ReadFile(templateFs, "theme/"+r.config.MailTheme+".gohtml")
+	if err != nil {
+		return err
+	}
+
+	locales, err := fs.ReadDir(templateFs, ".")
+	if err != nil {
+		return err
+	}
+	for _, locale := range locales {
+		if !locale.IsDir() || locale.Name() == "theme" {
+			continue
+		}
+		htmlFiles, err := fs.Glob(templateFs, locale.Name()+"/*.gohtml")
+		if err != nil {
+			return err
+		}
+		r.templates[locale.Name()] = make(map[string]emailTemplate)
+		for _, htmlFile := range htmlFiles {
+			name := strings.TrimSuffix(path.Base(htmlFile), ".gohtml")
+			var tmpl emailTemplate
+
+			content, err := fs.ReadFile(templateFs, htmlFile) //html content inside the theme layout
+			if err != nil {
+				return err
+			}
+			if tmpl.html, err = htmltemplate.New(name).Parse(string(layout)); err != nil {
+				return err
+			}
+			if _, err = tmpl.html.Parse(string(content)); err != nil {
+				return err
+			}
+
+			if content, err = fs.ReadFile(templateFs, locale.Name()+"/"+name+".subject"); err != nil {
+				return err
+			}
+			if tmpl.subject, err = texttemplate.New(name).Parse(strings.TrimSpace(string(content))); err != nil {
+				return err
+			}
+
+			if content, err = fs.ReadFile(templateFs, locale.Name()+"/"+name+".txt"); err == nil { //plain text part is optional, it is derived from the html otherwise
+				if tmpl.text, err = texttemplate.New(name).Parse(string(content)); err != nil {
+					return err
+				}
+			}
+			r.templates[locale.Name()][name] = tmpl
+		}
+	}
+
+	if _, ok := r.templates[r.config.MailLocale]; !ok {
+		return errors.New("there are no templates for the default locale " + r.config.MailLocale)
+	}
+	return nil
+}
+
+// Render the named template in the given locale, falling back to the default locale when it is not translated
+func (r *TemplateRegistry) Render(name, locale string, data map[string]any) (RenderedEmail, error) {
+	var rendered RenderedEmail
+	tmpl, ok := r.templates[locale][name]
+	if !ok {
+		locale = r.config.MailLocale
+		if tmpl, ok = r.templates[locale][name]; !ok {
+			return rendered, errors.New("cannot find email template: " + name)
+		}
+	}
+
+	values := make(map[string]any, len(data)+2) //common values available to every template
+	for key, value := range data {
+		values[key] = value
+	}
+	values["AppName"] = r.config.AppName
+	values["Locale"] = locale
+
+	var buffer bytes.Buffer
+	if err := tmpl.subject.Execute(&buffer, values); err != nil {
+		return rendered, err
+	}
+	rendered.Subject = buffer.String()
+
+	buffer.Reset()
+	if err := tmpl.html.ExecuteTemplate(&buffer, "layout", values); err != nil {
+		return rendered, err
+	}
+	rendered.HtmlBody = buffer.String()
+
+	if tmpl.text == nil {
+		rendered.TextBody = htmlToText(rendered.HtmlBody)
+		return rendered, nil
+	}
+	buffer.Reset()
+	if err := tmpl.text.Execute(&buffer, values); err != nil {
+		return rendered, err
+	}
+	rendered.TextBody = buffer.String()
+	return rendered, nil
+}
+
+// htmlToText strip the tags from the html body, good enough for the plain text part of a simple email
+func htmlToText(html string) string {
+	var text strings.Builder
+	inTag := false
+	for _, char := range html {
+		switch {
+		case char == '<':
+			inTag = true
+		case char == '>':
+			inTag = false
+		case !inTag:
+			text.WriteRune(char)
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(text.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
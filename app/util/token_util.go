@@ -9,12 +9,17 @@ import (
 	"github.com/go-redis/redis/v9"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrRefreshTokenReused = errors.New("refresh token has already been used, every token of this session is revoked")
+
 type TokenDetails struct {
+	SessionId    string
+	ParentUuid   string `json:"-"` //the refresh uuid this pair was refreshed from, empty on login
 	AccessToken  string
 	RefreshToken string
 	AccessUuid   string
@@ -26,51 +31,67 @@ type TokenDetails struct {
 type TokenUtil struct {
 	db        *redis.Client
 	appConfig *config.AppConfig
+	keyUtil   *KeyUtil
 }
 
-func NewTokenUtil(db *redis.Client, appConfig *config.AppConfig) *TokenUtil {
+func NewTokenUtil(db *redis.Client, appConfig *config.AppConfig, keyUtil *KeyUtil) *TokenUtil {
 	return &TokenUtil{
 		db:        db,
 		appConfig: appConfig,
+		keyUtil:   keyUtil,
 	}
 }
 
-func (tu *TokenUtil) CreateToken(userId uint64) (*TokenDetails, error) {
-	td := &TokenDetails{}
-	td.AtExpires = time.Now().Add(time.Minute * tu.appConfig.AccessMinute).Unix()
+// CreateToken create a new pair of tokens for the session, an empty session id start a new session
+func (tu *TokenUtil) CreateToken(userId uint64, sessionId string) (*TokenDetails, error) {
+	td := &TokenDetails{SessionId: sessionId}
+	if td.SessionId == "" {
+		td.SessionId = uuid.New().String()
+	}
+	td.AtExpires = time.Now().Add(tu.appConfig.AccessMinute).Unix()
 	td.AccessUuid = uuid.New().String()
 
-	td.RtExpires = time.Now().Add(time.Minute * tu.appConfig.RefreshMinute).Unix()
+	td.RtExpires = time.Now().Add(tu.appConfig.RefreshMinute).Unix()
 	td.RefreshUuid = uuid.New().String()
 
-	var err error
+	signingKey, err := tu.keyUtil.SigningKey()
+	if err != nil {
+		return nil, err
+	}
 
 	//Creating Access Token
 	atClaims := jwt.MapClaims{}
+	atClaims["token_type"] = "access"
 	atClaims["authorized"] = true
 	atClaims["access_uuid"] = td.AccessUuid
+	atClaims["session_id"] = td.SessionId
 	atClaims["user_id"] = userId
 	atClaims["exp"] = td.AtExpires
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(tu.appConfig.AccessSecret))
+	at := jwt.NewWithClaims(jwt.GetSigningMethod(signingKey.Algorithm), atClaims)
+	at.Header["kid"] = signingKey.Kid //tell the verifier which of the published keys to use
+	td.AccessToken, err = at.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
 	//Creating Refresh Token
 	rtClaims := jwt.MapClaims{}
+	rtClaims["token_type"] = "refresh"
 	rtClaims["refresh_uuid"] = td.RefreshUuid
+	rtClaims["session_id"] = td.SessionId
 	rtClaims["user_id"] = userId
 	rtClaims["exp"] = td.RtExpires
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(tu.appConfig.RefreshSecret))
+	rt := jwt.NewWithClaims(jwt.GetSigningMethod(signingKey.Algorithm), rtClaims)
+	rt.Header["kid"] = signingKey.Kid
+	td.RefreshToken, err = rt.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 	return td, nil
 }
 
-func (tu *TokenUtil) StoreAuthn(userid uint64, td *TokenDetails) error {
+// StoreAuthn store the tokens of the session to redis together with the session record of the given device and ip
+func (tu *TokenUtil) StoreAuthn(userid uint64, td *TokenDetails, device, ip string) error {
 	at := time.Unix(td.AtExpires, 0) //converting Unix to UTC(to Time object)
 	rt := time.Unix(td.RtExpires, 0)
 	now := time.Now()
@@ -84,7 +105,7 @@ func (tu *TokenUtil) StoreAuthn(userid uint64, td *TokenDetails) error {
 	if err := tu.db.Set(ctx, td.RefreshUuid, strconv.Itoa(int(userid)), rt.Sub(now)).Err(); err != nil {
 		return err
 	}
-	return nil
+	return tu.storeSession(ctx, userid, td, device, ip, rt.Sub(now))
 }
 
 func (tu *TokenUtil) FetchAuthn(uuid string) error {
@@ -121,18 +142,32 @@ func (tu *TokenUtil) ExtractToken(c *gin.Context) string {
 	return ""
 }
 
-func (tu *TokenUtil) VerifyToken(c *gin.Context, secret string) (*jwt.Token, error) {
+// ExtractRefreshToken read the refresh token from the cookie when it is enabled, otherwise like the other tokens
+func (tu *TokenUtil) ExtractRefreshToken(c *gin.Context) string {
+	if tu.appConfig.RefreshCookie {
+		if token, err := c.Cookie(tu.appConfig.RefreshCookieName); err == nil && token != "" {
+			return token
+		}
+	}
+	return tu.ExtractToken(c)
+}
+
+func (tu *TokenUtil) VerifyToken(tokenString string) (*jwt.Token, error) {
 	//verify the token format and algorithm
-	tokenString := tu.ExtractToken(c)
 	if tokenString == "" {
 		return nil, errors.New("cannot find token")
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok { //Make sure that the token method conform to "SigningMethodHMAC"
+		kid, _ := token.Header["kid"].(string) //find the public key that signed this token
+		publicKey, algorithm, err := tu.keyUtil.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != algorithm { //Make sure that the token method conform to the key, a token must not pick its own algorithm
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
+		return publicKey, nil
 	})
 	if err != nil {
 		return nil, err
@@ -140,25 +175,31 @@ func (tu *TokenUtil) VerifyToken(c *gin.Context, secret string) (*jwt.Token, err
 	return token, nil
 }
 
-func (tu *TokenUtil) ValidateToken(c *gin.Context, secret string) (*jwt.Token, error) {
+// ValidateToken verify the token and make sure it is an access or a refresh token as expected
+func (tu *TokenUtil) ValidateToken(tokenString, tokenType string) (*jwt.Token, error) {
 	//verify the token claims
-	token, err := tu.VerifyToken(c, secret)
+	token, err := tu.VerifyToken(tokenString)
 	if err != nil {
 		return token, err
 	}
-	if _, ok := token.Claims.(jwt.Claims); !ok && !token.Valid {
-		return token, err
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return token, errors.New("invalid token")
+	}
+	if claims["token_type"] != tokenType { //a refresh token can not be used to access the api and vice versa
+		return token, errors.New("unexpected token type")
 	}
 	return token, nil
 }
 
 type AccessDetails struct {
 	AccessUuid string
+	SessionId  string
 	UserId     uint64
 }
 
 func (tu *TokenUtil) GetValidatedAccess(c *gin.Context) (*AccessDetails, error) {
-	token, err := tu.ValidateToken(c, tu.appConfig.AccessSecret)
+	token, err := tu.ValidateToken(tu.ExtractToken(c), "access")
 	if err != nil {
 		return nil, err
 	}
@@ -174,8 +215,10 @@ func (tu *TokenUtil) GetValidatedAccess(c *gin.Context) (*AccessDetails, error)
 		return nil, err
 	}
 
+	sessionId, _ := claims["session_id"].(string) //tokens issued before the sessions were introduced have no session
 	return &AccessDetails{
 		AccessUuid: accessUuid,
+		SessionId:  sessionId,
 		UserId:     userId,
 	}, nil
 }
@@ -183,7 +226,7 @@ func (tu *TokenUtil) GetValidatedAccess(c *gin.Context) (*AccessDetails, error)
 // TODO: learn tu all
 
 func (tu *TokenUtil) Refresh(c *gin.Context) (map[string]string, error) {
-	token, err := tu.ValidateToken(c, tu.appConfig.RefreshSecret)
+	token, err := tu.ValidateToken(tu.ExtractRefreshToken(c), "refresh")
 	if err != nil {
 		return nil, err
 	}
@@ -199,24 +242,197 @@ func (tu *TokenUtil) Refresh(c *gin.Context) (map[string]string, error) {
 		return nil, err
 	}
 
-	//Delete the previous Refresh Token
+	sessionId, _ := claims["session_id"].(string)
+	ctx := context.Background()
+
+	//Delete the previous Refresh Token, only one request can win this
 	deleted, err := tu.DeleteAuthn(refreshUuid)
-	if err != nil || deleted == 0 { //if any goes wrong
+	if err != nil {
 		return nil, err
 	}
+	if deleted == 0 {
+		if sessionId != "" && tu.db.HGet(ctx, "refresh_family:"+sessionId, refreshUuid+":status").Val() == "used" { //a consumed token is replayed, it may have been stolen
+			tu.DeleteSession(userId, sessionId)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, errors.New("refresh token is no longer valid") //the session has been revoked or has expired
+	}
+	if sessionId != "" { //the previous access token of the session is replaced as well
+		tu.db.HSet(ctx, "refresh_family:"+sessionId, refreshUuid+":status", "used")
+		if accessUuid, err := tu.db.HGet(ctx, "session:"+sessionId, "access_uuid").Result(); err == nil {
+			tu.DeleteAuthn(accessUuid)
+		}
+	}
 	//Create new pairs of refresh and access tokens
-	tokenDetails, err := tu.CreateToken(userId)
+	tokenDetails, err := tu.CreateToken(userId, sessionId)
 	if err != nil {
 		return nil, err
 	}
+	tokenDetails.ParentUuid = refreshUuid
 	//save the tokens metadata to redis
-	saveErr := tu.StoreAuthn(userId, tokenDetails)
+	saveErr := tu.StoreAuthn(userId, tokenDetails, c.Request.UserAgent(), c.ClientIP())
 	if saveErr != nil {
-		return nil, err
+		return nil, saveErr
 	}
 	tokens := map[string]string{
 		"access_token":  tokenDetails.AccessToken,
 		"refresh_token": tokenDetails.RefreshToken,
 	}
+	if tu.SetRefreshCookie(c, tokenDetails) {
+		delete(tokens, "refresh_token")
+	}
 	return tokens, nil
 }
+
+// SetRefreshCookie put the refresh token in an http only cookie when it is enabled and report whether it did,
+// the caller should leave the token out of the response body then
+func (tu *TokenUtil) SetRefreshCookie(c *gin.Context, td *TokenDetails) bool {
+	if !tu.appConfig.RefreshCookie {
+		return false
+	}
+	tu.setCookie(c, tu.appConfig.RefreshCookieName, td.RefreshToken, int(time.Until(time.Unix(td.RtExpires, 0)).Seconds()))
+	return true
+}
+
+func (tu *TokenUtil) ClearRefreshCookie(c *gin.Context) {
+	if tu.appConfig.RefreshCookie {
+		tu.setCookie(c, tu.appConfig.RefreshCookieName, "", -1)
+	}
+}
+
+// SetOidcStateCookie keep the signed oidc state in the browser until the login at the provider is finished
+func (tu *TokenUtil) SetOidcStateCookie(c *gin.Context, signedState string) {
+	tu.setCookie(c, "oidc_state", signedState, int(tu.appConfig.OidcStateMinute.Seconds()))
+}
+
+// TakeOidcStateCookie return the signed oidc state of the browser and clear it, a state can only be used once
+func (tu *TokenUtil) TakeOidcStateCookie(c *gin.Context) string {
+	signedState, _ := c.Cookie("oidc_state")
+	tu.setCookie(c, "oidc_state", "", -1)
+	return signedState
+}
+
+func (tu *TokenUtil) setCookie(c *gin.Context, name, value string, maxAge int) {
+	switch tu.appConfig.RefreshCookieSameSite {
+	case "strict":
+		c.SetSameSite(http.SameSiteStrictMode)
+	case "lax":
+		c.SetSameSite(http.SameSiteLaxMode)
+	default:
+		c.SetSameSite(http.SameSiteNoneMode)
+	}
+	c.SetCookie(name, value, maxAge, tu.appConfig.RefreshCookiePath, tu.appConfig.RefreshCookieDomain, tu.appConfig.RefreshCookieSecure, true)
+}
+
+type Session struct {
+	SessionId  string    `json:"session_id"`
+	Device     string    `json:"device"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// storeSession keep the session record in the session:<id> hash and its id in the user_sessions:<user id> set.
+// The record lives as long as the refresh token
+func (tu *TokenUtil) storeSession(ctx context.Context, userId uint64, td *TokenDetails, device, ip string, ttl time.Duration) error {
+	sessionKey := "session:" + td.SessionId
+	userKey := "user_sessions:" + strconv.FormatUint(userId, 10)
+	now := time.Now().Unix()
+	_, err := tu.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, sessionKey, "created_at", now) //kept when the session is refreshed
+		pipe.HSet(ctx, sessionKey, "user_id", userId, "device", device, "ip", ip, "last_used_at", now, "access_uuid", td.AccessUuid, "refresh_uuid", td.RefreshUuid)
+		pipe.Expire(ctx, sessionKey, ttl)
+		pipe.SAdd(ctx, userKey, td.SessionId)
+		pipe.Expire(ctx, userKey, ttl)
+		familyKey := "refresh_family:" + td.SessionId //every refresh token of the session linked to its predecessor
+		pipe.HSet(ctx, familyKey, td.RefreshUuid+":status", "active", td.RefreshUuid+":parent", td.ParentUuid)
+		pipe.Expire(ctx, familyKey, ttl)
+		return nil
+	})
+	return err
+}
+
+// TouchSession update when and from where the session was last used
+func (tu *TokenUtil) TouchSession(sessionId, ip string) error {
+	if sessionId == "" {
+		return nil
+	}
+	ctx := context.Background()
+	sessionKey := "session:" + sessionId
+	if exists, err := tu.db.Exists(ctx, sessionKey).Result(); err != nil || exists == 0 { //do not bring a deleted session back
+		return err
+	}
+	return tu.db.HSet(ctx, sessionKey, "ip", ip, "last_used_at", time.Now().Unix()).Err()
+}
+
+// GetSessions list the active sessions of the user, the ids of the expired sessions are cleaned up
+func (tu *TokenUtil) GetSessions(userId uint64) ([]Session, error) {
+	ctx := context.Background()
+	userKey := "user_sessions:" + strconv.FormatUint(userId, 10)
+	sessionIds, err := tu.db.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	for _, sessionId := range sessionIds {
+		values, err := tu.db.HGetAll(ctx, "session:"+sessionId).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			tu.db.SRem(ctx, userKey, sessionId)
+			continue
+		}
+		createdAt, _ := strconv.ParseInt(values["created_at"], 10, 64)
+		lastUsedAt, _ := strconv.ParseInt(values["last_used_at"], 10, 64)
+		sessions = append(sessions, Session{
+			SessionId:  sessionId,
+			Device:     values["device"],
+			Ip:         values["ip"],
+			CreatedAt:  time.Unix(createdAt, 0),
+			LastUsedAt: time.Unix(lastUsedAt, 0),
+		})
+	}
+	return sessions, nil
+}
+
+// DeleteSession revoke the session of the user by deleting its access token, refresh token and record.
+// It returns false when the session does not belong to the user
+func (tu *TokenUtil) DeleteSession(userId uint64, sessionId string) (bool, error) {
+	ctx := context.Background()
+	sessionKey := "session:" + sessionId
+	values, err := tu.db.HGetAll(ctx, sessionKey).Result()
+	if err != nil {
+		return false, err
+	}
+	if values["user_id"] != strconv.FormatUint(userId, 10) {
+		return false, nil
+	}
+	_, err = tu.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, values["access_uuid"], values["refresh_uuid"], sessionKey, "refresh_family:"+sessionId)
+		pipe.SRem(ctx, "user_sessions:"+strconv.FormatUint(userId, 10), sessionId)
+		return nil
+	})
+	return err == nil, err
+}
+
+// DeleteSessions revoke every session of the user and return how many were revoked
+func (tu *TokenUtil) DeleteSessions(userId uint64) (int, error) {
+	sessionIds, err := tu.db.SMembers(context.Background(), "user_sessions:"+strconv.FormatUint(userId, 10)).Result()
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, sessionId := range sessionIds {
+		deleted, err := tu.DeleteSession(userId, sessionId)
+		if err != nil {
+			return revoked, err
+		}
+		if deleted {
+			revoked++
+		}
+	}
+	tu.db.Del(context.Background(), "user_sessions:"+strconv.FormatUint(userId, 10))
+	return revoked, nil
+}
@@ -0,0 +1,16 @@
+package validation
+
+import "time"
+
+type ApiKeyRequest struct {
+	Name      string     `json:"name" binding:"required,min=3,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,unique"`
+	ExpiresAt *time.Time `json:"expires_at"` //RFC3339, the key never expires when empty
+}
+
+type ComplimentaryRequest struct {
+	Name    string `json:"name" binding:"required,min=3,max=36"`
+	Email   string `json:"email" binding:"required,email,min=5,max=64"`
+	Phone   string `json:"phone" binding:"omitempty,min=7,max=15,number"`
+	SeatIds []uint `json:"seat_ids" binding:"required,min=1,max=20,unique"`
+}
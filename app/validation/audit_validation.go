@@ -0,0 +1,16 @@
+package validation
+
+import "time"
+
+type AuditEventQuery struct {
+	ActorType  string     `form:"actor_type" binding:"omitempty,oneof=user staff api_key gateway system anonymous"`
+	ActorId    string     `form:"actor_id" binding:"max=64"`
+	Action     string     `form:"action" binding:"max=64"`
+	TargetType string     `form:"target_type" binding:"max=64"`
+	TargetId   string     `form:"target_id" binding:"max=128"`
+	RequestId  string     `form:"request_id" binding:"max=64"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` //RFC3339, inclusive
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`   //RFC3339, exclusive
+	Page       int        `form:"page" binding:"omitempty,min=1"`
+	PerPage    int        `form:"per_page" binding:"omitempty,min=1,max=500"`
+}
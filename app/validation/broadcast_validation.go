@@ -0,0 +1,11 @@
+package validation
+
+import "time"
+
+type BroadcastRequest struct {
+	Subject     string     `json:"subject" binding:"required,max=150"`
+	Body        string     `json:"body" binding:"required"`
+	Target      string     `json:"target" binding:"required,oneof=all section attendance"`
+	TargetValue string     `json:"target_value" binding:"max=255"` //venue section names or row labels such as Balcony or A,B,C for section, attended, exchanged or absent for attendance
+	ScheduledAt *time.Time `json:"scheduled_at"`                   //RFC3339, the broadcast is sent right away when empty
+}
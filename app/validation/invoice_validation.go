@@ -0,0 +1,9 @@
+package validation
+
+type InvoiceLineResponse struct {
+	Kind      string `json:"kind"` //ticket, discount, fee or tax
+	Name      string `json:"name"`
+	Quantity  uint   `json:"quantity"`
+	UnitPrice int64  `json:"unit_price"`
+	Amount    int64  `json:"amount"`
+}
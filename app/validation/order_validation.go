@@ -0,0 +1,58 @@
+package validation
+
+import "time"
+
+type UserOrderQuery struct {
+	Page    int `form:"page" binding:"omitempty,min=1"`
+	PerPage int `form:"per_page" binding:"omitempty,min=1,max=100"`
+}
+
+type OrderQuery struct {
+	Status  string     `form:"status" binding:"omitempty,oneof=awaiting_payment pending cancelling paid expired cancelled denied failed refunded partially_refunded"`
+	UserId  uint64     `form:"user_id"`
+	From    *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` //RFC3339, inclusive
+	To      *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`   //RFC3339, exclusive
+	Page    int        `form:"page" binding:"omitempty,min=1"`
+	PerPage int        `form:"per_page" binding:"omitempty,min=1,max=500"`
+}
+
+type OrderResponse struct {
+	OrderId              string               `json:"order_id"`
+	UserId               uint64               `json:"user_id"`
+	Name                 string               `json:"name"`
+	Email                string               `json:"email"`
+	Status               string               `json:"status"`
+	Currency             string               `json:"currency"`
+	Subtotal             uint64               `json:"subtotal"`
+	Discount             uint64               `json:"discount"`
+	Fees                 uint64               `json:"fees"`
+	Tax                  uint64               `json:"tax"`
+	Total                uint64               `json:"total"`
+	PromoCode            string               `json:"promo_code"`
+	PaymentType          string               `json:"payment_type"`
+	GatewayStatus        string               `json:"gateway_status"`
+	GatewayTransactionId string               `json:"gateway_transaction_id"`
+	RedirectUrl          string               `json:"redirect_url"`
+	ExpiresAt            *time.Time           `json:"expires_at"`
+	PaidAt               *time.Time           `json:"paid_at"`
+	ClosedAt             *time.Time           `json:"closed_at"`
+	CreatedAt            time.Time            `json:"created_at"`
+	Timeline             []OrderEventResponse `json:"timeline"`
+	PaymentInstructions  []map[string]string  `json:"payment_instructions,omitempty"` //how to pay the pending order
+	Lines                []OrderLineResponse  `json:"lines"`
+}
+
+type OrderEventResponse struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+type OrderLineResponse struct {
+	TransactionId  uint64 `json:"transaction_id"`
+	Name           string `json:"name"`
+	Link           string `json:"link"`
+	Price          uint   `json:"price"`
+	Confirmation   string `json:"confirmation"`
+	PostSaleStatus string `json:"post_sale_status"`
+	Transferred    bool   `json:"transferred"` //given to another user, who has the link now
+}
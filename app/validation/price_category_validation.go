@@ -0,0 +1,22 @@
+package validation
+
+type PriceCategoryRequest struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Price       uint   `json:"price"`
+	Currency    string `json:"currency" binding:"omitempty,len=3,uppercase"` //IDR when empty
+	Description string `json:"description" binding:"max=255"`
+	Color       string `json:"color" binding:"omitempty,hexcolor"`
+}
+
+type CategorySeatsRequest struct {
+	SeatIds []uint `json:"seat_ids" binding:"required,min=1,unique"`
+}
+
+type CategoryResponse struct {
+	PriceCategoryId uint64 `json:"price_category_id"`
+	Name            string `json:"name"`
+	Price           uint   `json:"price"`
+	Currency        string `json:"currency"`
+	Description     string `json:"description"`
+	Color           string `json:"color"`
+}
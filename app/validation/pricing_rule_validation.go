@@ -0,0 +1,29 @@
+package validation
+
+import "time"
+
+type PricingRuleRequest struct {
+	Name            string     `json:"name" binding:"required,max=64"`
+	PriceCategoryId *uint64    `json:"price_category_id"` //leave empty for every seat and ticket
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	MinSoldPercent  uint       `json:"min_sold_percent" binding:"max=100"` //the rule applies once this much of the category is sold
+	Kind            string     `json:"kind" binding:"required,oneof=percentage fixed price"`
+	Value           int        `json:"value"` //percent or amount added to the price, negative for a discount. The price itself for the price kind
+	Priority        int        `json:"priority"`
+	Active          *bool      `json:"active"` //true when empty
+}
+
+type PricingRuleResponse struct {
+	PricingRuleId   uint64     `json:"pricing_rule_id"`
+	Name            string     `json:"name"`
+	PriceCategoryId *uint64    `json:"price_category_id"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	MinSoldPercent  uint       `json:"min_sold_percent"`
+	Kind            string     `json:"kind"`
+	Value           int        `json:"value"`
+	Priority        int        `json:"priority"`
+	Active          bool       `json:"active"`
+	AppliesNow      bool       `json:"applies_now"` //the rule prices the seats and tickets right now, unless a rule with a higher priority does
+}
@@ -0,0 +1,47 @@
+package validation
+
+import "time"
+
+type PromoCodeRequest struct {
+	Code             string     `json:"code" binding:"required,min=3,max=32,alphanum"` //case insensitive
+	Description      string     `json:"description" binding:"max=255"`
+	Kind             string     `json:"kind" binding:"required,oneof=percentage fixed"`
+	Value            uint       `json:"value" binding:"required,min=1"`      //the percentage, or the amount taken off the order
+	PriceCategoryIds []uint64   `json:"price_category_ids" binding:"unique"` //leave empty for every seat and ticket
+	MaxUses          int        `json:"max_uses" binding:"min=0"`            //0 for no limit
+	MaxUsesPerUser   int        `json:"max_uses_per_user" binding:"min=0"`   //0 for no limit
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	Active           *bool      `json:"active"` //true when empty
+}
+
+type PromoCodeResponse struct {
+	PromoCodeId      uint64     `json:"promo_code_id"`
+	Code             string     `json:"code"`
+	Description      string     `json:"description"`
+	Kind             string     `json:"kind"`
+	Value            uint       `json:"value"`
+	PriceCategoryIds []uint64   `json:"price_category_ids"`
+	MaxUses          int        `json:"max_uses"`
+	MaxUsesPerUser   int        `json:"max_uses_per_user"`
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	Active           bool       `json:"active"`
+	Redeemed         int        `json:"redeemed"`       //settled orders that used the code
+	DiscountTotal    uint64     `json:"discount_total"` //given on the settled orders
+}
+
+type PromoRedemptionResponse struct {
+	OrderId   string    `json:"order_id"`
+	UserId    uint64    `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Discount  uint      `json:"discount"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CheckoutRequest struct {
+	PromoCode     string `json:"promo_code" binding:"max=32"`
+	PaymentMethod string `json:"payment_method" binding:"omitempty,oneof=credit_card gopay shopeepay bca_va bni_va bri_va permata_va echannel other_va indomaret alfamart akulaku"` //only offer this method on the payment page
+}
@@ -0,0 +1,14 @@
+package validation
+
+import "time"
+
+type PurchaseLimitRequest struct {
+	PriceCategoryId *uint64 `json:"price_category_id"` //leave empty for the event wide limit
+	MaxSeats        int     `json:"max_seats" binding:"required,min=1,max=1000"`
+}
+
+type PurchaseLimitOverrideRequest struct {
+	MaxSeats  int        `json:"max_seats" binding:"required,min=1,max=1000"`
+	Reason    string     `json:"reason" binding:"required,max=255"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
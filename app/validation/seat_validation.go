@@ -1,10 +1,13 @@
 package validation
 
 type ReservationResponse struct {
-	SeatId uint   `json:"seat_id"`
-	Name   string `json:"name"`
-	Price  uint   `json:"price"`
-	Status string `json:"status"`
+	SeatId      uint              `json:"seat_id"`
+	Name        string            `json:"name"`
+	Price       uint              `json:"price"`      //the price now, after the pricing rules
+	BasePrice   uint              `json:"base_price"` //the price of the seat or its category
+	PricingRule string            `json:"pricing_rule,omitempty"`
+	Status      string            `json:"status"`
+	Category    *CategoryResponse `json:"category"` //null for a seat without a price category
 }
 
 type BasicResponse struct {
@@ -12,6 +15,13 @@ type BasicResponse struct {
 	Price uint   `json:"price"`
 }
 
+// ReservationRequest hold seats, general admission tickets or both, the total is capped by the purchase limits, see ReservationService.CheckPurchaseLimitTxn
 type ReservationRequest struct {
-	SeatIds []uint `json:"data" binding:"required,unique,max=5"`
+	SeatIds []uint          `json:"data" binding:"unique"`
+	Tickets []TicketRequest `json:"tickets" binding:"unique=TicketTypeId,dive"`
+}
+
+type TicketRequest struct {
+	TicketTypeId uint64 `json:"ticket_type_id" binding:"required"`
+	Quantity     int    `json:"quantity" binding:"required,min=1"`
 }
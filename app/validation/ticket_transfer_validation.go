@@ -0,0 +1,20 @@
+package validation
+
+import "time"
+
+type TicketTransferRequest struct {
+	Link  string `json:"link" binding:"required,max=64"` //the seat link or the general admission ticket code in the e-ticket
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+type TicketTransferResponse struct {
+	TicketTransferId uint64     `json:"ticket_transfer_id"`
+	Direction        string     `json:"direction"` //outgoing when the user offered the ticket, incoming when it was offered to the user
+	SeatName         string     `json:"seat_name"`
+	FromName         string     `json:"from_name"`
+	ToEmail          string     `json:"to_email"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"created_at"`
+	AcceptedAt       *time.Time `json:"accepted_at"`
+	CancelledAt      *time.Time `json:"cancelled_at"`
+}
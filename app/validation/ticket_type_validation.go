@@ -0,0 +1,23 @@
+package validation
+
+type TicketTypeRequest struct {
+	Name            string  `json:"name" binding:"required,max=50"`
+	Description     string  `json:"description" binding:"max=255"`
+	Price           uint    `json:"price"`             //ignored when the ticket type is in a price category
+	PriceCategoryId *uint64 `json:"price_category_id"` //the ticket type gets the category price
+	Capacity        uint    `json:"capacity" binding:"required,min=1"`
+	OnSale          *bool   `json:"on_sale"` //true when empty
+}
+
+type TicketTypeResponse struct {
+	TicketTypeId    uint64  `json:"ticket_type_id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description"`
+	Price           uint    `json:"price"`      //the price now, after the pricing rules
+	BasePrice       uint    `json:"base_price"` //the price of the ticket type or its category
+	PricingRule     string  `json:"pricing_rule,omitempty"`
+	PriceCategoryId *uint64 `json:"price_category_id"`
+	Capacity        uint    `json:"capacity"`
+	Available       uint    `json:"available"`
+	OnSale          bool    `json:"on_sale"`
+}
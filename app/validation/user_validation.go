@@ -1,15 +1,10 @@
 package validation
 
-type LoginValidation struct {
-	Name  string `json:"name" binding:"required_without=Email,min=0,max=36"`
-	Email string `json:"email" binding:"required_without=Name,min=0,max=36"`
-	Phone string `json:"phone" binding:"required,min=7,max=15,number"`
-}
-
 type RegisterValidation struct {
-	Name  string `json:"name" binding:"required,min=3,max=36"`
-	Email string `json:"email" binding:"required,email,min=5,max=36"`
-	Phone string `json:"phone" binding:"required,min=7,max=15,number"`
+	Name   string `json:"name" binding:"required,min=3,max=36"`
+	Email  string `json:"email" binding:"required,email,min=5,max=36"`
+	Phone  string `json:"phone" binding:"required,min=7,max=15,number"`
+	Locale string `json:"locale" binding:"omitempty,oneof=id en"`
 }
 
 type OtpVerification struct {
@@ -20,3 +15,40 @@ type OtpVerification struct {
 type RegisterEmailValidation struct {
 	Email string `json:"email" binding:"required,email,min=5,max=36"`
 }
+
+type StaffLoginValidation struct {
+	Email        string `json:"email" binding:"required,email,max=64"`
+	Password     string `json:"password" binding:"required,max=128"`
+	Otp          string `json:"otp" binding:"omitempty,number,min=6,max=6"`
+	RecoveryCode string `json:"recovery_code" binding:"omitempty,max=16"`
+}
+
+type StaffValidation struct {
+	Name     string `json:"name" binding:"required,min=3,max=36"`
+	Email    string `json:"email" binding:"required,email,min=5,max=64"`
+	Role     string `json:"role" binding:"required,oneof=admin gate"`
+	Password string `json:"password" binding:"required,max=128"`
+}
+
+type PasswordValidation struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=128"`
+	NewPassword     string `json:"new_password" binding:"required,max=128"`
+}
+
+type TotpValidation struct {
+	Otp string `json:"otp" binding:"required,number,min=6,max=6"`
+}
+
+type TotpDisableValidation struct {
+	Password string `json:"password" binding:"required,max=128"`
+	Otp      string `json:"otp" binding:"required,number,min=6,max=6"`
+}
+
+type StaffPasswordValidation struct {
+	Password string `json:"password" binding:"required,max=128"`
+}
+
+type OidcCallbackValidation struct {
+	Code  string `json:"code" binding:"required,max=2048"`
+	State string `json:"state" binding:"required,max=128"`
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"time"
+)
+
+type BroadcastWorker struct {
+	config           *config.AppConfig
+	broadcastService *service.BroadcastService
+	log              *util.LogUtil
+}
+
+func NewBroadcastWorker(config *config.AppConfig, broadcastService *service.BroadcastService, log *util.LogUtil) *BroadcastWorker {
+	return &BroadcastWorker{config: config, broadcastService: broadcastService, log: log}
+}
+
+// Run queue the emails of the due broadcasts until the process is stopped, the email worker delivers them
+func (w *BroadcastWorker) Run() {
+	w.log.Log.Info("broadcast worker started")
+	ticker := time.NewTicker(w.config.BroadcastWorkerTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := w.broadcastService.DispatchDue(); err != nil {
+			w.log.BasicLog(err, "BroadcastWorker@Run")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"time"
+)
+
+type EmailWorker struct {
+	config       *config.AppConfig
+	emailService *service.EmailService
+	log          *util.LogUtil
+}
+
+func NewEmailWorker(config *config.AppConfig, emailService *service.EmailService, log *util.LogUtil) *EmailWorker {
+	return &EmailWorker{config: config, emailService: emailService, log: log}
+}
+
+// Run poll the email outbox and deliver the queued emails until the process is stopped
+func (w *EmailWorker) Run() {
+	w.log.Log.Info("email worker started")
+	ticker := time.NewTicker(w.config.MailWorkerTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		for { //keep draining while the outbox is full, then wait for the next tick
+			processed, err := w.emailService.DispatchDue(20)
+			if err != nil {
+				w.log.BasicLog(err, "EmailWorker@Run")
+				break
+			}
+			if processed < 20 {
+				break
+			}
+		}
+	}
+}
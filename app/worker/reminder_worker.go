@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"time"
+)
+
+type ReminderWorker struct {
+	config          *config.AppConfig
+	reminderService *service.ReminderService
+	log             *util.LogUtil
+}
+
+func NewReminderWorker(config *config.AppConfig, reminderService *service.ReminderService, log *util.LogUtil) *ReminderWorker {
+	return &ReminderWorker{config: config, reminderService: reminderService, log: log}
+}
+
+// Run queue the hold reminders and release the expired holds until the process is stopped
+func (w *ReminderWorker) Run() {
+	w.log.Log.Info("reminder worker started")
+	ticker := time.NewTicker(w.config.ReminderWorkerTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := w.reminderService.RemindExpiringHolds(); err != nil {
+			w.log.BasicLog(err, "ReminderWorker@Run")
+		}
+		if _, err := w.reminderService.ReleaseExpiredHolds(); err != nil {
+			w.log.BasicLog(err, "ReminderWorker@Run")
+		}
+	}
+}
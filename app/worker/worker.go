@@ -0,0 +1,26 @@
+package worker
+
+import "sync"
+
+// Worker run every background job of the app in one process
+type Worker struct {
+	emailWorker     *EmailWorker
+	reminderWorker  *ReminderWorker
+	broadcastWorker *BroadcastWorker
+}
+
+func NewWorker(emailWorker *EmailWorker, reminderWorker *ReminderWorker, broadcastWorker *BroadcastWorker) *Worker {
+	return &Worker{emailWorker: emailWorker, reminderWorker: reminderWorker, broadcastWorker: broadcastWorker}
+}
+
+func (w *Worker) Run() {
+	var wg sync.WaitGroup
+	for _, run := range []func(){w.emailWorker.Run, w.reminderWorker.Run, w.broadcastWorker.Run} {
+		wg.Add(1)
+		go func(run func()) {
+			defer wg.Done()
+			run()
+		}(run)
+	}
+	wg.Wait()
+}
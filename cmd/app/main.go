@@ -4,6 +4,7 @@ import (
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/frchandra/ticketing-gmcgo/injector"
 	"github.com/gin-gonic/gin"
+	"log"
 )
 
 func main() {
@@ -15,7 +16,10 @@ func main() {
 		gin.SetMode(gin.DebugMode)
 	}
 
-	router := injector.InitializeServer()
+	router, err := injector.InitializeServer()
+	if err != nil {
+		log.Fatalln(err)
+	}
 	router.Run(":" + appConfig.AppPort)
 
 	//TODO: simulasi runtime error, apakah seluruh aplikasi berhenti?
@@ -15,7 +15,10 @@ import (
 
 func main() {
 	fmt.Println("sending email")
-	mailer := injector.InitializeEmail()
+	mailer, err := injector.InitializeEmail()
+	if err != nil {
+		log.Fatalln(err)
+	}
 	logger := app.NewLogger(config.NewAppConfig())
 	logutil := util.NewLogUtil(logger)
 
@@ -27,15 +30,14 @@ func main() {
 		"Seats": []string{"H31", "H32", "H33"},
 	}
 
-	var seatsName = []string{"H31", "H32", "H33"}
-	var attachments map[string][]byte = make(map[string][]byte)
+	var attachments []util.MailAttachment
 
 	for i := 31; i <= 33; i++ {
-		ticket, _ := ticketUtil.GenerateETicket("H"+strconv.Itoa(i), "H"+strconv.Itoa(i))
-		attachments["H"+strconv.Itoa(i)+".png"] = ticket
+		ticket, _ := ticketUtil.GenerateETicket("SEAT", "H"+strconv.Itoa(i), "H"+strconv.Itoa(i))
+		attachments = append(attachments, util.MailAttachment{Filename: "H" + strconv.Itoa(i) + ".png", Content: ticket})
 	}
 
-	err := mailer.SendTicketEmail(data, reciever, attachments, seatsName)
+	err = mailer.Send("ticket", "id", data, reciever, attachments)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"log"
+	"time"
+)
+
+// rotate the jwt signing keys. The new key is published right away and signs after JWT_KEY_ACTIVATION,
+// the old keys keep verifying the issued tokens until they are pruned
+func main() {
+	appConfig := config.NewAppConfig()
+	algorithm := flag.String("alg", appConfig.JwtAlgorithm, "algorithm of the new key, RS256 or EdDSA")
+	prune := flag.Duration("prune", 0, "also delete the keys older than this, keep it longer than the refresh token lifetime")
+	flag.Parse()
+
+	key, err := util.GenerateSigningKey(appConfig.JwtKeyDir, *algorithm)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("generated %s key %s, it signs new tokens from %s\n", key.Algorithm, key.Kid, key.CreatedAt.Add(appConfig.JwtKeyActivation).Format(time.RFC3339))
+
+	if *prune > 0 {
+		pruned, err := util.PruneSigningKeys(appConfig.JwtKeyDir, time.Now().Add(-*prune))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, kid := range pruned {
+			fmt.Printf("deleted key %s\n", kid)
+		}
+	}
+}
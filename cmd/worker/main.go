@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"github.com/frchandra/ticketing-gmcgo/injector"
+	"log"
+)
+
+func main() {
+	fmt.Println("running worker")
+	worker, err := injector.InitializeWorker()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	worker.Run()
+}
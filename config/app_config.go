@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -34,10 +35,19 @@ type AppConfig struct {
 	MinioRootPassword  string
 	MinioTicketsBucket string
 
-	AccessSecret  string
-	RefreshSecret string
-	AccessMinute  time.Duration
-	RefreshMinute time.Duration
+	JwtAlgorithm     string
+	JwtKeyDir        string
+	JwtKeyReload     time.Duration
+	JwtKeyActivation time.Duration
+	AccessMinute     time.Duration
+	RefreshMinute    time.Duration
+
+	RefreshCookie         bool
+	RefreshCookieName     string
+	RefreshCookiePath     string
+	RefreshCookieDomain   string
+	RefreshCookieSecure   bool
+	RefreshCookieSameSite string
 
 	MerchId              string
 	MidtransIsProduction bool
@@ -54,26 +64,141 @@ type AppConfig struct {
 	MailEncryption  string
 	MailFromAddress string
 	MailFromName    string
+	MailFileDir     string
+	MailTemplateDir string
+	MailTheme       string
+	MailLocale      string
+	MailMaxAttempt  int
+	MailRetryMinute time.Duration
+	MailWorkerTick  time.Duration
+
+	Fees           []FeeRule
+	TaxName        string
+	TaxPercent     float64
+	TaxIncluded    bool
+	InvoicePrefix  string
+	InvoiceIssuer  string
+	InvoiceAddress string
+	InvoiceTaxId   string
+
+	VenueLayoutFile     string
+	TransactionMinute   time.Duration
+	PurchaseLimit       int
+	EventStartsAt       *time.Time
+	TransferLimit       int
+	TransferCutoff      time.Duration
+	EventReminderLead   time.Duration
+	ReminderLeadMinute  time.Duration
+	ReminderWorkerTick  time.Duration
+	BroadcastWorkerTick time.Duration
+	OtpSecret           string
+	OtpExpireMinute     time.Duration
+	OtpMaxAttempt       int
+	OtpLockMinute       time.Duration
+	OtpRateWindow       time.Duration
+	OtpEmailLimit       int
+	OtpIpLimit          int
 
-	TransactionMinute time.Duration
-	TotpPeriod        uint
+	AdminName              string
+	AdminEmail             string
+	AdminPassword          string
+	StaffPasswordMinLength int
+	StaffMaxFailedLogin    int
+	StaffLockMinute        time.Duration
 
-	AdminName  string
-	AdminEmail string
-	AdminPhone string
+	OidcProviders   map[string]OidcProvider
+	OidcStateMinute time.Duration
+	OidcStateSecret string
 
 	IsOpenGate      bool
 	QrScanBehaviour string
+
+	TrustedProxies    []string
+	RateLimitEnabled  bool
+	RateLimitPolicies map[string]RateLimitPolicy
+	WebhookAllowedIps []string
+}
+
+// FeeRule is a fee charged on every order. Kind is per_ticket or per_order with Amount in rupiah, or percentage with
+// Amount as the percent of the order after the discount
+type FeeRule struct {
+	Name   string
+	Kind   string
+	Amount float64
+}
+
+// RateLimitPolicy allow Limit requests per Window for each Key, the key is ip, user, email or api_key
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+	Key    string
+}
+
+// OidcProvider is an openid connect provider the customers can sign in with
+type OidcProvider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string //the frontend page that post the code back to the callback endpoint
+	Scopes       []string
 }
 
 func NewAppConfig() *AppConfig {
 	midtransIsProduction, _ := strconv.ParseBool(getEnv("MIDTRANS_IS_PRODUCTION", "0"))
 	isProduction, _ := strconv.ParseBool(getEnv("IS_PRODUCTION", "0"))
 
+	jwtKeyReload, _ := time.ParseDuration(getEnv("JWT_KEY_RELOAD", "1m"))
+	jwtKeyActivation, _ := time.ParseDuration(getEnv("JWT_KEY_ACTIVATION", "5m"))
 	accessMinute, _ := time.ParseDuration(getEnv("ACCESS_MINUTE", "15m"))
-	refreshMinute, _ := time.ParseDuration(getEnv("ACCESS_MINUTE", "120m"))
+	refreshMinute, _ := time.ParseDuration(getEnv("REFRESH_MINUTE", "120m"))
+	refreshCookie, _ := strconv.ParseBool(getEnv("REFRESH_COOKIE", "0"))
+	refreshCookieSecure, _ := strconv.ParseBool(getEnv("REFRESH_COOKIE_SECURE", "1"))
 	transactionMinute, _ := time.ParseDuration(getEnv("TRANSACTION_MINUTE", "15m"))
-	totpPeriodSecond, _ := time.ParseDuration(getEnv("TOTP_PERIOD", "5m"))
+	purchaseLimit, _ := strconv.Atoi(getEnv("PURCHASE_LIMIT", "5"))
+	var eventStartsAt *time.Time
+	if value := getEnv("EVENT_STARTS_AT", ""); value != "" {
+		startsAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			log.Fatalf("invalid EVENT_STARTS_AT %s, use a time like 2023-08-19T19:00:00+07:00", value)
+		}
+		eventStartsAt = &startsAt
+	} else {
+		log.Println("EVENT_STARTS_AT is not set, the ticket transfers never close and no event day reminder is sent")
+	}
+	transferLimit, _ := strconv.Atoi(getEnv("TRANSFER_LIMIT", "2"))
+	transferCutoff, _ := time.ParseDuration(getEnv("TRANSFER_CUTOFF", "24h"))
+	eventReminderLead, _ := time.ParseDuration(getEnv("EVENT_REMINDER_LEAD", "3h"))
+	reminderLeadMinute, _ := time.ParseDuration(getEnv("REMINDER_LEAD_MINUTE", "5m"))
+	reminderWorkerTick, _ := time.ParseDuration(getEnv("REMINDER_WORKER_TICK", "1m"))
+	broadcastWorkerTick, _ := time.ParseDuration(getEnv("BROADCAST_WORKER_TICK", "30s"))
+	otpSecret := getEnv("OTP_SECRET", "")
+	if otpSecret == "" {
+		log.Fatalf("OTP_SECRET is required, it is the key of the otp code hashes")
+	}
+	otpExpireMinute, _ := time.ParseDuration(getEnv("OTP_EXPIRE_MINUTE", getEnv("TOTP_PERIOD", "5m")))
+	otpMaxAttempt, _ := strconv.Atoi(getEnv("OTP_MAX_ATTEMPT", "5"))
+	otpLockMinute, _ := time.ParseDuration(getEnv("OTP_LOCK_MINUTE", "15m"))
+	otpRateWindow, _ := time.ParseDuration(getEnv("OTP_RATE_WINDOW", "15m"))
+	otpEmailLimit, _ := strconv.Atoi(getEnv("OTP_EMAIL_LIMIT", "3"))
+	otpIpLimit, _ := strconv.Atoi(getEnv("OTP_IP_LIMIT", "20"))
+	staffPasswordMinLength, _ := strconv.Atoi(getEnv("STAFF_PASSWORD_MIN_LENGTH", "12"))
+	staffMaxFailedLogin, _ := strconv.Atoi(getEnv("STAFF_MAX_FAILED_LOGIN", "5"))
+	staffLockMinute, _ := time.ParseDuration(getEnv("STAFF_LOCK_MINUTE", "15m"))
+	oidcStateMinute, _ := time.ParseDuration(getEnv("OIDC_STATE_MINUTE", "10m"))
+	oidcProviders := parseOidcProviders(splitEnv(getEnv("OIDC_PROVIDERS", ""))) //for example google,mock
+	oidcStateSecret := getEnv("OIDC_STATE_SECRET", "")
+	if len(oidcProviders) > 0 && oidcStateSecret == "" {
+		log.Fatalf("OIDC_STATE_SECRET is required when OIDC_PROVIDERS is set, it signs the login state cookie")
+	}
+	mailRetryMinute, _ := time.ParseDuration(getEnv("MAIL_RETRY_MINUTE", "1m"))
+	mailWorkerTick, _ := time.ParseDuration(getEnv("MAIL_WORKER_TICK", "10s"))
+	mailMaxAttempt, _ := strconv.Atoi(getEnv("MAIL_MAX_ATTEMPT", "6"))
+
+	taxPercent, _ := strconv.ParseFloat(getEnv("TAX_PERCENT", "0"), 64)
+	taxIncluded, _ := strconv.ParseBool(getEnv("TAX_INCLUDED", "0"))
+
+	rateLimitEnabled, _ := strconv.ParseBool(getEnv("RATE_LIMIT_ENABLED", "1"))
 
 	dbMaxIdleConnection, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNECTION", "10"))
 	dbMaxOpenConnection, _ := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNECTION", "10"))
@@ -105,10 +230,19 @@ func NewAppConfig() *AppConfig {
 		MinioRootPassword:  getEnv("MINIO_ROOT_PASSWORD", ""),
 		MinioTicketsBucket: getEnv("MINIO_TICKETS_BUCKET", ""),
 
-		AccessSecret:  getEnv("ACCESS_SECRET", ""),
-		RefreshSecret: getEnv("REFRESH_SECRET", ""),
-		AccessMinute:  accessMinute,
-		RefreshMinute: refreshMinute,
+		JwtAlgorithm:     getEnv("JWT_ALGORITHM", "EdDSA"), //RS256 or EdDSA, used for the generated keys
+		JwtKeyDir:        getEnv("JWT_KEY_DIR", "./storage/keys"),
+		JwtKeyReload:     jwtKeyReload,
+		JwtKeyActivation: jwtKeyActivation, //a rotated key is published this long before it signs
+		AccessMinute:     accessMinute,
+		RefreshMinute:    refreshMinute,
+
+		RefreshCookie:         refreshCookie, //deliver the refresh token as an http only cookie instead of in the json body
+		RefreshCookieName:     getEnv("REFRESH_COOKIE_NAME", "refresh_token"),
+		RefreshCookiePath:     getEnv("REFRESH_COOKIE_PATH", "/api/v1/user"), //only sent to the refresh and logout endpoints
+		RefreshCookieDomain:   getEnv("REFRESH_COOKIE_DOMAIN", ""),
+		RefreshCookieSecure:   refreshCookieSecure,
+		RefreshCookieSameSite: getEnv("REFRESH_COOKIE_SAME_SITE", "none"), //strict, lax or none
 
 		MerchId:              getEnv("MERCH_ID", ""),
 		MidtransIsProduction: midtransIsProduction,
@@ -117,7 +251,7 @@ func NewAppConfig() *AppConfig {
 		ClientKeyProduction:  getEnv("CLIENT_KEY_PRODUCTION", ""),
 		ServerKeyProduction:  getEnv("SERVER_KEY_PRODUCTION", ""),
 
-		MailMailer:      getEnv("MAIL_MAILER", "smtp"),
+		MailMailer:      getEnv("MAIL_MAILER", "smtp"), //smtp, file, memory
 		MailHost:        getEnv("MAIL_HOST", "smtp.gmail.com"),
 		MailPort:        getEnv("MAIL_PORT", "465"),
 		MailUsername:    getEnv("MAIL_USERNAME", ""),
@@ -125,16 +259,69 @@ func NewAppConfig() *AppConfig {
 		MailEncryption:  getEnv("MAIL_ENCRYPTION", "ssl"),
 		MailFromAddress: getEnv("MAIL_FROM_ADDRESS", ""),
 		MailFromName:    getEnv("MAIL_FROM_NAME", "gmco"),
+		MailFileDir:     getEnv("MAIL_FILE_DIR", "./storage/mail"),
+		MailTemplateDir: getEnv("MAIL_TEMPLATE_DIR", ""), //empty means using the templates embedded in the binary
+		MailTheme:       getEnv("MAIL_THEME", "default"),
+		MailLocale:      getEnv("MAIL_LOCALE", "id"),
+		MailMaxAttempt:  mailMaxAttempt,
+		MailRetryMinute: mailRetryMinute,
+		MailWorkerTick:  mailWorkerTick,
+
+		Fees:           parseFeeRules(splitEnv(getEnv("FEES", ""))), //for example Booking fee/per_ticket/5000,Service fee/percentage/2.5
+		TaxName:        getEnv("TAX_NAME", "PPN"),
+		TaxPercent:     taxPercent,  //0 for no tax line
+		TaxIncluded:    taxIncluded, //the prices already include the tax, so it is only shown on the invoice
+		InvoicePrefix:  getEnv("INVOICE_PREFIX", "INV-"),
+		InvoiceIssuer:  getEnv("INVOICE_ISSUER", getEnv("MAIL_FROM_NAME", "gmco")),
+		InvoiceAddress: getEnv("INVOICE_ADDRESS", ""),
+		InvoiceTaxId:   getEnv("INVOICE_TAX_ID", ""),
+
+		VenueLayoutFile:     getEnv("VENUE_LAYOUT_FILE", ""), //the layout json seeded by the migrator, empty means the embedded default
+		TransactionMinute:   transactionMinute,
+		PurchaseLimit:       purchaseLimit,     //seats one buyer can hold when the admin has not set an event wide limit
+		EventStartsAt:       eventStartsAt,     //like 2023-08-19T19:00:00+07:00, empty means the transfers never close
+		TransferLimit:       transferLimit,     //times one ticket can change hands, 0 for no limit
+		TransferCutoff:      transferCutoff,    //the transfers close this long before the event starts
+		EventReminderLead:   eventReminderLead, //the ticket holders are reminded this long before the event starts, 0 for no reminder
+		ReminderLeadMinute:  reminderLeadMinute,
+		ReminderWorkerTick:  reminderWorkerTick,
+		BroadcastWorkerTick: broadcastWorkerTick,
+		OtpSecret:           otpSecret, //key of the otp code hashes
+		OtpExpireMinute:     otpExpireMinute,
+		OtpMaxAttempt:       otpMaxAttempt, //wrong codes before the email is locked
+		OtpLockMinute:       otpLockMinute,
+		OtpRateWindow:       otpRateWindow,
+		OtpEmailLimit:       otpEmailLimit, //codes sent to one email per rate window
+		OtpIpLimit:          otpIpLimit,    //code requests and verifications from one ip per rate window
 
-		TransactionMinute: transactionMinute,
-		TotpPeriod:        uint(totpPeriodSecond.Seconds()),
+		AdminName:              getEnv("ADMIN_NAME", ""),
+		AdminEmail:             getEnv("ADMIN_EMAIL", ""),
+		AdminPassword:          getEnv("ADMIN_PASSWORD", ""), //only used to seed the first admin account
+		StaffPasswordMinLength: staffPasswordMinLength,
+		StaffMaxFailedLogin:    staffMaxFailedLogin, //wrong passwords or authenticator codes before the account is locked
+		StaffLockMinute:        staffLockMinute,
 
-		AdminName:  getEnv("ADMIN_NAME", ""),
-		AdminEmail: getEnv("ADMIN_EMAIL", ""),
-		AdminPhone: getEnv("ADMIN_PHONE", ""),
+		OidcProviders:   oidcProviders,
+		OidcStateMinute: oidcStateMinute, //time to finish the login at the provider
+		OidcStateSecret: oidcStateSecret, //key of the cookie that binds the login state to the browser
 
 		IsOpenGate:      true,
 		QrScanBehaviour: "open_gate", //open_gate, ticket_exchanging, default
+
+		TrustedProxies:   splitEnv(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16")), //the client ip is read from X-Forwarded-For only behind these proxies
+		RateLimitEnabled: rateLimitEnabled,
+		RateLimitPolicies: map[string]RateLimitPolicy{ //each policy is configured as limit/window/key
+			"otp_email":   parseRateLimitPolicy(getEnv("RATE_LIMIT_OTP_EMAIL", "5/10m/email")),
+			"otp_ip":      parseRateLimitPolicy(getEnv("RATE_LIMIT_OTP_IP", "30/10m/ip")),
+			"login":       parseRateLimitPolicy(getEnv("RATE_LIMIT_LOGIN", "10/1m/ip")),
+			"refresh":     parseRateLimitPolicy(getEnv("RATE_LIMIT_REFRESH", "30/1m/ip")),
+			"reserve":     parseRateLimitPolicy(getEnv("RATE_LIMIT_RESERVE", "10/1m/user")),
+			"checkout":    parseRateLimitPolicy(getEnv("RATE_LIMIT_CHECKOUT", "10/1m/user")),
+			"transfer":    parseRateLimitPolicy(getEnv("RATE_LIMIT_TRANSFER", "10/1h/user")), //every offer emails someone
+			"webhook":     parseRateLimitPolicy(getEnv("RATE_LIMIT_WEBHOOK", "120/1m/ip")),
+			"integration": parseRateLimitPolicy(getEnv("RATE_LIMIT_INTEGRATION", "120/1m/api_key")),
+		},
+		WebhookAllowedIps: splitEnv(getEnv("WEBHOOK_ALLOWED_IPS", "")), //ips or cidrs of the payment gateway, they bypass the webhook limit. A signed notification always does
 	}
 	return &appConfig
 }
@@ -149,3 +336,75 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func splitEnv(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// parseRateLimitPolicy read a policy in the limit/window/key format such as 10/1m/ip
+func parseRateLimitPolicy(value string) RateLimitPolicy {
+	parts := strings.Split(value, "/")
+	if len(parts) != 3 {
+		log.Fatalf("invalid rate limit policy %s, use limit/window/key", value)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil {
+		log.Fatalf("invalid rate limit policy %s: %s", value, err.Error())
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil {
+		log.Fatalf("invalid rate limit policy %s: %s", value, err.Error())
+	}
+	return RateLimitPolicy{Limit: limit, Window: window, Key: parts[2]}
+}
+
+// parseFeeRules read the fees in the name/kind/amount format such as Booking fee/per_ticket/5000
+func parseFeeRules(values []string) []FeeRule {
+	var fees []FeeRule
+	for _, value := range values {
+		parts := strings.Split(value, "/")
+		if len(parts) != 3 {
+			log.Fatalf("invalid fee %s, use name/kind/amount", value)
+		}
+		if parts[1] != "per_ticket" && parts[1] != "per_order" && parts[1] != "percentage" {
+			log.Fatalf("invalid fee %s, the kind is per_ticket, per_order or percentage", value)
+		}
+		amount, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || amount < 0 {
+			log.Fatalf("invalid fee %s: the amount must be a positive number", value)
+		}
+		fees = append(fees, FeeRule{Name: strings.TrimSpace(parts[0]), Kind: parts[1], Amount: amount})
+	}
+	return fees
+}
+
+// parseOidcProviders read the OIDC_<NAME>_* variables of each provider name. The issuer of google is known
+func parseOidcProviders(names []string) map[string]OidcProvider {
+	providers := make(map[string]OidcProvider)
+	for _, name := range names {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := ""
+		if name == "google" {
+			issuer = "https://accounts.google.com"
+		}
+		provider := OidcProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", issuer),
+			ClientId:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectUrl:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       splitEnv(getEnv(prefix+"SCOPES", "openid,email,profile")),
+		}
+		if provider.Issuer == "" || provider.ClientId == "" || provider.RedirectUrl == "" {
+			log.Fatalf("oidc provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+		providers[name] = provider
+	}
+	return providers
+}
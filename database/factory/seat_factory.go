@@ -1,310 +1,52 @@
 package factory
 
 import (
+	"encoding/json"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
-	"github.com/google/uuid"
+	"github.com/frchandra/ticketing-gmcgo/app/service"
+	"github.com/frchandra/ticketing-gmcgo/config"
+	"github.com/frchandra/ticketing-gmcgo/resource"
 	"gorm.io/gorm"
+	"os"
 )
 
 type SeatFactory struct {
-	db *gorm.DB
+	db     *gorm.DB
+	config *config.AppConfig
 }
 
-func NewSeatFactory(db *gorm.DB) SeatFactory {
-	return SeatFactory{db: db}
+func NewSeatFactory(db *gorm.DB, config *config.AppConfig) SeatFactory {
+	return SeatFactory{db: db, config: config}
 }
 
+// RunFactory seed the venue and its seats from the venue layout, the embedded default layout when VENUE_LAYOUT_FILE is empty
 func (this SeatFactory) RunFactory() error {
-	/*	temp := []string{"A", "B", "C", "D", "E"}
-		for i := 1; i <= 5; i++ {
-			for j := 10; j <= 21; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  165000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		temp = []string{"H", "I", "J", "K", "L"}
-		for i := 1; i <= 5; i++ {
-			for j := 10; j <= 21; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  165000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		temp = []string{"E", "F", "G", "H", "I", "J", "K", "L", "M"}
-		for i := 1; i <= 9; i++ {
-			for j := 1; j <= 9; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  145000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		temp = []string{"E", "F", "G", "H", "I", "J", "K", "L", "M"}
-		for i := 1; i <= 9; i++ {
-			for j := 22; j <= 30; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  145000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		for i := 10; i <= 15; i++ {
-			seat := &model.Seat{
-				Name:   "M" + strconv.Itoa(i),
-				Price:  165000,
-				Link:   uuid.New().String(),
-				Status: "available",
-			}
-			err := this.db.Debug().Create(seat).Error
-			if err != nil {
-				return err
-			}
-		}
-
-		temp = []string{"B", "C", "D"}
-		for i := 1; i <= 3; i++ {
-			for j := 3; j <= 9; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  145000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		temp = []string{"B", "C", "D"}
-		for i := 1; i <= 3; i++ {
-			for j := 22; j <= 28; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat := &model.Seat{
-					Name:   name,
-					Price:  145000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err := this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		for i := 1; i <= 15; i++ {
-			seat := &model.Seat{
-				Name:   "O" + strconv.Itoa(i),
-				Price:  145000,
-				Link:   uuid.New().String(),
-				Status: "available",
-			}
-			err := this.db.Debug().Create(seat).Error
-			if err != nil {
-				return err
-			}
-		}
-
-		for i := 23; i <= 30; i++ {
-			seat := &model.Seat{
-				Name:   "O" + strconv.Itoa(i),
-				Price:  145000,
-				Link:   uuid.New().String(),
-				Status: "available",
-			}
-			err := this.db.Debug().Create(seat).Error
-			if err != nil {
-				return err
-			}
-		}
-	*/
-	seat := &model.Seat{
-		Name:   "A8",
-		Price:  145000,
-		Link:   uuid.New().String(),
-		Status: "available",
+	var data []byte
+	var err error
+	if this.config.VenueLayoutFile != "" {
+		data, err = os.ReadFile(this.config.VenueLayoutFile)
+	} else {
+		data, err = resource.Venues.ReadFile("venue/default.json")
 	}
-	err := this.db.Debug().Create(seat).Error
 	if err != nil {
 		return err
 	}
 
-	seat = &model.Seat{
-		Name:   "A9",
-		Price:  145000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
-		return err
-	}
-
-	seat = &model.Seat{
-		Name:   "A22",
-		Price:  145000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
-		return err
-	}
-
-	seat = &model.Seat{
-		Name:   "A23",
-		Price:  145000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
+	var layout service.VenueLayout
+	if err = json.Unmarshal(data, &layout); err != nil {
 		return err
 	}
-
-	seat = &model.Seat{
-		Name:   "C1",
-		Price:  165000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
-		return err
-	}
-
-	seat = &model.Seat{
-		Name:   "C2",
-		Price:  165000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
-		return err
-	}
-
-	seat = &model.Seat{
-		Name:   "D1",
-		Price:  165000,
-		Link:   uuid.New().String(),
-		Status: "available",
-	}
-	err = this.db.Debug().Create(seat).Error
-	if err != nil {
-		return err
-	}
-
-	seat = &model.Seat{
-		Name:   "D2",
-		Price:  165000,
-		Link:   uuid.New().String(),
-		Status: "available",
+	categories := make(map[string]model.PriceCategory)
+	for _, layoutCategory := range layout.Categories {
+		category := service.NewCategoryFromLayout(layoutCategory)
+		if err = this.db.Debug().Create(&category).Error; err != nil {
+			return err
+		}
+		categories[category.Name] = category
 	}
-	err = this.db.Debug().Create(seat).Error
+	venue, err := service.BuildVenue(layout, categories)
 	if err != nil {
 		return err
 	}
-
-	/*	seat = &model.Seat{
-			Name:   "C29",
-			Price:  165000,
-			Link:   uuid.New().String(),
-			Status: "available",
-		}
-		err = this.db.Debug().Create(seat).Error
-		if err != nil {
-			return err
-		}
-
-		seat = &model.Seat{
-			Name:   "C30",
-			Price:  165000,
-			Link:   uuid.New().String(),
-			Status: "available",
-		}
-		err = this.db.Debug().Create(seat).Error
-		if err != nil {
-			return err
-		}
-
-		seat = &model.Seat{
-			Name:   "D29",
-			Price:  165000,
-			Link:   uuid.New().String(),
-			Status: "available",
-		}
-		err = this.db.Debug().Create(seat).Error
-		if err != nil {
-			return err
-		}
-
-		seat = &model.Seat{
-			Name:   "D30",
-			Price:  165000,
-			Link:   uuid.New().String(),
-			Status: "available",
-		}
-		err = this.db.Debug().Create(seat).Error
-		if err != nil {
-			return err
-		}*/
-
-	/*	temp = []string{"F", "G"}
-		for i := 1; i <= 2; i++ {
-			for j := 10; j <= 21; j++ {
-				name := temp[i-1] + strconv.Itoa(j)
-				seat = &model.Seat{
-					Name:   name,
-					Price:  165000,
-					Link:   uuid.New().String(),
-					Status: "available",
-				}
-				err = this.db.Debug().Create(seat).Error
-				if err != nil {
-					return err
-				}
-			}
-		}*/
-
-	return nil
-
+	return this.db.Debug().Create(&venue).Error
 }
@@ -1,7 +1,9 @@
 package factory
 
 import (
+	"errors"
 	"github.com/frchandra/ticketing-gmcgo/app/model"
+	"github.com/frchandra/ticketing-gmcgo/app/util"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"gorm.io/gorm"
 )
@@ -16,13 +18,24 @@ func NewUserFactory(db *gorm.DB, config *config.AppConfig) *UserFactory {
 }
 
 func (this *UserFactory) RunFactory() error {
+	if this.config.AdminPassword == "" {
+		return errors.New("ADMIN_PASSWORD is required to seed the admin account")
+	}
+	if err := util.CheckPasswordPolicy(this.config.AdminPassword, this.config.AdminEmail, this.config.StaffPasswordMinLength); err != nil {
+		return errors.New("ADMIN_PASSWORD: " + err.Error())
+	}
+	passwordHash, err := util.HashPassword(this.config.AdminPassword)
+	if err != nil {
+		return err
+	}
 	adminUser := model.User{
-		Name:  this.config.AdminName,
-		Email: this.config.AdminEmail,
-		Phone: this.config.AdminPhone,
+		Name:         this.config.AdminName,
+		Email:        this.config.AdminEmail,
+		Role:         "admin",
+		PasswordHash: passwordHash,
 	}
 
-	err := this.db.Debug().Create(&adminUser).Error
+	err = this.db.Debug().Create(&adminUser).Error
 	if err != nil {
 		return err
 	}
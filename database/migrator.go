@@ -8,6 +8,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// auditEventsAppendOnly make the database itself reject changing or deleting an audit event
+var auditEventsAppendOnly = []string{
+	`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_events is append only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+	`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`,
+}
+
+// invoiceNumberSequence number the invoices of the paid orders, the numbers start again with the tables
+var invoiceNumberSequence = []string{
+	`DROP SEQUENCE IF EXISTS invoice_number_seq`,
+	`CREATE SEQUENCE invoice_number_seq`,
+}
+
 type Migrator struct {
 	db *gorm.DB
 }
@@ -18,13 +36,20 @@ func NewMigrator(db *gorm.DB) *Migrator {
 	}
 }
 
+// RunMigration drop and recreate every table except audit_events, the audit trail outlives a fresh migration. Its target
+// ids may then point to the rows of the previous data
 func (mi *Migrator) RunMigration(option string) {
-	if err := mi.db.Migrator().DropTable(&model.User{}, &model.Seat{}, &model.Transaction{}); err != nil {
+	if err := mi.db.Migrator().DropTable(&model.User{}, &model.Seat{}, &model.Transaction{}, &model.EmailOutbox{}, &model.Broadcast{}, &model.BroadcastRecipient{}, &model.UserIdentity{}, &model.ApiKey{}, &model.PurchaseLimit{}, &model.PurchaseLimitOverride{}, &model.Venue{}, &model.VenueSection{}, &model.VenueRow{}, &model.PriceCategory{}, &model.TicketType{}, &model.PromoCode{}, &model.PromoRedemption{}, &model.PricingRule{}, &model.Invoice{}, &model.InvoiceLine{}, &model.Order{}, &model.TicketTransfer{}); err != nil {
 		panic(err)
 	}
-	if err := mi.db.AutoMigrate(&model.User{}, &model.Seat{}, &model.Transaction{}); err != nil {
+	if err := mi.db.AutoMigrate(&model.User{}, &model.Seat{}, &model.Transaction{}, &model.EmailOutbox{}, &model.Broadcast{}, &model.BroadcastRecipient{}, &model.UserIdentity{}, &model.ApiKey{}, &model.AuditEvent{}, &model.PurchaseLimit{}, &model.PurchaseLimitOverride{}, &model.Venue{}, &model.VenueSection{}, &model.VenueRow{}, &model.PriceCategory{}, &model.TicketType{}, &model.PromoCode{}, &model.PromoRedemption{}, &model.PricingRule{}, &model.Invoice{}, &model.InvoiceLine{}, &model.Order{}, &model.TicketTransfer{}); err != nil {
 		panic(err)
 	}
+	for _, statement := range append(auditEventsAppendOnly, invoiceNumberSequence...) {
+		if err := mi.db.Exec(statement).Error; err != nil {
+			panic(err)
+		}
+	}
 	if err := mi.RunFactory(); err != nil {
 		panic(err)
 	}
@@ -34,7 +59,7 @@ func (mi *Migrator) RunMigration(option string) {
 func (mi *Migrator) GetFactory() []factory.Factory {
 	return []factory.Factory{
 		factory.NewUserFactory(mi.db, config.NewAppConfig()),
-		factory.NewSeatFactory(mi.db),
+		factory.NewSeatFactory(mi.db, config.NewAppConfig()),
 	}
 }
 
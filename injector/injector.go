@@ -10,6 +10,7 @@ import (
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/worker"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/frchandra/ticketing-gmcgo/database"
 	"github.com/gin-gonic/gin"
@@ -21,17 +22,31 @@ var MiddlewareSet = wire.NewSet(
 	middleware.NewAdminMiddleware,
 	middleware.NewGateMiddleware,
 	middleware.NewScanQrMiddleware,
+	middleware.NewRateLimitMiddleware,
+	middleware.NewApiKeyMiddleware,
+	middleware.NewRequestIdMiddleware,
 )
 
 var UserSet = wire.NewSet(
 	repository.NewUserRepository,
 	service.NewUserService,
+	service.NewOtpService,
+	service.NewSessionService,
+	service.NewStaffService,
+	service.NewOidcService,
+	controller.NewSessionController,
+	controller.NewStaffController,
+	controller.NewOidcController,
+	controller.NewJwksController,
 	controller.NewAuthController,
 	controller.NewUserController,
 )
 
 var ReservationSet = wire.NewSet(
+	repository.NewPurchaseLimitRepository,
 	service.NewReservationService,
+	service.NewPurchaseLimitService,
+	controller.NewPurchaseLimitController,
 	controller.NewReservationController,
 )
 
@@ -39,6 +54,30 @@ var SeatSet = wire.NewSet(
 	controller.NewSeatController,
 	repository.NewSeatRepository,
 	service.NewSeatService,
+	repository.NewVenueRepository,
+	service.NewVenueService,
+	controller.NewVenueController,
+	repository.NewPriceCategoryRepository,
+	service.NewPriceCategoryService,
+	controller.NewPriceCategoryController,
+	repository.NewTicketTypeRepository,
+	service.NewTicketTypeService,
+	controller.NewTicketTypeController,
+	repository.NewPromoCodeRepository,
+	service.NewPromoCodeService,
+	controller.NewPromoCodeController,
+	repository.NewPricingRuleRepository,
+	service.NewPricingService,
+	controller.NewPricingRuleController,
+	repository.NewInvoiceRepository,
+	service.NewInvoiceService,
+	controller.NewInvoiceController,
+	repository.NewOrderRepository,
+	service.NewOrderService,
+	controller.NewOrderController,
+	repository.NewTicketTransferRepository,
+	service.NewTicketTransferService,
+	controller.NewTicketTransferController,
 )
 
 var TransactionSet = wire.NewSet(
@@ -52,19 +91,52 @@ var SnapSet = wire.NewSet(
 	service.NewSnapService,
 )
 
+var EmailSet = wire.NewSet(
+	repository.NewEmailOutboxRepository,
+	service.NewEmailService,
+	controller.NewEmailController,
+)
+
+var BroadcastSet = wire.NewSet(
+	repository.NewBroadcastRepository,
+	service.NewBroadcastService,
+	controller.NewBroadcastController,
+)
+
+var IntegrationSet = wire.NewSet(
+	repository.NewApiKeyRepository,
+	service.NewApiKeyService,
+	service.NewIntegrationService,
+	controller.NewApiKeyController,
+	controller.NewIntegrationController,
+)
+
+var AuditSet = wire.NewSet(
+	repository.NewAuditEventRepository,
+	service.NewAuditService,
+	controller.NewAuditController,
+)
+
 var GateSet = wire.NewSet(
+	service.NewConfigService,
 	controller.NewConfigController,
 )
 
 var UtilSet = wire.NewSet(
 	util.NewTokenUtil,
+	util.NewKeyUtil,
+	util.NewOtpUtil,
+	util.NewOidcUtil,
+	util.NewRateLimitUtil,
 	util.NewSnapUtil,
+	util.NewMailer,
+	util.NewTemplateRegistry,
 	util.NewEmailUtil,
 	util.NewETicketUtil,
 	util.NewLogUtil,
 )
 
-func InitializeServer() *gin.Engine {
+func InitializeServer() (*gin.Engine, error) {
 	wire.Build(
 		config.NewAppConfig,
 		app.NewDatabase,
@@ -78,10 +150,14 @@ func InitializeServer() *gin.Engine {
 		ReservationSet,
 		TransactionSet,
 		SnapSet,
+		EmailSet,
+		BroadcastSet,
+		IntegrationSet,
+		AuditSet,
 		GateSet,
 		app.NewRouter,
 	)
-	return nil
+	return nil, nil
 }
 
 func InitializeMigrator() *database.Migrator {
@@ -94,12 +170,48 @@ func InitializeMigrator() *database.Migrator {
 	return nil
 }
 
-func InitializeEmail() *util.EmailUtil {
+func InitializeEmail() (*util.EmailUtil, error) {
 	wire.Build(
 		config.NewAppConfig,
 		app.NewLogger,
 		util.NewLogUtil,
+		util.NewMailer,
+		util.NewTemplateRegistry,
 		util.NewEmailUtil,
 	)
-	return nil
+	return nil, nil
+}
+
+func InitializeWorker() (*worker.Worker, error) {
+	wire.Build(
+		config.NewAppConfig,
+		app.NewLogger,
+		app.NewDatabase,
+		app.NewMinio,
+		util.NewLogUtil,
+		util.NewMailer,
+		util.NewTemplateRegistry,
+		util.NewEmailUtil,
+		util.NewETicketUtil,
+		repository.NewEmailOutboxRepository,
+		repository.NewSeatRepository,
+		repository.NewTransactionRepository,
+		repository.NewBroadcastRepository,
+		repository.NewAuditEventRepository,
+		repository.NewPriceCategoryRepository,
+		repository.NewTicketTypeRepository,
+		repository.NewOrderRepository,
+		service.NewAuditService,
+		service.NewOrderService,
+		service.NewTicketTypeService,
+		service.NewEmailService,
+		service.NewSeatService,
+		service.NewReminderService,
+		service.NewBroadcastService,
+		worker.NewEmailWorker,
+		worker.NewReminderWorker,
+		worker.NewBroadcastWorker,
+		worker.NewWorker,
+	)
+	return nil, nil
 }
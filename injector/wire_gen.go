@@ -13,6 +13,7 @@ import (
 	"github.com/frchandra/ticketing-gmcgo/app/repository"
 	"github.com/frchandra/ticketing-gmcgo/app/service"
 	"github.com/frchandra/ticketing-gmcgo/app/util"
+	"github.com/frchandra/ticketing-gmcgo/app/worker"
 	"github.com/frchandra/ticketing-gmcgo/config"
 	"github.com/frchandra/ticketing-gmcgo/database"
 	"github.com/gin-gonic/gin"
@@ -21,38 +22,100 @@ import (
 
 // Injectors from injector.go:
 
-func InitializeServer() *gin.Engine {
+func InitializeServer() (*gin.Engine, error) {
 	appConfig := config.NewAppConfig()
 	logger := app.NewLogger(appConfig)
 	client := app.NewCache(appConfig, logger)
-	tokenUtil := util.NewTokenUtil(client, appConfig)
+	logUtil := util.NewLogUtil(logger)
+	keyUtil := util.NewKeyUtil(appConfig, logUtil)
+	tokenUtil := util.NewTokenUtil(client, appConfig, keyUtil)
 	userMiddleware := middleware.NewUserMiddleware(tokenUtil, logger)
 	db := app.NewDatabase(appConfig, logger)
-	logUtil := util.NewLogUtil(logger)
 	userRepository := repository.NewUserRepository(db, logUtil)
 	userService := service.NewUserService(userRepository, tokenUtil)
 	adminMiddleware := middleware.NewAdminMiddleware(tokenUtil, logger, appConfig, userService)
 	gateMiddleware := middleware.NewGateMiddleware(appConfig)
 	scanQrMiddleware := middleware.NewScanQrMiddleware(tokenUtil, logger, appConfig, userService)
-	userController := controller.NewUserController(userService, tokenUtil, appConfig)
-	emailUtil := util.NewEmailUtil(appConfig, logUtil)
-	authController := controller.NewAuthController(userService, tokenUtil, logUtil, emailUtil, appConfig)
-	transactionRepository := repository.NewTransactionRepository(db, logUtil)
-	transactionService := service.NewTransactionService(transactionRepository, appConfig)
-	reservationService := service.NewReservationService(appConfig, transactionService)
-	seatRepository := repository.NewSeatRepository(db, logUtil)
-	seatService := service.NewSeatService(appConfig, seatRepository, transactionRepository)
-	reservationController := controller.NewReservationController(appConfig, db, logUtil, reservationService, transactionService, seatService, userService, tokenUtil)
+	rateLimitUtil := util.NewRateLimitUtil(client)
 	snapUtil := util.NewSnapUtil(appConfig)
-	transactionController := controller.NewTransactionController(transactionService, userService, snapUtil, logUtil)
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(appConfig, rateLimitUtil, snapUtil, logger)
+	apiKeyRepository := repository.NewApiKeyRepository(db, logUtil)
+	auditEventRepository := repository.NewAuditEventRepository(db, logUtil)
+	auditService := service.NewAuditService(auditEventRepository, logUtil)
+	apiKeyService := service.NewApiKeyService(apiKeyRepository, auditService, logUtil)
+	apiKeyMiddleware := middleware.NewApiKeyMiddleware(apiKeyService, logger)
+	requestIdMiddleware := middleware.NewRequestIdMiddleware()
+	userController := controller.NewUserController(userService, tokenUtil, appConfig)
+	emailOutboxRepository := repository.NewEmailOutboxRepository(db, logUtil)
+	mailer, err := util.NewMailer(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	templateRegistry := util.NewTemplateRegistry(appConfig, logUtil)
+	emailUtil := util.NewEmailUtil(appConfig, logUtil, mailer, templateRegistry)
 	minioClient := app.NewMinio(appConfig, logger)
 	eTicketUtil := util.NewETicketUtil(appConfig, minioClient, logUtil)
-	snapService := service.NewSnapService(transactionService, seatService, transactionRepository, snapUtil, emailUtil, eTicketUtil, logUtil)
-	snapController := controller.NewSnapController(snapService, snapUtil, transactionService, logUtil)
-	configController := controller.NewConfigController(appConfig, logUtil)
+	emailService := service.NewEmailService(appConfig, emailOutboxRepository, emailUtil, eTicketUtil, auditService, logUtil)
+	otpUtil := util.NewOtpUtil(client, appConfig)
+	otpService := service.NewOtpService(appConfig, userService, emailService, otpUtil, logUtil)
+	authController := controller.NewAuthController(userService, otpService, tokenUtil, logUtil, appConfig)
+	transactionRepository := repository.NewTransactionRepository(db, logUtil)
+	seatRepository := repository.NewSeatRepository(db, logUtil)
+	purchaseLimitRepository := repository.NewPurchaseLimitRepository(db, logUtil)
+	priceCategoryRepository := repository.NewPriceCategoryRepository(db, logUtil)
+	ticketTypeRepository := repository.NewTicketTypeRepository(db, logUtil)
+	pricingRuleRepository := repository.NewPricingRuleRepository(db, logUtil)
+	pricingService := service.NewPricingService(pricingRuleRepository, priceCategoryRepository, seatRepository, auditService)
+	priceCategoryService := service.NewPriceCategoryService(db, priceCategoryRepository, seatRepository, ticketTypeRepository, transactionRepository, pricingService, auditService)
+	ticketTypeService := service.NewTicketTypeService(appConfig, db, ticketTypeRepository, priceCategoryRepository, transactionRepository, auditService)
+	reservationService := service.NewReservationService(appConfig, userRepository, transactionRepository, seatRepository, purchaseLimitRepository, priceCategoryService, ticketTypeService)
+	promoCodeRepository := repository.NewPromoCodeRepository(db, logUtil)
+	promoCodeService := service.NewPromoCodeService(appConfig, db, promoCodeRepository, auditService)
+	invoiceRepository := repository.NewInvoiceRepository(db, logUtil)
+	invoiceService := service.NewInvoiceService(appConfig, invoiceRepository)
+	orderRepository := repository.NewOrderRepository(db, logUtil)
+	orderService := service.NewOrderService(orderRepository)
+	transactionService := service.NewTransactionService(db, transactionRepository, userRepository, priceCategoryRepository, ticketTypeService, promoCodeService, pricingService, invoiceService, orderService, appConfig)
+	seatService := service.NewSeatService(appConfig, seatRepository, transactionRepository, auditService)
+	reservationController := controller.NewReservationController(appConfig, db, logUtil, reservationService, priceCategoryService, ticketTypeService, pricingService, transactionService, seatService, userService, tokenUtil)
+	snapService := service.NewSnapService(db, transactionService, seatService, ticketTypeService, promoCodeService, invoiceService, orderService, auditService, transactionRepository, userRepository, snapUtil, logUtil)
+	transactionController := controller.NewTransactionController(transactionService, userService, promoCodeService, invoiceService, orderService, snapService, snapUtil, logUtil)
+	snapController := controller.NewSnapController(snapService, snapUtil, transactionService, emailService, logUtil)
+	configService := service.NewConfigService(appConfig, auditService)
+	configController := controller.NewConfigController(appConfig, configService, logUtil)
 	seatController := controller.NewSeatController(seatService, transactionService, logUtil)
-	engine := app.NewRouter(appConfig, userMiddleware, adminMiddleware, gateMiddleware, scanQrMiddleware, userController, authController, reservationController, transactionController, snapController, configController, seatController)
-	return engine
+	emailController := controller.NewEmailController(emailService, logUtil)
+	broadcastRepository := repository.NewBroadcastRepository(db, logUtil)
+	broadcastService := service.NewBroadcastService(appConfig, db, broadcastRepository, transactionRepository, emailService, auditService, logUtil)
+	broadcastController := controller.NewBroadcastController(broadcastService, logUtil)
+	sessionService := service.NewSessionService(userService, auditService, tokenUtil, logUtil)
+	sessionController := controller.NewSessionController(sessionService, logUtil)
+	jwksController := controller.NewJwksController(keyUtil, appConfig)
+	staffService := service.NewStaffService(userRepository, userService, sessionService, auditService, appConfig, logUtil)
+	staffController := controller.NewStaffController(staffService, userService, tokenUtil, logUtil)
+	oidcUtil := util.NewOidcUtil(client, appConfig)
+	oidcService := service.NewOidcService(userRepository, userService, oidcUtil, logUtil)
+	oidcController := controller.NewOidcController(oidcService, userService, tokenUtil, logUtil)
+	apiKeyController := controller.NewApiKeyController(apiKeyService, logUtil)
+	integrationService := service.NewIntegrationService(appConfig, db, transactionRepository, seatRepository, promoCodeRepository, orderRepository, orderService, seatService, userService, emailService, auditService, logUtil)
+	integrationController := controller.NewIntegrationController(integrationService, logUtil)
+	auditController := controller.NewAuditController(auditService, logUtil)
+	purchaseLimitService := service.NewPurchaseLimitService(appConfig, purchaseLimitRepository, priceCategoryRepository, userService, auditService)
+	purchaseLimitController := controller.NewPurchaseLimitController(purchaseLimitService, logUtil)
+	venueRepository := repository.NewVenueRepository(db, logUtil)
+	venueService := service.NewVenueService(db, venueRepository, seatRepository, priceCategoryRepository, seatService, auditService)
+	venueController := controller.NewVenueController(venueService, logUtil)
+	priceCategoryController := controller.NewPriceCategoryController(priceCategoryService, logUtil)
+	ticketTypeController := controller.NewTicketTypeController(ticketTypeService, pricingService, logUtil)
+	promoCodeController := controller.NewPromoCodeController(promoCodeService, logUtil)
+	pricingRuleController := controller.NewPricingRuleController(pricingService, logUtil)
+	invoiceController := controller.NewInvoiceController(invoiceService, logUtil)
+	orderController := controller.NewOrderController(orderService, logUtil)
+	ticketTransferRepository := repository.NewTicketTransferRepository(db, logUtil)
+	ticketTransferService := service.NewTicketTransferService(appConfig, db, ticketTransferRepository, transactionRepository, seatRepository, transactionService, userService, emailService, auditService)
+	ticketTransferController := controller.NewTicketTransferController(ticketTransferService, userService, logUtil)
+	engine := app.NewRouter(appConfig, userMiddleware, adminMiddleware, gateMiddleware, scanQrMiddleware, rateLimitMiddleware, apiKeyMiddleware, requestIdMiddleware, userController, authController, reservationController, transactionController, snapController, configController, seatController, emailController, broadcastController, sessionController, jwksController, staffController, oidcController, apiKeyController, integrationController, auditController, purchaseLimitController, venueController, priceCategoryController, ticketTypeController, promoCodeController, pricingRuleController, invoiceController, orderController, ticketTransferController)
+	return engine, nil
 }
 
 func InitializeMigrator() *database.Migrator {
@@ -63,28 +126,76 @@ func InitializeMigrator() *database.Migrator {
 	return migrator
 }
 
-func InitializeEmail() *util.EmailUtil {
+func InitializeEmail() (*util.EmailUtil, error) {
+	appConfig := config.NewAppConfig()
+	logger := app.NewLogger(appConfig)
+	logUtil := util.NewLogUtil(logger)
+	mailer, err := util.NewMailer(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	templateRegistry := util.NewTemplateRegistry(appConfig, logUtil)
+	emailUtil := util.NewEmailUtil(appConfig, logUtil, mailer, templateRegistry)
+	return emailUtil, nil
+}
+
+func InitializeWorker() (*worker.Worker, error) {
 	appConfig := config.NewAppConfig()
 	logger := app.NewLogger(appConfig)
+	db := app.NewDatabase(appConfig, logger)
 	logUtil := util.NewLogUtil(logger)
-	emailUtil := util.NewEmailUtil(appConfig, logUtil)
-	return emailUtil
+	emailOutboxRepository := repository.NewEmailOutboxRepository(db, logUtil)
+	mailer, err := util.NewMailer(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	templateRegistry := util.NewTemplateRegistry(appConfig, logUtil)
+	emailUtil := util.NewEmailUtil(appConfig, logUtil, mailer, templateRegistry)
+	client := app.NewMinio(appConfig, logger)
+	eTicketUtil := util.NewETicketUtil(appConfig, client, logUtil)
+	auditEventRepository := repository.NewAuditEventRepository(db, logUtil)
+	auditService := service.NewAuditService(auditEventRepository, logUtil)
+	emailService := service.NewEmailService(appConfig, emailOutboxRepository, emailUtil, eTicketUtil, auditService, logUtil)
+	emailWorker := worker.NewEmailWorker(appConfig, emailService, logUtil)
+	transactionRepository := repository.NewTransactionRepository(db, logUtil)
+	seatRepository := repository.NewSeatRepository(db, logUtil)
+	seatService := service.NewSeatService(appConfig, seatRepository, transactionRepository, auditService)
+	ticketTypeRepository := repository.NewTicketTypeRepository(db, logUtil)
+	priceCategoryRepository := repository.NewPriceCategoryRepository(db, logUtil)
+	ticketTypeService := service.NewTicketTypeService(appConfig, db, ticketTypeRepository, priceCategoryRepository, transactionRepository, auditService)
+	orderRepository := repository.NewOrderRepository(db, logUtil)
+	orderService := service.NewOrderService(orderRepository)
+	reminderService := service.NewReminderService(appConfig, transactionRepository, seatService, ticketTypeService, orderService, emailService, auditService, logUtil)
+	reminderWorker := worker.NewReminderWorker(appConfig, reminderService, logUtil)
+	broadcastRepository := repository.NewBroadcastRepository(db, logUtil)
+	broadcastService := service.NewBroadcastService(appConfig, db, broadcastRepository, transactionRepository, emailService, auditService, logUtil)
+	broadcastWorker := worker.NewBroadcastWorker(appConfig, broadcastService, logUtil)
+	workerWorker := worker.NewWorker(emailWorker, reminderWorker, broadcastWorker)
+	return workerWorker, nil
 }
 
 // injector.go:
 
-var MiddlewareSet = wire.NewSet(middleware.NewUserMiddleware, middleware.NewAdminMiddleware, middleware.NewGateMiddleware, middleware.NewScanQrMiddleware)
+var MiddlewareSet = wire.NewSet(middleware.NewUserMiddleware, middleware.NewAdminMiddleware, middleware.NewGateMiddleware, middleware.NewScanQrMiddleware, middleware.NewRateLimitMiddleware, middleware.NewApiKeyMiddleware, middleware.NewRequestIdMiddleware)
 
-var UserSet = wire.NewSet(repository.NewUserRepository, service.NewUserService, controller.NewAuthController, controller.NewUserController)
+var UserSet = wire.NewSet(repository.NewUserRepository, service.NewUserService, service.NewOtpService, service.NewSessionService, service.NewStaffService, service.NewOidcService, controller.NewSessionController, controller.NewStaffController, controller.NewOidcController, controller.NewJwksController, controller.NewAuthController, controller.NewUserController)
 
-var ReservationSet = wire.NewSet(service.NewReservationService, controller.NewReservationController)
+var ReservationSet = wire.NewSet(repository.NewPurchaseLimitRepository, service.NewReservationService, service.NewPurchaseLimitService, controller.NewPurchaseLimitController, controller.NewReservationController)
 
-var SeatSet = wire.NewSet(controller.NewSeatController, repository.NewSeatRepository, service.NewSeatService)
+var SeatSet = wire.NewSet(controller.NewSeatController, repository.NewSeatRepository, service.NewSeatService, repository.NewVenueRepository, service.NewVenueService, controller.NewVenueController, repository.NewPriceCategoryRepository, service.NewPriceCategoryService, controller.NewPriceCategoryController, repository.NewTicketTypeRepository, service.NewTicketTypeService, controller.NewTicketTypeController, repository.NewPromoCodeRepository, service.NewPromoCodeService, controller.NewPromoCodeController, repository.NewPricingRuleRepository, service.NewPricingService, controller.NewPricingRuleController, repository.NewInvoiceRepository, service.NewInvoiceService, controller.NewInvoiceController, repository.NewOrderRepository, service.NewOrderService, controller.NewOrderController, repository.NewTicketTransferRepository, service.NewTicketTransferService, controller.NewTicketTransferController)
 
 var TransactionSet = wire.NewSet(controller.NewTransactionController, repository.NewTransactionRepository, service.NewTransactionService)
 
 var SnapSet = wire.NewSet(controller.NewSnapController, service.NewSnapService)
 
-var GateSet = wire.NewSet(controller.NewConfigController)
+var EmailSet = wire.NewSet(repository.NewEmailOutboxRepository, service.NewEmailService, controller.NewEmailController)
+
+var BroadcastSet = wire.NewSet(repository.NewBroadcastRepository, service.NewBroadcastService, controller.NewBroadcastController)
+
+var IntegrationSet = wire.NewSet(repository.NewApiKeyRepository, service.NewApiKeyService, service.NewIntegrationService, controller.NewApiKeyController, controller.NewIntegrationController)
+
+var AuditSet = wire.NewSet(repository.NewAuditEventRepository, service.NewAuditService, controller.NewAuditController)
+
+var GateSet = wire.NewSet(service.NewConfigService, controller.NewConfigController)
 
-var UtilSet = wire.NewSet(util.NewTokenUtil, util.NewSnapUtil, util.NewEmailUtil, util.NewETicketUtil, util.NewLogUtil)
+var UtilSet = wire.NewSet(util.NewTokenUtil, util.NewKeyUtil, util.NewOtpUtil, util.NewOidcUtil, util.NewRateLimitUtil, util.NewSnapUtil, util.NewMailer, util.NewTemplateRegistry, util.NewEmailUtil, util.NewETicketUtil, util.NewLogUtil)
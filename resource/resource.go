@@ -0,0 +1,13 @@
+package resource
+
+import "embed"
+
+// Templates hold the email templates so the binary does not depend on the working directory
+//
+//go:embed template
+var Templates embed.FS
+
+// Venues hold the default venue layout seeded by the migrator
+//
+//go:embed venue
+var Venues embed.FS